@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/cf-lager"
+	"github.com/cloudfoundry-incubator/guardian/cni"
+	"github.com/cloudfoundry/gunk/command_runner/linux_command_runner"
+	"github.com/opencontainers/specs/specs-go"
+	"github.com/pivotal-golang/lager"
+)
+
+func main() {
+	cf_lager.AddFlags(flag.CommandLine)
+	logger, _ := cf_lager.New("cni-hook")
+
+	// the daemon runs del itself when the container never stopped, by which
+	// point the container's log file is gone, so it does not give one
+	if logFile := os.Getenv("GARDEN_LOG_FILE"); logFile != "" {
+		logFileHandle, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			panic(err)
+		}
+
+		logger.RegisterSink(lager.NewWriterSink(logFileHandle, lager.DEBUG))
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Fatal("panicked", fmt.Errorf("%#v", err))
+		}
+	}()
+
+	state := specs.State{}
+	if err := json.NewDecoder(os.Stdin).Decode(&state); err != nil {
+		panic(err)
+	}
+
+	action := flag.String("action", "", "the CNI command to run, one of 'add' or 'del'")
+	handle := flag.String("handle", "", "the handle of the container, passed to the plugins as its ID")
+	configDir := flag.String("config-dir", "", "the directory containing the CNI network configuration")
+	pluginDir := flag.String("plugin-dir", "", "the directories containing the CNI plugins, separated by colons")
+	resultFile := flag.String("result-file", "", "the file to write the result of add to")
+	netnsFile := flag.String("netns-file", "", "the file to pin the container's network namespace to on add, so that del can find it once the container's processes have exited")
+	ifName := flag.String("ifname", "eth0", "the name of the container's interface")
+	flag.Parse()
+
+	logger = logger.Session("hook", lager.Data{
+		"action": *action,
+		"handle": *handle,
+		"pid":    state.Pid,
+	})
+
+	logger.Info("start")
+	defer logger.Info("finished")
+
+	list, err := cni.LoadConfList(*configDir)
+	if err != nil {
+		panic(err)
+	}
+
+	invoker := &cni.Invoker{
+		Runner:     linux_command_runner.New(),
+		PluginDirs: filepath.SplitList(*pluginDir),
+	}
+
+	switch *action {
+	case "add":
+		netns := netnsPath(state)
+		if *netnsFile != "" {
+			if err := pinNetns(netns, *netnsFile); err != nil {
+				panic(err)
+			}
+
+			netns = *netnsFile
+		}
+
+		result, err := invoker.Add(logger, *handle, netns, *ifName, list)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := ioutil.WriteFile(*resultFile, result, 0600); err != nil {
+			panic(err)
+		}
+	case "del":
+		netns := netnsPath(state)
+		pinned := false
+		if _, err := os.Stat(*netnsFile); *netnsFile != "" && err == nil {
+			netns = *netnsFile
+			pinned = true
+		}
+
+		// without a network namespace there is nothing the plugins could have
+		// added, e.g. because add never ran
+		if netns == "" {
+			logger.Info("no-network-namespace")
+			return
+		}
+
+		if err := invoker.Del(logger, *handle, netns, *ifName, list); err != nil {
+			panic(err)
+		}
+
+		if pinned {
+			if err := unpinNetns(*netnsFile); err != nil {
+				panic(err)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unknown action '%s'", *action))
+	}
+}
+
+// pinNetns bind mounts the network namespace at netns to path, so that it
+// outlives the container's processes
+func pinNetns(netns, path string) error {
+	if netns == "" {
+		return fmt.Errorf("the container has no network namespace to pin")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0400)
+	if err != nil {
+		return fmt.Errorf("creating network namespace file: %s", err)
+	}
+	file.Close()
+
+	if err := syscall.Mount(netns, path, "none", syscall.MS_BIND, ""); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("pinning network namespace: %s", err)
+	}
+
+	return nil
+}
+
+// unpinNetns releases a network namespace pinned by pinNetns
+func unpinNetns(path string) error {
+	if err := syscall.Unmount(path, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unpinning network namespace: %s", err)
+	}
+
+	return os.Remove(path)
+}
+
+// netnsPath is the path of the container's network namespace, or empty when
+// the container's init process has exited, as it will have by the poststop
+// hook
+func netnsPath(state specs.State) string {
+	if state.Pid == 0 {
+		return ""
+	}
+
+	path := fmt.Sprintf("/proc/%d/ns/net", state.Pid)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
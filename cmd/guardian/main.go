@@ -24,10 +24,14 @@ import (
 	"github.com/cloudfoundry-incubator/garden-shed/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden/server"
 	"github.com/cloudfoundry-incubator/goci"
+	"github.com/cloudfoundry-incubator/guardian/cni"
 	"github.com/cloudfoundry-incubator/guardian/gardener"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/devices"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/factory"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/ports"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
 	"github.com/cloudfoundry-incubator/guardian/logging"
@@ -134,12 +138,42 @@ var networkPlugin = flag.String(
 	"path to optional network plugin binary",
 )
 
+var networkPluginCapacity = flag.Uint64(
+	"networkPluginCapacity",
+	256,
+	"number of containers the network plugin's network can host",
+)
+
 var networkPluginExtraArgs = flag.String(
 	"networkPluginExtraArgs",
 	"",
 	"comma seperated extra args for the network plugin binary",
 )
 
+var cniConfigDir = flag.String(
+	"cniConfigDir",
+	"",
+	"directory containing the CNI network configuration to network containers with, instead of kawasaki",
+)
+
+var cniPluginDir = flag.String(
+	"cniPluginDir",
+	"/opt/cni/bin",
+	"directories containing the CNI plugin binaries, separated by colons",
+)
+
+var cniCapacity = flag.Uint64(
+	"cniCapacity",
+	256,
+	"number of containers the CNI network can host",
+)
+
+var cniHookBin = flag.String(
+	"cniHookBin",
+	"",
+	"path to the cni-hook binary which invokes the CNI plugins",
+)
+
 var depotPath = flag.String(
 	"depot",
 	"",
@@ -176,9 +210,53 @@ var portPoolSize = flag.Uint(
 	"size of port pool used for mapped container ports",
 )
 
-var networkPool = flag.String("networkPool",
-	"10.254.0.0/22",
-	"Pool of dynamically allocated container subnets")
+var stateDir = flag.String(
+	"stateDir",
+	"",
+	"directory in which to persist the daemon's own state across restarts, kept apart from the containers in the depot (default: a 'state' directory alongside the depot)",
+)
+
+var portPoolStateFilePath = flag.String(
+	"portPoolStateFilePath",
+	"",
+	"path of the file in which to persist the port pool state across restarts (default: <stateDir>/port_pool.json)",
+)
+
+var namedNetworksStateFilePath = flag.String(
+	"namedNetworksStateFilePath",
+	"",
+	"path of the file in which to persist the named networks' state across restarts (default: <stateDir>/named_networks.json)",
+)
+
+var embeddedDNS = flag.Bool(
+	"embeddedDNS",
+	false,
+	"serve DNS on each bridge IP so that containers can resolve the handles and 'dns.names' of the other containers on their subnet, forwarding other queries to -dnsServer or the host's resolvers. Queries to the bridge IP are accepted even when host access is denied",
+)
+
+var networkPoolStrategy = flag.String(
+	"networkPoolStrategy",
+	subnets.FirstFreeStrategyName,
+	"how dynamic subnets and IPs are picked: 'first-free' takes the lowest free one, 'round-robin' the next free one after the last taken, so that released ones are reused last, and 'hash' starts from one picked by hashing the container's handle",
+)
+
+var networkPoolCooldown = flag.Duration(
+	"networkPoolCooldown",
+	0,
+	"how long a released subnet or IP is kept out of dynamic allocation",
+)
+
+var networkPoolReserved = flag.String(
+	"networkPoolReserved",
+	"",
+	"CIDR blocks which are never allocated dynamically, though they may still be requested statically",
+)
+
+var networkPoolIPv6 = flag.String(
+	"networkPoolIPv6",
+	"",
+	"IPv6 network (prefix length at most /96) to give containers an IPv6 address from, in addition to their IPv4 address (default: IPv4 only). Policy groups and -networkPolicy are not supported with it",
+)
 
 var denyNetworks = flag.String(
 	"denyNetworks",
@@ -234,6 +312,24 @@ var allowHostAccess = flag.Bool(
 	"allow network access to host",
 )
 
+var allowHostAccessOverride = flag.Bool(
+	"allowHostAccessOverride",
+	false,
+	"allow containers to be granted network access to the host by setting their 'network.host-access' property to 'true'. Without it the property may only deny access",
+)
+
+var firewallBackend = flag.String(
+	"firewallBackend",
+	"iptables",
+	"firewall to configure container networking with, one of 'iptables' or 'nftables' (default: iptables)",
+)
+
+var firewallReconcileInterval = flag.Duration(
+	"firewallReconcileInterval",
+	time.Minute,
+	"interval at which to check the firewall for missing or stale container rules, 0 to disable",
+)
+
 var iptablesLogMethod = flag.String(
 	"iptablesLogMethod",
 	"kernel",
@@ -296,6 +392,13 @@ func main() {
 		"Image which should never be garbage collected. (Can be specified multiple times)",
 	)
 
+	var networkPools []*net.IPNet
+	flag.Var(
+		vars.CIDRList{List: &networkPools},
+		"networkPool",
+		"Pool of dynamically allocated container subnets. (Can be specified multiple times, in which case the pools are allocated from in order) (default: 10.254.0.0/22)",
+	)
+
 	var dnsServers []net.IP
 	flag.Var(
 		vars.IPList{List: &dnsServers},
@@ -303,6 +406,13 @@ func main() {
 		"DNS server IP address to use instead of automatically determined servers. (Can be specified multiple times)",
 	)
 
+	networkPolicies := kawasaki.NetworkPolicies{}
+	flag.Var(
+		networkPolicies,
+		"networkPolicy",
+		"Allow the members of one container policy group (see the 'network.policy-group' property) to connect to those of another on their subnet, as <from-group>:<to-group>. (Can be specified multiple times)",
+	)
+
 	cf_debug_server.AddFlags(flag.CommandLine)
 	cf_lager.AddFlags(flag.CommandLine)
 	flag.Parse()
@@ -334,16 +444,74 @@ func main() {
 		panic(err)
 	}
 
-	_, networkPoolCIDR, err := net.ParseCIDR(*networkPool)
+	if len(networkPools) == 0 {
+		_, defaultNetworkPool, _ := net.ParseCIDR("10.254.0.0/22")
+		networkPools = append(networkPools, defaultNetworkPool)
+	}
+
+	if err := subnets.ValidateDynamicRanges(networkPools); err != nil {
+		panic(err)
+	}
+
+	allocationStrategy, err := subnets.NewAllocationStrategy(*networkPoolStrategy)
 	if err != nil {
 		panic(err)
 	}
 
+	var networkPoolReservedCIDRs []*net.IPNet
+	if *networkPoolReserved != "" {
+		for _, reserved := range strings.Split(*networkPoolReserved, ",") {
+			_, reservedCIDR, err := net.ParseCIDR(strings.TrimSpace(reserved))
+			if err != nil {
+				panic(fmt.Errorf("invalid -networkPoolReserved: %s", err))
+			}
+
+			networkPoolReservedCIDRs = append(networkPoolReservedCIDRs, reservedCIDR)
+		}
+	}
+
+	var networkPoolIPv6CIDR *net.IPNet
+	if *networkPoolIPv6 != "" {
+		if _, networkPoolIPv6CIDR, err = net.ParseCIDR(*networkPoolIPv6); err != nil {
+			panic(err)
+		}
+
+		if err := subnets.ValidateIPv6Pool(networkPoolIPv6CIDR); err != nil {
+			panic(err)
+		}
+	}
+
+	var allowNetworksList []string
+	if *allowNetworks != "" {
+		allowNetworksList = strings.Split(*allowNetworks, ",")
+	}
+
 	var denyNetworksList []string
 	if *denyNetworks != "" {
 		denyNetworksList = strings.Split(*denyNetworks, ",")
 	}
 
+	if *iptablesLogMethod != iptables.LogMethodKernel && *iptablesLogMethod != iptables.LogMethodNFLog {
+		panic(fmt.Errorf("Value of -iptablesLogMethod %s must be one of 'kernel' or 'nflog'", *iptablesLogMethod))
+	}
+
+	if *firewallBackend != kawasaki.FirewallBackendIPTables && *firewallBackend != kawasaki.FirewallBackendNFTables {
+		panic(fmt.Errorf("Value of -firewallBackend %s must be one of 'iptables' or 'nftables'", *firewallBackend))
+	}
+
+	if networkPoolIPv6CIDR != nil && *firewallBackend != kawasaki.FirewallBackendIPTables {
+		panic(fmt.Errorf("-networkPoolIPv6 is only supported with the 'iptables' firewall backend"))
+	}
+
+	if len(networkPolicies) > 0 && *firewallBackend != kawasaki.FirewallBackendIPTables {
+		panic(fmt.Errorf("-networkPolicy is only supported with the 'iptables' firewall backend"))
+	}
+
+	// the policy groups' sets only hold IPv4 addresses
+	if len(networkPolicies) > 0 && networkPoolIPv6CIDR != nil {
+		panic(fmt.Errorf("-networkPolicy is not supported with -networkPoolIPv6"))
+	}
+
 	externalIPAddr, err := parseExternalIP(*externalIP)
 	if err != nil {
 		panic(err)
@@ -351,22 +519,58 @@ func main() {
 
 	interfacePrefix := fmt.Sprintf("w%s", *tag)
 	chainPrefix := fmt.Sprintf("w-%s-", *tag)
-	ipt := wireIptables(logger, chainPrefix)
+	firewall := wireFirewall(logger, *firewallBackend, chainPrefix, *iptablesLogMethod, *allowHostAccess, *embeddedDNS, interfacePrefix, allowNetworksList, denyNetworksList, networkPolicies, networkPoolIPv6CIDR)
 
 	propManager := properties.NewManager()
 
-	var networker gardener.Networker = netplugin.New(*networkPlugin, strings.Split(*networkPluginExtraArgs, ",")...)
-	if *networkPlugin == "" {
-		networker = wireNetworker(logger, *kawasakiBin, *tag, networkPoolCIDR, externalIPAddr, dnsServers, ipt, interfacePrefix, chainPrefix, propManager)
+	// the state must outlive reboots and tmp cleaners as the containers in
+	// the depot do, so it is kept next to them by default
+	if *stateDir == "" {
+		*stateDir = filepath.Join(filepath.Dir(filepath.Clean(*depotPath)), "state")
+	}
+
+	if err := os.MkdirAll(*stateDir, 0700); err != nil {
+		logger.Fatal("failed-to-create-state-dir", err)
+	}
+
+	if *portPoolStateFilePath == "" {
+		*portPoolStateFilePath = filepath.Join(*stateDir, "port_pool.json")
+	}
+
+	portPool := wirePortPool(logger, *portPoolStateFilePath)
+
+	if *namedNetworksStateFilePath == "" {
+		*namedNetworksStateFilePath = filepath.Join(*stateDir, "named_networks.json")
+	}
+
+	containerizer := wireContainerizer(logger, *depotPath, *iodaemonBin, *nstarBin, *tarBin, resolvedRootFSPath, propManager)
+
+	var dnsResponder kawasaki.DNSResponder
+	if *embeddedDNS {
+		dnsResponder = wireDNSResponder(logger, containerizer, propManager, dnsServers)
+	}
+
+	if *networkPlugin != "" && *cniConfigDir != "" {
+		panic(fmt.Errorf("-networkPlugin and -cniConfigDir cannot both be set"))
+	}
+
+	var networker gardener.Networker
+	if *networkPlugin != "" {
+		networker = wireNetworkPlugin(logger, propManager)
+	} else if *cniConfigDir != "" {
+		networker = wireCNINetworker(logger, externalIPAddr, propManager)
+	} else {
+		subnetPool := subnets.NewPool(networkPools, allocationStrategy, networkPoolReservedCIDRs, *networkPoolCooldown, clock.NewClock())
+		networker = wireNetworker(logger, *kawasakiBin, *tag, subnetPool, networkPoolIPv6CIDR, externalIPAddr, dnsServers, firewall, interfacePrefix, chainPrefix, *firewallBackend, *iptablesLogMethod, propManager, portPool, *namedNetworksStateFilePath, dnsResponder, filepath.Join(*stateDir, "network-sharers"), *allowHostAccessOverride)
 	}
 
 	backend := &gardener.Gardener{
 		UidGenerator:    wireUidGenerator(),
-		Starter:         wireStarter(logger, ipt, *allowHostAccess, interfacePrefix, denyNetworksList),
+		Starter:         wireStarter(logger, firewall),
 		SysInfoProvider: sysinfo.NewProvider(*depotPath),
 		Networker:       networker,
 		VolumeCreator:   wireVolumeCreator(logger, *graphRoot, insecureRegistries, persistentImages),
-		Containerizer:   wireContainerizer(logger, *depotPath, *iodaemonBin, *nstarBin, *tarBin, resolvedRootFSPath, propManager),
+		Containerizer:   containerizer,
 		PropertyManager: propManager,
 
 		Logger: logger,
@@ -390,11 +594,20 @@ func main() {
 		logger.Fatal("failed-to-start-server", err)
 	}
 
+	if *networkPlugin == "" && *cniConfigDir == "" && *firewallReconcileInterval > 0 {
+		kawasaki.NewReconciler(logger, containerizer, propManager, firewall, *firewallReconcileInterval, clock.NewClock()).Start()
+	}
+
 	signals := make(chan os.Signal, 1)
 
 	go func() {
 		<-signals
 		gardenServer.Stop()
+
+		if err := portPool.Save(); err != nil {
+			logger.Error("failed-to-save-port-pool-state", err)
+		}
+
 		os.Exit(0)
 	}()
 
@@ -412,51 +625,157 @@ func wireUidGenerator() gardener.UidGeneratorFunc {
 	return gardener.UidGeneratorFunc(func() string { return mustStringify(uuid.NewV4()) })
 }
 
-func wireStarter(logger lager.Logger, ipt *iptables.IPTables, allowHostAccess bool, nicPrefix string, denyNetworks []string) gardener.Starter {
+func wireStarter(logger lager.Logger, firewall kawasaki.Firewall) gardener.Starter {
 	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: logger.Session("runner")}
 
 	return &StartAll{starters: []gardener.Starter{
 		rundmc.NewStarter(logger, mustOpen("/proc/cgroups"), mustOpen("/proc/self/cgroup"), path.Join(os.TempDir(), fmt.Sprintf("cgroups-%s", *tag)), runner),
-		iptables.NewStarter(ipt, allowHostAccess, nicPrefix, denyNetworks),
+		firewall,
 	}}
 }
 
-func wireIptables(logger lager.Logger, prefix string) *iptables.IPTables {
-	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: logger.Session("iptables-runner")}
-	return iptables.New(runner, prefix)
+func wireFirewall(logger lager.Logger, backend, prefix, logMethod string, allowHostAccess, embeddedDNS bool, nicPrefix string, allowNetworks, denyNetworks []string, policies kawasaki.NetworkPolicies, ipv6Pool *net.IPNet) kawasaki.Firewall {
+	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: logger.Session(backend + "-runner")}
+
+	if backend == kawasaki.FirewallBackendNFTables {
+		return nftables.NewFirewall(nftables.New(runner, prefix), logMethod, allowHostAccess, embeddedDNS, nicPrefix, allowNetworks, denyNetworks, devices.Link{}.DefaultInterface)
+	}
+
+	if ipv6Pool == nil {
+		return iptables.NewFirewall(iptables.New(runner, prefix), logMethod, allowHostAccess, embeddedDNS, nicPrefix, allowNetworks, denyNetworks, policies, devices.Link{}.DefaultInterface)
+	}
+
+	ipv4AllowNetworks, ipv6AllowNetworks := splitNetworksByFamily(allowNetworks)
+	ipv4DenyNetworks, ipv6DenyNetworks := splitNetworksByFamily(denyNetworks)
+
+	return kawasaki.DualStackFirewall{
+		IPv4:     iptables.NewFirewall(iptables.New(runner, prefix), logMethod, allowHostAccess, embeddedDNS, nicPrefix, ipv4AllowNetworks, ipv4DenyNetworks, policies, devices.Link{}.DefaultInterface),
+		IPv6:     iptables.NewFirewall(iptables.NewIPv6(runner, prefix), logMethod, allowHostAccess, false, nicPrefix, ipv6AllowNetworks, ipv6DenyNetworks, policies, devices.Link{}.DefaultInterface),
+		IPv6Pool: ipv6Pool,
+	}
+}
+
+func splitNetworksByFamily(networks []string) (ipv4, ipv6 []string) {
+	for _, network := range networks {
+		if strings.Contains(network, ":") {
+			ipv6 = append(ipv6, network)
+		} else {
+			ipv4 = append(ipv4, network)
+		}
+	}
+
+	return ipv4, ipv6
 }
 
 func wireNetworker(
 	log lager.Logger,
 	kawasakiBin string,
 	tag string,
-	networkPoolCIDR *net.IPNet,
+	subnetPool subnets.Pool,
+	networkPoolIPv6CIDR *net.IPNet,
 	externalIP net.IP,
 	dnsServers []net.IP,
-	ipt *iptables.IPTables,
+	firewall kawasaki.Firewall,
 	interfacePrefix string,
 	chainPrefix string,
+	firewallBackend string,
+	iptablesLogMethod string,
 	propManager *properties.Manager,
+	portPool *ports.PersistentPool,
+	namedNetworksStateFilePath string,
+	dnsResponder kawasaki.DNSResponder,
+	networkSharersDir string,
+	allowHostAccessOverride bool,
 ) gardener.Networker {
 	idGenerator := kawasaki.NewSequentialIDGenerator(time.Now().UnixNano())
-	portPool, err := ports.NewPool(uint32(*portPoolStart), uint32(*portPoolSize), ports.State{})
+
+	namedNetworks, err := kawasaki.NewNamedNetworks(namedNetworksStateFilePath)
 	if err != nil {
-		log.Fatal("invalid pool range", err)
+		log.Fatal("invalid-named-networks-state", err)
+	}
+
+	if err := namedNetworks.Recover(log, subnetPool); err != nil {
+		log.Fatal("failed-to-recover-named-networks", err)
+	}
+
+	if dnsResponder != nil {
+		if err := namedNetworks.RestoreDNS(log, dnsResponder); err != nil {
+			log.Fatal("failed-to-restore-dns-responder", err)
+		}
 	}
 
 	return kawasaki.New(
 		kawasakiBin,
 		kawasaki.SpecParserFunc(kawasaki.ParseSpec),
-		subnets.NewPool(networkPoolCIDR),
-		kawasaki.NewConfigCreator(idGenerator, interfacePrefix, chainPrefix, externalIP, dnsServers),
-		factory.NewDefaultConfigurer(ipt),
+		subnetPool,
+		kawasaki.NewConfigCreator(idGenerator, interfacePrefix, chainPrefix, firewallBackend, iptablesLogMethod, externalIP, networkPoolIPv6CIDR, dnsServers),
+		factory.NewDefaultConfigurer(firewall, firewall),
 		propManager,
 		portPool,
-		iptables.NewPortForwarder(ipt),
-		iptables.NewFirewallOpener(ipt),
+		firewall,
+		firewall,
+		namedNetworks,
+		dnsResponder,
+		kawasaki.NewNetworkSharers(networkSharersDir),
+		allowHostAccessOverride,
 	)
 }
 
+func wireNetworkPlugin(log lager.Logger, propManager *properties.Manager) gardener.Networker {
+	resultsDir := path.Join(os.TempDir(), fmt.Sprintf("garden-%s", *tag), "netplugin-results")
+	if err := os.MkdirAll(resultsDir, 0700); err != nil {
+		log.Fatal("failed-to-create-netplugin-results-dir", err)
+	}
+
+	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: log.Session("netplugin-runner")}
+	return netplugin.New(runner, propManager, resultsDir, *networkPluginCapacity, *networkPlugin, strings.Split(*networkPluginExtraArgs, ",")...)
+}
+
+func wireCNINetworker(log lager.Logger, externalIP net.IP, propManager *properties.Manager) gardener.Networker {
+	resultsDir := path.Join(os.TempDir(), fmt.Sprintf("garden-%s", *tag), "cni-results")
+	if err := os.MkdirAll(resultsDir, 0700); err != nil {
+		log.Fatal("failed-to-create-cni-results-dir", err)
+	}
+
+	netnsDir := path.Join(os.TempDir(), fmt.Sprintf("garden-%s", *tag), "cni-netns")
+	if err := os.MkdirAll(netnsDir, 0700); err != nil {
+		log.Fatal("failed-to-create-cni-netns-dir", err)
+	}
+
+	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: log.Session("cni-runner")}
+	return cni.NewNetworker(runner, *cniHookBin, *cniConfigDir, filepath.SplitList(*cniPluginDir), resultsDir, netnsDir, *cniCapacity, externalIP, propManager)
+}
+
+func wireDNSResponder(log lager.Logger, containerizer *rundmc.Containerizer, propManager *properties.Manager, dnsServers []net.IP) *dns.Responder {
+	var upstreams []string
+	for _, server := range dnsServers {
+		upstreams = append(upstreams, net.JoinHostPort(server.String(), "53"))
+	}
+
+	if len(upstreams) == 0 {
+		var err error
+		if upstreams, err = dns.HostNameservers("/etc/resolv.conf"); err != nil {
+			log.Fatal("failed-to-read-host-nameservers", err)
+		}
+	}
+
+	return dns.NewResponder(log, &dns.ContainerResolver{Containers: containerizer, Properties: propManager}, upstreams)
+}
+
+func wirePortPool(log lager.Logger, stateFilePath string) *ports.PersistentPool {
+	state, err := ports.LoadState(stateFilePath)
+	if err != nil {
+		log.Info("no-port-pool-state", lager.Data{"path": stateFilePath, "reason": err.Error()})
+	}
+
+	portPool, err := ports.NewPool(uint32(*portPoolStart), uint32(*portPoolSize), state)
+	if err != nil {
+		log.Fatal("invalid pool range", err)
+	}
+
+	return ports.NewPersistentPool(portPool, stateFilePath)
+}
+
 func wireVolumeCreator(logger lager.Logger, graphRoot string, insecureRegistries, persistentImages vars.StringList) *rootfs_provider.CakeOrdinator {
 	logger = logger.Session("volume-creator", lager.Data{"graphRoot": graphRoot})
 	runner := &logging.Runner{CommandRunner: linux_command_runner.New(), Logger: logger}
@@ -648,6 +967,7 @@ func wireContainerizer(log lager.Logger, depotPath, iodaemonPath, nstarPath, tar
 			},
 			bundlerules.Limits{},
 			bundlerules.Hooks{LogFilePattern: filepath.Join(depotPath, "%s", "network.log")},
+			bundlerules.NetworkMode{},
 			bundlerules.BindMounts{},
 			bundlerules.Env{},
 			bundlerules.PrivilegedCaps{},
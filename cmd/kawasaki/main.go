@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 
 	"github.com/cloudfoundry-incubator/cf-debug-server"
 	"github.com/cloudfoundry-incubator/cf-lager"
@@ -14,6 +15,7 @@ import (
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/factory"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
 	"github.com/cloudfoundry-incubator/guardian/pkg/vars"
 	"github.com/cloudfoundry/gunk/command_runner/linux_command_runner"
 	"github.com/docker/docker/pkg/reexec"
@@ -32,7 +34,9 @@ func main() {
 	logger, _ := cf_lager.New("kawasaki")
 
 	logFile := os.Getenv("GARDEN_LOG_FILE")
-	logFileHandle, err := os.Create(logFile)
+	// the poststop hook logs to the same file as the prestart hook, so append
+	// rather than truncate it
+	logFileHandle, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		panic(err)
 	}
@@ -58,19 +62,70 @@ func main() {
 	flag.StringVar(&config.BridgeName, "bridge-interface", "", "the bridge interface to create or use")
 	flag.StringVar(&config.IPTablePrefix, "iptable-prefix", "", "the iptable chain prefix")
 	flag.StringVar(&config.IPTableInstance, "iptable-instance", "", "the iptable instance to add rules to")
+	flag.StringVar(&config.IPTableLogMethod, "iptable-log-method", iptables.LogMethodKernel, "how to log packets matching logged NetOut rules, one of 'kernel' or 'nflog'")
+	flag.StringVar(&config.FirewallBackend, "firewall-backend", kawasaki.FirewallBackendIPTables, "the firewall backend to add rules with, one of 'iptables' or 'nftables'")
+	flag.StringVar(&config.PolicyGroup, "policy-group", "", "the policy group the container belongs to, if any")
+	hostAccess := flag.String("host-access", "", "whether the container may reach the host, overriding the daemon's setting, if 'true' or 'false'")
+	var denyNetworks vars.StringList
+	flag.Var(&denyNetworks, "deny-network", "an IP or CIDR block the container may not reach, in addition to the daemon's")
 	flag.IntVar(&config.Mtu, "mtu", 1500, "the mtu")
 	flag.Var(&IPValue{&config.BridgeIP}, "bridge-ip", "the IP address of the bridge interface")
 	flag.Var(&IPValue{&config.ExternalIP}, "external-ip", "the IP address of the host interface")
 	flag.Var(&IPValue{&config.ContainerIP}, "container-ip", "the IP address of the container interface")
 	flag.Var(&vars.IPList{List: &config.DNSServers}, "dns-server", "the IP address(s) of DNS servers to unconditionally use")
+	flag.Var(&IPValue{&config.BridgeIPv6}, "bridge-ipv6", "the IPv6 address of the bridge interface")
+	flag.Var(&IPValue{&config.ContainerIPv6}, "container-ipv6", "the IPv6 address of the container interface")
 	subnet := flag.String("subnet", "", "subnet of the bridge")
+	ipv6Pool := flag.String("ipv6-pool", "", "the IPv6 pool container addresses are derived from, if any")
+	subnetIPv6 := flag.String("subnet-ipv6", "", "IPv6 subnet of the bridge")
+	embeddedDNS := flag.Bool("embedded-dns", false, "use the DNS responder listening on the bridge IP")
+	var extraHosts, dnsSearch, dnsOptions vars.StringList
+	flag.Var(&extraHosts, "extra-host", "an additional hosts file entry for the container, as hostname:ip")
+	flag.Var(&dnsSearch, "dns-search", "a DNS search domain for the container")
+	flag.Var(&dnsOptions, "dns-option", "a resolv.conf option for the container")
+	var attachments []kawasaki.NetworkConfig
+	flag.Var(&ConfigList{&attachments}, "attachment", "the JSON encoded configuration of an additional network attachment")
+	teardown := flag.Bool("teardown", false, "tear down the container's network rather than configure it, as the poststop hook")
+	networkSharersDir := flag.String("network-sharers-dir", "", "the directory recording the containers which share the container's network, which is not torn down while any do")
 	flag.Parse()
 
+	var hostEntries []dns.HostEntry
+	for _, host := range extraHosts.List {
+		entry, err := dns.ParseHostEntry(host)
+		if err != nil {
+			panic(err)
+		}
+
+		hostEntries = append(hostEntries, entry)
+	}
+
 	_, config.Subnet, err = net.ParseCIDR(*subnet)
 	if err != nil {
 		panic(err)
 	}
 
+	if *ipv6Pool != "" {
+		if _, config.IPv6Pool, err = net.ParseCIDR(*ipv6Pool); err != nil {
+			panic(err)
+		}
+
+		if _, config.SubnetIPv6, err = net.ParseCIDR(*subnetIPv6); err != nil {
+			panic(err)
+		}
+	}
+
+	if *hostAccess != "" {
+		allow, err := strconv.ParseBool(*hostAccess)
+		if err != nil {
+			panic(err)
+		}
+
+		config.Overrides.HostAccess = &allow
+	}
+	config.Overrides.DenyNetworks = denyNetworks.List
+
+	config.ContainerHandle = state.ID
+
 	logger = logger.Session("hook", lager.Data{
 		"config": config,
 		"pid":    state.Pid,
@@ -78,17 +133,58 @@ func main() {
 
 	logger.Info("start")
 
-	configurer := factory.NewDefaultConfigurer(iptables.New(linux_command_runner.New(), config.IPTablePrefix))
+	configurer := factory.NewDefaultConfigurer(wireInstanceChainCreator(config, *embeddedDNS), wirePolicyGroups(config))
+	if *teardown {
+		if err := kawasaki.Teardown(logger, configurer, config, attachments, *networkSharersDir); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	if err := configurer.Apply(logger, config, fmt.Sprintf("/proc/%d/ns/net", state.Pid)); err != nil {
 		panic(err)
 	}
 
-	dnsResolvConfigurer := wireDNSResolvConfigurer(state, config)
+	for _, attachment := range attachments {
+		attachment.ContainerHandle = state.ID
+		if err := configurer.Apply(logger.Session("attachment", lager.Data{"config": attachment}), attachment, fmt.Sprintf("/proc/%d/ns/net", state.Pid)); err != nil {
+			panic(err)
+		}
+	}
+
+	dnsResolvConfigurer := wireDNSResolvConfigurer(state, config, *embeddedDNS, hostEntries, dnsSearch.List, dnsOptions.List)
 	if err := dnsResolvConfigurer.Configure(logger); err != nil {
 		panic(err)
 	}
 }
 
+func wireInstanceChainCreator(config kawasaki.NetworkConfig, embeddedDNS bool) kawasaki.InstanceChainCreator {
+	if config.FirewallBackend == kawasaki.FirewallBackendNFTables {
+		return nftables.NewInstanceChainCreator(nftables.New(linux_command_runner.New(), config.IPTablePrefix), config.IPTableLogMethod, embeddedDNS)
+	}
+
+	ipv4 := iptables.NewInstanceChainCreator(iptables.New(linux_command_runner.New(), config.IPTablePrefix), config.IPTableLogMethod, embeddedDNS)
+	if config.IPv6Pool == nil {
+		return ipv4
+	}
+
+	return kawasaki.DualStackChainCreator{
+		IPv4:     ipv4,
+		IPv6:     iptables.NewInstanceChainCreator(iptables.NewIPv6(linux_command_runner.New(), config.IPTablePrefix), config.IPTableLogMethod, false),
+		IPv6Pool: config.IPv6Pool,
+	}
+}
+
+func wirePolicyGroups(config kawasaki.NetworkConfig) kawasaki.PolicyGroupEnforcer {
+	if config.FirewallBackend == kawasaki.FirewallBackendNFTables {
+		return nftables.PolicyGroups{}
+	}
+
+	// the network policies are applied by the daemon when it starts, so
+	// joining a group only needs the group's sets
+	return iptables.NewPolicyGroups(iptables.New(linux_command_runner.New(), config.IPTablePrefix), nil)
+}
+
 func extractRootIds(bndl *goci.Bndl) (int, int) {
 	rootUid := 0
 	for _, mapping := range bndl.Spec.Linux.UIDMappings {
@@ -109,7 +205,7 @@ func extractRootIds(bndl *goci.Bndl) (int, int) {
 	return rootUid, rootGid
 }
 
-func wireDNSResolvConfigurer(state specs.State, config kawasaki.NetworkConfig) *dns.ResolvConfigurer {
+func wireDNSResolvConfigurer(state specs.State, config kawasaki.NetworkConfig, embeddedDNS bool, extraHosts []dns.HostEntry, searchDomains, options []string) *dns.ResolvConfigurer {
 	bundleLoader := &goci.BndlLoader{}
 	bndl, err := bundleLoader.Load(state.BundlePath)
 	if err != nil {
@@ -120,13 +216,17 @@ func wireDNSResolvConfigurer(state specs.State, config kawasaki.NetworkConfig) *
 
 	configurer := &dns.ResolvConfigurer{
 		HostsFileCompiler: &dns.HostsFileCompiler{
-			Handle: state.ID,
-			IP:     config.ContainerIP,
+			Handle:     state.ID,
+			IP:         config.ContainerIP,
+			ExtraHosts: extraHosts,
 		},
 		ResolvFileCompiler: &dns.ResolvFileCompiler{
 			HostResolvConfPath: "/etc/resolv.conf",
 			HostIP:             config.BridgeIP,
 			OverrideServers:    config.DNSServers,
+			EmbeddedDNS:        embeddedDNS,
+			SearchDomains:      searchDomains,
+			Options:            options,
 		},
 		FileWriter: &dns.RootfsWriter{
 			RootfsPath: bndl.Spec.Root.Path,
@@ -172,3 +272,29 @@ func (c CIDRValue) Set(s string) error {
 	_, *c.IPNet, err = net.ParseCIDR(s)
 	return err
 }
+
+type ConfigList struct {
+	List *[]kawasaki.NetworkConfig
+}
+
+func (c ConfigList) String() string {
+	if c.List == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", *c.List)
+}
+
+func (c ConfigList) Get() interface{} {
+	return *c.List
+}
+
+func (c ConfigList) Set(s string) error {
+	var config kawasaki.NetworkConfig
+	if err := json.Unmarshal([]byte(s), &config); err != nil {
+		return err
+	}
+
+	*c.List = append(*c.List, config)
+	return nil
+}
@@ -0,0 +1,94 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// NetworkConfigList is a CNI network configuration list, i.e. the chain of
+// plugins to invoke to network a container
+type NetworkConfigList struct {
+	Name       string
+	CNIVersion string
+	Plugins    []PluginConfig
+}
+
+// PluginConfig is the configuration of one plugin in a list. The raw
+// configuration is kept as plugins may define any fields of their own.
+type PluginConfig struct {
+	Type string
+	Raw  map[string]interface{}
+}
+
+type configFile struct {
+	Name       string                   `json:"name"`
+	CNIVersion string                   `json:"cniVersion"`
+	Plugins    []map[string]interface{} `json:"plugins"`
+}
+
+// LoadConfList loads the first network configuration in the directory, in
+// lexical order as is the CNI convention. A .conflist file holds a list of
+// plugins, whereas a .conf or .json file holds a single plugin.
+func LoadConfList(dir string) (*NetworkConfigList, error) {
+	var paths []string
+	for _, ext := range []string{".conflist", ".conf", ".json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no CNI network configuration found in '%s'", dir)
+	}
+
+	sort.Strings(paths)
+	return loadFile(paths[0])
+}
+
+func loadFile(path string) (*NetworkConfigList, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CNI network configuration: %s", err)
+	}
+
+	var file configFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("parsing CNI network configuration '%s': %s", path, err)
+	}
+
+	if file.Name == "" {
+		return nil, fmt.Errorf("CNI network configuration '%s' has no name", path)
+	}
+
+	list := &NetworkConfigList{Name: file.Name, CNIVersion: file.CNIVersion}
+
+	if filepath.Ext(path) != ".conflist" {
+		var plugin map[string]interface{}
+		if err := json.Unmarshal(contents, &plugin); err != nil {
+			return nil, err
+		}
+
+		file.Plugins = []map[string]interface{}{plugin}
+	}
+
+	for i, plugin := range file.Plugins {
+		pluginType, _ := plugin["type"].(string)
+		if pluginType == "" {
+			return nil, fmt.Errorf("CNI network configuration '%s' has no type for plugin %d", path, i)
+		}
+
+		list.Plugins = append(list.Plugins, PluginConfig{Type: pluginType, Raw: plugin})
+	}
+
+	if len(list.Plugins) == 0 {
+		return nil, fmt.Errorf("CNI network configuration '%s' has no plugins", path)
+	}
+
+	return list, nil
+}
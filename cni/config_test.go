@@ -0,0 +1,96 @@
+package cni_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/guardian/cni"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadConfList", func() {
+	var configDir string
+
+	BeforeEach(func() {
+		var err error
+		configDir, err = ioutil.TempDir("", "cni-config")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(configDir)).To(Succeed())
+	})
+
+	writeConfig := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(configDir, name), []byte(contents), 0600)).To(Succeed())
+	}
+
+	It("loads a configuration list", func() {
+		writeConfig("10-tenant.conflist", `{
+			"cniVersion": "0.3.1",
+			"name": "tenant",
+			"plugins": [
+				{"type": "bridge", "bridge": "cni0", "ipam": {"type": "host-local", "subnet": "10.22.0.0/16"}},
+				{"type": "portmap"}
+			]
+		}`)
+
+		list, err := cni.LoadConfList(configDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(list.Name).To(Equal("tenant"))
+		Expect(list.CNIVersion).To(Equal("0.3.1"))
+		Expect(list.Plugins).To(HaveLen(2))
+		Expect(list.Plugins[0].Type).To(Equal("bridge"))
+		Expect(list.Plugins[0].Raw).To(HaveKeyWithValue("bridge", "cni0"))
+		Expect(list.Plugins[1].Type).To(Equal("portmap"))
+	})
+
+	It("loads a single plugin configuration as a list of one", func() {
+		writeConfig("10-tenant.conf", `{"cniVersion": "0.2.0", "name": "tenant", "type": "bridge"}`)
+
+		list, err := cni.LoadConfList(configDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(list.Name).To(Equal("tenant"))
+		Expect(list.Plugins).To(HaveLen(1))
+		Expect(list.Plugins[0].Type).To(Equal("bridge"))
+	})
+
+	It("loads the first configuration in lexical order", func() {
+		writeConfig("20-second.conflist", `{"name": "second", "plugins": [{"type": "bridge"}]}`)
+		writeConfig("10-first.conf", `{"name": "first", "type": "macvlan"}`)
+
+		list, err := cni.LoadConfList(configDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Name).To(Equal("first"))
+	})
+
+	Context("when there is no configuration", func() {
+		It("returns an error", func() {
+			_, err := cni.LoadConfList(configDir)
+			Expect(err).To(MatchError(ContainSubstring("no CNI network configuration found")))
+		})
+	})
+
+	Context("when a plugin has no type", func() {
+		It("returns an error", func() {
+			writeConfig("10-tenant.conflist", `{"name": "tenant", "plugins": [{"bridge": "cni0"}]}`)
+
+			_, err := cni.LoadConfList(configDir)
+			Expect(err).To(MatchError(ContainSubstring("has no type for plugin 0")))
+		})
+	})
+
+	Context("when the configuration has no name", func() {
+		It("returns an error", func() {
+			writeConfig("10-tenant.conf", `{"type": "bridge"}`)
+
+			_, err := cni.LoadConfList(configDir)
+			Expect(err).To(MatchError(ContainSubstring("has no name")))
+		})
+	})
+})
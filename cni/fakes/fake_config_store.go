@@ -0,0 +1,45 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/cni"
+)
+
+type FakeConfigStore struct {
+	SetStub        func(handle string, name string, value string)
+	setMutex       sync.RWMutex
+	setArgsForCall []struct {
+		handle string
+		name   string
+		value  string
+	}
+}
+
+func (fake *FakeConfigStore) Set(handle string, name string, value string) {
+	fake.setMutex.Lock()
+	fake.setArgsForCall = append(fake.setArgsForCall, struct {
+		handle string
+		name   string
+		value  string
+	}{handle, name, value})
+	fake.setMutex.Unlock()
+	if fake.SetStub != nil {
+		fake.SetStub(handle, name, value)
+	}
+}
+
+func (fake *FakeConfigStore) SetCallCount() int {
+	fake.setMutex.RLock()
+	defer fake.setMutex.RUnlock()
+	return len(fake.setArgsForCall)
+}
+
+func (fake *FakeConfigStore) SetArgsForCall(i int) (string, string, string) {
+	fake.setMutex.RLock()
+	defer fake.setMutex.RUnlock()
+	return fake.setArgsForCall[i].handle, fake.setArgsForCall[i].name, fake.setArgsForCall[i].value
+}
+
+var _ cni.ConfigStore = new(FakeConfigStore)
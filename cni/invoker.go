@@ -0,0 +1,120 @@
+package cni
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+)
+
+// Invoker runs the plugins of a network configuration list using the CNI
+// exec protocol
+type Invoker struct {
+	Runner     command_runner.CommandRunner
+	PluginDirs []string
+}
+
+// Add runs ADD for each plugin in the list in order, passing each the result
+// of the previous as prevResult. It returns the result of the last plugin.
+func (i *Invoker) Add(log lager.Logger, containerID, netnsPath, ifName string, list *NetworkConfigList) ([]byte, error) {
+	log = log.Session("cni-add", lager.Data{"containerID": containerID, "network": list.Name})
+
+	var prevResult []byte
+	for _, plugin := range list.Plugins {
+		result, err := i.exec(log, "ADD", containerID, netnsPath, ifName, list, plugin, prevResult)
+		if err != nil {
+			return nil, err
+		}
+
+		prevResult = result
+	}
+
+	return prevResult, nil
+}
+
+// Del runs DEL for each plugin in the list in reverse order. The network
+// namespace path may be empty if the namespace no longer exists.
+func (i *Invoker) Del(log lager.Logger, containerID, netnsPath, ifName string, list *NetworkConfigList) error {
+	log = log.Session("cni-del", lager.Data{"containerID": containerID, "network": list.Name})
+
+	for p := len(list.Plugins) - 1; p >= 0; p-- {
+		if _, err := i.exec(log, "DEL", containerID, netnsPath, ifName, list, list.Plugins[p], nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *Invoker) exec(log lager.Logger, command, containerID, netnsPath, ifName string, list *NetworkConfigList, plugin PluginConfig, prevResult []byte) ([]byte, error) {
+	pluginPath, err := i.find(plugin.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := pluginStdin(list, plugin, prevResult)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := new(bytes.Buffer)
+	cmd := exec.Command(pluginPath)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"CNI_COMMAND="+command,
+		"CNI_CONTAINERID="+containerID,
+		"CNI_NETNS="+netnsPath,
+		"CNI_IFNAME="+ifName,
+		"CNI_PATH="+strings.Join(i.PluginDirs, string(os.PathListSeparator)),
+	)
+
+	if err := i.Runner.Run(cmd); err != nil {
+		var pluginErr Error
+		if jsonErr := json.Unmarshal(stdout.Bytes(), &pluginErr); jsonErr == nil && pluginErr.Msg != "" {
+			err = pluginErr
+		}
+
+		log.Error("plugin-failed", err, lager.Data{"plugin": plugin.Type, "command": command})
+		return nil, fmt.Errorf("CNI plugin %s failed on %s: %s", plugin.Type, command, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (i *Invoker) find(pluginType string) (string, error) {
+	for _, dir := range i.PluginDirs {
+		path := filepath.Join(dir, pluginType)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("CNI plugin %s not found in %v", pluginType, i.PluginDirs)
+}
+
+// pluginStdin is the plugin's own configuration with the list's name and
+// version, as each plugin in a list is invoked as if it were a network on its
+// own
+func pluginStdin(list *NetworkConfigList, plugin PluginConfig, prevResult []byte) ([]byte, error) {
+	config := map[string]interface{}{}
+	for k, v := range plugin.Raw {
+		config[k] = v
+	}
+
+	config["name"] = list.Name
+	config["cniVersion"] = list.CNIVersion
+
+	if prevResult != nil {
+		config["prevResult"] = json.RawMessage(prevResult)
+	}
+
+	return json.Marshal(config)
+}
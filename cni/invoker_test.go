@@ -0,0 +1,169 @@
+package cni_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/guardian/cni"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Invoker", func() {
+	var (
+		fakeRunner *fake_command_runner.FakeCommandRunner
+		pluginDir  string
+		list       *cni.NetworkConfigList
+		invoker    *cni.Invoker
+		logger     *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		pluginDir, err = ioutil.TempDir("", "cni-plugins")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, plugin := range []string{"bridge", "portmap"} {
+			Expect(ioutil.WriteFile(filepath.Join(pluginDir, plugin), nil, 0700)).To(Succeed())
+		}
+
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		invoker = &cni.Invoker{Runner: fakeRunner, PluginDirs: []string{"/does/not/exist", pluginDir}}
+
+		list = &cni.NetworkConfigList{
+			Name:       "tenant",
+			CNIVersion: "0.3.1",
+			Plugins: []cni.PluginConfig{
+				{Type: "bridge", Raw: map[string]interface{}{"type": "bridge", "bridge": "cni0"}},
+				{Type: "portmap", Raw: map[string]interface{}{"type": "portmap"}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(pluginDir)).To(Succeed())
+	})
+
+	type invocation struct {
+		env   []string
+		stdin map[string]interface{}
+	}
+
+	recordInvocations := func(plugin string, output string) *[]invocation {
+		invocations := &[]invocation{}
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: filepath.Join(pluginDir, plugin)}, func(cmd *exec.Cmd) error {
+			stdin, err := ioutil.ReadAll(cmd.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(json.Unmarshal(stdin, &config)).To(Succeed())
+
+			*invocations = append(*invocations, invocation{env: cmd.Env, stdin: config})
+			cmd.Stdout.Write([]byte(output))
+			return nil
+		})
+
+		return invocations
+	}
+
+	Describe("Add", func() {
+		It("runs ADD for each plugin with the CNI environment", func() {
+			bridge := recordInvocations("bridge", `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.22.0.5/16"}]}`)
+			recordInvocations("portmap", `{"cniVersion":"0.3.1"}`)
+
+			_, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(*bridge).To(HaveLen(1))
+			Expect((*bridge)[0].env).To(ContainElement("CNI_COMMAND=ADD"))
+			Expect((*bridge)[0].env).To(ContainElement("CNI_CONTAINERID=some-handle"))
+			Expect((*bridge)[0].env).To(ContainElement("CNI_NETNS=/proc/42/ns/net"))
+			Expect((*bridge)[0].env).To(ContainElement("CNI_IFNAME=eth0"))
+			Expect((*bridge)[0].env).To(ContainElement("CNI_PATH=/does/not/exist:" + pluginDir))
+		})
+
+		It("passes each plugin its configuration with the list's name and version", func() {
+			bridge := recordInvocations("bridge", `{"cniVersion":"0.3.1"}`)
+			recordInvocations("portmap", `{"cniVersion":"0.3.1"}`)
+
+			_, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect((*bridge)[0].stdin).To(Equal(map[string]interface{}{
+				"type":       "bridge",
+				"bridge":     "cni0",
+				"name":       "tenant",
+				"cniVersion": "0.3.1",
+			}))
+		})
+
+		It("passes the previous plugin's result to the next and returns the last result", func() {
+			recordInvocations("bridge", `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.22.0.5/16"}]}`)
+			portmap := recordInvocations("portmap", `{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.22.0.5/16","gateway":"10.22.0.1"}]}`)
+
+			result, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect((*portmap)[0].stdin["prevResult"]).To(Equal(map[string]interface{}{
+				"cniVersion": "0.3.1",
+				"ips":        []interface{}{map[string]interface{}{"version": "4", "address": "10.22.0.5/16"}},
+			}))
+			Expect(result).To(MatchJSON(`{"cniVersion":"0.3.1","ips":[{"version":"4","address":"10.22.0.5/16","gateway":"10.22.0.1"}]}`))
+		})
+
+		Context("when a plugin fails", func() {
+			It("returns the plugin's error", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: filepath.Join(pluginDir, "bridge")}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`{"cniVersion":"0.3.1","code":11,"msg":"no IP addresses available","details":"range exhausted"}`))
+					return errors.New("exit status 1")
+				})
+
+				_, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+				Expect(err).To(MatchError("CNI plugin bridge failed on ADD: no IP addresses available: range exhausted"))
+			})
+
+			It("does not run the rest of the list", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: filepath.Join(pluginDir, "bridge")}, func(cmd *exec.Cmd) error {
+					return errors.New("exit status 1")
+				})
+
+				_, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+				Expect(err).To(MatchError("CNI plugin bridge failed on ADD: exit status 1"))
+				Expect(fakeRunner.ExecutedCommands()).To(HaveLen(1))
+			})
+		})
+
+		Context("when a plugin cannot be found", func() {
+			It("returns an error", func() {
+				list.Plugins[0].Type = "macvlan"
+
+				_, err := invoker.Add(logger, "some-handle", "/proc/42/ns/net", "eth0", list)
+				Expect(err).To(MatchError(ContainSubstring("CNI plugin macvlan not found")))
+			})
+		})
+	})
+
+	Describe("Del", func() {
+		It("runs DEL for each plugin in reverse order", func() {
+			recordInvocations("bridge", "")
+			recordInvocations("portmap", "")
+
+			Expect(invoker.Del(logger, "some-handle", "", "eth0", list)).To(Succeed())
+
+			executed := fakeRunner.ExecutedCommands()
+			Expect(executed).To(HaveLen(2))
+			Expect(executed[0].Path).To(Equal(filepath.Join(pluginDir, "portmap")))
+			Expect(executed[1].Path).To(Equal(filepath.Join(pluginDir, "bridge")))
+			Expect(executed[0].Env).To(ContainElement("CNI_COMMAND=DEL"))
+			Expect(executed[0].Env).To(ContainElement("CNI_NETNS="))
+		})
+	})
+})
@@ -0,0 +1,231 @@
+package cni
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/opencontainers/specs/specs-go"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . ConfigStore
+
+type ConfigStore interface {
+	Set(handle string, name string, value string)
+}
+
+// Networker networks containers with CNI plugins. The plugins are invoked by
+// the hook binary from the container's prestart and poststop hooks, as they
+// must run against the container's network namespace.
+//
+// The plugins assign the containers' addresses and own any port mappings and
+// egress rules, so NetIn, NetOut and the removal of their rules are not
+// supported, and the number of containers the network can host is configured
+// rather than known.
+type Networker struct {
+	runner     command_runner.CommandRunner
+	hookPath   string
+	configDir  string
+	pluginDirs []string
+
+	// resultsDir is where the prestart hook writes the CNI result for Created
+	// to read
+	resultsDir string
+
+	// netnsDir is where the prestart hook pins each container's network
+	// namespace, so that the plugins can delete the container's network
+	// after its processes have exited
+	netnsDir string
+
+	capacity    uint64
+	externalIP  net.IP
+	configStore ConfigStore
+}
+
+func NewNetworker(runner command_runner.CommandRunner, hookPath, configDir string, pluginDirs []string, resultsDir, netnsDir string, capacity uint64, externalIP net.IP, configStore ConfigStore) *Networker {
+	return &Networker{
+		runner:     runner,
+		hookPath:   hookPath,
+		configDir:  configDir,
+		pluginDirs: pluginDirs,
+
+		resultsDir: resultsDir,
+		netnsDir:   netnsDir,
+
+		capacity:    capacity,
+		externalIP:  externalIP,
+		configStore: configStore,
+	}
+}
+
+func (n *Networker) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks, error) {
+	log = log.Session("cni-hooks", lager.Data{"handle": handle})
+
+	if spec != "" {
+		return gardener.Hooks{}, fmt.Errorf("network spec '%s' is not supported, the CNI network configuration assigns addresses", spec)
+	}
+
+	// fail now rather than in the hook if the configuration is unusable
+	if _, err := LoadConfList(n.configDir); err != nil {
+		log.Error("load-config-failed", err)
+		return gardener.Hooks{}, err
+	}
+
+	if err := os.Remove(n.resultPath(handle)); err != nil && !os.IsNotExist(err) {
+		return gardener.Hooks{}, err
+	}
+
+	return gardener.Hooks{
+		Prestart: gardener.Hook{
+			Path: n.hookPath,
+			Args: append(n.hookArgs("add", handle), "--result-file", n.resultPath(handle)),
+		},
+		Poststop: gardener.Hook{
+			Path: n.hookPath,
+			Args: n.hookArgs("del", handle),
+		},
+	}, nil
+}
+
+// Created stores the addresses assigned by the plugins as the container's
+// properties
+func (n *Networker) Created(log lager.Logger, handle string) error {
+	log = log.Session("cni-created", lager.Data{"handle": handle})
+
+	output, err := ioutil.ReadFile(n.resultPath(handle))
+	if err != nil {
+		log.Error("read-result-failed", err)
+		return fmt.Errorf("reading CNI result: %s", err)
+	}
+
+	result, err := ParseResult(output)
+	if err != nil {
+		log.Error("parse-result-failed", err)
+		return err
+	}
+
+	containerIP, gateway := result.IPv4()
+	if containerIP == nil {
+		return errors.New("CNI result has no IPv4 address for the container")
+	}
+
+	n.configStore.Set(handle, gardener.ContainerIPKey, containerIP.String())
+	n.configStore.Set(handle, gardener.BridgeIPKey, stringOrEmpty(gateway))
+	n.configStore.Set(handle, gardener.ExternalIPKey, stringOrEmpty(n.externalIP))
+
+	if containerIPv6 := result.IPv6(); containerIPv6 != nil {
+		n.configStore.Set(handle, gardener.ContainerIPv6Key, containerIPv6.String())
+	}
+
+	return nil
+}
+
+// Capacity returns the configured number of containers the network can
+// host, as addresses are assigned by the plugins
+func (n *Networker) Capacity() uint64 {
+	return n.capacity
+}
+
+// Destroy tells the plugins to delete the container's network if the
+// poststop hook has not, e.g. because the container never started, and
+// removes the CNI result. The hook unpins the container's network namespace
+// once the plugins have deleted its network, so a pinned namespace means that
+// there is still a network to delete.
+func (n *Networker) Destroy(log lager.Logger, handle string) error {
+	log = log.Session("cni-destroy", lager.Data{"handle": handle})
+
+	if _, err := os.Stat(n.netnsPath(handle)); err == nil {
+		if err := n.del(log, handle); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(n.resultPath(handle)); err != nil && !os.IsNotExist(err) {
+		log.Error("remove-result-failed", err)
+		return err
+	}
+
+	return nil
+}
+
+func (n *Networker) NetIn(log lager.Logger, handle string, spec gardener.NetInSpec) (uint32, uint32, error) {
+	return 0, 0, errors.New("NetIn is not supported by the CNI networker")
+}
+
+func (n *Networker) NetOut(log lager.Logger, handle string, rule garden.NetOutRule) error {
+	return errors.New("NetOut is not supported by the CNI networker")
+}
+
+func (n *Networker) RemoveNetIn(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error {
+	return errors.New("RemoveNetIn is not supported by the CNI networker")
+}
+
+func (n *Networker) NetOutRules(log lager.Logger, handle string) ([]gardener.NetOutEntry, error) {
+	return nil, errors.New("NetOutRules is not supported by the CNI networker")
+}
+
+func (n *Networker) RemoveNetOut(log lager.Logger, handle string, id int) error {
+	return errors.New("RemoveNetOut is not supported by the CNI networker")
+}
+
+// del runs the hook binary to delete the container's network, as the poststop
+// hook does. There is no container state to give it, so it finds the
+// container's network namespace where it was pinned.
+func (n *Networker) del(log lager.Logger, handle string) error {
+	state, err := json.Marshal(specs.State{ID: handle})
+	if err != nil {
+		return err
+	}
+
+	args := n.hookArgs("del", handle)
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(n.hookPath, args[1:]...)
+	cmd.Stdin = bytes.NewReader(state)
+	cmd.Stderr = stderr
+
+	if err := n.runner.Run(cmd); err != nil {
+		log.Error("del-failed", err, lager.Data{"stderr": stderr.String()})
+		return fmt.Errorf("deleting CNI network: %s: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+func (n *Networker) hookArgs(action, handle string) []string {
+	return []string{
+		n.hookPath,
+		"--action", action,
+		"--handle", handle,
+		"--config-dir", n.configDir,
+		"--plugin-dir", strings.Join(n.pluginDirs, string(os.PathListSeparator)),
+		"--netns-file", n.netnsPath(handle),
+	}
+}
+
+func (n *Networker) netnsPath(handle string) string {
+	return filepath.Join(n.netnsDir, handle)
+}
+
+func (n *Networker) resultPath(handle string) string {
+	return filepath.Join(n.resultsDir, handle+".json")
+}
+
+func stringOrEmpty(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
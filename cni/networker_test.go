@@ -0,0 +1,262 @@
+package cni_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/cni"
+	"github.com/cloudfoundry-incubator/guardian/cni/fakes"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	"github.com/opencontainers/specs/specs-go"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Networker", func() {
+	var (
+		fakeRunner      *fake_command_runner.FakeCommandRunner
+		configDir       string
+		resultsDir      string
+		netnsDir        string
+		fakeConfigStore *fakes.FakeConfigStore
+		properties      map[string]string
+		networker       *cni.Networker
+		logger          *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		configDir, err = ioutil.TempDir("", "cni-config")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(configDir, "10-tenant.conf"), []byte(`{"name":"tenant","type":"bridge"}`), 0600)).To(Succeed())
+
+		resultsDir, err = ioutil.TempDir("", "cni-results")
+		Expect(err).NotTo(HaveOccurred())
+
+		netnsDir, err = ioutil.TempDir("", "cni-netns")
+		Expect(err).NotTo(HaveOccurred())
+
+		properties = map[string]string{}
+		fakeConfigStore = new(fakes.FakeConfigStore)
+		fakeConfigStore.SetStub = func(handle, name, value string) {
+			Expect(handle).To(Equal("some-handle"))
+			properties[name] = value
+		}
+
+		logger = lagertest.NewTestLogger("test")
+		fakeRunner = fake_command_runner.New()
+		networker = cni.NewNetworker(fakeRunner, "/path/to/cni-hook", configDir, []string{"/opt/cni/bin", "/usr/lib/cni"}, resultsDir, netnsDir, 42, net.ParseIP("1.2.3.4"), fakeConfigStore)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(configDir)).To(Succeed())
+		Expect(os.RemoveAll(resultsDir)).To(Succeed())
+		Expect(os.RemoveAll(netnsDir)).To(Succeed())
+	})
+
+	netnsPath := func() string {
+		return filepath.Join(netnsDir, "some-handle")
+	}
+
+	resultPath := func() string {
+		return filepath.Join(resultsDir, "some-handle.json")
+	}
+
+	Describe("Hooks", func() {
+		It("runs the hook binary to add and delete the container's network", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart).To(Equal(gardener.Hook{
+				Path: "/path/to/cni-hook",
+				Args: []string{
+					"/path/to/cni-hook", "--action", "add", "--handle", "some-handle",
+					"--config-dir", configDir, "--plugin-dir", "/opt/cni/bin:/usr/lib/cni",
+					"--netns-file", netnsPath(), "--result-file", resultPath(),
+				},
+			}))
+
+			Expect(hooks.Poststop).To(Equal(gardener.Hook{
+				Path: "/path/to/cni-hook",
+				Args: []string{
+					"/path/to/cni-hook", "--action", "del", "--handle", "some-handle",
+					"--config-dir", configDir, "--plugin-dir", "/opt/cni/bin:/usr/lib/cni",
+					"--netns-file", netnsPath(),
+				},
+			}))
+		})
+
+		It("removes any stale result for the handle", func() {
+			Expect(ioutil.WriteFile(resultPath(), []byte("{}"), 0600)).To(Succeed())
+
+			_, err := networker.Hooks(logger, "some-handle", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultPath()).NotTo(BeAnExistingFile())
+		})
+
+		Context("when a network spec is given", func() {
+			It("returns an error", func() {
+				_, err := networker.Hooks(logger, "some-handle", "10.0.0.2/30")
+				Expect(err).To(MatchError(ContainSubstring("network spec '10.0.0.2/30' is not supported")))
+			})
+		})
+
+		Context("when the network configuration cannot be loaded", func() {
+			It("returns an error", func() {
+				Expect(os.Remove(filepath.Join(configDir, "10-tenant.conf"))).To(Succeed())
+
+				_, err := networker.Hooks(logger, "some-handle", "")
+				Expect(err).To(MatchError(ContainSubstring("no CNI network configuration found")))
+			})
+		})
+	})
+
+	Describe("Created", func() {
+		It("stores the container's addresses as properties", func() {
+			Expect(ioutil.WriteFile(resultPath(), []byte(`{
+				"cniVersion": "0.3.1",
+				"ips": [
+					{"version": "4", "address": "10.22.0.5/16", "gateway": "10.22.0.1"},
+					{"version": "6", "address": "fd00::5/64"}
+				]
+			}`), 0600)).To(Succeed())
+
+			Expect(networker.Created(logger, "some-handle")).To(Succeed())
+			Expect(properties).To(Equal(map[string]string{
+				gardener.ContainerIPKey:   "10.22.0.5",
+				gardener.BridgeIPKey:      "10.22.0.1",
+				gardener.ExternalIPKey:    "1.2.3.4",
+				gardener.ContainerIPv6Key: "fd00::5",
+			}))
+		})
+
+		Context("when the result has no IPv4 address", func() {
+			It("returns an error", func() {
+				Expect(ioutil.WriteFile(resultPath(), []byte(`{"cniVersion":"0.3.1"}`), 0600)).To(Succeed())
+				Expect(networker.Created(logger, "some-handle")).To(MatchError("CNI result has no IPv4 address for the container"))
+			})
+		})
+
+		Context("when there is no result", func() {
+			It("returns an error", func() {
+				Expect(networker.Created(logger, "some-handle")).To(MatchError(ContainSubstring("reading CNI result")))
+			})
+		})
+	})
+
+	Describe("Destroy", func() {
+		It("removes the result", func() {
+			Expect(ioutil.WriteFile(resultPath(), []byte("{}"), 0600)).To(Succeed())
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+			Expect(resultPath()).NotTo(BeAnExistingFile())
+		})
+
+		It("succeeds when there is no result", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+		})
+
+		It("does not run the hook binary when the container's network namespace is not pinned", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+			Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
+		})
+
+		Context("when the container's network namespace is still pinned", func() {
+			var (
+				stdin   []byte
+				hookErr error
+			)
+
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(netnsPath(), nil, 0600)).To(Succeed())
+
+				stdin = nil
+				hookErr = nil
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "/path/to/cni-hook"}, func(cmd *exec.Cmd) error {
+					var err error
+					stdin, err = ioutil.ReadAll(cmd.Stdin)
+					Expect(err).NotTo(HaveOccurred())
+
+					if hookErr != nil {
+						cmd.Stderr.Write([]byte("plugin exploded"))
+					}
+
+					return hookErr
+				})
+			})
+
+			It("runs the hook binary to delete the container's network", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "/path/to/cni-hook",
+					Args: []string{
+						"--action", "del", "--handle", "some-handle",
+						"--config-dir", configDir, "--plugin-dir", "/opt/cni/bin:/usr/lib/cni",
+						"--netns-file", netnsPath(),
+					},
+				}))
+
+				var state specs.State
+				Expect(json.Unmarshal(stdin, &state)).To(Succeed())
+				Expect(state.ID).To(Equal("some-handle"))
+			})
+
+			It("removes the result", func() {
+				Expect(ioutil.WriteFile(resultPath(), []byte("{}"), 0600)).To(Succeed())
+
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+				Expect(resultPath()).NotTo(BeAnExistingFile())
+			})
+
+			Context("when the hook binary fails", func() {
+				BeforeEach(func() {
+					hookErr = errors.New("exit status 1")
+				})
+
+				It("returns an error", func() {
+					Expect(networker.Destroy(logger, "some-handle")).To(MatchError("deleting CNI network: exit status 1: plugin exploded"))
+				})
+
+				It("keeps the result", func() {
+					Expect(ioutil.WriteFile(resultPath(), []byte("{}"), 0600)).To(Succeed())
+
+					networker.Destroy(logger, "some-handle")
+					Expect(resultPath()).To(BeAnExistingFile())
+				})
+			})
+		})
+	})
+
+	Describe("Capacity", func() {
+		It("returns the configured capacity", func() {
+			Expect(networker.Capacity()).To(Equal(uint64(42)))
+		})
+	})
+
+	It("does not support NetIn or NetOut", func() {
+		_, _, err := networker.NetIn(logger, "some-handle", gardener.NetInSpec{})
+		Expect(err).To(MatchError("NetIn is not supported by the CNI networker"))
+
+		Expect(networker.NetOut(logger, "some-handle", garden.NetOutRule{})).To(MatchError("NetOut is not supported by the CNI networker"))
+	})
+
+	It("does not support removing port mappings or NetOut rules", func() {
+		Expect(networker.RemoveNetIn(logger, "some-handle", 8080, garden.ProtocolTCP)).To(MatchError("RemoveNetIn is not supported by the CNI networker"))
+
+		_, err := networker.NetOutRules(logger, "some-handle")
+		Expect(err).To(MatchError("NetOutRules is not supported by the CNI networker"))
+
+		Expect(networker.RemoveNetOut(logger, "some-handle", 1)).To(MatchError("RemoveNetOut is not supported by the CNI networker"))
+	})
+})
@@ -0,0 +1,94 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// Result is the result of a CNI ADD, in either the current format, listing
+// the IPs, or the pre-0.3.0 format with a single IPv4 and IPv6 configuration
+type Result struct {
+	CNIVersion string `json:"cniVersion,omitempty"`
+
+	IPs []IPConfig `json:"ips,omitempty"`
+
+	IP4 *LegacyIPConfig `json:"ip4,omitempty"`
+	IP6 *LegacyIPConfig `json:"ip6,omitempty"`
+}
+
+type IPConfig struct {
+	Address string `json:"address"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+type LegacyIPConfig struct {
+	IP      string `json:"ip"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// Error is the error a CNI plugin prints when it fails
+type Error struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Details string `json:"details,omitempty"`
+}
+
+func (e Error) Error() string {
+	if e.Details == "" {
+		return e.Msg
+	}
+
+	return fmt.Sprintf("%s: %s", e.Msg, e.Details)
+}
+
+func ParseResult(output []byte) (Result, error) {
+	var result Result
+	if err := json.Unmarshal(output, &result); err != nil {
+		return Result{}, fmt.Errorf("invalid CNI result '%s': %s", output, err)
+	}
+
+	return result, nil
+}
+
+// IPv4 returns the container's first IPv4 address and its gateway, if any
+func (r Result) IPv4() (ip, gateway net.IP) {
+	for _, config := range r.configs() {
+		if ip, gateway := config.parse(); ip != nil && ip.To4() != nil {
+			return ip, gateway
+		}
+	}
+
+	return nil, nil
+}
+
+// IPv6 returns the container's first IPv6 address, if any
+func (r Result) IPv6() net.IP {
+	for _, config := range r.configs() {
+		if ip, _ := config.parse(); ip != nil && ip.To4() == nil {
+			return ip
+		}
+	}
+
+	return nil
+}
+
+func (r Result) configs() []IPConfig {
+	configs := r.IPs
+	for _, legacy := range []*LegacyIPConfig{r.IP4, r.IP6} {
+		if legacy != nil {
+			configs = append(configs, IPConfig{Address: legacy.IP, Gateway: legacy.Gateway})
+		}
+	}
+
+	return configs
+}
+
+func (c IPConfig) parse() (ip, gateway net.IP) {
+	ip, _, err := net.ParseCIDR(c.Address)
+	if err != nil {
+		return nil, nil
+	}
+
+	return ip, net.ParseIP(c.Gateway)
+}
@@ -0,0 +1,43 @@
+package cni_test
+
+import (
+	"net"
+
+	"github.com/cloudfoundry-incubator/guardian/cni"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Result", func() {
+	It("returns the addresses from a current result", func() {
+		result, err := cni.ParseResult([]byte(`{
+			"cniVersion": "0.3.1",
+			"ips": [
+				{"version": "6", "address": "fd00::5/64"},
+				{"version": "4", "address": "10.22.0.5/16", "gateway": "10.22.0.1"}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ip, gateway := result.IPv4()
+		Expect(ip).To(Equal(net.ParseIP("10.22.0.5")))
+		Expect(gateway).To(Equal(net.ParseIP("10.22.0.1")))
+		Expect(result.IPv6()).To(Equal(net.ParseIP("fd00::5")))
+	})
+
+	It("returns the addresses from a pre-0.3.0 result", func() {
+		result, err := cni.ParseResult([]byte(`{"ip4": {"ip": "10.22.0.5/16", "gateway": "10.22.0.1"}}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		ip, gateway := result.IPv4()
+		Expect(ip).To(Equal(net.ParseIP("10.22.0.5")))
+		Expect(gateway).To(Equal(net.ParseIP("10.22.0.1")))
+		Expect(result.IPv6()).To(BeNil())
+	})
+
+	It("returns an error for invalid output", func() {
+		_, err := cni.ParseResult([]byte("potato"))
+		Expect(err).To(MatchError(ContainSubstring("invalid CNI result 'potato'")))
+	})
+})
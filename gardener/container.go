@@ -122,13 +122,33 @@ func (c *container) CurrentMemoryLimits() (garden.MemoryLimits, error) {
 }
 
 func (c *container) NetIn(hostPort, containerPort uint32) (uint32, uint32, error) {
-	return c.networker.NetIn(c.logger, c.handle, hostPort, containerPort)
+	return c.NetInWithSpec(NetInSpec{
+		HostPort:      hostPort,
+		ContainerPort: containerPort,
+		Protocol:      garden.ProtocolTCP,
+	})
+}
+
+func (c *container) NetInWithSpec(spec NetInSpec) (uint32, uint32, error) {
+	return c.networker.NetIn(c.logger, c.handle, spec)
+}
+
+func (c *container) RemoveNetIn(hostPort uint32, protocol garden.Protocol) error {
+	return c.networker.RemoveNetIn(c.logger, c.handle, hostPort, protocol)
 }
 
 func (c *container) NetOut(netOutRule garden.NetOutRule) error {
 	return c.networker.NetOut(c.logger, c.handle, netOutRule)
 }
 
+func (c *container) NetOutRules() ([]NetOutEntry, error) {
+	return c.networker.NetOutRules(c.logger, c.handle)
+}
+
+func (c *container) RemoveNetOut(id int) error {
+	return c.networker.RemoveNetOut(c.logger, c.handle, id)
+}
+
 func (c *container) Attach(processID string, io garden.ProcessIO) (garden.Process, error) {
 	return nil, nil
 }
@@ -160,11 +180,19 @@ func (c *container) Property(name string) (string, error) {
 }
 
 func (c *container) SetProperty(name string, value string) error {
+	if IsReservedProperty(name) {
+		return reservedPropertyError(name)
+	}
+
 	c.propertyManager.Set(c.handle, name, value)
 	return nil
 }
 
 func (c *container) RemoveProperty(name string) error {
+	if IsReservedProperty(name) {
+		return reservedPropertyError(name)
+	}
+
 	return c.propertyManager.Remove(c.handle, name)
 }
 
@@ -36,13 +36,12 @@ type FakeNetworker struct {
 	destroyReturns struct {
 		result1 error
 	}
-	NetInStub        func(log lager.Logger, handle string, hostPort, containerPort uint32) (uint32, uint32, error)
+	NetInStub        func(log lager.Logger, handle string, spec gardener.NetInSpec) (uint32, uint32, error)
 	netInMutex       sync.RWMutex
 	netInArgsForCall []struct {
-		log           lager.Logger
-		handle        string
-		hostPort      uint32
-		containerPort uint32
+		log    lager.Logger
+		handle string
+		spec   gardener.NetInSpec
 	}
 	netInReturns struct {
 		result1 uint32
@@ -59,6 +58,37 @@ type FakeNetworker struct {
 	netOutReturns struct {
 		result1 error
 	}
+	RemoveNetInStub        func(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error
+	removeNetInMutex       sync.RWMutex
+	removeNetInArgsForCall []struct {
+		log      lager.Logger
+		handle   string
+		hostPort uint32
+		protocol garden.Protocol
+	}
+	removeNetInReturns struct {
+		result1 error
+	}
+	NetOutRulesStub        func(log lager.Logger, handle string) ([]gardener.NetOutEntry, error)
+	netOutRulesMutex       sync.RWMutex
+	netOutRulesArgsForCall []struct {
+		log    lager.Logger
+		handle string
+	}
+	netOutRulesReturns struct {
+		result1 []gardener.NetOutEntry
+		result2 error
+	}
+	RemoveNetOutStub        func(log lager.Logger, handle string, id int) error
+	removeNetOutMutex       sync.RWMutex
+	removeNetOutArgsForCall []struct {
+		log    lager.Logger
+		handle string
+		id     int
+	}
+	removeNetOutReturns struct {
+		result1 error
+	}
 }
 
 func (fake *FakeNetworker) Hooks(log lager.Logger, handle string, spec string) (gardener.Hooks, error) {
@@ -153,17 +183,16 @@ func (fake *FakeNetworker) DestroyReturns(result1 error) {
 	}{result1}
 }
 
-func (fake *FakeNetworker) NetIn(log lager.Logger, handle string, hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+func (fake *FakeNetworker) NetIn(log lager.Logger, handle string, spec gardener.NetInSpec) (uint32, uint32, error) {
 	fake.netInMutex.Lock()
 	fake.netInArgsForCall = append(fake.netInArgsForCall, struct {
-		log           lager.Logger
-		handle        string
-		hostPort      uint32
-		containerPort uint32
-	}{log, handle, hostPort, containerPort})
+		log    lager.Logger
+		handle string
+		spec   gardener.NetInSpec
+	}{log, handle, spec})
 	fake.netInMutex.Unlock()
 	if fake.NetInStub != nil {
-		return fake.NetInStub(log, handle, hostPort, containerPort)
+		return fake.NetInStub(log, handle, spec)
 	} else {
 		return fake.netInReturns.result1, fake.netInReturns.result2, fake.netInReturns.result3
 	}
@@ -175,10 +204,10 @@ func (fake *FakeNetworker) NetInCallCount() int {
 	return len(fake.netInArgsForCall)
 }
 
-func (fake *FakeNetworker) NetInArgsForCall(i int) (lager.Logger, string, uint32, uint32) {
+func (fake *FakeNetworker) NetInArgsForCall(i int) (lager.Logger, string, gardener.NetInSpec) {
 	fake.netInMutex.RLock()
 	defer fake.netInMutex.RUnlock()
-	return fake.netInArgsForCall[i].log, fake.netInArgsForCall[i].handle, fake.netInArgsForCall[i].hostPort, fake.netInArgsForCall[i].containerPort
+	return fake.netInArgsForCall[i].log, fake.netInArgsForCall[i].handle, fake.netInArgsForCall[i].spec
 }
 
 func (fake *FakeNetworker) NetInReturns(result1 uint32, result2 uint32, result3 error) {
@@ -224,4 +253,107 @@ func (fake *FakeNetworker) NetOutReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeNetworker) RemoveNetIn(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error {
+	fake.removeNetInMutex.Lock()
+	fake.removeNetInArgsForCall = append(fake.removeNetInArgsForCall, struct {
+		log      lager.Logger
+		handle   string
+		hostPort uint32
+		protocol garden.Protocol
+	}{log, handle, hostPort, protocol})
+	fake.removeNetInMutex.Unlock()
+	if fake.RemoveNetInStub != nil {
+		return fake.RemoveNetInStub(log, handle, hostPort, protocol)
+	} else {
+		return fake.removeNetInReturns.result1
+	}
+}
+
+func (fake *FakeNetworker) RemoveNetInCallCount() int {
+	fake.removeNetInMutex.RLock()
+	defer fake.removeNetInMutex.RUnlock()
+	return len(fake.removeNetInArgsForCall)
+}
+
+func (fake *FakeNetworker) RemoveNetInArgsForCall(i int) (lager.Logger, string, uint32, garden.Protocol) {
+	fake.removeNetInMutex.RLock()
+	defer fake.removeNetInMutex.RUnlock()
+	return fake.removeNetInArgsForCall[i].log, fake.removeNetInArgsForCall[i].handle, fake.removeNetInArgsForCall[i].hostPort, fake.removeNetInArgsForCall[i].protocol
+}
+
+func (fake *FakeNetworker) RemoveNetInReturns(result1 error) {
+	fake.RemoveNetInStub = nil
+	fake.removeNetInReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNetworker) NetOutRules(log lager.Logger, handle string) ([]gardener.NetOutEntry, error) {
+	fake.netOutRulesMutex.Lock()
+	fake.netOutRulesArgsForCall = append(fake.netOutRulesArgsForCall, struct {
+		log    lager.Logger
+		handle string
+	}{log, handle})
+	fake.netOutRulesMutex.Unlock()
+	if fake.NetOutRulesStub != nil {
+		return fake.NetOutRulesStub(log, handle)
+	} else {
+		return fake.netOutRulesReturns.result1, fake.netOutRulesReturns.result2
+	}
+}
+
+func (fake *FakeNetworker) NetOutRulesCallCount() int {
+	fake.netOutRulesMutex.RLock()
+	defer fake.netOutRulesMutex.RUnlock()
+	return len(fake.netOutRulesArgsForCall)
+}
+
+func (fake *FakeNetworker) NetOutRulesArgsForCall(i int) (lager.Logger, string) {
+	fake.netOutRulesMutex.RLock()
+	defer fake.netOutRulesMutex.RUnlock()
+	return fake.netOutRulesArgsForCall[i].log, fake.netOutRulesArgsForCall[i].handle
+}
+
+func (fake *FakeNetworker) NetOutRulesReturns(result1 []gardener.NetOutEntry, result2 error) {
+	fake.NetOutRulesStub = nil
+	fake.netOutRulesReturns = struct {
+		result1 []gardener.NetOutEntry
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeNetworker) RemoveNetOut(log lager.Logger, handle string, id int) error {
+	fake.removeNetOutMutex.Lock()
+	fake.removeNetOutArgsForCall = append(fake.removeNetOutArgsForCall, struct {
+		log    lager.Logger
+		handle string
+		id     int
+	}{log, handle, id})
+	fake.removeNetOutMutex.Unlock()
+	if fake.RemoveNetOutStub != nil {
+		return fake.RemoveNetOutStub(log, handle, id)
+	} else {
+		return fake.removeNetOutReturns.result1
+	}
+}
+
+func (fake *FakeNetworker) RemoveNetOutCallCount() int {
+	fake.removeNetOutMutex.RLock()
+	defer fake.removeNetOutMutex.RUnlock()
+	return len(fake.removeNetOutArgsForCall)
+}
+
+func (fake *FakeNetworker) RemoveNetOutArgsForCall(i int) (lager.Logger, string, int) {
+	fake.removeNetOutMutex.RLock()
+	defer fake.removeNetOutMutex.RUnlock()
+	return fake.removeNetOutArgsForCall[i].log, fake.removeNetOutArgsForCall[i].handle, fake.removeNetOutArgsForCall[i].id
+}
+
+func (fake *FakeNetworker) RemoveNetOutReturns(result1 error) {
+	fake.RemoveNetOutStub = nil
+	fake.removeNetOutReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ gardener.Networker = new(FakeNetworker)
@@ -1,8 +1,12 @@
 package gardener
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
@@ -19,7 +23,63 @@ import (
 const ContainerIPKey = "garden.network.container-ip"
 const BridgeIPKey = "garden.network.host-ip"
 const ExternalIPKey = "garden.network.external-ip"
+const ContainerIPv6Key = "garden.network.container-ipv6"
 const MappedPortsKey = "garden.network.mapped-ports"
+const AttachmentsKey = "garden.network.attachments"
+
+// Network modes which may be given in place of a container's network spec.
+// A container in NetworkModeNone has a network namespace with only a loopback
+// interface, and one in NetworkModeHost shares the host's network namespace.
+const (
+	NetworkModeNone = "none"
+	NetworkModeHost = "host"
+)
+
+// NetworkPeerPrefix begins a network spec which names another container, e.g.
+// "container:app", whose network namespace the container should join. The
+// peer's handle is stored under NetworkPeerKey.
+const NetworkPeerPrefix = "container:"
+const NetworkPeerKey = "garden.network.peer"
+
+// ReservedPropertyPrefixes begin the names of the properties the server and
+// its networkers keep their state of a container in. Clients may read them but
+// not set or remove them, as the server relies on their values, e.g. to know
+// which container's network a container has joined.
+var ReservedPropertyPrefixes = []string{"garden.", "kawasaki.", "netplugin."}
+
+// IsReservedProperty returns true if the property is kept by the server
+func IsReservedProperty(name string) bool {
+	for _, prefix := range ReservedPropertyPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func reservedPropertyError(name string) error {
+	return fmt.Errorf("property %s is reserved and cannot be set by clients", name)
+}
+
+// NetworkSpecMode returns the network mode or peer given by a container's
+// network spec. A spec given as a JSON object, i.e. beginning with '{', gives
+// them in its "mode" option; any other spec is returned as it is. A JSON spec
+// which cannot be parsed gives no mode, and is left to the networker to reject.
+func NetworkSpecMode(spec string) string {
+	if !strings.HasPrefix(spec, "{") {
+		return spec
+	}
+
+	var jsonSpec struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.Unmarshal([]byte(spec), &jsonSpec); err != nil {
+		return ""
+	}
+
+	return jsonSpec.Mode
+}
 
 type SysInfoProvider interface {
 	TotalMemory() (uint64, error)
@@ -41,8 +101,90 @@ type Networker interface {
 	Hooks(log lager.Logger, handle, spec string) (Hooks, error)
 	Capacity() uint64
 	Destroy(log lager.Logger, handle string) error
-	NetIn(log lager.Logger, handle string, hostPort, containerPort uint32) (uint32, uint32, error)
+	NetIn(log lager.Logger, handle string, spec NetInSpec) (uint32, uint32, error)
 	NetOut(log lager.Logger, handle string, rule garden.NetOutRule) error
+	RemoveNetIn(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error
+	NetOutRules(log lager.Logger, handle string) ([]NetOutEntry, error)
+	RemoveNetOut(log lager.Logger, handle string, id int) error
+}
+
+// Container is the garden.Container returned by the Gardener. It adds the
+// network operations which garden.Container's methods have no room for, such
+// as forwarding UDP ports or ranges of ports.
+type Container interface {
+	garden.Container
+
+	// NetInWithSpec forwards the ports described by the spec, returning the
+	// first host and container ports of the range
+	NetInWithSpec(spec NetInSpec) (uint32, uint32, error)
+
+	// RemoveNetIn removes the port mapping with the given host port and
+	// protocol
+	RemoveNetIn(hostPort uint32, protocol garden.Protocol) error
+
+	// NetOutRules returns the NetOut rules which have been applied to the
+	// container
+	NetOutRules() ([]NetOutEntry, error)
+
+	// RemoveNetOut removes the NetOut rule with the given ID
+	RemoveNetOut(id int) error
+}
+
+// NetworkCreationObserver is optionally implemented by a Networker which
+// needs to act once a container has been created, and so once its prestart
+// network hook has run
+type NetworkCreationObserver interface {
+	Created(log lager.Logger, handle string) error
+}
+
+// NetworkModeNetworker is optionally implemented by a Networker which
+// supports the network modes and peers which may be given in place of a
+// network spec. Containers are refused a mode or peer by any other Networker,
+// e.g. one which passes the spec on to an external plugin.
+type NetworkModeNetworker interface {
+	SupportsNetworkModes() bool
+}
+
+// NetInSpec describes a contiguous range of ports to forward from the host to
+// a container.
+type NetInSpec struct {
+	// First port of the range on the host, 0 to acquire a range from the pool
+	HostPort uint32
+
+	// First port of the range in the container, 0 to use the host port
+	ContainerPort uint32
+
+	// Number of contiguous ports to forward, 0 is treated as 1
+	PortCount uint32
+
+	// Either garden.ProtocolTCP or garden.ProtocolUDP
+	Protocol garden.Protocol
+}
+
+// PortMapping is how each mapped port is stored under MappedPortsKey. It is a
+// superset of garden.PortMapping so the stored value can be read as either.
+type PortMapping struct {
+	HostPort      uint32
+	ContainerPort uint32
+	Protocol      string
+}
+
+// NetOutEntry is a NetOut rule which has been applied to a container, along
+// with an ID identifying it within that container
+type NetOutEntry struct {
+	ID   int               `json:"id"`
+	Rule garden.NetOutRule `json:"rule"`
+}
+
+// NetworkAttachment is how each of a container's network attachments is
+// stored, as a JSON list, under AttachmentsKey. The first attachment in the
+// list carries the container's default route.
+type NetworkAttachment struct {
+	Interface    string
+	ContainerIP  string
+	HostIP       string
+	Subnet       string
+	DefaultRoute bool
 }
 
 type VolumeCreator interface {
@@ -96,6 +238,18 @@ type DesiredContainerSpec struct {
 	// Network hook
 	NetworkHooks Hooks
 
+	// NetworkMode is NetworkModeNone or NetworkModeHost when the container's
+	// network spec selected one, and empty otherwise
+	NetworkMode string
+
+	// NetworkPeer is the handle of the container whose network namespace the
+	// container joins, if any
+	NetworkPeer string
+
+	// NetworkNamespacePath is the path of the network namespace the container
+	// joins. It is set by the containerizer from NetworkPeer.
+	NetworkNamespacePath string
+
 	// Bind mounts
 	BindMounts []garden.BindMount
 
@@ -164,6 +318,21 @@ func (g *Gardener) Create(spec garden.ContainerSpec) (ctr garden.Container, err
 	log.Info("start")
 	defer log.Info("created")
 
+	mode := NetworkSpecMode(spec.Network)
+	if isNetworkMode(mode) && !g.supportsNetworkModes() {
+		return nil, fmt.Errorf("network mode %s is not supported by the networker", mode)
+	}
+
+	if mode == NetworkModeHost && !spec.Privileged {
+		return nil, errors.New("host networking is only available to privileged containers")
+	}
+
+	for name := range spec.Properties {
+		if IsReservedProperty(name) {
+			return nil, reservedPropertyError(name)
+		}
+	}
+
 	defer func() {
 		if err != nil {
 			log := log.Session("cleanup")
@@ -173,6 +342,26 @@ func (g *Gardener) Create(spec garden.ContainerSpec) (ctr garden.Container, err
 		}
 	}()
 
+	// properties are set before the network is configured so that the
+	// networker can read any network settings from them
+	for name, value := range spec.Properties {
+		g.PropertyManager.Set(spec.Handle, name, value)
+	}
+
+	var networkPeer string
+	if strings.HasPrefix(mode, NetworkPeerPrefix) {
+		networkPeer = strings.TrimPrefix(mode, NetworkPeerPrefix)
+		if networkPeer == "" {
+			return nil, fmt.Errorf("network spec %s does not name a container", mode)
+		}
+
+		if _, err := g.Containerizer.Info(log, networkPeer); err != nil {
+			return nil, fmt.Errorf("network peer %s: %s", networkPeer, err)
+		}
+
+		g.PropertyManager.Set(spec.Handle, NetworkPeerKey, networkPeer)
+	}
+
 	hooks, err := g.Networker.Hooks(log, spec.Handle, spec.Network)
 	if err != nil {
 		return nil, err
@@ -201,6 +390,8 @@ func (g *Gardener) Create(spec garden.ContainerSpec) (ctr garden.Container, err
 		Handle:       spec.Handle,
 		RootFSPath:   rootFSPath,
 		NetworkHooks: hooks,
+		NetworkMode:  networkMode(mode),
+		NetworkPeer:  networkPeer,
 		Privileged:   spec.Privileged,
 		BindMounts:   spec.BindMounts,
 		Limits:       spec.Limits,
@@ -209,26 +400,42 @@ func (g *Gardener) Create(spec garden.ContainerSpec) (ctr garden.Container, err
 		return nil, err
 	}
 
+	if observer, ok := g.Networker.(NetworkCreationObserver); ok {
+		if err := observer.Created(log, spec.Handle); err != nil {
+			return nil, err
+		}
+	}
+
 	container, err := g.Lookup(spec.Handle)
 	if err != nil {
 		return nil, err
 	}
 
-	for name, value := range spec.Properties {
-		err := container.SetProperty(name, value)
-		if err != nil {
-			return nil, err
-		}
+	return container, nil
+}
+
+func isNetworkMode(mode string) bool {
+	return mode == NetworkModeNone || mode == NetworkModeHost || strings.HasPrefix(mode, NetworkPeerPrefix)
+}
+
+func (g *Gardener) supportsNetworkModes() bool {
+	networker, ok := g.Networker.(NetworkModeNetworker)
+	return ok && networker.SupportsNetworkModes()
+}
+
+func networkMode(mode string) string {
+	if mode == NetworkModeNone || mode == NetworkModeHost {
+		return mode
 	}
 
-	return container, nil
+	return ""
 }
 
 func (g *Gardener) Lookup(handle string) (garden.Container, error) {
 	return g.lookup(handle), nil
 }
 
-func (g *Gardener) lookup(handle string) garden.Container {
+func (g *Gardener) lookup(handle string) Container {
 	return &container{
 		logger:          g.Logger,
 		handle:          handle,
@@ -246,9 +453,36 @@ func (g *Gardener) Destroy(handle string) error {
 	log.Info("start")
 	defer log.Info("destroyed")
 
+	sharers, err := g.networkSharers(handle)
+	if err != nil {
+		return err
+	}
+
+	if len(sharers) > 0 {
+		return fmt.Errorf("container %s cannot be destroyed while containers share its network: %s", handle, strings.Join(sharers, ", "))
+	}
+
 	return g.destroy(log, handle)
 }
 
+// networkSharers returns the handles of the containers which have joined the
+// given container's network namespace
+func (g *Gardener) networkSharers(handle string) ([]string, error) {
+	handles, err := g.Containerizer.Handles()
+	if err != nil {
+		return nil, err
+	}
+
+	var sharers []string
+	for _, other := range handles {
+		if peer, err := g.PropertyManager.Get(other, NetworkPeerKey); err == nil && peer == handle {
+			sharers = append(sharers, other)
+		}
+	}
+
+	return sharers, nil
+}
+
 func (g *Gardener) destroy(log lager.Logger, handle string) error {
 	if err := g.Containerizer.Destroy(g.Logger, handle); err != nil {
 		return err
@@ -366,6 +366,214 @@ var _ = Describe("Gardener", func() {
 					"thingy": "thing",
 				}))
 			})
+
+			It("sets the properties before configuring the network", func() {
+				networker.HooksStub = func(_ lager.Logger, handle, spec string) (gardener.Hooks, error) {
+					Expect(propertyManager.SetCallCount()).To(Equal(2))
+					return gardener.Hooks{}, nil
+				}
+
+				_, err := gdnr.Create(garden.ContainerSpec{
+					Handle:     "something",
+					Properties: startingProperties,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(networker.HooksCallCount()).To(Equal(1))
+			})
+
+			Context("when a reserved property is specified", func() {
+				It("returns an error without creating anything", func() {
+					for _, name := range []string{gardener.NetworkPeerKey, "kawasaki.network-mode", "kawasaki.network-peer", "netplugin.network-spec"} {
+						_, err := gdnr.Create(garden.ContainerSpec{
+							Handle:     "something",
+							Properties: garden.Properties{name: "other-container"},
+						})
+						Expect(err).To(MatchError(fmt.Sprintf("property %s is reserved and cannot be set by clients", name)))
+					}
+
+					Expect(propertyManager.SetCallCount()).To(Equal(0))
+					Expect(networker.HooksCallCount()).To(Equal(0))
+					Expect(containerizer.CreateCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the networker observes container creation", func() {
+			var createdHandles []string
+
+			BeforeEach(func() {
+				createdHandles = nil
+				gdnr.Networker = observingNetworker{
+					FakeNetworker: networker,
+					created: func(_ lager.Logger, handle string) error {
+						Expect(containerizer.CreateCallCount()).To(Equal(1))
+						createdHandles = append(createdHandles, handle)
+						return nil
+					},
+				}
+			})
+
+			It("tells the networker once the container has been created", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Handle: "bob"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(createdHandles).To(Equal([]string{"bob"}))
+			})
+
+			Context("when the networker fails", func() {
+				BeforeEach(func() {
+					gdnr.Networker = observingNetworker{
+						FakeNetworker: networker,
+						created: func(lager.Logger, string) error {
+							return errors.New("no network")
+						},
+					}
+				})
+
+				It("returns the error and destroys the container", func() {
+					_, err := gdnr.Create(garden.ContainerSpec{Handle: "bob"})
+					Expect(err).To(MatchError("no network"))
+					Expect(containerizer.DestroyCallCount()).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when a network mode is given", func() {
+			BeforeEach(func() {
+				gdnr.Networker = modeNetworker{networker}
+			})
+
+			It("passes it to the containerizer", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: "none"})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, spec := containerizer.CreateArgsForCall(0)
+				Expect(spec.NetworkMode).To(Equal(gardener.NetworkModeNone))
+			})
+
+			It("still asks the networker for the container's hooks", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: "none"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(networker.HooksCallCount()).To(Equal(1))
+				_, _, spec := networker.HooksArgsForCall(0)
+				Expect(spec).To(Equal("none"))
+			})
+
+			Context("when the mode is host", func() {
+				It("passes it to the containerizer for a privileged container", func() {
+					_, err := gdnr.Create(garden.ContainerSpec{Network: "host", Privileged: true})
+					Expect(err).NotTo(HaveOccurred())
+
+					_, spec := containerizer.CreateArgsForCall(0)
+					Expect(spec.NetworkMode).To(Equal(gardener.NetworkModeHost))
+				})
+
+				It("rejects an unprivileged container", func() {
+					_, err := gdnr.Create(garden.ContainerSpec{Network: "host"})
+					Expect(err).To(MatchError("host networking is only available to privileged containers"))
+
+					Expect(networker.HooksCallCount()).To(Equal(0))
+					Expect(containerizer.CreateCallCount()).To(Equal(0))
+				})
+			})
+
+			It("is taken from the mode of a JSON network spec", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: `{"mode": "host"}`, Privileged: true})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, spec := containerizer.CreateArgsForCall(0)
+				Expect(spec.NetworkMode).To(Equal(gardener.NetworkModeHost))
+
+				_, _, networkSpec := networker.HooksArgsForCall(0)
+				Expect(networkSpec).To(Equal(`{"mode": "host"}`))
+			})
+
+			It("rejects an unprivileged container whose JSON network spec gives the host mode", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: `{"mode": "host"}`})
+				Expect(err).To(MatchError("host networking is only available to privileged containers"))
+			})
+
+			It("is not set for other network specs", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: "10.0.0.2/30"})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, spec := containerizer.CreateArgsForCall(0)
+				Expect(spec.NetworkMode).To(BeEmpty())
+			})
+		})
+
+		Context("when the network spec names a peer container", func() {
+			BeforeEach(func() {
+				gdnr.Networker = modeNetworker{networker}
+			})
+
+			It("records the peer and passes it to the containerizer", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Handle: "sidecar", Network: "container:app"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(containerizer.InfoCallCount()).To(BeNumerically(">=", 1))
+				_, peer := containerizer.InfoArgsForCall(0)
+				Expect(peer).To(Equal("app"))
+
+				handle, name, value := propertyManager.SetArgsForCall(0)
+				Expect(handle).To(Equal("sidecar"))
+				Expect(name).To(Equal(gardener.NetworkPeerKey))
+				Expect(value).To(Equal("app"))
+
+				_, spec := containerizer.CreateArgsForCall(0)
+				Expect(spec.NetworkPeer).To(Equal("app"))
+			})
+
+			It("still asks the networker for the container's hooks", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Handle: "sidecar", Network: "container:app"})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, spec := networker.HooksArgsForCall(0)
+				Expect(spec).To(Equal("container:app"))
+			})
+
+			It("takes the peer from the mode of a JSON network spec", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Handle: "sidecar", Network: `{"mode": "container:app"}`})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, spec := containerizer.CreateArgsForCall(0)
+				Expect(spec.NetworkPeer).To(Equal("app"))
+			})
+
+			Context("when the peer does not exist", func() {
+				It("returns an error", func() {
+					containerizer.InfoReturns(gardener.ActualContainerSpec{}, errors.New("not found"))
+
+					_, err := gdnr.Create(garden.ContainerSpec{Handle: "sidecar", Network: "container:app"})
+					Expect(err).To(MatchError("network peer app: not found"))
+					Expect(networker.HooksCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the spec does not name a container", func() {
+				It("returns an error", func() {
+					_, err := gdnr.Create(garden.ContainerSpec{Handle: "sidecar", Network: "container:"})
+					Expect(err).To(MatchError("network spec container: does not name a container"))
+				})
+			})
+		})
+
+		Context("when the networker does not support network modes", func() {
+			It("rejects a network mode before asking the networker for hooks", func() {
+				for _, network := range []string{"none", "host", "container:app", `{"mode": "none"}`} {
+					_, err := gdnr.Create(garden.ContainerSpec{Network: network, Privileged: true})
+					Expect(err).To(MatchError(fmt.Sprintf("network mode %s is not supported by the networker", gardener.NetworkSpecMode(network))))
+				}
+
+				Expect(networker.HooksCallCount()).To(Equal(0))
+				Expect(containerizer.CreateCallCount()).To(Equal(0))
+			})
+
+			It("still passes other network specs to the networker", func() {
+				_, err := gdnr.Create(garden.ContainerSpec{Network: "10.0.0.2/30"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(networker.HooksCallCount()).To(Equal(1))
+			})
 		})
 
 		Context("when bind mounts are specified", func() {
@@ -492,11 +700,14 @@ var _ = Describe("Gardener", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(networker.NetInCallCount()).To(Equal(1))
 
-				actualLogger, actualHandle, actualExtPort, actualContainerPort := networker.NetInArgsForCall(0)
+				actualLogger, actualHandle, actualSpec := networker.NetInArgsForCall(0)
 				Expect(actualLogger).To(Equal(logger))
 				Expect(actualHandle).To(Equal(container.Handle()))
-				Expect(actualExtPort).To(Equal(externalPort))
-				Expect(actualContainerPort).To(Equal(contianerPort))
+				Expect(actualSpec).To(Equal(gardener.NetInSpec{
+					HostPort:      externalPort,
+					ContainerPort: contianerPort,
+					Protocol:      garden.ProtocolTCP,
+				}))
 			})
 
 			Context("when networker returns an error", func() {
@@ -508,6 +719,26 @@ var _ = Describe("Gardener", func() {
 					Expect(err).To(MatchError("error"))
 				})
 			})
+
+			Context("when given a spec", func() {
+				It("asks the networker to forward the ports the spec describes", func() {
+					networker.NetInReturns(60000, 53, nil)
+					spec := gardener.NetInSpec{
+						ContainerPort: 53,
+						PortCount:     3,
+						Protocol:      garden.ProtocolUDP,
+					}
+
+					hostPort, containerPort, err := container.(gardener.Container).NetInWithSpec(spec)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hostPort).To(BeEquivalentTo(60000))
+					Expect(containerPort).To(BeEquivalentTo(53))
+
+					_, actualHandle, actualSpec := networker.NetInArgsForCall(0)
+					Expect(actualHandle).To(Equal("banana"))
+					Expect(actualSpec).To(Equal(spec))
+				})
+			})
 		})
 
 		Describe("NetOut", func() {
@@ -543,6 +774,87 @@ var _ = Describe("Gardener", func() {
 				})
 			})
 		})
+
+		Describe("RemoveNetIn", func() {
+			var container gardener.Container
+
+			BeforeEach(func() {
+				c, err := gdnr.Lookup("banana")
+				Expect(err).NotTo(HaveOccurred())
+				container = c.(gardener.Container)
+			})
+
+			It("asks the networker to remove the port mapping", func() {
+				Expect(container.RemoveNetIn(8080, garden.ProtocolUDP)).To(Succeed())
+				Expect(networker.RemoveNetInCallCount()).To(Equal(1))
+
+				_, handle, hostPort, protocol := networker.RemoveNetInArgsForCall(0)
+				Expect(handle).To(Equal("banana"))
+				Expect(hostPort).To(BeEquivalentTo(8080))
+				Expect(protocol).To(Equal(garden.ProtocolUDP))
+			})
+
+			Context("when networker returns an error", func() {
+				It("returns the error", func() {
+					networker.RemoveNetInReturns(fmt.Errorf("banana republic"))
+					Expect(container.RemoveNetIn(8080, garden.ProtocolTCP)).To(MatchError("banana republic"))
+				})
+			})
+		})
+
+		Describe("NetOutRules", func() {
+			var container gardener.Container
+
+			BeforeEach(func() {
+				c, err := gdnr.Lookup("banana")
+				Expect(err).NotTo(HaveOccurred())
+				container = c.(gardener.Container)
+			})
+
+			It("returns the rules the networker has applied to the container", func() {
+				entries := []gardener.NetOutEntry{{ID: 1, Rule: garden.NetOutRule{Protocol: garden.ProtocolTCP}}}
+				networker.NetOutRulesReturns(entries, nil)
+
+				Expect(container.NetOutRules()).To(Equal(entries))
+
+				_, handle := networker.NetOutRulesArgsForCall(0)
+				Expect(handle).To(Equal("banana"))
+			})
+
+			Context("when networker returns an error", func() {
+				It("returns the error", func() {
+					networker.NetOutRulesReturns(nil, fmt.Errorf("banana republic"))
+					_, err := container.NetOutRules()
+					Expect(err).To(MatchError("banana republic"))
+				})
+			})
+		})
+
+		Describe("RemoveNetOut", func() {
+			var container gardener.Container
+
+			BeforeEach(func() {
+				c, err := gdnr.Lookup("banana")
+				Expect(err).NotTo(HaveOccurred())
+				container = c.(gardener.Container)
+			})
+
+			It("asks the networker to remove the rule", func() {
+				Expect(container.RemoveNetOut(3)).To(Succeed())
+				Expect(networker.RemoveNetOutCallCount()).To(Equal(1))
+
+				_, handle, id := networker.RemoveNetOutArgsForCall(0)
+				Expect(handle).To(Equal("banana"))
+				Expect(id).To(Equal(3))
+			})
+
+			Context("when networker returns an error", func() {
+				It("returns the error", func() {
+					networker.RemoveNetOutReturns(fmt.Errorf("banana republic"))
+					Expect(container.RemoveNetOut(3)).To(MatchError("banana republic"))
+				})
+			})
+		})
 	})
 
 	Context("when no containers exist", func() {
@@ -601,6 +913,32 @@ var _ = Describe("Gardener", func() {
 			Expect(propertyManager.DestroyKeySpaceArgsForCall(0)).To(Equal("some-handle"))
 		})
 
+		Context("when other containers share the container's network", func() {
+			BeforeEach(func() {
+				containerizer.HandlesReturns([]string{"some-handle", "sidecar-1", "other", "sidecar-2"}, nil)
+				propertyManager.GetStub = func(handle, name string) (string, error) {
+					if name == gardener.NetworkPeerKey && (handle == "sidecar-1" || handle == "sidecar-2") {
+						return "some-handle", nil
+					}
+
+					return "", errors.New("no such property")
+				}
+			})
+
+			It("refuses to destroy it", func() {
+				err := gdnr.Destroy("some-handle")
+				Expect(err).To(MatchError("container some-handle cannot be destroyed while containers share its network: sidecar-1, sidecar-2"))
+
+				Expect(containerizer.DestroyCallCount()).To(Equal(0))
+				Expect(networker.DestroyCallCount()).To(Equal(0))
+			})
+
+			It("destroys the sharers", func() {
+				Expect(gdnr.Destroy("sidecar-1")).To(Succeed())
+				Expect(containerizer.DestroyCallCount()).To(Equal(1))
+			})
+		})
+
 		Context("when containerizer fails to destroy the container", func() {
 			BeforeEach(func() {
 				containerizer.DestroyReturns(errors.New("containerized deletion failed"))
@@ -730,6 +1068,15 @@ var _ = Describe("Gardener", func() {
 			Expect(handle).To(Equal("some-handle"))
 			Expect(name).To(Equal("name"))
 		})
+
+		It("does not let clients set or remove reserved properties", func() {
+			Expect(container.SetProperty(gardener.NetworkPeerKey, "other-container")).To(MatchError("property garden.network.peer is reserved and cannot be set by clients"))
+			Expect(container.SetProperty("kawasaki.network-peer", "other-container")).To(MatchError("property kawasaki.network-peer is reserved and cannot be set by clients"))
+			Expect(container.RemoveProperty("kawasaki.network-mode")).To(MatchError("property kawasaki.network-mode is reserved and cannot be set by clients"))
+
+			Expect(propertyManager.SetCallCount()).To(Equal(0))
+			Expect(propertyManager.RemoveCallCount()).To(Equal(0))
+		})
 	})
 
 	Describe("Info", func() {
@@ -1052,3 +1399,20 @@ var _ = Describe("Gardener", func() {
 		})
 	})
 })
+
+type observingNetworker struct {
+	*fakes.FakeNetworker
+	created func(log lager.Logger, handle string) error
+}
+
+func (n observingNetworker) Created(log lager.Logger, handle string) error {
+	return n.created(log, handle)
+}
+
+type modeNetworker struct {
+	*fakes.FakeNetworker
+}
+
+func (modeNetworker) SupportsNetworkModes() bool {
+	return true
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -15,4 +16,34 @@ func main() {
 	if err := ioutil.WriteFile(os.Args[1], []byte(args), 0700); err != nil {
 		panic(err)
 	}
+
+	switch flagValue("--action") {
+	case "up":
+		result := `{"version":"1","container_ip":"10.255.10.10","properties":{"networkplugin.up":"true"}}`
+		if err := ioutil.WriteFile(flagValue("--result-file"), []byte(result), 0600); err != nil {
+			panic(err)
+		}
+	case "net-in":
+		fmt.Printf(`{"version":"1","host_port":%s,"container_port":%s}`, nonZero(flagValue("--host-port")), nonZero(flagValue("--container-port")))
+	case "net-out":
+		fmt.Print(`{"version":"1"}`)
+	}
+}
+
+func flagValue(name string) string {
+	for i, arg := range os.Args[:len(os.Args)-1] {
+		if arg == name {
+			return os.Args[i+1]
+		}
+	}
+
+	return ""
+}
+
+func nonZero(port string) string {
+	if port == "0" {
+		return "60000"
+	}
+
+	return port
 }
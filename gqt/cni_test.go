@@ -0,0 +1,120 @@
+package gqt_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/gqt/runner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+// These tests use the reference bridge and host-local CNI plugins, from the
+// directory in CNI_PLUGINS_DIR
+var _ = Describe("CNI networking", func() {
+	var (
+		client    *runner.RunningGarden
+		container garden.Container
+		configDir string
+	)
+
+	BeforeEach(func() {
+		pluginDir := os.Getenv("CNI_PLUGINS_DIR")
+		if pluginDir == "" {
+			Skip("CNI_PLUGINS_DIR undefined")
+		}
+
+		hookBin, err := gexec.Build("github.com/cloudfoundry-incubator/guardian/cmd/cni-hook")
+		Expect(err).NotTo(HaveOccurred())
+
+		configDir, err = ioutil.TempDir("", "cni-config")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(configDir, "10-gqt.conflist"), []byte(fmt.Sprintf(`{
+			"cniVersion": "0.3.1",
+			"name": "gqt-%d",
+			"plugins": [{
+				"type": "bridge",
+				"bridge": "gqtcni%d",
+				"isGateway": true,
+				"ipMasq": true,
+				"ipam": {
+					"type": "host-local",
+					"subnet": "10.244.%d.0/24",
+					"dataDir": "%s"
+				}
+			}]
+		}`, GinkgoParallelNode(), GinkgoParallelNode(), GinkgoParallelNode(), filepath.Join(configDir, "ipam"))), 0600)).To(Succeed())
+
+		client = startGarden(
+			"--cniConfigDir", configDir,
+			"--cniPluginDir", pluginDir,
+			"--cniHookBin", hookBin,
+		)
+
+		container, err = client.Create(garden.ContainerSpec{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if client != nil {
+			Expect(client.DestroyAndStop()).To(Succeed())
+		}
+
+		Expect(os.RemoveAll(configDir)).To(Succeed())
+	})
+
+	containerSubnet := func() string {
+		return fmt.Sprintf("10.244.%d.", GinkgoParallelNode())
+	}
+
+	It("records the IP assigned by the plugins in the container's info", func() {
+		info, err := container.Info()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(info.ContainerIP).To(HavePrefix(containerSubnet()))
+		Expect(info.HostIP).To(Equal(containerSubnet() + "1"))
+	})
+
+	It("configures the container's interface", func() {
+		info, err := container.Info()
+		Expect(err).NotTo(HaveOccurred())
+
+		buffer := gbytes.NewBuffer()
+		proc, err := container.Run(
+			garden.ProcessSpec{
+				Path: "ifconfig",
+				User: "root",
+			}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, buffer), Stderr: GinkgoWriter},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proc.Wait()).To(Equal(0))
+
+		Expect(buffer).To(gbytes.Say(info.ContainerIP))
+	})
+
+	It("is pingable", func() {
+		info, err := container.Info()
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := exec.Command("/bin/ping", "-c 2", info.ContainerIP).Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(ContainSubstring(" 0% packet loss"))
+	})
+
+	It("releases the container's IP when it is destroyed", func() {
+		info, err := container.Info()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Destroy(container.Handle())).To(Succeed())
+
+		Eventually(filepath.Join(configDir, "ipam", fmt.Sprintf("gqt-%d", GinkgoParallelNode()), info.ContainerIP)).ShouldNot(BeAnExistingFile())
+	})
+})
@@ -45,5 +45,17 @@ var _ = Describe("Garden API", func() {
 				Expect(capacity.MaxContainers).To(Equal(uint64(64)))
 			})
 		})
+
+		Context("when several network pools are given", func() {
+			BeforeEach(func() {
+				args = append(args, "--networkPool", "10.254.0.0/24", "--networkPool", "10.253.0.0/25")
+			})
+
+			It("returns the combined capacity of the subnet pools", func() {
+				capacity, err := client.Capacity()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(capacity.MaxContainers).To(Equal(uint64(96)))
+			})
+		})
 	})
 })
@@ -14,6 +14,7 @@ import (
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/guardian/gardener"
 	"github.com/cloudfoundry-incubator/guardian/gqt/runner"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -98,6 +99,142 @@ var _ = Describe("Net", func() {
 				),
 			)
 		})
+
+		It("stores the network plugin's result in the container's info", func() {
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(info.ContainerIP).To(Equal("10.255.10.10"))
+			Expect(info.Properties).To(HaveKeyWithValue("networkplugin.up", "true"))
+		})
+
+		It("maps ports using the network plugin", func() {
+			hostPort, containerPort, err := container.NetIn(0, 8080)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostPort).To(BeEquivalentTo(60000))
+			Expect(containerPort).To(BeEquivalentTo(8080))
+
+			info, err := container.Info()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.MappedPorts).To(ContainElement(garden.PortMapping{HostPort: 60000, ContainerPort: 8080}))
+		})
+	})
+
+	Context("when the container is in the none network mode", func() {
+		BeforeEach(func() {
+			containerNetwork = "none"
+		})
+
+		It("has only a loopback interface", func() {
+			buffer := gbytes.NewBuffer()
+			proc, err := container.Run(
+				garden.ProcessSpec{
+					Path: "sh",
+					Args: []string{"-c", "ls /sys/class/net"},
+					User: "root",
+				}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, buffer), Stderr: GinkgoWriter},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proc.Wait()).To(Equal(0))
+
+			Expect(strings.Fields(string(buffer.Contents()))).To(ConsistOf("lo"))
+		})
+
+		It("can be destroyed", func() {
+			Expect(client.Destroy(container.Handle())).To(Succeed())
+		})
+	})
+
+	Context("when a container is in the host network mode", func() {
+		It("shares the host's network interfaces when privileged", func() {
+			hostContainer, err := client.Create(garden.ContainerSpec{Network: "host", Privileged: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			// the host's first interface after loopback will be its physical
+			// one, rather than one created by another test
+			hostInterfaces, err := net.Interfaces()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(hostInterfaces)).To(BeNumerically(">", 1))
+
+			buffer := gbytes.NewBuffer()
+			proc, err := hostContainer.Run(
+				garden.ProcessSpec{
+					Path: "sh",
+					Args: []string{"-c", "ls /sys/class/net"},
+					User: "root",
+				}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, buffer), Stderr: GinkgoWriter},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proc.Wait()).To(Equal(0))
+
+			Expect(strings.Fields(string(buffer.Contents()))).To(ContainElement(hostInterfaces[1].Name))
+		})
+
+		It("is refused to unprivileged containers", func() {
+			_, err := client.Create(garden.ContainerSpec{Network: "host"})
+			Expect(err).To(MatchError(ContainSubstring("host networking is only available to privileged containers")))
+		})
+	})
+
+	Context("when a container shares another container's network", func() {
+		var sidecar garden.Container
+
+		JustBeforeEach(func() {
+			var err error
+			sidecar, err = client.Create(garden.ContainerSpec{
+				Network: "container:" + container.Handle(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			// the sharer must go before its peer can be destroyed
+			client.Destroy(sidecar.Handle())
+		})
+
+		It("reports the peer's address", func() {
+			Expect(containerIP(sidecar)).To(Equal(containerIP(container)))
+		})
+
+		It("can reach the peer's listeners on localhost", func() {
+			Expect(listenInContainer(container, 8080)).To(Succeed())
+
+			Eventually(func() error {
+				return checkConnection(sidecar, "127.0.0.1", 8080)
+			}).Should(Succeed())
+		})
+
+		It("refuses to destroy the peer while the sharer exists", func() {
+			Expect(client.Destroy(container.Handle())).To(MatchError(ContainSubstring("share its network")))
+
+			Expect(client.Destroy(sidecar.Handle())).To(Succeed())
+			Expect(client.Destroy(container.Handle())).To(Succeed())
+		})
+	})
+
+	Context("when the network spec is a JSON object", func() {
+		var expectedIP string
+
+		BeforeEach(func() {
+			expectedIP = ipAddress(containerNetwork, 5)
+			containerNetwork = fmt.Sprintf(`{"subnet": "%s", "ip": "%s", "mtu": 1400}`, containerNetwork, expectedIP)
+		})
+
+		It("gives the container the IP address and MTU it names", func() {
+			buffer := gbytes.NewBuffer()
+			proc, err := container.Run(
+				garden.ProcessSpec{
+					Path: "ifconfig",
+					User: "root",
+				}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, buffer), Stderr: GinkgoWriter},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proc.Wait()).To(Equal(0))
+
+			Expect(containerIP(container)).To(Equal(expectedIP))
+			Expect(buffer).To(gbytes.Say(expectedIP))
+			Expect(buffer).To(gbytes.Say("MTU:1400"))
+		})
 	})
 
 	Context("when the native (kawasaki) networker is used", func() {
@@ -192,6 +329,155 @@ var _ = Describe("Net", func() {
 			})
 		})
 
+		Context("when the container has a second network attachment", func() {
+			var managementNetwork string
+
+			BeforeEach(func() {
+				managementNetwork = fmt.Sprintf("192.168.%d.0/24", 100+GinkgoParallelNode())
+				containerNetwork = fmt.Sprintf("192.168.%d.0/24,%s", 12+GinkgoParallelNode(), managementNetwork)
+			})
+
+			It("has an address on each network", func() {
+				buffer := gbytes.NewBuffer()
+				proc, err := container.Run(
+					garden.ProcessSpec{
+						Path: "ifconfig",
+						User: "root",
+					}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, buffer), Stderr: GinkgoWriter},
+				)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(proc.Wait()).To(Equal(0))
+
+				Expect(buffer.Contents()).To(ContainSubstring(ipAddress(containerNetwork, 2)))
+				Expect(buffer.Contents()).To(ContainSubstring(ipAddress(managementNetwork, 2)))
+			})
+
+			It("is pingable on each network", func() {
+				for _, network := range []string{containerNetwork, managementNetwork} {
+					out, err := exec.Command("/bin/ping", "-c 2", ipAddress(network, 2)).Output()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(out).To(ContainSubstring(" 0% packet loss"))
+				}
+			})
+
+			It("routes by default via the first attachment", func() {
+				Expect(checkConnection(container, exampleDotCom.String(), 80)).To(Succeed())
+			})
+
+			It("records both attachments in the container's info", func() {
+				info, err := container.Info()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(info.ContainerIP).To(Equal(ipAddress(containerNetwork, 2)))
+				Expect(info.Properties[gardener.AttachmentsKey]).To(ContainSubstring(ipAddress(managementNetwork, 2)))
+			})
+		})
+
+		Context("when containers are in policy groups", func() {
+			var tenantA1, tenantA2, tenantB garden.Container
+
+			createInGroup := func(group string) garden.Container {
+				c, err := client.Create(garden.ContainerSpec{
+					Network:    containerNetwork,
+					Properties: garden.Properties{kawasaki.PolicyGroupProperty: group},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				return c
+			}
+
+			JustBeforeEach(func() {
+				tenantA1 = createInGroup("tenant-a")
+				tenantA2 = createInGroup("tenant-a")
+				tenantB = createInGroup("tenant-b")
+			})
+
+			AfterEach(func() {
+				for _, c := range []garden.Container{tenantA1, tenantA2, tenantB} {
+					Expect(client.Destroy(c.Handle())).To(Succeed())
+				}
+			})
+
+			It("allows connections between members of a group", func() {
+				Expect(listenInContainer(tenantA2, 8080)).To(Succeed())
+				Eventually(func() error { return checkConnection(tenantA1, containerIP(tenantA2), 8080) }).Should(Succeed())
+			})
+
+			It("drops connections to members of other groups", func() {
+				Expect(listenInContainer(tenantB, 8080)).To(Succeed())
+				Expect(checkConnection(tenantA1, containerIP(tenantB), 8080)).NotTo(Succeed())
+			})
+
+			It("drops connections to containers outside any group", func() {
+				Expect(listenInContainer(container, 8080)).To(Succeed())
+				Expect(checkConnection(tenantA1, containerIP(container), 8080)).NotTo(Succeed())
+			})
+
+			It("drops connections from containers outside any group", func() {
+				Expect(listenInContainer(tenantA1, 8080)).To(Succeed())
+				Expect(checkConnection(container, containerIP(tenantA1), 8080)).NotTo(Succeed())
+			})
+
+			Context("when a network policy allows one group to reach another", func() {
+				BeforeEach(func() {
+					args = append(args, "-networkPolicy", "tenant-a:tenant-b")
+				})
+
+				It("allows connections in the direction of the policy", func() {
+					Expect(listenInContainer(tenantB, 8080)).To(Succeed())
+					Eventually(func() error { return checkConnection(tenantA1, containerIP(tenantB), 8080) }).Should(Succeed())
+				})
+
+				It("still drops connections in the other direction", func() {
+					Expect(listenInContainer(tenantA1, 8080)).To(Succeed())
+					Expect(checkConnection(tenantB, containerIP(tenantA1), 8080)).NotTo(Succeed())
+				})
+			})
+		})
+
+		Context("when the embedded DNS responder is used", func() {
+			var peer garden.Container
+
+			BeforeEach(func() {
+				args = append(args, "-embeddedDNS", "-allowHostAccess=false")
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				peer, err = client.Create(garden.ContainerSpec{Network: containerNetwork})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(client.Destroy(peer.Handle())).To(Succeed())
+			})
+
+			It("answers queries through the default firewall", func() {
+				Eventually(func() (string, error) { return resolveInContainer(container, peer.Handle()) }).Should(ContainSubstring(containerIP(peer)))
+			})
+
+			Context("when the container's host access is denied by its properties", func() {
+				var denied garden.Container
+
+				JustBeforeEach(func() {
+					var err error
+					denied, err = client.Create(garden.ContainerSpec{
+						Network:    containerNetwork,
+						Properties: garden.Properties{kawasaki.HostAccessProperty: "false"},
+					})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					Expect(client.Destroy(denied.Handle())).To(Succeed())
+				})
+
+				It("still answers its queries", func() {
+					Eventually(func() (string, error) { return resolveInContainer(denied, peer.Handle()) }).Should(ContainSubstring(containerIP(peer)))
+				})
+			})
+		})
+
 		Context("when default network pool is changed", func() {
 			var (
 				otherContainer   garden.Container
@@ -229,6 +515,38 @@ var _ = Describe("Net", func() {
 				Expect(containerIP(otherContainer)).To(ContainSubstring("10.253."))
 			})
 
+			Context("when several network pools are given", func() {
+				BeforeEach(func() {
+					args = []string{"-networkPool", "10.253.0.0/30", "-networkPool", "10.253.1.0/30"}
+				})
+
+				It("vends IPs from the next pool once the first is full", func() {
+					Expect(containerIP(container)).To(Equal("10.253.0.2"))
+					Expect(containerIP(otherContainer)).To(Equal("10.253.1.2"))
+				})
+			})
+
+			Context("when released subnets cool down before being reused", func() {
+				BeforeEach(func() {
+					args = []string{"-networkPool", "10.253.0.0/28", "-networkPoolCooldown", "1h"}
+				})
+
+				It("does not reuse IP addresses straight away", func() {
+					Expect(containerIP(otherContainer)).NotTo(Equal(otherContainerIP))
+				})
+			})
+
+			Context("when part of the network pool is reserved", func() {
+				BeforeEach(func() {
+					args = []string{"-networkPool", "10.253.0.0/28", "-networkPoolReserved", "10.253.0.0/29"}
+				})
+
+				It("vends IPs from outside the reserved range", func() {
+					Expect(containerIP(container)).To(Equal("10.253.0.10"))
+					Expect(containerIP(otherContainer)).To(Equal("10.253.0.14"))
+				})
+			})
+
 			It("is accessible from the outside", func() {
 				hostPort, containerPort, err := otherContainer.NetIn(0, 4321)
 				Expect(err).ToNot(HaveOccurred())
@@ -416,6 +734,29 @@ func checkConnection(container garden.Container, ip string, port int) error {
 	}
 }
 
+func resolveInContainer(container garden.Container, name string) (string, error) {
+	stdout := gbytes.NewBuffer()
+	process, err := container.Run(garden.ProcessSpec{
+		User: "alice",
+		Path: "nslookup",
+		Args: []string{name},
+	}, garden.ProcessIO{Stdout: io.MultiWriter(GinkgoWriter, stdout), Stderr: GinkgoWriter})
+	if err != nil {
+		return "", err
+	}
+
+	exitCode, err := process.Wait()
+	if err != nil {
+		return "", err
+	}
+
+	if exitCode != 0 {
+		return "", fmt.Errorf("nslookup failed. Process exited with code %d", exitCode)
+	}
+
+	return string(stdout.Contents()), nil
+}
+
 func ipAddress(subnet string, index int) string {
 	ip := strings.Split(subnet, "/")[0]
 	pattern := regexp.MustCompile(".[0-9]+$")
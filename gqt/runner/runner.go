@@ -162,6 +162,7 @@ func cmd(tmpdir, depotDir, graphPath, network, addr, bin, initBin, kawasakiBin,
 	gardenArgs = appendDefaultFlag(gardenArgs, "--listenNetwork", network)
 	gardenArgs = appendDefaultFlag(gardenArgs, "--listenAddr", addr)
 	gardenArgs = appendDefaultFlag(gardenArgs, "--depot", depotDir)
+	gardenArgs = appendDefaultFlag(gardenArgs, "--stateDir", filepath.Join(tmpdir, "state"))
 	gardenArgs = appendDefaultFlag(gardenArgs, "--graph", graphPath)
 	gardenArgs = appendDefaultFlag(gardenArgs, "--tag", fmt.Sprintf("%d", GinkgoParallelNode()))
 	gardenArgs = appendDefaultFlag(gardenArgs, "--initBin", initBin)
@@ -21,28 +21,49 @@ type IDGenerator interface {
 }
 
 type NetworkConfig struct {
-	HostIntf        string
-	ContainerIntf   string
-	IPTablePrefix   string
-	IPTableInstance string
-	BridgeName      string
-	BridgeIP        net.IP
-	ContainerIP     net.IP
-	ExternalIP      net.IP
-	Subnet          *net.IPNet
-	Mtu             int
-	DNSServers      []net.IP
+	ContainerHandle  string
+	HostIntf         string
+	ContainerIntf    string
+	IPTablePrefix    string
+	IPTableInstance  string
+	IPTableLogMethod string
+	FirewallBackend  string
+	BridgeName       string
+	BridgeIP         net.IP
+	ContainerIP      net.IP
+	ExternalIP       net.IP
+	Subnet           *net.IPNet
+	IPv6Pool         *net.IPNet
+	BridgeIPv6       net.IP
+	ContainerIPv6    net.IP
+	SubnetIPv6       *net.IPNet
+	Mtu              int
+	DNSServers       []net.IP
+
+	// NoDefaultRoute is set for a container's additional network attachments,
+	// as the container's default route is via its first attachment
+	NoDefaultRoute bool
+
+	// PolicyGroup is the policy group the container belongs to, if any
+	PolicyGroup string
+
+	// Overrides are the container's exceptions to the firewall settings
+	// which apply to all containers
+	Overrides FirewallOverrides
 }
 
 type Creator struct {
 	idGenerator     IDGenerator
 	interfacePrefix string
 	chainPrefix     string
+	firewallBackend string
+	logMethod       string
 	externalIP      net.IP
+	ipv6Pool        *net.IPNet
 	dnsServers      []net.IP
 }
 
-func NewConfigCreator(idGenerator IDGenerator, interfacePrefix, chainPrefix string, externalIP net.IP, dnsServers []net.IP) *Creator {
+func NewConfigCreator(idGenerator IDGenerator, interfacePrefix, chainPrefix, firewallBackend, logMethod string, externalIP net.IP, ipv6Pool *net.IPNet, dnsServers []net.IP) *Creator {
 	if len(interfacePrefix) > maxInterfacePrefixLen {
 		panic("interface prefix is too long")
 	}
@@ -55,24 +76,51 @@ func NewConfigCreator(idGenerator IDGenerator, interfacePrefix, chainPrefix stri
 		idGenerator:     idGenerator,
 		interfacePrefix: interfacePrefix,
 		chainPrefix:     chainPrefix,
+		firewallBackend: firewallBackend,
+		logMethod:       logMethod,
 		externalIP:      externalIP,
+		ipv6Pool:        ipv6Pool,
 		dnsServers:      dnsServers,
 	}
 }
 
+// FirewallBackend returns the backend the configs' firewall rules are added
+// with
+func (c *Creator) FirewallBackend() string {
+	return c.firewallBackend
+}
+
+// IPv6Pool returns the pool the configs' IPv6 addresses are taken from, or nil
+// if containers have no IPv6 addresses
+func (c *Creator) IPv6Pool() *net.IPNet {
+	return c.ipv6Pool
+}
+
 func (c *Creator) Create(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP) (NetworkConfig, error) {
 	id := c.idGenerator.Generate()
-	return NetworkConfig{
-		HostIntf:        fmt.Sprintf("%s%s-0", c.interfacePrefix, id),
-		ContainerIntf:   fmt.Sprintf("%s%s-1", c.interfacePrefix, id),
-		BridgeName:      fmt.Sprintf("%s%s", c.interfacePrefix, strings.Replace(subnet.IP.String(), ".", "-", -1)),
-		IPTablePrefix:   c.chainPrefix,
-		IPTableInstance: id,
-		ContainerIP:     ip,
-		BridgeIP:        subnets.GatewayIP(subnet),
-		ExternalIP:      c.externalIP,
-		Subnet:          subnet,
-		Mtu:             1500,
-		DNSServers:      c.dnsServers,
-	}, nil
+	config := NetworkConfig{
+		ContainerHandle:  handle,
+		HostIntf:         fmt.Sprintf("%s%s-0", c.interfacePrefix, id),
+		ContainerIntf:    fmt.Sprintf("%s%s-1", c.interfacePrefix, id),
+		BridgeName:       fmt.Sprintf("%s%s", c.interfacePrefix, strings.Replace(subnet.IP.String(), ".", "-", -1)),
+		IPTablePrefix:    c.chainPrefix,
+		IPTableInstance:  id,
+		IPTableLogMethod: c.logMethod,
+		FirewallBackend:  c.firewallBackend,
+		ContainerIP:      ip,
+		BridgeIP:         subnets.GatewayIP(subnet),
+		ExternalIP:       c.externalIP,
+		Subnet:           subnet,
+		Mtu:              1500,
+		DNSServers:       c.dnsServers,
+	}
+
+	if c.ipv6Pool != nil {
+		config.IPv6Pool = c.ipv6Pool
+		config.SubnetIPv6 = subnets.IPv6Subnet(c.ipv6Pool, subnet)
+		config.BridgeIPv6 = subnets.IPv6Address(c.ipv6Pool, config.BridgeIP)
+		config.ContainerIPv6 = subnets.IPv6Address(c.ipv6Pool, ip)
+	}
+
+	return config, nil
 }
@@ -36,21 +36,25 @@ var _ = Describe("ConfigCreator", func() {
 		logger = lagertest.NewTestLogger("test")
 		idGenerator = &fakes.FakeIDGenerator{}
 
-		creator = kawasaki.NewConfigCreator(idGenerator, "w1", "0123456789abcdef", externalIP, dnsServers)
+		creator = kawasaki.NewConfigCreator(idGenerator, "w1", "0123456789abcdef", "nftables", "nflog", externalIP, nil, dnsServers)
 	})
 
 	It("panics if the interface prefix is longer than 2 characters", func() {
 		Expect(func() {
-			kawasaki.NewConfigCreator(idGenerator, "too-long", "wc", externalIP, dnsServers)
+			kawasaki.NewConfigCreator(idGenerator, "too-long", "wc", "nftables", "nflog", externalIP, nil, dnsServers)
 		}).To(Panic())
 	})
 
 	It("panics if the chain prefix is longer than 16 characters", func() {
 		Expect(func() {
-			kawasaki.NewConfigCreator(idGenerator, "w1", "0123456789abcdefg", externalIP, dnsServers)
+			kawasaki.NewConfigCreator(idGenerator, "w1", "0123456789abcdefg", "nftables", "nflog", externalIP, nil, dnsServers)
 		}).To(Panic())
 	})
 
+	It("returns the firewall backend", func() {
+		Expect(creator.FirewallBackend()).To(Equal("nftables"))
+	})
+
 	It("assigns the bridge name based on the subnet", func() {
 		config, err := creator.Create(logger, "banana", subnet, ip)
 		Expect(err).NotTo(HaveOccurred())
@@ -86,6 +90,27 @@ var _ = Describe("ConfigCreator", func() {
 		Expect(config.IPTableInstance).To(Equal("cocacola"))
 	})
 
+	It("saves the handle", func() {
+		config, err := creator.Create(logger, "banana", subnet, ip)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.ContainerHandle).To(Equal("banana"))
+	})
+
+	It("assigns the iptables log method", func() {
+		config, err := creator.Create(logger, "banana", subnet, ip)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.IPTableLogMethod).To(Equal("nflog"))
+	})
+
+	It("assigns the firewall backend", func() {
+		config, err := creator.Create(logger, "banana", subnet, ip)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.FirewallBackend).To(Equal("nftables"))
+	})
+
 	It("only generates 1 ID per invocation", func() {
 		_, err := creator.Create(logger, "bananashmanana", subnet, ip)
 		Expect(err).NotTo(HaveOccurred())
@@ -115,6 +140,38 @@ var _ = Describe("ConfigCreator", func() {
 		Expect(config.BridgeIP.String()).To(Equal("192.168.12.1"))
 	})
 
+	It("does not assign IPv6 addresses by default", func() {
+		config, err := creator.Create(logger, "banana", subnet, ip)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.IPv6Pool).To(BeNil())
+		Expect(config.ContainerIPv6).To(BeNil())
+		Expect(config.BridgeIPv6).To(BeNil())
+		Expect(config.SubnetIPv6).To(BeNil())
+	})
+
+	Context("when an IPv6 pool is configured", func() {
+		var ipv6Pool *net.IPNet
+
+		BeforeEach(func() {
+			var err error
+			_, ipv6Pool, err = net.ParseCIDR("fd00::/64")
+			Expect(err).NotTo(HaveOccurred())
+
+			creator = kawasaki.NewConfigCreator(idGenerator, "w1", "0123456789abcdef", "nftables", "nflog", externalIP, ipv6Pool, dnsServers)
+		})
+
+		It("assigns IPv6 addresses corresponding to the IPv4 ones", func() {
+			config, err := creator.Create(logger, "banana", subnet, ip)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(config.IPv6Pool).To(Equal(ipv6Pool))
+			Expect(config.ContainerIPv6.String()).To(Equal("fd00::c0a8:c14"))
+			Expect(config.BridgeIPv6.String()).To(Equal("fd00::c0a8:c01"))
+			Expect(config.SubnetIPv6.String()).To(Equal("fd00::c0a8:c00/120"))
+		})
+	})
+
 	It("hard-codes the MTU to 1500", func() {
 		config, err := creator.Create(logger, "banana", subnet, ip)
 		Expect(err).NotTo(HaveOccurred())
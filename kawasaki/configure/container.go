@@ -18,23 +18,33 @@ type Container struct {
 }
 
 func (c *Container) Apply(log lager.Logger, config kawasaki.NetworkConfig) error {
-	return c.configureContainerIntf(
+	if err := c.configureContainerIntf(
 		log,
 		config.ContainerIntf,
 		config.ContainerIP,
 		config.BridgeIP,
 		config.Subnet,
 		config.Mtu,
-	)
+		!config.NoDefaultRoute,
+	); err != nil {
+		return err
+	}
+
+	if config.ContainerIPv6 == nil {
+		return nil
+	}
+
+	return c.configureContainerIPv6(log, config.ContainerIntf, config.ContainerIPv6, config.BridgeIPv6, config.SubnetIPv6, !config.NoDefaultRoute)
 }
 
-func (c *Container) configureContainerIntf(log lager.Logger, name string, ip, gatewayIP net.IP, subnet *net.IPNet, mtu int) (err error) {
+func (c *Container) configureContainerIntf(log lager.Logger, name string, ip, gatewayIP net.IP, subnet *net.IPNet, mtu int, defaultRoute bool) (err error) {
 	cLog := log.Session("configure-container", lager.Data{
-		"name":    name,
-		"ip":      ip,
-		"gateway": gatewayIP,
-		"subnet":  subnet,
-		"mtu":     mtu,
+		"name":         name,
+		"ip":           ip,
+		"gateway":      gatewayIP,
+		"subnet":       subnet,
+		"mtu":          mtu,
+		"defaultRoute": defaultRoute,
 	})
 
 	cLog.Debug("start")
@@ -53,8 +63,10 @@ func (c *Container) configureContainerIntf(log lager.Logger, name string, ip, ga
 		return &LinkUpError{err, intf, "container"}
 	}
 
-	if err := c.Link.AddDefaultGW(intf, gatewayIP); err != nil {
-		return &ConfigureDefaultGWError{err, intf, gatewayIP}
+	if defaultRoute {
+		if err := c.Link.AddDefaultGW(intf, gatewayIP); err != nil {
+			return &ConfigureDefaultGWError{err, intf, gatewayIP}
+		}
 	}
 
 	if err := c.Link.SetMTU(intf, mtu); err != nil {
@@ -65,6 +77,37 @@ func (c *Container) configureContainerIntf(log lager.Logger, name string, ip, ga
 	return nil
 }
 
+func (c *Container) configureContainerIPv6(log lager.Logger, name string, ip, gatewayIP net.IP, subnet *net.IPNet, defaultRoute bool) (err error) {
+	cLog := log.Session("configure-container-ipv6", lager.Data{
+		"name":         name,
+		"ip":           ip,
+		"gateway":      gatewayIP,
+		"subnet":       subnet,
+		"defaultRoute": defaultRoute,
+	})
+
+	cLog.Debug("start")
+
+	var found bool
+	var intf *net.Interface
+	if intf, found, err = c.Link.InterfaceByName(name); !found || err != nil {
+		return &FindLinkError{err, "container", name}
+	}
+
+	if err := c.Link.AddIP(intf, ip, subnet); err != nil {
+		return &ConfigureLinkError{err, "container", intf, ip, subnet}
+	}
+
+	if defaultRoute {
+		if err := c.Link.AddDefaultGW(intf, gatewayIP); err != nil {
+			return &ConfigureDefaultGWError{err, intf, gatewayIP}
+		}
+	}
+
+	cLog.Debug("done")
+	return nil
+}
+
 func (c *Container) configureLoopbackIntf() (err error) {
 	var found bool
 	var lo *net.Interface
@@ -144,5 +144,64 @@ var _ = Describe("Container", func() {
 				Expect(err).To(MatchError(&configure.ConfigureDefaultGWError{Cause: linkApplyr.AddDefaultGWReturns, Interface: &net.Interface{Name: "foo"}, IP: net.ParseIP("2.3.4.5")}))
 			})
 		})
+
+		Context("when the config is for an additional attachment", func() {
+			BeforeEach(func() {
+				config.ContainerIntf = "foo"
+				config.BridgeIP = net.ParseIP("2.3.4.5")
+				config.NoDefaultRoute = true
+			})
+
+			AfterEach(func() {
+				config = kawasaki.NetworkConfig{}
+			})
+
+			It("does not add a default gateway", func() {
+				Expect(configurer.Apply(logger, config)).To(Succeed())
+				Expect(linkApplyr.AddDefaultGWCalledWith.Interface).To(BeNil())
+			})
+
+			It("still brings the link up", func() {
+				Expect(configurer.Apply(logger, config)).To(Succeed())
+				Expect(linkApplyr.SetUpCalledWith).To(ContainElement(&net.Interface{Name: "foo"}))
+			})
+		})
+
+		Context("when the config has an IPv6 address", func() {
+			BeforeEach(func() {
+				config.ContainerIntf = "foo"
+				config.ContainerIP, config.Subnet, _ = net.ParseCIDR("2.3.4.5/30")
+				config.BridgeIP = net.ParseIP("2.3.4.5")
+				config.ContainerIPv6, config.SubnetIPv6, _ = net.ParseCIDR("fd00::203:405/126")
+				config.BridgeIPv6 = net.ParseIP("fd00::203:406")
+			})
+
+			AfterEach(func() {
+				config = kawasaki.NetworkConfig{}
+			})
+
+			It("adds it alongside the IPv4 address", func() {
+				Expect(configurer.Apply(logger, config)).To(Succeed())
+				Expect(linkApplyr.AddIPCalledWith).To(ContainElement(fakedevices.InterfaceIPAndSubnet{
+					Interface: &net.Interface{Name: "foo"},
+					IP:        config.ContainerIPv6,
+					Subnet:    config.SubnetIPv6,
+				}))
+			})
+
+			It("adds an IPv6 default gateway via the bridge", func() {
+				Expect(configurer.Apply(logger, config)).To(Succeed())
+				Expect(linkApplyr.AddDefaultGWCalledWith.IP).To(Equal(net.ParseIP("fd00::203:406")))
+			})
+
+			Context("when adding the IPv6 default gateway fails", func() {
+				It("returns a wrapped error", func() {
+					linkApplyr.AddDefaultGWReturns = errors.New("potato")
+
+					err := configurer.Apply(logger, config)
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
 	})
 })
@@ -14,6 +14,7 @@ type Host struct {
 	}
 
 	Link interface {
+		AddIP(intf *net.Interface, ip net.IP, subnet *net.IPNet) error
 		SetUp(intf *net.Interface) error
 		SetMTU(intf *net.Interface, mtu int) error
 		SetNs(intf *net.Interface, fd int) error
@@ -47,7 +48,7 @@ func (c *Host) Apply(logger lager.Logger, config kawasaki.NetworkConfig, netns *
 
 	cLog.Debug("configuring")
 
-	if bridge, err = c.configureBridgeIntf(cLog, config.BridgeName, config.BridgeIP, config.Subnet); err != nil {
+	if bridge, err = c.configureBridgeIntf(cLog, config); err != nil {
 		return err
 	}
 
@@ -71,17 +72,27 @@ func (c *Host) Destroy(config kawasaki.NetworkConfig) error {
 	return c.Bridge.Destroy(config.BridgeName)
 }
 
-func (c *Host) configureBridgeIntf(log lager.Logger, name string, ip net.IP, subnet *net.IPNet) (*net.Interface, error) {
+func (c *Host) configureBridgeIntf(log lager.Logger, config kawasaki.NetworkConfig) (*net.Interface, error) {
 	log = log.Session("bridge-interface")
 
 	log.Debug("find")
-	bridge, bridgeExists, err := c.Link.InterfaceByName(name)
+	bridge, bridgeExists, err := c.Link.InterfaceByName(config.BridgeName)
 	if err != nil || !bridgeExists {
-		bridge, err = c.Bridge.Create(name, ip, subnet)
+		bridge, err = c.Bridge.Create(config.BridgeName, config.BridgeIP, config.Subnet)
 		if err != nil {
 			log.Error("create", err)
 			return nil, err
 		}
+
+		// containers on an existing bridge share its IPv6 subnet, so the address
+		// only needs adding when the bridge is created
+		if config.BridgeIPv6 != nil {
+			log.Debug("add-ipv6")
+			if err = c.Link.AddIP(bridge, config.BridgeIPv6, config.SubnetIPv6); err != nil {
+				log.Error("add-ipv6", err)
+				return nil, &ConfigureLinkError{err, "bridge", bridge, config.BridgeIPv6, config.SubnetIPv6}
+			}
+		}
 	}
 
 	log.Debug("bring-up")
@@ -158,6 +158,42 @@ var _ = Describe("Host", func() {
 						Expect(bridger.AddCalledWith.Bridge).To(Equal(createdBridge))
 					})
 
+					Context("and the config has an IPv6 bridge address", func() {
+						BeforeEach(func() {
+							config.BridgeName = "banana-bridge"
+							config.BridgeIPv6 = net.ParseIP("fd00::a01:1")
+							_, config.SubnetIPv6, _ = net.ParseCIDR("fd00::a01:0/126")
+						})
+
+						It("adds it to the created bridge", func() {
+							createdBridge := &net.Interface{Name: "created"}
+							bridger.CreateReturns.Interface = createdBridge
+
+							Expect(configurer.Apply(logger, config, netnsFD)).To(Succeed())
+							Expect(linkConfigurer.AddIPCalledWith).To(ConsistOf(fakedevices.InterfaceIPAndSubnet{
+								Interface: createdBridge,
+								IP:        config.BridgeIPv6,
+								Subnet:    config.SubnetIPv6,
+							}))
+						})
+
+						Context("when adding the address fails", func() {
+							It("returns a wrapped error", func() {
+								createdBridge := &net.Interface{Name: "created"}
+								bridger.CreateReturns.Interface = createdBridge
+								linkConfigurer.AddIPReturns["created"] = errors.New("no v6 for you")
+
+								Expect(configurer.Apply(logger, config, netnsFD)).To(MatchError(&configure.ConfigureLinkError{
+									Cause:          errors.New("no v6 for you"),
+									Role:           "bridge",
+									Interface:      createdBridge,
+									IntendedIP:     config.BridgeIPv6,
+									IntendedSubnet: config.SubnetIPv6,
+								}))
+							})
+						})
+					})
+
 					Context("but if creating the bridge fails", func() {
 						It("returns an error", func() {
 							bridger.CreateReturns.Error = errors.New("kawasaki!")
@@ -175,6 +211,13 @@ var _ = Describe("Host", func() {
 						Expect(bridger.AddCalledWith.Bridge).To(Equal(existingBridge))
 					})
 
+					It("does not add an IPv6 address to it", func() {
+						config.BridgeName = "bridge"
+						config.BridgeIPv6 = net.ParseIP("fd00::a01:1")
+						Expect(configurer.Apply(logger, config, netnsFD)).To(Succeed())
+						Expect(linkConfigurer.AddIPCalledWith).To(BeEmpty())
+					})
+
 					It("brings the host interface up", func() {
 						config.BridgeName = "bridge"
 						Expect(configurer.Apply(logger, config, netnsFD)).To(Succeed())
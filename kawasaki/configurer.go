@@ -16,6 +16,7 @@ type configurer struct {
 	hostConfigurer       HostConfigurer
 	containerApplier     ContainerApplier
 	instanceChainCreator InstanceChainCreator
+	policyGroups         PolicyGroupEnforcer
 	nsExecer             NetnsExecer
 }
 
@@ -27,8 +28,12 @@ type HostConfigurer interface {
 
 //go:generate counterfeiter . InstanceChainCreator
 type InstanceChainCreator interface {
-	Create(logger lager.Logger, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error
+	Create(logger lager.Logger, handle, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error
 	Destroy(logger lager.Logger, instanceChain string) error
+
+	// Override applies a container's firewall overrides once its chains
+	// exist. Destroy removes them along with the chains.
+	Override(logger lager.Logger, instanceChain, bridgeName string, ip net.IP, overrides FirewallOverrides) error
 }
 
 //go:generate counterfeiter . ContainerApplier
@@ -36,11 +41,12 @@ type ContainerApplier interface {
 	Apply(logger lager.Logger, cfg NetworkConfig) error
 }
 
-func NewConfigurer(hostConfigurer HostConfigurer, containerApplier ContainerApplier, instanceChainCreator InstanceChainCreator, nsExecer NetnsExecer) *configurer {
+func NewConfigurer(hostConfigurer HostConfigurer, containerApplier ContainerApplier, instanceChainCreator InstanceChainCreator, policyGroups PolicyGroupEnforcer, nsExecer NetnsExecer) *configurer {
 	return &configurer{
 		hostConfigurer:       hostConfigurer,
 		containerApplier:     containerApplier,
 		instanceChainCreator: instanceChainCreator,
+		policyGroups:         policyGroups,
 		nsExecer:             nsExecer,
 	}
 }
@@ -56,16 +62,34 @@ func (c *configurer) Apply(log lager.Logger, cfg NetworkConfig, nsPath string) e
 		return err
 	}
 
-	if err := c.instanceChainCreator.Create(log, cfg.IPTableInstance, cfg.BridgeName, cfg.ContainerIP, cfg.Subnet); err != nil {
+	if err := c.instanceChainCreator.Create(log, cfg.ContainerHandle, cfg.IPTableInstance, cfg.BridgeName, cfg.ContainerIP, cfg.Subnet); err != nil {
 		return err
 	}
 
+	if cfg.PolicyGroup != "" {
+		if err := c.policyGroups.Join(log, cfg.IPTableInstance, cfg.PolicyGroup, cfg.ContainerIP, cfg.Subnet); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.Overrides.empty() {
+		if err := c.instanceChainCreator.Override(log, cfg.IPTableInstance, cfg.BridgeName, cfg.ContainerIP, cfg.Overrides); err != nil {
+			return err
+		}
+	}
+
 	return c.nsExecer.Exec(fd, func() error {
 		return c.containerApplier.Apply(log, cfg)
 	})
 }
 
 func (c *configurer) Destroy(log lager.Logger, cfg NetworkConfig) error {
+	if cfg.PolicyGroup != "" {
+		if err := c.policyGroups.Leave(log, cfg.PolicyGroup, cfg.ContainerIP); err != nil {
+			return err
+		}
+	}
+
 	if err := c.instanceChainCreator.Destroy(log, cfg.IPTableInstance); err != nil {
 		return err
 	}
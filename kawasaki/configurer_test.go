@@ -23,6 +23,7 @@ var _ = Describe("Configurer", func() {
 		fakeHostConfigurer         *fakes.FakeHostConfigurer
 		fakeContainerConfigApplier *fakes.FakeContainerApplier
 		fakeInstanceChainCreator   *fakes.FakeInstanceChainCreator
+		fakePolicyGroups           *fakes.FakePolicyGroupEnforcer
 		fakeNsExecer               *fakes.FakeNetnsExecer
 
 		netnsFD *os.File
@@ -36,13 +37,14 @@ var _ = Describe("Configurer", func() {
 		fakeHostConfigurer = new(fakes.FakeHostConfigurer)
 		fakeContainerConfigApplier = new(fakes.FakeContainerApplier)
 		fakeInstanceChainCreator = new(fakes.FakeInstanceChainCreator)
+		fakePolicyGroups = new(fakes.FakePolicyGroupEnforcer)
 
 		fakeNsExecer = new(fakes.FakeNetnsExecer)
 
 		var err error
 		netnsFD, err = ioutil.TempFile("", "")
 		Expect(err).NotTo(HaveOccurred())
-		configurer = kawasaki.NewConfigurer(fakeHostConfigurer, fakeContainerConfigApplier, fakeInstanceChainCreator, fakeNsExecer)
+		configurer = kawasaki.NewConfigurer(fakeHostConfigurer, fakeContainerConfigApplier, fakeInstanceChainCreator, fakePolicyGroups, fakeNsExecer)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -101,6 +103,7 @@ var _ = Describe("Configurer", func() {
 			It("applies the iptable configuration", func() {
 				_, subnet, _ := net.ParseCIDR("1.2.3.4/5")
 				cfg := kawasaki.NetworkConfig{
+					ContainerHandle: "some-handle",
 					IPTablePrefix:   "the-iptable",
 					IPTableInstance: "instance",
 					BridgeName:      "the-bridge-name",
@@ -110,13 +113,83 @@ var _ = Describe("Configurer", func() {
 
 				Expect(configurer.Apply(logger, cfg, netnsFD.Name())).To(Succeed())
 				Expect(fakeInstanceChainCreator.CreateCallCount()).To(Equal(1))
-				_, instanceChain, bridgeName, ip, subnet := fakeInstanceChainCreator.CreateArgsForCall(0)
+				_, handle, instanceChain, bridgeName, ip, subnet := fakeInstanceChainCreator.CreateArgsForCall(0)
+				Expect(handle).To(Equal("some-handle"))
 				Expect(instanceChain).To(Equal("instance"))
 				Expect(bridgeName).To(Equal("the-bridge-name"))
 				Expect(ip).To(Equal(net.ParseIP("1.2.3.4")))
 				Expect(subnet).To(Equal(subnet))
 			})
 
+			It("does not join a policy group when the container is not in one", func() {
+				Expect(configurer.Apply(logger, kawasaki.NetworkConfig{}, netnsFD.Name())).To(Succeed())
+				Expect(fakePolicyGroups.JoinCallCount()).To(Equal(0))
+			})
+
+			Context("when the container is in a policy group", func() {
+				var cfg kawasaki.NetworkConfig
+
+				BeforeEach(func() {
+					_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+					cfg = kawasaki.NetworkConfig{
+						IPTableInstance: "instance",
+						ContainerIP:     net.ParseIP("10.0.0.2"),
+						Subnet:          subnet,
+						PolicyGroup:     "tenant-a",
+					}
+				})
+
+				It("joins the group once the instance chains exist", func() {
+					fakePolicyGroups.JoinStub = func(lager.Logger, string, string, net.IP, *net.IPNet) error {
+						Expect(fakeInstanceChainCreator.CreateCallCount()).To(Equal(1))
+						return nil
+					}
+
+					Expect(configurer.Apply(logger, cfg, netnsFD.Name())).To(Succeed())
+
+					Expect(fakePolicyGroups.JoinCallCount()).To(Equal(1))
+					_, instance, group, ip, subnet := fakePolicyGroups.JoinArgsForCall(0)
+					Expect(instance).To(Equal("instance"))
+					Expect(group).To(Equal("tenant-a"))
+					Expect(ip).To(Equal(cfg.ContainerIP))
+					Expect(subnet).To(Equal(cfg.Subnet))
+				})
+
+				It("returns an error if joining the group fails", func() {
+					fakePolicyGroups.JoinReturns(errors.New("no-ipset"))
+					Expect(configurer.Apply(logger, cfg, netnsFD.Name())).To(MatchError("no-ipset"))
+					Expect(fakeNsExecer.ExecCallCount()).To(Equal(0))
+				})
+			})
+
+			It("applies the container's firewall overrides once the instance chains exist", func() {
+				fakeInstanceChainCreator.OverrideStub = func(lager.Logger, string, string, net.IP, kawasaki.FirewallOverrides) error {
+					Expect(fakeInstanceChainCreator.CreateCallCount()).To(Equal(1))
+					return nil
+				}
+
+				allow := true
+				cfg := kawasaki.NetworkConfig{
+					IPTableInstance: "instance",
+					BridgeName:      "the-bridge-name",
+					ContainerIP:     net.ParseIP("10.0.0.2"),
+					Overrides:       kawasaki.FirewallOverrides{HostAccess: &allow, DenyNetworks: []string{"10.1.0.0/16"}},
+				}
+				Expect(configurer.Apply(logger, cfg, netnsFD.Name())).To(Succeed())
+
+				Expect(fakeInstanceChainCreator.OverrideCallCount()).To(Equal(1))
+				_, instance, bridgeName, ip, overrides := fakeInstanceChainCreator.OverrideArgsForCall(0)
+				Expect(instance).To(Equal("instance"))
+				Expect(bridgeName).To(Equal("the-bridge-name"))
+				Expect(ip).To(Equal(net.ParseIP("10.0.0.2")))
+				Expect(overrides).To(Equal(cfg.Overrides))
+			})
+
+			It("does not apply overrides when the container has none", func() {
+				Expect(configurer.Apply(logger, kawasaki.NetworkConfig{}, netnsFD.Name())).To(Succeed())
+				Expect(fakeInstanceChainCreator.OverrideCallCount()).To(Equal(0))
+			})
+
 			Context("when applying IPTables configuration fails", func() {
 				It("returns the error", func() {
 					fakeInstanceChainCreator.CreateReturns(errors.New("oh no"))
@@ -189,6 +262,24 @@ var _ = Describe("Configurer", func() {
 			Expect(instance).To(Equal("sausages"))
 		})
 
+		It("leaves the container's policy group", func() {
+			cfg := kawasaki.NetworkConfig{
+				ContainerIP: net.ParseIP("10.0.0.2"),
+				PolicyGroup: "tenant-a",
+			}
+			Expect(configurer.Destroy(logger, cfg)).To(Succeed())
+
+			Expect(fakePolicyGroups.LeaveCallCount()).To(Equal(1))
+			_, group, ip := fakePolicyGroups.LeaveArgsForCall(0)
+			Expect(group).To(Equal("tenant-a"))
+			Expect(ip).To(Equal(net.ParseIP("10.0.0.2")))
+		})
+
+		It("does not leave a policy group when the container is not in one", func() {
+			Expect(configurer.Destroy(logger, kawasaki.NetworkConfig{})).To(Succeed())
+			Expect(fakePolicyGroups.LeaveCallCount()).To(Equal(0))
+		})
+
 		Context("when the teardown of ip tables fail", func() {
 			BeforeEach(func() {
 				fakeInstanceChainCreator.DestroyReturns(errors.New("ananas is the best"))
@@ -52,21 +52,36 @@ func (Bridge) Add(bridge, slaveIf *net.Interface) error {
 	return netlink.LinkSetMaster(slave, master.(*netlink.Bridge))
 }
 
+// Destroy deletes the bridge, unless any interfaces are still attached to it.
+// A bridge may be shared by several containers, e.g. on a named network, so
+// it is only deleted once the last of their host interfaces has gone.
+// Destroying a bridge which does not exist succeeds, so Destroy is idempotent.
 func (Bridge) Destroy(bridge string) error {
 	netlinkMu.Lock()
 	defer netlinkMu.Unlock()
 
-	intfs, err := net.Interfaces()
+	links, err := netlink.LinkList()
 	if err != nil {
 		return err
 	}
 
-	for _, i := range intfs {
-		if i.Name == bridge {
-			link := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: bridge}}
-			return netlink.LinkDel(link)
+	var master netlink.Link
+	for _, link := range links {
+		if link.Attrs().Name == bridge {
+			master = link
+			break
 		}
 	}
 
-	return nil
+	if master == nil {
+		return nil
+	}
+
+	for _, link := range links {
+		if link.Attrs().MasterIndex == master.Attrs().Index {
+			return nil
+		}
+	}
+
+	return netlink.LinkDel(master)
 }
@@ -138,6 +138,46 @@ var _ = Describe("Bridge Management", func() {
 			})
 		})
 
+		Context("when interfaces are still attached to the bridge", func() {
+			var hostNames []string
+
+			BeforeEach(func() {
+				hostNames = []string{
+					fmt.Sprintf("gdn-test-h1-%d", GinkgoParallelNode()),
+					fmt.Sprintf("gdn-test-h2-%d", GinkgoParallelNode()),
+				}
+			})
+
+			AfterEach(func() {
+				for _, hostName := range hostNames {
+					cleanup(hostName)
+				}
+			})
+
+			It("deletes it only once the last of them has gone", func() {
+				br, err := b.Create(name, ip, subnet)
+				Expect(err).ToNot(HaveOccurred())
+
+				// two containers sharing the bridge
+				var v devices.VethCreator
+				for i, hostName := range hostNames {
+					host, _, err := v.Create(hostName, fmt.Sprintf("gdn-test-c%d-%d", i+1, GinkgoParallelNode()))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b.Add(br, host)).To(Succeed())
+				}
+
+				// the first container goes away
+				Expect(cleanup(hostNames[0])).To(Succeed())
+				Expect(b.Destroy(br.Name)).To(Succeed())
+				Expect(interfaceNames()).To(ContainElement(name))
+
+				// the second container goes away
+				Expect(cleanup(hostNames[1])).To(Succeed())
+				Expect(b.Destroy(br.Name)).To(Succeed())
+				Eventually(interfaceNames).ShouldNot(ContainElement(name))
+			})
+		})
+
 		Context("when the bridge does not exist", func() {
 			It("does not return an error (because Destroy should be idempotent)", func() {
 				Expect(b.Destroy("something")).To(Succeed())
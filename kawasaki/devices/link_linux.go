@@ -100,6 +100,33 @@ func (Link) InterfaceByName(name string) (*net.Interface, bool, error) {
 	return nil, false, nil
 }
 
+// DefaultInterface returns the name of the interface used by the first IPv4
+// default route, or an empty string if there is no default route
+func (Link) DefaultInterface() (string, error) {
+	netlinkMu.Lock()
+	defer netlinkMu.Unlock()
+
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return "", errF(err)
+	}
+
+	for _, route := range routes {
+		if route.Dst != nil {
+			continue
+		}
+
+		link, err := netlink.LinkByIndex(route.LinkIndex)
+		if err != nil {
+			return "", errF(err)
+		}
+
+		return link.Attrs().Name, nil
+	}
+
+	return "", nil
+}
+
 func (Link) List() (names []string, err error) {
 	netlinkMu.Lock()
 	defer netlinkMu.Unlock()
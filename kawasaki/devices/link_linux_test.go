@@ -5,6 +5,7 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/devices"
 	. "github.com/onsi/ginkgo"
@@ -177,6 +178,15 @@ var _ = Describe("Link Management", func() {
 		})
 	})
 
+	Describe("DefaultInterface", func() {
+		It("returns the interface of the default route", func() {
+			out, err := exec.Command("sh", "-c", "ip route show | grep default | cut -d' ' -f5 | head -1").Output()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l.DefaultInterface()).To(Equal(strings.TrimSpace(string(out))))
+		})
+	})
+
 	Describe("List", func() {
 		It("lists all the interfaces", func() {
 			names, err := l.List()
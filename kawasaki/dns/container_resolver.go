@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/pivotal-golang/lager"
+)
+
+// NamesProperty is the container property listing additional names,
+// separated by commas, which the container can be reached by from the other
+// containers on its subnet
+const NamesProperty = "dns.names"
+
+//go:generate counterfeiter . HandleLister
+
+type HandleLister interface {
+	Handles() ([]string, error)
+}
+
+//go:generate counterfeiter . PropertyGetter
+
+type PropertyGetter interface {
+	Get(handle string, name string) (string, error)
+}
+
+// ContainerResolver resolves the names of containers for the other containers
+// on the same subnet. A container is named by its handle and by any names in
+// its NamesProperty.
+type ContainerResolver struct {
+	Containers HandleLister
+	Properties PropertyGetter
+}
+
+type containerAddrs struct {
+	handle   string
+	bridgeIP string
+	ipv4     net.IP
+	ipv6     net.IP
+}
+
+// Resolve returns the IPv4 and IPv6 addresses of the container with the
+// given name on the same subnet as the container with the source IP. It
+// returns false if there is no such container.
+func (r *ContainerResolver) Resolve(log lager.Logger, name string, source net.IP) (ipv4, ipv6 net.IP, found bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return nil, nil, false
+	}
+
+	handles, err := r.Containers.Handles()
+	if err != nil {
+		log.Error("list-handles-failed", err)
+		return nil, nil, false
+	}
+
+	var containers []containerAddrs
+	var sourceBridge string
+	for _, handle := range handles {
+		addrs, ok := r.addrs(handle)
+		if !ok {
+			continue
+		}
+
+		if addrs.ipv4.Equal(source) || (addrs.ipv6 != nil && addrs.ipv6.Equal(source)) {
+			sourceBridge = addrs.bridgeIP
+		}
+
+		containers = append(containers, addrs)
+	}
+
+	if sourceBridge == "" {
+		return nil, nil, false
+	}
+
+	for _, container := range containers {
+		if container.bridgeIP != sourceBridge || !r.hasName(container.handle, name) {
+			continue
+		}
+
+		return container.ipv4, container.ipv6, true
+	}
+
+	return nil, nil, false
+}
+
+func (r *ContainerResolver) addrs(handle string) (containerAddrs, bool) {
+	containerIP, err := r.Properties.Get(handle, gardener.ContainerIPKey)
+	if err != nil || containerIP == "" {
+		return containerAddrs{}, false
+	}
+
+	bridgeIP, err := r.Properties.Get(handle, gardener.BridgeIPKey)
+	if err != nil || bridgeIP == "" {
+		return containerAddrs{}, false
+	}
+
+	addrs := containerAddrs{handle: handle, bridgeIP: bridgeIP, ipv4: net.ParseIP(containerIP)}
+	if containerIPv6, err := r.Properties.Get(handle, gardener.ContainerIPv6Key); err == nil && containerIPv6 != "" {
+		addrs.ipv6 = net.ParseIP(containerIPv6)
+	}
+
+	return addrs, true
+}
+
+func (r *ContainerResolver) hasName(handle, name string) bool {
+	if strings.ToLower(handle) == name {
+		return true
+	}
+
+	names, err := r.Properties.Get(handle, NamesProperty)
+	if err != nil {
+		return false
+	}
+
+	for _, n := range strings.Split(names, ",") {
+		if strings.ToLower(strings.TrimSpace(n)) == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package dns_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns/fakes"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ContainerResolver", func() {
+	var (
+		fakeHandleLister   *fakes.FakeHandleLister
+		fakePropertyGetter *fakes.FakePropertyGetter
+		properties         map[string]map[string]string
+		resolver           *dns.ContainerResolver
+		logger             *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		fakeHandleLister = new(fakes.FakeHandleLister)
+		fakePropertyGetter = new(fakes.FakePropertyGetter)
+		logger = lagertest.NewTestLogger("test")
+
+		properties = map[string]map[string]string{
+			"client": {
+				gardener.ContainerIPKey: "10.0.0.2",
+				gardener.BridgeIPKey:    "10.0.0.1",
+			},
+			"server": {
+				gardener.ContainerIPKey: "10.0.0.3",
+				gardener.BridgeIPKey:    "10.0.0.1",
+				dns.NamesProperty:       "db, Primary-DB",
+			},
+			"elsewhere": {
+				gardener.ContainerIPKey: "10.0.1.2",
+				gardener.BridgeIPKey:    "10.0.1.1",
+			},
+		}
+
+		fakeHandleLister.HandlesReturns([]string{"client", "server", "elsewhere", "plugin-networked"}, nil)
+		fakePropertyGetter.GetStub = func(handle, name string) (string, error) {
+			if value, ok := properties[handle][name]; ok {
+				return value, nil
+			}
+
+			return "", fmt.Errorf("no property %s", name)
+		}
+
+		resolver = &dns.ContainerResolver{
+			Containers: fakeHandleLister,
+			Properties: fakePropertyGetter,
+		}
+	})
+
+	It("resolves the handle of a container on the same subnet", func() {
+		ipv4, ipv6, found := resolver.Resolve(logger, "server.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeTrue())
+		Expect(ipv4).To(Equal(net.ParseIP("10.0.0.3")))
+		Expect(ipv6).To(BeNil())
+	})
+
+	It("resolves the names in the container's names property, ignoring case", func() {
+		ipv4, _, found := resolver.Resolve(logger, "primary-db.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeTrue())
+		Expect(ipv4).To(Equal(net.ParseIP("10.0.0.3")))
+
+		_, _, found = resolver.Resolve(logger, "db.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeTrue())
+	})
+
+	It("returns the container's IPv6 address when it has one", func() {
+		properties["server"][gardener.ContainerIPv6Key] = "fd00::a00:3"
+
+		_, ipv6, found := resolver.Resolve(logger, "server.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeTrue())
+		Expect(ipv6).To(Equal(net.ParseIP("fd00::a00:3")))
+	})
+
+	It("does not resolve containers on another subnet", func() {
+		_, _, found := resolver.Resolve(logger, "elsewhere.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeFalse())
+	})
+
+	It("does not resolve names for queries from outside of a container", func() {
+		_, _, found := resolver.Resolve(logger, "server.", net.ParseIP("192.168.0.1"))
+		Expect(found).To(BeFalse())
+	})
+
+	It("does not resolve unknown names", func() {
+		_, _, found := resolver.Resolve(logger, "example.com.", net.ParseIP("10.0.0.2"))
+		Expect(found).To(BeFalse())
+	})
+
+	Context("when listing the containers fails", func() {
+		It("does not resolve the name", func() {
+			fakeHandleLister.HandlesReturns(nil, errors.New("boom"))
+
+			_, _, found := resolver.Resolve(logger, "server.", net.ParseIP("10.0.0.2"))
+			Expect(found).To(BeFalse())
+		})
+	})
+})
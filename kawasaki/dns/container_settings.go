@@ -0,0 +1,60 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Container properties, each a list separated by commas, which customise the
+// hosts and resolv.conf files written into the container
+const (
+	// ExtraHostsProperty lists additional hosts entries as hostname:ip
+	ExtraHostsProperty = "dns.extra-hosts"
+
+	// ServersProperty lists the DNS servers for the container to use in place
+	// of the host's or the globally configured servers
+	ServersProperty = "dns.servers"
+
+	SearchDomainsProperty = "dns.search"
+	OptionsProperty       = "dns.options"
+)
+
+// HostEntry is an additional entry in a container's hosts file
+type HostEntry struct {
+	Hostname string
+	IP       net.IP
+}
+
+func (e HostEntry) String() string {
+	return fmt.Sprintf("%s:%s", e.Hostname, e.IP)
+}
+
+// ParseHostEntry parses a hostname:ip pair. The IP may be an IPv6 address,
+// as hostnames cannot contain colons.
+func ParseHostEntry(s string) (HostEntry, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return HostEntry{}, fmt.Errorf("invalid host entry '%s': must be hostname:ip", s)
+	}
+
+	ip := net.ParseIP(parts[1])
+	if ip == nil {
+		return HostEntry{}, fmt.Errorf("invalid host entry '%s': '%s' is not a valid IP address", s, parts[1])
+	}
+
+	return HostEntry{Hostname: parts[0], IP: ip}, nil
+}
+
+// SplitList splits the value of one of the list properties, dropping empty
+// elements
+func SplitList(value string) []string {
+	var list []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,46 @@
+package dns_test
+
+import (
+	"net"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseHostEntry", func() {
+	It("parses a hostname and IPv4 address", func() {
+		entry, err := dns.ParseHostEntry("db.internal:10.1.1.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Hostname).To(Equal("db.internal"))
+		Expect(entry.IP).To(Equal(net.ParseIP("10.1.1.1")))
+	})
+
+	It("parses a hostname and IPv6 address", func() {
+		entry, err := dns.ParseHostEntry("db.internal:fd00::1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.IP).To(Equal(net.ParseIP("fd00::1")))
+		Expect(entry.String()).To(Equal("db.internal:fd00::1"))
+	})
+
+	It("returns an error when there is no hostname", func() {
+		_, err := dns.ParseHostEntry(":10.1.1.1")
+		Expect(err).To(MatchError("invalid host entry ':10.1.1.1': must be hostname:ip"))
+	})
+
+	It("returns an error when the IP is invalid", func() {
+		_, err := dns.ParseHostEntry("db.internal:banana")
+		Expect(err).To(MatchError("invalid host entry 'db.internal:banana': 'banana' is not a valid IP address"))
+	})
+})
+
+var _ = Describe("SplitList", func() {
+	It("splits on commas, trimming whitespace and dropping empty elements", func() {
+		Expect(dns.SplitList(" a.com, b.com,,")).To(Equal([]string{"a.com", "b.com"}))
+	})
+
+	It("returns nothing for an empty value", func() {
+		Expect(dns.SplitList("")).To(BeEmpty())
+	})
+})
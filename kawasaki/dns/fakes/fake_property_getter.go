@@ -0,0 +1,57 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
+)
+
+type FakePropertyGetter struct {
+	GetStub        func(handle string, name string) (string, error)
+	getMutex       sync.RWMutex
+	getArgsForCall []struct {
+		handle string
+		name   string
+	}
+	getReturns struct {
+		result1 string
+		result2 error
+	}
+}
+
+func (fake *FakePropertyGetter) Get(handle string, name string) (string, error) {
+	fake.getMutex.Lock()
+	fake.getArgsForCall = append(fake.getArgsForCall, struct {
+		handle string
+		name   string
+	}{handle, name})
+	fake.getMutex.Unlock()
+	if fake.GetStub != nil {
+		return fake.GetStub(handle, name)
+	} else {
+		return fake.getReturns.result1, fake.getReturns.result2
+	}
+}
+
+func (fake *FakePropertyGetter) GetCallCount() int {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return len(fake.getArgsForCall)
+}
+
+func (fake *FakePropertyGetter) GetArgsForCall(i int) (string, string) {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return fake.getArgsForCall[i].handle, fake.getArgsForCall[i].name
+}
+
+func (fake *FakePropertyGetter) GetReturns(result1 string, result2 error) {
+	fake.GetStub = nil
+	fake.getReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+var _ dns.PropertyGetter = new(FakePropertyGetter)
@@ -0,0 +1,63 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeResolver struct {
+	ResolveStub        func(log lager.Logger, name string, source net.IP) (net.IP, net.IP, bool)
+	resolveMutex       sync.RWMutex
+	resolveArgsForCall []struct {
+		log    lager.Logger
+		name   string
+		source net.IP
+	}
+	resolveReturns struct {
+		result1 net.IP
+		result2 net.IP
+		result3 bool
+	}
+}
+
+func (fake *FakeResolver) Resolve(log lager.Logger, name string, source net.IP) (net.IP, net.IP, bool) {
+	fake.resolveMutex.Lock()
+	fake.resolveArgsForCall = append(fake.resolveArgsForCall, struct {
+		log    lager.Logger
+		name   string
+		source net.IP
+	}{log, name, source})
+	fake.resolveMutex.Unlock()
+	if fake.ResolveStub != nil {
+		return fake.ResolveStub(log, name, source)
+	} else {
+		return fake.resolveReturns.result1, fake.resolveReturns.result2, fake.resolveReturns.result3
+	}
+}
+
+func (fake *FakeResolver) ResolveCallCount() int {
+	fake.resolveMutex.RLock()
+	defer fake.resolveMutex.RUnlock()
+	return len(fake.resolveArgsForCall)
+}
+
+func (fake *FakeResolver) ResolveArgsForCall(i int) (lager.Logger, string, net.IP) {
+	fake.resolveMutex.RLock()
+	defer fake.resolveMutex.RUnlock()
+	return fake.resolveArgsForCall[i].log, fake.resolveArgsForCall[i].name, fake.resolveArgsForCall[i].source
+}
+
+func (fake *FakeResolver) ResolveReturns(result1 net.IP, result2 net.IP, result3 bool) {
+	fake.ResolveStub = nil
+	fake.resolveReturns = struct {
+		result1 net.IP
+		result2 net.IP
+		result3 bool
+	}{result1, result2, result3}
+}
+
+var _ dns.Resolver = new(FakeResolver)
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 
@@ -8,11 +9,18 @@ import (
 )
 
 type HostsFileCompiler struct {
-	Handle string
-	IP     net.IP
+	Handle     string
+	IP         net.IP
+	ExtraHosts []HostEntry
 }
 
 func (h *HostsFileCompiler) Compile(log lager.Logger) ([]byte, error) {
-	contents := fmt.Sprintf("127.0.0.1 localhost\n%s %s\n", h.IP, h.Handle)
-	return []byte(contents), nil
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "127.0.0.1 localhost\n%s %s\n", h.IP, h.Handle)
+
+	for _, entry := range h.ExtraHosts {
+		fmt.Fprintf(&buf, "%s %s\n", entry.IP, entry.Hostname)
+	}
+
+	return buf.Bytes(), nil
 }
@@ -39,5 +39,16 @@ var _ = Describe("HostsFileCompiler", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(string(contents)).To(ContainSubstring("123.124.126.128 my-handle"))
 		})
+
+		It("should add any extra hosts after the hostname mapping", func() {
+			compiler.ExtraHosts = []HostEntry{
+				{Hostname: "db.internal", IP: net.ParseIP("10.1.1.1")},
+				{Hostname: "v6.internal", IP: net.ParseIP("fd00::1")},
+			}
+
+			contents, err := compiler.Compile(log)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("127.0.0.1 localhost\n123.124.126.128 my-handle\n10.1.1.1 db.internal\nfd00::1 v6.internal\n"))
+		})
 	})
 })
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"strings"
 
 	"github.com/pivotal-golang/lager"
 )
@@ -15,13 +16,47 @@ type ResolvFileCompiler struct {
 	HostResolvConfPath string
 	HostIP             net.IP
 	OverrideServers    []net.IP
+
+	// EmbeddedDNS makes the container use the DNS responder listening on
+	// HostIP, which forwards to any override servers itself
+	EmbeddedDNS bool
+
+	// SearchDomains and Options are appended to the resolv.conf, taking
+	// precedence over any search domains copied from the host
+	SearchDomains []string
+	Options       []string
 }
 
 func (r *ResolvFileCompiler) Compile(log lager.Logger) ([]byte, error) {
+	contents, err := r.compileNameservers(log)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(contents)
+	if len(contents) > 0 && !bytes.HasSuffix(contents, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	if len(r.SearchDomains) > 0 {
+		fmt.Fprintf(buf, "search %s\n", strings.Join(r.SearchDomains, " "))
+	}
+
+	if len(r.Options) > 0 {
+		fmt.Fprintf(buf, "options %s\n", strings.Join(r.Options, " "))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *ResolvFileCompiler) compileNameservers(log lager.Logger) ([]byte, error) {
 	log = log.Session("resolv-file-compile", lager.Data{
 		"HostResolvConfPath": r.HostResolvConfPath,
 		"HostIP":             r.HostIP,
 		"OverrideServers":    r.OverrideServers,
+		"EmbeddedDNS":        r.EmbeddedDNS,
+		"SearchDomains":      r.SearchDomains,
+		"Options":            r.Options,
 	})
 
 	f, err := os.Open(r.HostResolvConfPath)
@@ -37,6 +72,10 @@ func (r *ResolvFileCompiler) Compile(log lager.Logger) ([]byte, error) {
 		return nil, fmt.Errorf("reading file '%s': %s", r.HostResolvConfPath, err)
 	}
 
+	if r.EmbeddedDNS {
+		return []byte(fmt.Sprintf("nameserver %s\n", r.HostIP.String())), nil
+	}
+
 	if len(r.OverrideServers) > 0 {
 		var buf bytes.Buffer
 		for _, name := range r.OverrideServers {
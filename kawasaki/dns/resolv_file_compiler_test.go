@@ -78,6 +78,18 @@ var _ = Describe("ResolvFileCompiler", func() {
 			})
 		})
 
+		Context("and the embedded DNS responder is used", func() {
+			It("should make the container use the responder on the host IP, even with overrides", func() {
+				compiler.EmbeddedDNS = true
+				compiler.OverrideServers = []net.IP{net.ParseIP("8.8.8.8")}
+
+				contents, err := compiler.Compile(log)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(contents)).To(Equal("nameserver 254.253.252.251\n"))
+			})
+		})
+
 		Context("and the host is running DNS", func() {
 			BeforeEach(func() {
 				writeFile(hostResolvConfPath, "nameserver 127.0.0.1\n")
@@ -105,6 +117,45 @@ var _ = Describe("ResolvFileCompiler", func() {
 
 				Expect(string(contents)).To(Equal(resolvConfContents))
 			})
+
+			Context("and search domains and options are given", func() {
+				It("should append them to the host's resolv.conf", func() {
+					compiler.SearchDomains = []string{"svc.internal", "internal"}
+					compiler.Options = []string{"ndots:2", "rotate"}
+
+					contents, err := compiler.Compile(log)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(string(contents)).To(Equal(resolvConfContents + "search svc.internal internal\noptions ndots:2 rotate\n"))
+				})
+			})
+		})
+
+		Context("and the host's resolv.conf does not end with a newline", func() {
+			BeforeEach(func() {
+				writeFile(hostResolvConfPath, "nameserver 8.8.4.4")
+			})
+
+			It("should start the search domains on a new line", func() {
+				compiler.SearchDomains = []string{"internal"}
+
+				contents, err := compiler.Compile(log)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(contents)).To(Equal("nameserver 8.8.4.4\nsearch internal\n"))
+			})
+		})
+
+		Context("and options are given with the embedded DNS responder", func() {
+			It("should append them after the responder", func() {
+				compiler.EmbeddedDNS = true
+				compiler.Options = []string{"ndots:1"}
+
+				contents, err := compiler.Compile(log)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(contents)).To(Equal("nameserver 254.253.252.251\noptions ndots:1\n"))
+			})
 		})
 	})
 })
@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	mdns "github.com/miekg/dns"
+	"github.com/pivotal-golang/clock"
+	"github.com/pivotal-golang/lager"
+)
+
+// answerTTL is kept short as containers come and go
+const answerTTL = 5
+
+//go:generate counterfeiter . Resolver
+
+type Resolver interface {
+	Resolve(log lager.Logger, name string, source net.IP) (ipv4, ipv6 net.IP, found bool)
+}
+
+// Responder is a DNS server listening on the IP of each bridge which has
+// containers on it. It answers the names of the containers on the querying
+// container's subnet and forwards all other queries to the upstream servers.
+type Responder struct {
+	Resolver  Resolver
+	Upstreams []string // host:port
+	Port      int
+
+	// RetryInterval is how often to retry listening on a bridge IP, which will
+	// fail until the bridge has been created by the first container's network
+	// hook
+	RetryInterval time.Duration
+	Clock         clock.Clock
+	Logger        lager.Logger
+
+	bridges map[string]*bridgeListener
+	mu      sync.Mutex
+}
+
+type bridgeListener struct {
+	containers int
+	stop       chan struct{}
+	servers    []*mdns.Server
+	mu         sync.Mutex
+}
+
+func NewResponder(logger lager.Logger, resolver Resolver, upstreams []string) *Responder {
+	return &Responder{
+		Resolver:  resolver,
+		Upstreams: upstreams,
+		Port:      53,
+
+		RetryInterval: 100 * time.Millisecond,
+		Clock:         clock.NewClock(),
+		Logger:        logger.Session("dns-responder"),
+
+		bridges: map[string]*bridgeListener{},
+	}
+}
+
+// Add starts listening on the bridge IP, if a container on the bridge has
+// not already been added
+func (r *Responder) Add(log lager.Logger, bridgeIP net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bridge, ok := r.bridges[bridgeIP.String()]; ok {
+		bridge.containers++
+		return
+	}
+
+	bridge := &bridgeListener{containers: 1, stop: make(chan struct{})}
+	r.bridges[bridgeIP.String()] = bridge
+
+	go r.listen(log.Session("dns-listen", lager.Data{"bridgeIP": bridgeIP.String()}), bridge, bridgeIP)
+}
+
+// Remove stops listening on the bridge IP once all of the containers added on
+// the bridge have been removed
+func (r *Responder) Remove(log lager.Logger, bridgeIP net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bridge, ok := r.bridges[bridgeIP.String()]
+	if !ok {
+		return
+	}
+
+	bridge.containers--
+	if bridge.containers > 0 {
+		return
+	}
+
+	delete(r.bridges, bridgeIP.String())
+	close(bridge.stop)
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	for _, server := range bridge.servers {
+		if err := server.Shutdown(); err != nil {
+			log.Error("dns-shutdown-failed", err, lager.Data{"bridgeIP": bridgeIP.String()})
+		}
+	}
+}
+
+func (r *Responder) listen(log lager.Logger, bridge *bridgeListener, bridgeIP net.IP) {
+	addr := net.JoinHostPort(bridgeIP.String(), strconv.Itoa(r.Port))
+
+	for {
+		packetConn, listener, err := listenUDPAndTCP(addr)
+		if err == nil {
+			bridge.mu.Lock()
+			defer bridge.mu.Unlock()
+
+			select {
+			case <-bridge.stop:
+				packetConn.Close()
+				listener.Close()
+				return
+			default:
+			}
+
+			bridge.servers = []*mdns.Server{
+				{PacketConn: packetConn, Handler: r},
+				{Listener: listener, Handler: r},
+			}
+
+			for _, server := range bridge.servers {
+				go r.serve(log, server)
+			}
+
+			log.Info("listening", lager.Data{"addr": addr})
+			return
+		}
+
+		log.Debug("listen-failed", lager.Data{"addr": addr, "error": err.Error()})
+
+		select {
+		case <-bridge.stop:
+			return
+		case <-r.Clock.NewTimer(r.RetryInterval).C():
+		}
+	}
+}
+
+func (r *Responder) serve(log lager.Logger, server *mdns.Server) {
+	if err := server.ActivateAndServe(); err != nil {
+		log.Error("serve-failed", err)
+	}
+}
+
+func listenUDPAndTCP(addr string) (net.PacketConn, net.Listener, error) {
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		packetConn.Close()
+		return nil, nil, err
+	}
+
+	return packetConn, listener, nil
+}
+
+// ServeDNS answers a query from a container
+func (r *Responder) ServeDNS(w mdns.ResponseWriter, req *mdns.Msg) {
+	log := r.Logger.Session("query")
+
+	if len(req.Question) != 1 {
+		r.fail(log, w, req, mdns.RcodeFormatError)
+		return
+	}
+
+	question := req.Question[0]
+	if answer, ok := r.answer(log, w.RemoteAddr(), req, question); ok {
+		if err := w.WriteMsg(answer); err != nil {
+			log.Error("write-failed", err)
+		}
+		return
+	}
+
+	r.forward(log, w, req)
+}
+
+// answer answers queries for the name of a container, returning false if the
+// name is not of a container on the querying container's subnet
+func (r *Responder) answer(log lager.Logger, remote net.Addr, req *mdns.Msg, question mdns.Question) (*mdns.Msg, bool) {
+	if question.Qclass != mdns.ClassINET {
+		return nil, false
+	}
+
+	ipv4, ipv6, found := r.Resolver.Resolve(log, question.Name, sourceIP(remote))
+	if !found {
+		return nil, false
+	}
+
+	answer := new(mdns.Msg)
+	answer.SetReply(req)
+	answer.Authoritative = true
+
+	header := mdns.RR_Header{Name: question.Name, Rrtype: question.Qtype, Class: mdns.ClassINET, Ttl: answerTTL}
+	switch {
+	case question.Qtype == mdns.TypeA && ipv4 != nil:
+		answer.Answer = append(answer.Answer, &mdns.A{Hdr: header, A: ipv4})
+	case question.Qtype == mdns.TypeAAAA && ipv6 != nil:
+		answer.Answer = append(answer.Answer, &mdns.AAAA{Hdr: header, AAAA: ipv6})
+	}
+
+	return answer, true
+}
+
+func (r *Responder) forward(log lager.Logger, w mdns.ResponseWriter, req *mdns.Msg) {
+	client := &mdns.Client{Net: w.LocalAddr().Network(), Timeout: 2 * time.Second}
+
+	for _, upstream := range r.Upstreams {
+		resp, _, err := client.Exchange(req, upstream)
+		if err != nil {
+			log.Debug("forward-failed", lager.Data{"upstream": upstream, "error": err.Error()})
+			continue
+		}
+
+		if err := w.WriteMsg(resp); err != nil {
+			log.Error("write-failed", err)
+		}
+		return
+	}
+
+	r.fail(log, w, req, mdns.RcodeServerFailure)
+}
+
+func (r *Responder) fail(log lager.Logger, w mdns.ResponseWriter, req *mdns.Msg, rcode int) {
+	resp := new(mdns.Msg)
+	resp.SetRcode(req, rcode)
+
+	if err := w.WriteMsg(resp); err != nil {
+		log.Error("write-failed", err)
+	}
+}
+
+func sourceIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+// HostNameservers returns the nameservers in a resolv.conf file as host:port
+// addresses to forward queries to
+func HostNameservers(resolvConfPath string) ([]string, error) {
+	config, err := mdns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file '%s': %s", resolvConfPath, err)
+	}
+
+	var upstreams []string
+	for _, server := range config.Servers {
+		upstreams = append(upstreams, net.JoinHostPort(server, config.Port))
+	}
+
+	return upstreams, nil
+}
@@ -0,0 +1,162 @@
+package dns_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns/fakes"
+	mdns "github.com/miekg/dns"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder", func() {
+	var (
+		fakeResolver *fakes.FakeResolver
+		upstream     *mdns.Server
+		responder    *dns.Responder
+		logger       *lagertest.TestLogger
+		port         int
+	)
+
+	freePort := func() int {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	query := func(name string, qtype uint16) *mdns.Msg {
+		req := new(mdns.Msg)
+		req.SetQuestion(name, qtype)
+
+		var resp *mdns.Msg
+		Eventually(func() error {
+			var err error
+			resp, _, err = new(mdns.Client).Exchange(req, "127.0.0.1:"+strconv.Itoa(port))
+			return err
+		}).Should(Succeed())
+
+		return resp
+	}
+
+	BeforeEach(func() {
+		fakeResolver = new(fakes.FakeResolver)
+		logger = lagertest.NewTestLogger("test")
+		port = freePort()
+
+		upstreamConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		upstream = &mdns.Server{PacketConn: upstreamConn, Handler: mdns.HandlerFunc(func(w mdns.ResponseWriter, req *mdns.Msg) {
+			resp := new(mdns.Msg)
+			resp.SetReply(req)
+			resp.Answer = append(resp.Answer, &mdns.A{
+				Hdr: mdns.RR_Header{Name: req.Question[0].Name, Rrtype: mdns.TypeA, Class: mdns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("93.184.216.34"),
+			})
+			w.WriteMsg(resp)
+		})}
+		go upstream.ActivateAndServe()
+
+		responder = dns.NewResponder(logger, fakeResolver, []string{upstreamConn.LocalAddr().String()})
+		responder.Port = port
+		responder.RetryInterval = 10 * time.Millisecond
+
+		responder.Add(logger, net.ParseIP("127.0.0.1"))
+	})
+
+	AfterEach(func() {
+		responder.Remove(logger, net.ParseIP("127.0.0.1"))
+		upstream.Shutdown()
+	})
+
+	It("answers the names of containers from the resolver", func() {
+		fakeResolver.ResolveReturns(net.ParseIP("10.0.0.3"), nil, true)
+
+		resp := query("server.", mdns.TypeA)
+		Expect(resp.Rcode).To(Equal(mdns.RcodeSuccess))
+		Expect(resp.Answer).To(HaveLen(1))
+		Expect(resp.Answer[0].(*mdns.A).A.String()).To(Equal("10.0.0.3"))
+
+		_, name, source := fakeResolver.ResolveArgsForCall(0)
+		Expect(name).To(Equal("server."))
+		Expect(source.String()).To(Equal("127.0.0.1"))
+	})
+
+	It("answers AAAA queries with the container's IPv6 address", func() {
+		fakeResolver.ResolveReturns(net.ParseIP("10.0.0.3"), net.ParseIP("fd00::a00:3"), true)
+
+		resp := query("server.", mdns.TypeAAAA)
+		Expect(resp.Answer).To(HaveLen(1))
+		Expect(resp.Answer[0].(*mdns.AAAA).AAAA.String()).To(Equal("fd00::a00:3"))
+	})
+
+	It("answers with no records when the container has no address of the type", func() {
+		fakeResolver.ResolveReturns(net.ParseIP("10.0.0.3"), nil, true)
+
+		resp := query("server.", mdns.TypeAAAA)
+		Expect(resp.Rcode).To(Equal(mdns.RcodeSuccess))
+		Expect(resp.Answer).To(BeEmpty())
+	})
+
+	It("forwards other names to the upstream servers", func() {
+		fakeResolver.ResolveReturns(nil, nil, false)
+
+		resp := query("example.com.", mdns.TypeA)
+		Expect(resp.Answer).To(HaveLen(1))
+		Expect(resp.Answer[0].(*mdns.A).A.String()).To(Equal("93.184.216.34"))
+	})
+
+	Context("when no upstream server answers", func() {
+		BeforeEach(func() {
+			responder.Upstreams = nil
+		})
+
+		It("fails the query", func() {
+			fakeResolver.ResolveReturns(nil, nil, false)
+
+			resp := query("example.com.", mdns.TypeA)
+			Expect(resp.Rcode).To(Equal(mdns.RcodeServerFailure))
+		})
+	})
+
+	Describe("Remove", func() {
+		It("keeps listening while other containers on the bridge remain", func() {
+			fakeResolver.ResolveReturns(net.ParseIP("10.0.0.3"), nil, true)
+
+			responder.Add(logger, net.ParseIP("127.0.0.1"))
+			query("server.", mdns.TypeA)
+			responder.Remove(logger, net.ParseIP("127.0.0.1"))
+
+			Expect(query("server.", mdns.TypeA).Answer).To(HaveLen(1))
+		})
+	})
+})
+
+var _ = Describe("HostNameservers", func() {
+	It("returns the nameservers from the resolv.conf file", func() {
+		f, err := ioutil.TempFile("", "resolv")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString("search example.com\nnameserver 127.0.0.1\nnameserver 8.8.8.8\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		Expect(dns.HostNameservers(f.Name())).To(Equal([]string{"127.0.0.1:53", "8.8.8.8:53"}))
+	})
+
+	Context("when the file does not exist", func() {
+		It("returns an error", func() {
+			_, err := dns.HostNameservers("/does/not/exist.conf")
+			Expect(err).To(MatchError(ContainSubstring("reading file '/does/not/exist.conf'")))
+		})
+	})
+})
@@ -0,0 +1,250 @@
+package kawasaki
+
+import (
+	"net"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
+	"github.com/pivotal-golang/lager"
+)
+
+// DualStackChainCreator creates each container's instance chains in both an
+// IPv4 and an IPv6 firewall. The IPv6 addresses are derived from the IPv4
+// ones passed to Create using the IPv6 pool.
+type DualStackChainCreator struct {
+	IPv4     InstanceChainCreator
+	IPv6     InstanceChainCreator
+	IPv6Pool *net.IPNet
+}
+
+func (d DualStackChainCreator) Create(logger lager.Logger, handle, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error {
+	if err := d.IPv4.Create(logger, handle, instanceChain, bridgeName, ip, network); err != nil {
+		return err
+	}
+
+	return d.IPv6.Create(logger, handle, instanceChain, bridgeName, subnets.IPv6Address(d.IPv6Pool, ip), subnets.IPv6Subnet(d.IPv6Pool, network))
+}
+
+// Destroy destroys the chains in both firewalls, even if destroying the IPv4
+// chains fails
+func (d DualStackChainCreator) Destroy(logger lager.Logger, instanceChain string) error {
+	ipv4Err := d.IPv4.Destroy(logger, instanceChain)
+	if err := d.IPv6.Destroy(logger, instanceChain); err != nil {
+		return err
+	}
+
+	return ipv4Err
+}
+
+// Override applies the host access override in both firewalls, and each
+// deny network in the firewall of its family
+func (d DualStackChainCreator) Override(logger lager.Logger, instanceChain, bridgeName string, ip net.IP, overrides FirewallOverrides) error {
+	ipv4, ipv6 := overrides, overrides
+	ipv4.DenyNetworks, ipv6.DenyNetworks = nil, nil
+	for _, network := range overrides.DenyNetworks {
+		if strings.Contains(network, ":") {
+			ipv6.DenyNetworks = append(ipv6.DenyNetworks, network)
+		} else {
+			ipv4.DenyNetworks = append(ipv4.DenyNetworks, network)
+		}
+	}
+
+	if err := d.IPv4.Override(logger, instanceChain, bridgeName, ip, ipv4); err != nil {
+		return err
+	}
+
+	return d.IPv6.Override(logger, instanceChain, bridgeName, subnets.IPv6Address(d.IPv6Pool, ip), ipv6)
+}
+
+// DualStackFirewall applies kawasaki's rules to both an IPv4 and an IPv6
+// firewall. Port forwarding only maps ports on the external IPv4 address, and
+// NetOut rules are split between the firewalls according to the family of
+// their networks.
+type DualStackFirewall struct {
+	IPv4     Firewall
+	IPv6     Firewall
+	IPv6Pool *net.IPNet
+}
+
+func (d DualStackFirewall) Start() error {
+	if err := d.IPv4.Start(); err != nil {
+		return err
+	}
+
+	return d.IPv6.Start()
+}
+
+func (d DualStackFirewall) chainCreator() DualStackChainCreator {
+	return DualStackChainCreator{IPv4: d.IPv4, IPv6: d.IPv6, IPv6Pool: d.IPv6Pool}
+}
+
+func (d DualStackFirewall) Create(logger lager.Logger, handle, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error {
+	return d.chainCreator().Create(logger, handle, instanceChain, bridgeName, ip, network)
+}
+
+func (d DualStackFirewall) Destroy(logger lager.Logger, instanceChain string) error {
+	return d.chainCreator().Destroy(logger, instanceChain)
+}
+
+func (d DualStackFirewall) Override(logger lager.Logger, instanceChain, bridgeName string, ip net.IP, overrides FirewallOverrides) error {
+	return d.chainCreator().Override(logger, instanceChain, bridgeName, ip, overrides)
+}
+
+func (d DualStackFirewall) Forward(spec PortForwarderSpec) error {
+	return d.IPv4.Forward(spec)
+}
+
+func (d DualStackFirewall) Unforward(spec PortForwarderSpec) error {
+	return d.IPv4.Unforward(spec)
+}
+
+func (d DualStackFirewall) Open(log lager.Logger, instance string, rule garden.NetOutRule) error {
+	ipv4Rule, ipv6Rule := splitNetOutRule(rule)
+
+	if ipv4Rule != nil {
+		if err := d.IPv4.Open(log, instance, *ipv4Rule); err != nil {
+			return err
+		}
+	}
+
+	if ipv6Rule != nil {
+		return d.IPv6.Open(log, instance, *ipv6Rule)
+	}
+
+	return nil
+}
+
+func (d DualStackFirewall) Close(log lager.Logger, instance string, rule garden.NetOutRule) error {
+	ipv4Rule, ipv6Rule := splitNetOutRule(rule)
+
+	if ipv4Rule != nil {
+		if err := d.IPv4.Close(log, instance, *ipv4Rule); err != nil {
+			return err
+		}
+	}
+
+	if ipv6Rule != nil {
+		return d.IPv6.Close(log, instance, *ipv6Rule)
+	}
+
+	return nil
+}
+
+// Join only restricts IPv4 traffic, as the policy groups' sets hold the
+// members' IPv4 addresses. Policy groups are therefore refused when there is
+// an IPv6 pool, and Join and Leave are only called for groups left by older
+// containers.
+func (d DualStackFirewall) Join(logger lager.Logger, instanceChain, group string, ip net.IP, network *net.IPNet) error {
+	return d.IPv4.Join(logger, instanceChain, group, ip, network)
+}
+
+func (d DualStackFirewall) Leave(logger lager.Logger, group string, ip net.IP) error {
+	return d.IPv4.Leave(logger, group, ip)
+}
+
+func (d DualStackFirewall) GlobalChainsExist() (bool, error) {
+	if exist, err := d.IPv4.GlobalChainsExist(); !exist || err != nil {
+		return false, err
+	}
+
+	return d.IPv6.GlobalChainsExist()
+}
+
+func (d DualStackFirewall) InstanceChains() ([]string, error) {
+	ipv4Instances, err := d.IPv4.InstanceChains()
+	if err != nil {
+		return nil, err
+	}
+
+	ipv6Instances, err := d.IPv6.InstanceChains()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var instances []string
+	for _, instance := range append(ipv4Instances, ipv6Instances...) {
+		if !seen[instance] {
+			seen[instance] = true
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+func (d DualStackFirewall) InstanceChainsIntact(instanceID string) (bool, error) {
+	if intact, err := d.IPv4.InstanceChainsIntact(instanceID); !intact || err != nil {
+		return false, err
+	}
+
+	return d.IPv6.InstanceChainsIntact(instanceID)
+}
+
+func (d DualStackFirewall) PortForwardExists(spec PortForwarderSpec) (bool, error) {
+	return d.IPv4.PortForwardExists(spec)
+}
+
+func (d DualStackFirewall) NetOutExists(instance string, rule garden.NetOutRule) (bool, error) {
+	ipv4Rule, ipv6Rule := splitNetOutRule(rule)
+
+	if ipv4Rule != nil {
+		if exists, err := d.IPv4.NetOutExists(instance, *ipv4Rule); !exists || err != nil {
+			return false, err
+		}
+	}
+
+	if ipv6Rule != nil {
+		return d.IPv6.NetOutExists(instance, *ipv6Rule)
+	}
+
+	return true, nil
+}
+
+// splitNetOutRule divides a rule's networks between IPv4 and IPv6, returning
+// nil for a family the rule does not apply to. A rule with no networks
+// applies to both, except for ICMP rules: their types and codes are ICMPv4
+// values, so they only apply to IPv6 when given IPv6 networks.
+func splitNetOutRule(rule garden.NetOutRule) (ipv4, ipv6 *garden.NetOutRule) {
+	if len(rule.Networks) == 0 {
+		if rule.Protocol == garden.ProtocolICMP {
+			return &rule, nil
+		}
+
+		ipv6Rule := rule
+		return &rule, &ipv6Rule
+	}
+
+	var ipv4Networks, ipv6Networks []garden.IPRange
+	for _, network := range rule.Networks {
+		if isIPv6Range(network) {
+			ipv6Networks = append(ipv6Networks, network)
+		} else {
+			ipv4Networks = append(ipv4Networks, network)
+		}
+	}
+
+	if len(ipv4Networks) > 0 {
+		ipv4Rule := rule
+		ipv4Rule.Networks = ipv4Networks
+		ipv4 = &ipv4Rule
+	}
+
+	if len(ipv6Networks) > 0 {
+		ipv6Rule := rule
+		ipv6Rule.Networks = ipv6Networks
+		ipv6 = &ipv6Rule
+	}
+
+	return ipv4, ipv6
+}
+
+func isIPv6Range(network garden.IPRange) bool {
+	ip := network.Start
+	if ip == nil {
+		ip = network.End
+	}
+
+	return ip != nil && ip.To4() == nil
+}
@@ -0,0 +1,265 @@
+package kawasaki_test
+
+import (
+	"errors"
+	"net"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("DualStackChainCreator", func() {
+	var (
+		fakeIPv4ChainCreator *fakes.FakeInstanceChainCreator
+		fakeIPv6ChainCreator *fakes.FakeInstanceChainCreator
+		chainCreator         kawasaki.DualStackChainCreator
+		logger               *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		fakeIPv4ChainCreator = new(fakes.FakeInstanceChainCreator)
+		fakeIPv6ChainCreator = new(fakes.FakeInstanceChainCreator)
+		logger = lagertest.NewTestLogger("test")
+
+		_, pool, err := net.ParseCIDR("fd00::/64")
+		Expect(err).NotTo(HaveOccurred())
+
+		chainCreator = kawasaki.DualStackChainCreator{
+			IPv4:     fakeIPv4ChainCreator,
+			IPv6:     fakeIPv6ChainCreator,
+			IPv6Pool: pool,
+		}
+	})
+
+	Describe("Create", func() {
+		var (
+			ip     net.IP
+			subnet *net.IPNet
+		)
+
+		BeforeEach(func() {
+			var err error
+			ip, subnet, err = net.ParseCIDR("10.0.0.2/24")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the IPv4 chains with the container's IPv4 address", func() {
+			Expect(chainCreator.Create(logger, "some-handle", "some-instance", "some-bridge", ip, subnet)).To(Succeed())
+
+			Expect(fakeIPv4ChainCreator.CreateCallCount()).To(Equal(1))
+			_, handle, instance, bridge, actualIP, actualSubnet := fakeIPv4ChainCreator.CreateArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+			Expect(instance).To(Equal("some-instance"))
+			Expect(bridge).To(Equal("some-bridge"))
+			Expect(actualIP).To(Equal(ip))
+			Expect(actualSubnet).To(Equal(subnet))
+		})
+
+		It("creates the IPv6 chains with the address derived from the IPv6 pool", func() {
+			Expect(chainCreator.Create(logger, "some-handle", "some-instance", "some-bridge", ip, subnet)).To(Succeed())
+
+			Expect(fakeIPv6ChainCreator.CreateCallCount()).To(Equal(1))
+			_, handle, instance, bridge, actualIP, actualSubnet := fakeIPv6ChainCreator.CreateArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+			Expect(instance).To(Equal("some-instance"))
+			Expect(bridge).To(Equal("some-bridge"))
+			Expect(actualIP.String()).To(Equal("fd00::a00:2"))
+			Expect(actualSubnet.String()).To(Equal("fd00::a00:0/120"))
+		})
+
+		Context("when creating the IPv4 chains fails", func() {
+			It("returns the error and does not create the IPv6 chains", func() {
+				fakeIPv4ChainCreator.CreateReturns(errors.New("banana"))
+
+				Expect(chainCreator.Create(logger, "some-handle", "some-instance", "some-bridge", ip, subnet)).To(MatchError("banana"))
+				Expect(fakeIPv6ChainCreator.CreateCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Override", func() {
+		It("applies host access in both families and each deny network in its own", func() {
+			deny := false
+			ip := net.ParseIP("10.0.0.2")
+			Expect(chainCreator.Override(logger, "some-instance", "some-bridge", ip, kawasaki.FirewallOverrides{
+				HostAccess:   &deny,
+				DenyNetworks: []string{"10.1.0.0/16", "fd01::/64"},
+			})).To(Succeed())
+
+			_, _, _, ipv4IP, ipv4Overrides := fakeIPv4ChainCreator.OverrideArgsForCall(0)
+			Expect(ipv4IP).To(Equal(ip))
+			Expect(*ipv4Overrides.HostAccess).To(BeFalse())
+			Expect(ipv4Overrides.DenyNetworks).To(Equal([]string{"10.1.0.0/16"}))
+
+			_, _, _, ipv6IP, ipv6Overrides := fakeIPv6ChainCreator.OverrideArgsForCall(0)
+			Expect(ipv6IP.To4()).To(BeNil())
+			Expect(*ipv6Overrides.HostAccess).To(BeFalse())
+			Expect(ipv6Overrides.DenyNetworks).To(Equal([]string{"fd01::/64"}))
+		})
+	})
+
+	Describe("Destroy", func() {
+		It("destroys the chains in both families", func() {
+			Expect(chainCreator.Destroy(logger, "some-instance")).To(Succeed())
+
+			_, instance := fakeIPv4ChainCreator.DestroyArgsForCall(0)
+			Expect(instance).To(Equal("some-instance"))
+			_, instance = fakeIPv6ChainCreator.DestroyArgsForCall(0)
+			Expect(instance).To(Equal("some-instance"))
+		})
+
+		Context("when destroying the IPv4 chains fails", func() {
+			It("still destroys the IPv6 chains and returns the error", func() {
+				fakeIPv4ChainCreator.DestroyReturns(errors.New("banana"))
+
+				Expect(chainCreator.Destroy(logger, "some-instance")).To(MatchError("banana"))
+				Expect(fakeIPv6ChainCreator.DestroyCallCount()).To(Equal(1))
+			})
+		})
+	})
+})
+
+func ipRange(ip string) garden.IPRange {
+	return garden.IPRange{Start: net.ParseIP(ip), End: net.ParseIP(ip)}
+}
+
+var _ = Describe("DualStackFirewall", func() {
+	var (
+		fakeIPv4Firewall *fakes.FakeFirewall
+		fakeIPv6Firewall *fakes.FakeFirewall
+		firewall         kawasaki.DualStackFirewall
+		logger           *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		fakeIPv4Firewall = new(fakes.FakeFirewall)
+		fakeIPv6Firewall = new(fakes.FakeFirewall)
+		logger = lagertest.NewTestLogger("test")
+
+		_, pool, err := net.ParseCIDR("fd00::/64")
+		Expect(err).NotTo(HaveOccurred())
+
+		firewall = kawasaki.DualStackFirewall{
+			IPv4:     fakeIPv4Firewall,
+			IPv6:     fakeIPv6Firewall,
+			IPv6Pool: pool,
+		}
+	})
+
+	Describe("Start", func() {
+		It("starts both firewalls", func() {
+			Expect(firewall.Start()).To(Succeed())
+
+			Expect(fakeIPv4Firewall.StartCallCount()).To(Equal(1))
+			Expect(fakeIPv6Firewall.StartCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("Forward", func() {
+		It("only forwards the IPv4 external address", func() {
+			spec := kawasaki.PortForwarderSpec{InstanceID: "some-instance", FromPort: 80, ToPort: 8080}
+			Expect(firewall.Forward(spec)).To(Succeed())
+
+			Expect(fakeIPv4Firewall.ForwardArgsForCall(0)).To(Equal(spec))
+			Expect(fakeIPv6Firewall.ForwardCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Join", func() {
+		It("only joins the group with the IPv4 address", func() {
+			ip, subnet, err := net.ParseCIDR("10.0.0.2/24")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(firewall.Join(logger, "some-instance", "tenant-a", ip, subnet)).To(Succeed())
+
+			Expect(fakeIPv4Firewall.JoinCallCount()).To(Equal(1))
+			_, instance, group, joinedIP, _ := fakeIPv4Firewall.JoinArgsForCall(0)
+			Expect(instance).To(Equal("some-instance"))
+			Expect(group).To(Equal("tenant-a"))
+			Expect(joinedIP).To(Equal(ip))
+			Expect(fakeIPv6Firewall.JoinCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Open", func() {
+		Context("when the rule has no networks", func() {
+			It("opens it in both families", func() {
+				rule := garden.NetOutRule{Protocol: garden.ProtocolTCP}
+				Expect(firewall.Open(logger, "some-instance", rule)).To(Succeed())
+
+				_, _, ipv4Rule := fakeIPv4Firewall.OpenArgsForCall(0)
+				Expect(ipv4Rule).To(Equal(rule))
+				_, _, ipv6Rule := fakeIPv6Firewall.OpenArgsForCall(0)
+				Expect(ipv6Rule).To(Equal(rule))
+			})
+
+			Context("and is for ICMP", func() {
+				It("only opens it for IPv4", func() {
+					Expect(firewall.Open(logger, "some-instance", garden.NetOutRule{Protocol: garden.ProtocolICMP})).To(Succeed())
+
+					Expect(fakeIPv4Firewall.OpenCallCount()).To(Equal(1))
+					Expect(fakeIPv6Firewall.OpenCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the rule has networks of both families", func() {
+			It("opens each family's networks in its own firewall", func() {
+				ipv4Range := ipRange("1.2.3.4")
+				ipv6Range := ipRange("2001:db8::1")
+
+				Expect(firewall.Open(logger, "some-instance", garden.NetOutRule{
+					Protocol: garden.ProtocolTCP,
+					Networks: []garden.IPRange{ipv4Range, ipv6Range},
+				})).To(Succeed())
+
+				_, _, ipv4Rule := fakeIPv4Firewall.OpenArgsForCall(0)
+				Expect(ipv4Rule.Networks).To(Equal([]garden.IPRange{ipv4Range}))
+				_, _, ipv6Rule := fakeIPv6Firewall.OpenArgsForCall(0)
+				Expect(ipv6Rule.Networks).To(Equal([]garden.IPRange{ipv6Range}))
+			})
+		})
+
+		Context("when the rule only has IPv4 networks", func() {
+			It("does not open it for IPv6", func() {
+				Expect(firewall.Open(logger, "some-instance", garden.NetOutRule{
+					Networks: []garden.IPRange{ipRange("1.2.3.4")},
+				})).To(Succeed())
+
+				Expect(fakeIPv4Firewall.OpenCallCount()).To(Equal(1))
+				Expect(fakeIPv6Firewall.OpenCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when opening the IPv4 rule fails", func() {
+			It("returns the error", func() {
+				fakeIPv4Firewall.OpenReturns(errors.New("banana"))
+
+				Expect(firewall.Open(logger, "some-instance", garden.NetOutRule{})).To(MatchError("banana"))
+				Expect(fakeIPv6Firewall.OpenCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("GlobalChainsExist", func() {
+		It("returns false when the IPv6 chains are missing", func() {
+			fakeIPv4Firewall.GlobalChainsExistReturns(true, nil)
+			fakeIPv6Firewall.GlobalChainsExistReturns(false, nil)
+
+			Expect(firewall.GlobalChainsExist()).To(BeFalse())
+		})
+	})
+
+	Describe("InstanceChains", func() {
+		It("returns the instances with chains in either family", func() {
+			fakeIPv4Firewall.InstanceChainsReturns([]string{"instance-1", "instance-2"}, nil)
+			fakeIPv6Firewall.InstanceChainsReturns([]string{"instance-2", "instance-3"}, nil)
+
+			Expect(firewall.InstanceChains()).To(ConsistOf("instance-1", "instance-2", "instance-3"))
+		})
+	})
+})
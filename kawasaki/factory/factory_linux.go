@@ -4,11 +4,10 @@ import (
 	"github.com/cloudfoundry-incubator/guardian/kawasaki"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/configure"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/devices"
-	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/netns"
 )
 
-func NewDefaultConfigurer(ipt *iptables.IPTables) kawasaki.Configurer {
+func NewDefaultConfigurer(instanceChainCreator kawasaki.InstanceChainCreator, policyGroups kawasaki.PolicyGroupEnforcer) kawasaki.Configurer {
 	hostConfigurer := &configure.Host{
 		Veth:   &devices.VethCreator{},
 		Link:   &devices.Link{},
@@ -22,7 +21,8 @@ func NewDefaultConfigurer(ipt *iptables.IPTables) kawasaki.Configurer {
 	return kawasaki.NewConfigurer(
 		hostConfigurer,
 		containerCfgApplier,
-		iptables.NewInstanceChainCreator(ipt),
+		instanceChainCreator,
+		policyGroups,
 		&netns.Execer{},
 	)
 }
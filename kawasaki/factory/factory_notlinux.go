@@ -1,12 +1,12 @@
+//go:build !linux
 // +build !linux
 
 package factory
 
 import (
 	"github.com/cloudfoundry-incubator/guardian/kawasaki"
-	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
 )
 
-func NewDefaultConfigurer(ipt *iptables.IPTables) kawasaki.Configurer {
+func NewDefaultConfigurer(instanceChainCreator kawasaki.InstanceChainCreator, policyGroups kawasaki.PolicyGroupEnforcer) kawasaki.Configurer {
 	panic("not supported on this platform")
 }
@@ -22,6 +22,18 @@ type FakeConfigCreator struct {
 		result1 kawasaki.NetworkConfig
 		result2 error
 	}
+	FirewallBackendStub        func() string
+	firewallBackendMutex       sync.RWMutex
+	firewallBackendArgsForCall []struct{}
+	firewallBackendReturns     struct {
+		result1 string
+	}
+	IPv6PoolStub        func() *net.IPNet
+	iPv6PoolMutex       sync.RWMutex
+	iPv6PoolArgsForCall []struct{}
+	iPv6PoolReturns     struct {
+		result1 *net.IPNet
+	}
 }
 
 func (fake *FakeConfigCreator) Create(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP) (kawasaki.NetworkConfig, error) {
@@ -60,4 +72,52 @@ func (fake *FakeConfigCreator) CreateReturns(result1 kawasaki.NetworkConfig, res
 	}{result1, result2}
 }
 
+func (fake *FakeConfigCreator) FirewallBackend() string {
+	fake.firewallBackendMutex.Lock()
+	fake.firewallBackendArgsForCall = append(fake.firewallBackendArgsForCall, struct{}{})
+	fake.firewallBackendMutex.Unlock()
+	if fake.FirewallBackendStub != nil {
+		return fake.FirewallBackendStub()
+	} else {
+		return fake.firewallBackendReturns.result1
+	}
+}
+
+func (fake *FakeConfigCreator) FirewallBackendCallCount() int {
+	fake.firewallBackendMutex.RLock()
+	defer fake.firewallBackendMutex.RUnlock()
+	return len(fake.firewallBackendArgsForCall)
+}
+
+func (fake *FakeConfigCreator) FirewallBackendReturns(result1 string) {
+	fake.FirewallBackendStub = nil
+	fake.firewallBackendReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeConfigCreator) IPv6Pool() *net.IPNet {
+	fake.iPv6PoolMutex.Lock()
+	fake.iPv6PoolArgsForCall = append(fake.iPv6PoolArgsForCall, struct{}{})
+	fake.iPv6PoolMutex.Unlock()
+	if fake.IPv6PoolStub != nil {
+		return fake.IPv6PoolStub()
+	} else {
+		return fake.iPv6PoolReturns.result1
+	}
+}
+
+func (fake *FakeConfigCreator) IPv6PoolCallCount() int {
+	fake.iPv6PoolMutex.RLock()
+	defer fake.iPv6PoolMutex.RUnlock()
+	return len(fake.iPv6PoolArgsForCall)
+}
+
+func (fake *FakeConfigCreator) IPv6PoolReturns(result1 *net.IPNet) {
+	fake.IPv6PoolStub = nil
+	fake.iPv6PoolReturns = struct {
+		result1 *net.IPNet
+	}{result1}
+}
+
 var _ kawasaki.ConfigCreator = new(FakeConfigCreator)
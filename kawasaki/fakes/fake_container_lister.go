@@ -0,0 +1,91 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeContainerLister struct {
+	HandlesStub        func() ([]string, error)
+	handlesMutex       sync.RWMutex
+	handlesArgsForCall []struct{}
+	handlesReturns     struct {
+		result1 []string
+		result2 error
+	}
+	InfoStub        func(log lager.Logger, handle string) (gardener.ActualContainerSpec, error)
+	infoMutex       sync.RWMutex
+	infoArgsForCall []struct {
+		log    lager.Logger
+		handle string
+	}
+	infoReturns struct {
+		result1 gardener.ActualContainerSpec
+		result2 error
+	}
+}
+
+func (fake *FakeContainerLister) Handles() ([]string, error) {
+	fake.handlesMutex.Lock()
+	fake.handlesArgsForCall = append(fake.handlesArgsForCall, struct{}{})
+	fake.handlesMutex.Unlock()
+	if fake.HandlesStub != nil {
+		return fake.HandlesStub()
+	} else {
+		return fake.handlesReturns.result1, fake.handlesReturns.result2
+	}
+}
+
+func (fake *FakeContainerLister) HandlesCallCount() int {
+	fake.handlesMutex.RLock()
+	defer fake.handlesMutex.RUnlock()
+	return len(fake.handlesArgsForCall)
+}
+
+func (fake *FakeContainerLister) HandlesReturns(result1 []string, result2 error) {
+	fake.HandlesStub = nil
+	fake.handlesReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeContainerLister) Info(log lager.Logger, handle string) (gardener.ActualContainerSpec, error) {
+	fake.infoMutex.Lock()
+	fake.infoArgsForCall = append(fake.infoArgsForCall, struct {
+		log    lager.Logger
+		handle string
+	}{log, handle})
+	fake.infoMutex.Unlock()
+	if fake.InfoStub != nil {
+		return fake.InfoStub(log, handle)
+	} else {
+		return fake.infoReturns.result1, fake.infoReturns.result2
+	}
+}
+
+func (fake *FakeContainerLister) InfoCallCount() int {
+	fake.infoMutex.RLock()
+	defer fake.infoMutex.RUnlock()
+	return len(fake.infoArgsForCall)
+}
+
+func (fake *FakeContainerLister) InfoArgsForCall(i int) (lager.Logger, string) {
+	fake.infoMutex.RLock()
+	defer fake.infoMutex.RUnlock()
+	return fake.infoArgsForCall[i].log, fake.infoArgsForCall[i].handle
+}
+
+func (fake *FakeContainerLister) InfoReturns(result1 gardener.ActualContainerSpec, result2 error) {
+	fake.InfoStub = nil
+	fake.infoReturns = struct {
+		result1 gardener.ActualContainerSpec
+		result2 error
+	}{result1, result2}
+}
+
+var _ kawasaki.ContainerLister = new(FakeContainerLister)
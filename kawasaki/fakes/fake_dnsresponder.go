@@ -0,0 +1,75 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeDNSResponder struct {
+	AddStub        func(log lager.Logger, bridgeIP net.IP)
+	addMutex       sync.RWMutex
+	addArgsForCall []struct {
+		log      lager.Logger
+		bridgeIP net.IP
+	}
+	RemoveStub        func(log lager.Logger, bridgeIP net.IP)
+	removeMutex       sync.RWMutex
+	removeArgsForCall []struct {
+		log      lager.Logger
+		bridgeIP net.IP
+	}
+}
+
+func (fake *FakeDNSResponder) Add(log lager.Logger, bridgeIP net.IP) {
+	fake.addMutex.Lock()
+	fake.addArgsForCall = append(fake.addArgsForCall, struct {
+		log      lager.Logger
+		bridgeIP net.IP
+	}{log, bridgeIP})
+	fake.addMutex.Unlock()
+	if fake.AddStub != nil {
+		fake.AddStub(log, bridgeIP)
+	}
+}
+
+func (fake *FakeDNSResponder) AddCallCount() int {
+	fake.addMutex.RLock()
+	defer fake.addMutex.RUnlock()
+	return len(fake.addArgsForCall)
+}
+
+func (fake *FakeDNSResponder) AddArgsForCall(i int) (lager.Logger, net.IP) {
+	fake.addMutex.RLock()
+	defer fake.addMutex.RUnlock()
+	return fake.addArgsForCall[i].log, fake.addArgsForCall[i].bridgeIP
+}
+
+func (fake *FakeDNSResponder) Remove(log lager.Logger, bridgeIP net.IP) {
+	fake.removeMutex.Lock()
+	fake.removeArgsForCall = append(fake.removeArgsForCall, struct {
+		log      lager.Logger
+		bridgeIP net.IP
+	}{log, bridgeIP})
+	fake.removeMutex.Unlock()
+	if fake.RemoveStub != nil {
+		fake.RemoveStub(log, bridgeIP)
+	}
+}
+
+func (fake *FakeDNSResponder) RemoveCallCount() int {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return len(fake.removeArgsForCall)
+}
+
+func (fake *FakeDNSResponder) RemoveArgsForCall(i int) (lager.Logger, net.IP) {
+	fake.removeMutex.RLock()
+	defer fake.removeMutex.RUnlock()
+	return fake.removeArgsForCall[i].log, fake.removeArgsForCall[i].bridgeIP
+}
+
+var _ kawasaki.DNSResponder = new(FakeDNSResponder)
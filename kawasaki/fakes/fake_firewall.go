@@ -0,0 +1,638 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeFirewall struct {
+	StartStub        func() error
+	startMutex       sync.RWMutex
+	startArgsForCall []struct{}
+	startReturns     struct {
+		result1 error
+	}
+	CreateStub        func(logger lager.Logger, handle string, instanceChain string, bridgeName string, ip net.IP, network *net.IPNet) error
+	createMutex       sync.RWMutex
+	createArgsForCall []struct {
+		logger        lager.Logger
+		handle        string
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		network       *net.IPNet
+	}
+	createReturns struct {
+		result1 error
+	}
+	DestroyStub        func(logger lager.Logger, instanceChain string) error
+	destroyMutex       sync.RWMutex
+	destroyArgsForCall []struct {
+		logger        lager.Logger
+		instanceChain string
+	}
+	destroyReturns struct {
+		result1 error
+	}
+	ForwardStub        func(spec kawasaki.PortForwarderSpec) error
+	forwardMutex       sync.RWMutex
+	forwardArgsForCall []struct {
+		spec kawasaki.PortForwarderSpec
+	}
+	forwardReturns struct {
+		result1 error
+	}
+	UnforwardStub        func(spec kawasaki.PortForwarderSpec) error
+	unforwardMutex       sync.RWMutex
+	unforwardArgsForCall []struct {
+		spec kawasaki.PortForwarderSpec
+	}
+	unforwardReturns struct {
+		result1 error
+	}
+	OpenStub        func(log lager.Logger, instance string, rule garden.NetOutRule) error
+	openMutex       sync.RWMutex
+	openArgsForCall []struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}
+	openReturns struct {
+		result1 error
+	}
+	CloseStub        func(log lager.Logger, instance string, rule garden.NetOutRule) error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}
+	closeReturns struct {
+		result1 error
+	}
+	GlobalChainsExistStub        func() (bool, error)
+	globalChainsExistMutex       sync.RWMutex
+	globalChainsExistArgsForCall []struct{}
+	globalChainsExistReturns     struct {
+		result1 bool
+		result2 error
+	}
+	InstanceChainsStub        func() ([]string, error)
+	instanceChainsMutex       sync.RWMutex
+	instanceChainsArgsForCall []struct{}
+	instanceChainsReturns     struct {
+		result1 []string
+		result2 error
+	}
+	InstanceChainsIntactStub        func(instanceID string) (bool, error)
+	instanceChainsIntactMutex       sync.RWMutex
+	instanceChainsIntactArgsForCall []struct {
+		instanceID string
+	}
+	instanceChainsIntactReturns struct {
+		result1 bool
+		result2 error
+	}
+	PortForwardExistsStub        func(spec kawasaki.PortForwarderSpec) (bool, error)
+	portForwardExistsMutex       sync.RWMutex
+	portForwardExistsArgsForCall []struct {
+		spec kawasaki.PortForwarderSpec
+	}
+	portForwardExistsReturns struct {
+		result1 bool
+		result2 error
+	}
+	NetOutExistsStub        func(instance string, rule garden.NetOutRule) (bool, error)
+	netOutExistsMutex       sync.RWMutex
+	netOutExistsArgsForCall []struct {
+		instance string
+		rule     garden.NetOutRule
+	}
+	netOutExistsReturns struct {
+		result1 bool
+		result2 error
+	}
+	JoinStub        func(logger lager.Logger, instanceChain string, group string, ip net.IP, network *net.IPNet) error
+	joinMutex       sync.RWMutex
+	joinArgsForCall []struct {
+		logger        lager.Logger
+		instanceChain string
+		group         string
+		ip            net.IP
+		network       *net.IPNet
+	}
+	joinReturns struct {
+		result1 error
+	}
+	LeaveStub        func(logger lager.Logger, group string, ip net.IP) error
+	leaveMutex       sync.RWMutex
+	leaveArgsForCall []struct {
+		logger lager.Logger
+		group  string
+		ip     net.IP
+	}
+	leaveReturns struct {
+		result1 error
+	}
+	OverrideStub        func(logger lager.Logger, instanceChain string, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error
+	overrideMutex       sync.RWMutex
+	overrideArgsForCall []struct {
+		logger        lager.Logger
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		overrides     kawasaki.FirewallOverrides
+	}
+	overrideReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeFirewall) Start() error {
+	fake.startMutex.Lock()
+	fake.startArgsForCall = append(fake.startArgsForCall, struct{}{})
+	fake.startMutex.Unlock()
+	if fake.StartStub != nil {
+		return fake.StartStub()
+	} else {
+		return fake.startReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) StartCallCount() int {
+	fake.startMutex.RLock()
+	defer fake.startMutex.RUnlock()
+	return len(fake.startArgsForCall)
+}
+
+func (fake *FakeFirewall) StartReturns(result1 error) {
+	fake.StartStub = nil
+	fake.startReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Create(logger lager.Logger, handle string, instanceChain string, bridgeName string, ip net.IP, network *net.IPNet) error {
+	fake.createMutex.Lock()
+	fake.createArgsForCall = append(fake.createArgsForCall, struct {
+		logger        lager.Logger
+		handle        string
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		network       *net.IPNet
+	}{logger, handle, instanceChain, bridgeName, ip, network})
+	fake.createMutex.Unlock()
+	if fake.CreateStub != nil {
+		return fake.CreateStub(logger, handle, instanceChain, bridgeName, ip, network)
+	} else {
+		return fake.createReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) CreateCallCount() int {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	return len(fake.createArgsForCall)
+}
+
+func (fake *FakeFirewall) CreateArgsForCall(i int) (lager.Logger, string, string, string, net.IP, *net.IPNet) {
+	fake.createMutex.RLock()
+	defer fake.createMutex.RUnlock()
+	return fake.createArgsForCall[i].logger, fake.createArgsForCall[i].handle, fake.createArgsForCall[i].instanceChain, fake.createArgsForCall[i].bridgeName, fake.createArgsForCall[i].ip, fake.createArgsForCall[i].network
+}
+
+func (fake *FakeFirewall) CreateReturns(result1 error) {
+	fake.CreateStub = nil
+	fake.createReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Destroy(logger lager.Logger, instanceChain string) error {
+	fake.destroyMutex.Lock()
+	fake.destroyArgsForCall = append(fake.destroyArgsForCall, struct {
+		logger        lager.Logger
+		instanceChain string
+	}{logger, instanceChain})
+	fake.destroyMutex.Unlock()
+	if fake.DestroyStub != nil {
+		return fake.DestroyStub(logger, instanceChain)
+	} else {
+		return fake.destroyReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) DestroyCallCount() int {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return len(fake.destroyArgsForCall)
+}
+
+func (fake *FakeFirewall) DestroyArgsForCall(i int) (lager.Logger, string) {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return fake.destroyArgsForCall[i].logger, fake.destroyArgsForCall[i].instanceChain
+}
+
+func (fake *FakeFirewall) DestroyReturns(result1 error) {
+	fake.DestroyStub = nil
+	fake.destroyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Forward(spec kawasaki.PortForwarderSpec) error {
+	fake.forwardMutex.Lock()
+	fake.forwardArgsForCall = append(fake.forwardArgsForCall, struct {
+		spec kawasaki.PortForwarderSpec
+	}{spec})
+	fake.forwardMutex.Unlock()
+	if fake.ForwardStub != nil {
+		return fake.ForwardStub(spec)
+	} else {
+		return fake.forwardReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) ForwardCallCount() int {
+	fake.forwardMutex.RLock()
+	defer fake.forwardMutex.RUnlock()
+	return len(fake.forwardArgsForCall)
+}
+
+func (fake *FakeFirewall) ForwardArgsForCall(i int) kawasaki.PortForwarderSpec {
+	fake.forwardMutex.RLock()
+	defer fake.forwardMutex.RUnlock()
+	return fake.forwardArgsForCall[i].spec
+}
+
+func (fake *FakeFirewall) ForwardReturns(result1 error) {
+	fake.ForwardStub = nil
+	fake.forwardReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Unforward(spec kawasaki.PortForwarderSpec) error {
+	fake.unforwardMutex.Lock()
+	fake.unforwardArgsForCall = append(fake.unforwardArgsForCall, struct {
+		spec kawasaki.PortForwarderSpec
+	}{spec})
+	fake.unforwardMutex.Unlock()
+	if fake.UnforwardStub != nil {
+		return fake.UnforwardStub(spec)
+	} else {
+		return fake.unforwardReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) UnforwardCallCount() int {
+	fake.unforwardMutex.RLock()
+	defer fake.unforwardMutex.RUnlock()
+	return len(fake.unforwardArgsForCall)
+}
+
+func (fake *FakeFirewall) UnforwardArgsForCall(i int) kawasaki.PortForwarderSpec {
+	fake.unforwardMutex.RLock()
+	defer fake.unforwardMutex.RUnlock()
+	return fake.unforwardArgsForCall[i].spec
+}
+
+func (fake *FakeFirewall) UnforwardReturns(result1 error) {
+	fake.UnforwardStub = nil
+	fake.unforwardReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Open(log lager.Logger, instance string, rule garden.NetOutRule) error {
+	fake.openMutex.Lock()
+	fake.openArgsForCall = append(fake.openArgsForCall, struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}{log, instance, rule})
+	fake.openMutex.Unlock()
+	if fake.OpenStub != nil {
+		return fake.OpenStub(log, instance, rule)
+	} else {
+		return fake.openReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) OpenCallCount() int {
+	fake.openMutex.RLock()
+	defer fake.openMutex.RUnlock()
+	return len(fake.openArgsForCall)
+}
+
+func (fake *FakeFirewall) OpenArgsForCall(i int) (lager.Logger, string, garden.NetOutRule) {
+	fake.openMutex.RLock()
+	defer fake.openMutex.RUnlock()
+	return fake.openArgsForCall[i].log, fake.openArgsForCall[i].instance, fake.openArgsForCall[i].rule
+}
+
+func (fake *FakeFirewall) OpenReturns(result1 error) {
+	fake.OpenStub = nil
+	fake.openReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Close(log lager.Logger, instance string, rule garden.NetOutRule) error {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}{log, instance, rule})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		return fake.CloseStub(log, instance, rule)
+	} else {
+		return fake.closeReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeFirewall) CloseArgsForCall(i int) (lager.Logger, string, garden.NetOutRule) {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return fake.closeArgsForCall[i].log, fake.closeArgsForCall[i].instance, fake.closeArgsForCall[i].rule
+}
+
+func (fake *FakeFirewall) CloseReturns(result1 error) {
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) GlobalChainsExist() (bool, error) {
+	fake.globalChainsExistMutex.Lock()
+	fake.globalChainsExistArgsForCall = append(fake.globalChainsExistArgsForCall, struct{}{})
+	fake.globalChainsExistMutex.Unlock()
+	if fake.GlobalChainsExistStub != nil {
+		return fake.GlobalChainsExistStub()
+	} else {
+		return fake.globalChainsExistReturns.result1, fake.globalChainsExistReturns.result2
+	}
+}
+
+func (fake *FakeFirewall) GlobalChainsExistCallCount() int {
+	fake.globalChainsExistMutex.RLock()
+	defer fake.globalChainsExistMutex.RUnlock()
+	return len(fake.globalChainsExistArgsForCall)
+}
+
+func (fake *FakeFirewall) GlobalChainsExistReturns(result1 bool, result2 error) {
+	fake.GlobalChainsExistStub = nil
+	fake.globalChainsExistReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFirewall) InstanceChains() ([]string, error) {
+	fake.instanceChainsMutex.Lock()
+	fake.instanceChainsArgsForCall = append(fake.instanceChainsArgsForCall, struct{}{})
+	fake.instanceChainsMutex.Unlock()
+	if fake.InstanceChainsStub != nil {
+		return fake.InstanceChainsStub()
+	} else {
+		return fake.instanceChainsReturns.result1, fake.instanceChainsReturns.result2
+	}
+}
+
+func (fake *FakeFirewall) InstanceChainsCallCount() int {
+	fake.instanceChainsMutex.RLock()
+	defer fake.instanceChainsMutex.RUnlock()
+	return len(fake.instanceChainsArgsForCall)
+}
+
+func (fake *FakeFirewall) InstanceChainsReturns(result1 []string, result2 error) {
+	fake.InstanceChainsStub = nil
+	fake.instanceChainsReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFirewall) InstanceChainsIntact(instanceID string) (bool, error) {
+	fake.instanceChainsIntactMutex.Lock()
+	fake.instanceChainsIntactArgsForCall = append(fake.instanceChainsIntactArgsForCall, struct {
+		instanceID string
+	}{instanceID})
+	fake.instanceChainsIntactMutex.Unlock()
+	if fake.InstanceChainsIntactStub != nil {
+		return fake.InstanceChainsIntactStub(instanceID)
+	} else {
+		return fake.instanceChainsIntactReturns.result1, fake.instanceChainsIntactReturns.result2
+	}
+}
+
+func (fake *FakeFirewall) InstanceChainsIntactCallCount() int {
+	fake.instanceChainsIntactMutex.RLock()
+	defer fake.instanceChainsIntactMutex.RUnlock()
+	return len(fake.instanceChainsIntactArgsForCall)
+}
+
+func (fake *FakeFirewall) InstanceChainsIntactArgsForCall(i int) string {
+	fake.instanceChainsIntactMutex.RLock()
+	defer fake.instanceChainsIntactMutex.RUnlock()
+	return fake.instanceChainsIntactArgsForCall[i].instanceID
+}
+
+func (fake *FakeFirewall) InstanceChainsIntactReturns(result1 bool, result2 error) {
+	fake.InstanceChainsIntactStub = nil
+	fake.instanceChainsIntactReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFirewall) PortForwardExists(spec kawasaki.PortForwarderSpec) (bool, error) {
+	fake.portForwardExistsMutex.Lock()
+	fake.portForwardExistsArgsForCall = append(fake.portForwardExistsArgsForCall, struct {
+		spec kawasaki.PortForwarderSpec
+	}{spec})
+	fake.portForwardExistsMutex.Unlock()
+	if fake.PortForwardExistsStub != nil {
+		return fake.PortForwardExistsStub(spec)
+	} else {
+		return fake.portForwardExistsReturns.result1, fake.portForwardExistsReturns.result2
+	}
+}
+
+func (fake *FakeFirewall) PortForwardExistsCallCount() int {
+	fake.portForwardExistsMutex.RLock()
+	defer fake.portForwardExistsMutex.RUnlock()
+	return len(fake.portForwardExistsArgsForCall)
+}
+
+func (fake *FakeFirewall) PortForwardExistsArgsForCall(i int) kawasaki.PortForwarderSpec {
+	fake.portForwardExistsMutex.RLock()
+	defer fake.portForwardExistsMutex.RUnlock()
+	return fake.portForwardExistsArgsForCall[i].spec
+}
+
+func (fake *FakeFirewall) PortForwardExistsReturns(result1 bool, result2 error) {
+	fake.PortForwardExistsStub = nil
+	fake.portForwardExistsReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFirewall) NetOutExists(instance string, rule garden.NetOutRule) (bool, error) {
+	fake.netOutExistsMutex.Lock()
+	fake.netOutExistsArgsForCall = append(fake.netOutExistsArgsForCall, struct {
+		instance string
+		rule     garden.NetOutRule
+	}{instance, rule})
+	fake.netOutExistsMutex.Unlock()
+	if fake.NetOutExistsStub != nil {
+		return fake.NetOutExistsStub(instance, rule)
+	} else {
+		return fake.netOutExistsReturns.result1, fake.netOutExistsReturns.result2
+	}
+}
+
+func (fake *FakeFirewall) NetOutExistsCallCount() int {
+	fake.netOutExistsMutex.RLock()
+	defer fake.netOutExistsMutex.RUnlock()
+	return len(fake.netOutExistsArgsForCall)
+}
+
+func (fake *FakeFirewall) NetOutExistsArgsForCall(i int) (string, garden.NetOutRule) {
+	fake.netOutExistsMutex.RLock()
+	defer fake.netOutExistsMutex.RUnlock()
+	return fake.netOutExistsArgsForCall[i].instance, fake.netOutExistsArgsForCall[i].rule
+}
+
+func (fake *FakeFirewall) NetOutExistsReturns(result1 bool, result2 error) {
+	fake.NetOutExistsStub = nil
+	fake.netOutExistsReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFirewall) Join(logger lager.Logger, instanceChain string, group string, ip net.IP, network *net.IPNet) error {
+	fake.joinMutex.Lock()
+	fake.joinArgsForCall = append(fake.joinArgsForCall, struct {
+		logger        lager.Logger
+		instanceChain string
+		group         string
+		ip            net.IP
+		network       *net.IPNet
+	}{logger, instanceChain, group, ip, network})
+	fake.joinMutex.Unlock()
+	if fake.JoinStub != nil {
+		return fake.JoinStub(logger, instanceChain, group, ip, network)
+	} else {
+		return fake.joinReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) JoinCallCount() int {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return len(fake.joinArgsForCall)
+}
+
+func (fake *FakeFirewall) JoinArgsForCall(i int) (lager.Logger, string, string, net.IP, *net.IPNet) {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return fake.joinArgsForCall[i].logger, fake.joinArgsForCall[i].instanceChain, fake.joinArgsForCall[i].group, fake.joinArgsForCall[i].ip, fake.joinArgsForCall[i].network
+}
+
+func (fake *FakeFirewall) JoinReturns(result1 error) {
+	fake.JoinStub = nil
+	fake.joinReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Leave(logger lager.Logger, group string, ip net.IP) error {
+	fake.leaveMutex.Lock()
+	fake.leaveArgsForCall = append(fake.leaveArgsForCall, struct {
+		logger lager.Logger
+		group  string
+		ip     net.IP
+	}{logger, group, ip})
+	fake.leaveMutex.Unlock()
+	if fake.LeaveStub != nil {
+		return fake.LeaveStub(logger, group, ip)
+	} else {
+		return fake.leaveReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) LeaveCallCount() int {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return len(fake.leaveArgsForCall)
+}
+
+func (fake *FakeFirewall) LeaveArgsForCall(i int) (lager.Logger, string, net.IP) {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return fake.leaveArgsForCall[i].logger, fake.leaveArgsForCall[i].group, fake.leaveArgsForCall[i].ip
+}
+
+func (fake *FakeFirewall) LeaveReturns(result1 error) {
+	fake.LeaveStub = nil
+	fake.leaveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFirewall) Override(logger lager.Logger, instanceChain string, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error {
+	fake.overrideMutex.Lock()
+	fake.overrideArgsForCall = append(fake.overrideArgsForCall, struct {
+		logger        lager.Logger
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		overrides     kawasaki.FirewallOverrides
+	}{logger, instanceChain, bridgeName, ip, overrides})
+	fake.overrideMutex.Unlock()
+	if fake.OverrideStub != nil {
+		return fake.OverrideStub(logger, instanceChain, bridgeName, ip, overrides)
+	} else {
+		return fake.overrideReturns.result1
+	}
+}
+
+func (fake *FakeFirewall) OverrideCallCount() int {
+	fake.overrideMutex.RLock()
+	defer fake.overrideMutex.RUnlock()
+	return len(fake.overrideArgsForCall)
+}
+
+func (fake *FakeFirewall) OverrideArgsForCall(i int) (lager.Logger, string, string, net.IP, kawasaki.FirewallOverrides) {
+	fake.overrideMutex.RLock()
+	defer fake.overrideMutex.RUnlock()
+	return fake.overrideArgsForCall[i].logger, fake.overrideArgsForCall[i].instanceChain, fake.overrideArgsForCall[i].bridgeName, fake.overrideArgsForCall[i].ip, fake.overrideArgsForCall[i].overrides
+}
+
+func (fake *FakeFirewall) OverrideReturns(result1 error) {
+	fake.OverrideStub = nil
+	fake.overrideReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ kawasaki.Firewall = new(FakeFirewall)
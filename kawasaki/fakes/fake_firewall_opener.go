@@ -20,6 +20,16 @@ type FakeFirewallOpener struct {
 	openReturns struct {
 		result1 error
 	}
+	CloseStub        func(log lager.Logger, instance string, rule garden.NetOutRule) error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}
+	closeReturns struct {
+		result1 error
+	}
 }
 
 func (fake *FakeFirewallOpener) Open(log lager.Logger, instance string, rule garden.NetOutRule) error {
@@ -56,4 +66,38 @@ func (fake *FakeFirewallOpener) OpenReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeFirewallOpener) Close(log lager.Logger, instance string, rule garden.NetOutRule) error {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+		log      lager.Logger
+		instance string
+		rule     garden.NetOutRule
+	}{log, instance, rule})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		return fake.CloseStub(log, instance, rule)
+	} else {
+		return fake.closeReturns.result1
+	}
+}
+
+func (fake *FakeFirewallOpener) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeFirewallOpener) CloseArgsForCall(i int) (lager.Logger, string, garden.NetOutRule) {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return fake.closeArgsForCall[i].log, fake.closeArgsForCall[i].instance, fake.closeArgsForCall[i].rule
+}
+
+func (fake *FakeFirewallOpener) CloseReturns(result1 error) {
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ kawasaki.FirewallOpener = new(FakeFirewallOpener)
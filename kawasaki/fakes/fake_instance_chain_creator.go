@@ -10,10 +10,11 @@ import (
 )
 
 type FakeInstanceChainCreator struct {
-	CreateStub        func(logger lager.Logger, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error
+	CreateStub        func(logger lager.Logger, handle, instanceChain, bridgeName string, ip net.IP, network *net.IPNet) error
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
 		logger        lager.Logger
+		handle        string
 		instanceChain string
 		bridgeName    string
 		ip            net.IP
@@ -31,20 +32,33 @@ type FakeInstanceChainCreator struct {
 	destroyReturns struct {
 		result1 error
 	}
+	OverrideStub        func(logger lager.Logger, instanceChain string, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error
+	overrideMutex       sync.RWMutex
+	overrideArgsForCall []struct {
+		logger        lager.Logger
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		overrides     kawasaki.FirewallOverrides
+	}
+	overrideReturns struct {
+		result1 error
+	}
 }
 
-func (fake *FakeInstanceChainCreator) Create(logger lager.Logger, instanceChain string, bridgeName string, ip net.IP, network *net.IPNet) error {
+func (fake *FakeInstanceChainCreator) Create(logger lager.Logger, handle string, instanceChain string, bridgeName string, ip net.IP, network *net.IPNet) error {
 	fake.createMutex.Lock()
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
 		logger        lager.Logger
+		handle        string
 		instanceChain string
 		bridgeName    string
 		ip            net.IP
 		network       *net.IPNet
-	}{logger, instanceChain, bridgeName, ip, network})
+	}{logger, handle, instanceChain, bridgeName, ip, network})
 	fake.createMutex.Unlock()
 	if fake.CreateStub != nil {
-		return fake.CreateStub(logger, instanceChain, bridgeName, ip, network)
+		return fake.CreateStub(logger, handle, instanceChain, bridgeName, ip, network)
 	} else {
 		return fake.createReturns.result1
 	}
@@ -56,10 +70,10 @@ func (fake *FakeInstanceChainCreator) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeInstanceChainCreator) CreateArgsForCall(i int) (lager.Logger, string, string, net.IP, *net.IPNet) {
+func (fake *FakeInstanceChainCreator) CreateArgsForCall(i int) (lager.Logger, string, string, string, net.IP, *net.IPNet) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
-	return fake.createArgsForCall[i].logger, fake.createArgsForCall[i].instanceChain, fake.createArgsForCall[i].bridgeName, fake.createArgsForCall[i].ip, fake.createArgsForCall[i].network
+	return fake.createArgsForCall[i].logger, fake.createArgsForCall[i].handle, fake.createArgsForCall[i].instanceChain, fake.createArgsForCall[i].bridgeName, fake.createArgsForCall[i].ip, fake.createArgsForCall[i].network
 }
 
 func (fake *FakeInstanceChainCreator) CreateReturns(result1 error) {
@@ -102,4 +116,40 @@ func (fake *FakeInstanceChainCreator) DestroyReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeInstanceChainCreator) Override(logger lager.Logger, instanceChain string, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error {
+	fake.overrideMutex.Lock()
+	fake.overrideArgsForCall = append(fake.overrideArgsForCall, struct {
+		logger        lager.Logger
+		instanceChain string
+		bridgeName    string
+		ip            net.IP
+		overrides     kawasaki.FirewallOverrides
+	}{logger, instanceChain, bridgeName, ip, overrides})
+	fake.overrideMutex.Unlock()
+	if fake.OverrideStub != nil {
+		return fake.OverrideStub(logger, instanceChain, bridgeName, ip, overrides)
+	} else {
+		return fake.overrideReturns.result1
+	}
+}
+
+func (fake *FakeInstanceChainCreator) OverrideCallCount() int {
+	fake.overrideMutex.RLock()
+	defer fake.overrideMutex.RUnlock()
+	return len(fake.overrideArgsForCall)
+}
+
+func (fake *FakeInstanceChainCreator) OverrideArgsForCall(i int) (lager.Logger, string, string, net.IP, kawasaki.FirewallOverrides) {
+	fake.overrideMutex.RLock()
+	defer fake.overrideMutex.RUnlock()
+	return fake.overrideArgsForCall[i].logger, fake.overrideArgsForCall[i].instanceChain, fake.overrideArgsForCall[i].bridgeName, fake.overrideArgsForCall[i].ip, fake.overrideArgsForCall[i].overrides
+}
+
+func (fake *FakeInstanceChainCreator) OverrideReturns(result1 error) {
+	fake.OverrideStub = nil
+	fake.overrideReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ kawasaki.InstanceChainCreator = new(FakeInstanceChainCreator)
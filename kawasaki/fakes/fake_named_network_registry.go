@@ -0,0 +1,163 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeNamedNetworkRegistry struct {
+	JoinStub        func(log lager.Logger, name string, handle string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error)
+	joinMutex       sync.RWMutex
+	joinArgsForCall []struct {
+		log     lager.Logger
+		name    string
+		handle  string
+		acquire kawasaki.AcquireFunc
+	}
+	joinReturns struct {
+		result1 *net.IPNet
+		result2 net.IP
+		result3 error
+	}
+	LeaveStub        func(log lager.Logger, name string, handle string)
+	leaveMutex       sync.RWMutex
+	leaveArgsForCall []struct {
+		log    lager.Logger
+		name   string
+		handle string
+	}
+	RecordStub        func(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP)
+	recordMutex       sync.RWMutex
+	recordArgsForCall []struct {
+		log    lager.Logger
+		handle string
+		subnet *net.IPNet
+		ip     net.IP
+	}
+	ForgetStub        func(log lager.Logger, handle string, subnet *net.IPNet)
+	forgetMutex       sync.RWMutex
+	forgetArgsForCall []struct {
+		log    lager.Logger
+		handle string
+		subnet *net.IPNet
+	}
+}
+
+func (fake *FakeNamedNetworkRegistry) Join(log lager.Logger, name string, handle string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error) {
+	fake.joinMutex.Lock()
+	fake.joinArgsForCall = append(fake.joinArgsForCall, struct {
+		log     lager.Logger
+		name    string
+		handle  string
+		acquire kawasaki.AcquireFunc
+	}{log, name, handle, acquire})
+	fake.joinMutex.Unlock()
+	if fake.JoinStub != nil {
+		return fake.JoinStub(log, name, handle, acquire)
+	} else {
+		return fake.joinReturns.result1, fake.joinReturns.result2, fake.joinReturns.result3
+	}
+}
+
+func (fake *FakeNamedNetworkRegistry) JoinCallCount() int {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return len(fake.joinArgsForCall)
+}
+
+func (fake *FakeNamedNetworkRegistry) JoinArgsForCall(i int) (lager.Logger, string, string, kawasaki.AcquireFunc) {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return fake.joinArgsForCall[i].log, fake.joinArgsForCall[i].name, fake.joinArgsForCall[i].handle, fake.joinArgsForCall[i].acquire
+}
+
+func (fake *FakeNamedNetworkRegistry) JoinReturns(result1 *net.IPNet, result2 net.IP, result3 error) {
+	fake.JoinStub = nil
+	fake.joinReturns = struct {
+		result1 *net.IPNet
+		result2 net.IP
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeNamedNetworkRegistry) Leave(log lager.Logger, name string, handle string) {
+	fake.leaveMutex.Lock()
+	fake.leaveArgsForCall = append(fake.leaveArgsForCall, struct {
+		log    lager.Logger
+		name   string
+		handle string
+	}{log, name, handle})
+	fake.leaveMutex.Unlock()
+	if fake.LeaveStub != nil {
+		fake.LeaveStub(log, name, handle)
+	}
+}
+
+func (fake *FakeNamedNetworkRegistry) LeaveCallCount() int {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return len(fake.leaveArgsForCall)
+}
+
+func (fake *FakeNamedNetworkRegistry) LeaveArgsForCall(i int) (lager.Logger, string, string) {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return fake.leaveArgsForCall[i].log, fake.leaveArgsForCall[i].name, fake.leaveArgsForCall[i].handle
+}
+
+func (fake *FakeNamedNetworkRegistry) Record(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP) {
+	fake.recordMutex.Lock()
+	fake.recordArgsForCall = append(fake.recordArgsForCall, struct {
+		log    lager.Logger
+		handle string
+		subnet *net.IPNet
+		ip     net.IP
+	}{log, handle, subnet, ip})
+	fake.recordMutex.Unlock()
+	if fake.RecordStub != nil {
+		fake.RecordStub(log, handle, subnet, ip)
+	}
+}
+
+func (fake *FakeNamedNetworkRegistry) RecordCallCount() int {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return len(fake.recordArgsForCall)
+}
+
+func (fake *FakeNamedNetworkRegistry) RecordArgsForCall(i int) (lager.Logger, string, *net.IPNet, net.IP) {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return fake.recordArgsForCall[i].log, fake.recordArgsForCall[i].handle, fake.recordArgsForCall[i].subnet, fake.recordArgsForCall[i].ip
+}
+
+func (fake *FakeNamedNetworkRegistry) Forget(log lager.Logger, handle string, subnet *net.IPNet) {
+	fake.forgetMutex.Lock()
+	fake.forgetArgsForCall = append(fake.forgetArgsForCall, struct {
+		log    lager.Logger
+		handle string
+		subnet *net.IPNet
+	}{log, handle, subnet})
+	fake.forgetMutex.Unlock()
+	if fake.ForgetStub != nil {
+		fake.ForgetStub(log, handle, subnet)
+	}
+}
+
+func (fake *FakeNamedNetworkRegistry) ForgetCallCount() int {
+	fake.forgetMutex.RLock()
+	defer fake.forgetMutex.RUnlock()
+	return len(fake.forgetArgsForCall)
+}
+
+func (fake *FakeNamedNetworkRegistry) ForgetArgsForCall(i int) (lager.Logger, string, *net.IPNet) {
+	fake.forgetMutex.RLock()
+	defer fake.forgetMutex.RUnlock()
+	return fake.forgetArgsForCall[i].log, fake.forgetArgsForCall[i].handle, fake.forgetArgsForCall[i].subnet
+}
+
+var _ kawasaki.NamedNetworkRegistry = new(FakeNamedNetworkRegistry)
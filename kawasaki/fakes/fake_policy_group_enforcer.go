@@ -0,0 +1,107 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakePolicyGroupEnforcer struct {
+	JoinStub        func(logger lager.Logger, instanceChain string, group string, ip net.IP, network *net.IPNet) error
+	joinMutex       sync.RWMutex
+	joinArgsForCall []struct {
+		logger        lager.Logger
+		instanceChain string
+		group         string
+		ip            net.IP
+		network       *net.IPNet
+	}
+	joinReturns struct {
+		result1 error
+	}
+	LeaveStub        func(logger lager.Logger, group string, ip net.IP) error
+	leaveMutex       sync.RWMutex
+	leaveArgsForCall []struct {
+		logger lager.Logger
+		group  string
+		ip     net.IP
+	}
+	leaveReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakePolicyGroupEnforcer) Join(logger lager.Logger, instanceChain string, group string, ip net.IP, network *net.IPNet) error {
+	fake.joinMutex.Lock()
+	fake.joinArgsForCall = append(fake.joinArgsForCall, struct {
+		logger        lager.Logger
+		instanceChain string
+		group         string
+		ip            net.IP
+		network       *net.IPNet
+	}{logger, instanceChain, group, ip, network})
+	fake.joinMutex.Unlock()
+	if fake.JoinStub != nil {
+		return fake.JoinStub(logger, instanceChain, group, ip, network)
+	} else {
+		return fake.joinReturns.result1
+	}
+}
+
+func (fake *FakePolicyGroupEnforcer) JoinCallCount() int {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return len(fake.joinArgsForCall)
+}
+
+func (fake *FakePolicyGroupEnforcer) JoinArgsForCall(i int) (lager.Logger, string, string, net.IP, *net.IPNet) {
+	fake.joinMutex.RLock()
+	defer fake.joinMutex.RUnlock()
+	return fake.joinArgsForCall[i].logger, fake.joinArgsForCall[i].instanceChain, fake.joinArgsForCall[i].group, fake.joinArgsForCall[i].ip, fake.joinArgsForCall[i].network
+}
+
+func (fake *FakePolicyGroupEnforcer) JoinReturns(result1 error) {
+	fake.JoinStub = nil
+	fake.joinReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakePolicyGroupEnforcer) Leave(logger lager.Logger, group string, ip net.IP) error {
+	fake.leaveMutex.Lock()
+	fake.leaveArgsForCall = append(fake.leaveArgsForCall, struct {
+		logger lager.Logger
+		group  string
+		ip     net.IP
+	}{logger, group, ip})
+	fake.leaveMutex.Unlock()
+	if fake.LeaveStub != nil {
+		return fake.LeaveStub(logger, group, ip)
+	} else {
+		return fake.leaveReturns.result1
+	}
+}
+
+func (fake *FakePolicyGroupEnforcer) LeaveCallCount() int {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return len(fake.leaveArgsForCall)
+}
+
+func (fake *FakePolicyGroupEnforcer) LeaveArgsForCall(i int) (lager.Logger, string, net.IP) {
+	fake.leaveMutex.RLock()
+	defer fake.leaveMutex.RUnlock()
+	return fake.leaveArgsForCall[i].logger, fake.leaveArgsForCall[i].group, fake.leaveArgsForCall[i].ip
+}
+
+func (fake *FakePolicyGroupEnforcer) LeaveReturns(result1 error) {
+	fake.LeaveStub = nil
+	fake.leaveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ kawasaki.PolicyGroupEnforcer = new(FakePolicyGroupEnforcer)
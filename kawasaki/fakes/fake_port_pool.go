@@ -15,6 +15,20 @@ type FakePortPool struct {
 		result1 uint32
 		result2 error
 	}
+	AcquireRangeStub        func(size uint32) (uint32, error)
+	acquireRangeMutex       sync.RWMutex
+	acquireRangeArgsForCall []struct {
+		size uint32
+	}
+	acquireRangeReturns struct {
+		result1 uint32
+		result2 error
+	}
+	ReleaseStub        func(port uint32)
+	releaseMutex       sync.RWMutex
+	releaseArgsForCall []struct {
+		port uint32
+	}
 }
 
 func (fake *FakePortPool) Acquire() (uint32, error) {
@@ -42,4 +56,60 @@ func (fake *FakePortPool) AcquireReturns(result1 uint32, result2 error) {
 	}{result1, result2}
 }
 
+func (fake *FakePortPool) AcquireRange(size uint32) (uint32, error) {
+	fake.acquireRangeMutex.Lock()
+	fake.acquireRangeArgsForCall = append(fake.acquireRangeArgsForCall, struct {
+		size uint32
+	}{size})
+	fake.acquireRangeMutex.Unlock()
+	if fake.AcquireRangeStub != nil {
+		return fake.AcquireRangeStub(size)
+	} else {
+		return fake.acquireRangeReturns.result1, fake.acquireRangeReturns.result2
+	}
+}
+
+func (fake *FakePortPool) AcquireRangeCallCount() int {
+	fake.acquireRangeMutex.RLock()
+	defer fake.acquireRangeMutex.RUnlock()
+	return len(fake.acquireRangeArgsForCall)
+}
+
+func (fake *FakePortPool) AcquireRangeArgsForCall(i int) uint32 {
+	fake.acquireRangeMutex.RLock()
+	defer fake.acquireRangeMutex.RUnlock()
+	return fake.acquireRangeArgsForCall[i].size
+}
+
+func (fake *FakePortPool) AcquireRangeReturns(result1 uint32, result2 error) {
+	fake.AcquireRangeStub = nil
+	fake.acquireRangeReturns = struct {
+		result1 uint32
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePortPool) Release(port uint32) {
+	fake.releaseMutex.Lock()
+	fake.releaseArgsForCall = append(fake.releaseArgsForCall, struct {
+		port uint32
+	}{port})
+	fake.releaseMutex.Unlock()
+	if fake.ReleaseStub != nil {
+		fake.ReleaseStub(port)
+	}
+}
+
+func (fake *FakePortPool) ReleaseCallCount() int {
+	fake.releaseMutex.RLock()
+	defer fake.releaseMutex.RUnlock()
+	return len(fake.releaseArgsForCall)
+}
+
+func (fake *FakePortPool) ReleaseArgsForCall(i int) uint32 {
+	fake.releaseMutex.RLock()
+	defer fake.releaseMutex.RUnlock()
+	return fake.releaseArgsForCall[i].port
+}
+
 var _ kawasaki.PortPool = new(FakePortPool)
@@ -0,0 +1,69 @@
+package kawasaki
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// HostAccessProperty is the container property which, when set to "true" or
+// "false", overrides whether the container may reach the host, as otherwise
+// set for all containers by -allowHostAccess. Like the other overrides it may
+// only tighten the global settings, i.e. deny host access, unless the
+// operator allows containers to be granted host access with
+// -allowHostAccessOverride.
+const HostAccessProperty = "network.host-access"
+
+// DenyNetworksProperty is the container property listing IPs and CIDR blocks
+// the container may not reach, in addition to those in -denyNetworks.
+// NetOut rules may still open them, as for -denyNetworks.
+const DenyNetworksProperty = "network.deny-networks"
+
+// FirewallOverrides are a container's exceptions to the firewall settings
+// which apply to all containers
+type FirewallOverrides struct {
+	HostAccess   *bool
+	DenyNetworks []string
+}
+
+func (o FirewallOverrides) empty() bool {
+	return o.HostAccess == nil && len(o.DenyNetworks) == 0
+}
+
+// loadFirewallOverrides returns the overrides given by the container's
+// HostAccessProperty and DenyNetworksProperty. Granting host access is refused
+// unless allowHostAccessOverride is set.
+func loadFirewallOverrides(configStore ConfigStore, handle string, allowHostAccessOverride bool) (FirewallOverrides, error) {
+	var overrides FirewallOverrides
+
+	if value, err := configStore.Get(handle, HostAccessProperty); err == nil && value != "" {
+		hostAccess, err := strconv.ParseBool(value)
+		if err != nil {
+			return FirewallOverrides{}, fmt.Errorf("invalid %s property: '%s' must be 'true' or 'false'", HostAccessProperty, value)
+		}
+
+		if hostAccess && !allowHostAccessOverride {
+			return FirewallOverrides{}, fmt.Errorf("invalid %s property: host access may only be granted to containers when the server allows it with -allowHostAccessOverride", HostAccessProperty)
+		}
+
+		overrides.HostAccess = &hostAccess
+	}
+
+	if value, err := configStore.Get(handle, DenyNetworksProperty); err == nil {
+		for _, network := range strings.Split(value, ",") {
+			network = strings.TrimSpace(network)
+			if network == "" {
+				continue
+			}
+
+			if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+				return FirewallOverrides{}, fmt.Errorf("invalid %s property: '%s' is not an IP address or CIDR block", DenyNetworksProperty, network)
+			}
+
+			overrides.DenyNetworks = append(overrides.DenyNetworks, network)
+		}
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,31 @@
+package iptables
+
+import "github.com/cloudfoundry-incubator/guardian/kawasaki"
+
+// Firewall provides kawasaki's packet filtering and NAT on top of iptables
+type Firewall struct {
+	*Starter
+	*InstanceChainCreator
+	*PortForwarder
+	*FirewallOpener
+	*PolicyGroups
+}
+
+func NewFirewall(iptables *IPTables, logMethod string, allowHostAccess, embeddedDNS bool, nicPrefix string, allowNetworks, denyNetworks []string, policies kawasaki.NetworkPolicies, defaultInterface func() (string, error)) *Firewall {
+	return &Firewall{
+		Starter:              NewStarter(iptables, allowHostAccess, embeddedDNS, nicPrefix, allowNetworks, denyNetworks, defaultInterface),
+		InstanceChainCreator: NewInstanceChainCreator(iptables, logMethod, embeddedDNS),
+		PortForwarder:        NewPortForwarder(iptables),
+		FirewallOpener:       NewFirewallOpener(iptables),
+		PolicyGroups:         NewPolicyGroups(iptables, policies),
+	}
+}
+
+// Start sets up the global chains and then the policy groups' ipsets
+func (f *Firewall) Start() error {
+	if err := f.Starter.Start(); err != nil {
+		return err
+	}
+
+	return f.PolicyGroups.Start()
+}
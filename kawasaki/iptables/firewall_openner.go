@@ -24,6 +24,48 @@ func (f *FirewallOpener) Open(logger lager.Logger, instance string, r garden.Net
 	logger = logger.Session("prepend-filter-rule", lager.Data{"rule": r, "instance": instance, "chain": chain})
 	logger.Debug("started")
 
+	if err := f.eachFilterRule(r, func(filter singleFilterRule) error {
+		return f.iptables.prependRule(chain, filter)
+	}); err != nil {
+		return err
+	}
+
+	logger.Debug("ending")
+	return nil
+}
+
+// Close removes the rules added by an Open call with the same NetOutRule
+func (f *FirewallOpener) Close(logger lager.Logger, instance string, r garden.NetOutRule) error {
+	chain := f.iptables.instanceChain(instance)
+
+	logger = logger.Session("delete-filter-rule", lager.Data{"rule": r, "instance": instance, "chain": chain})
+	logger.Debug("started")
+
+	if err := f.eachFilterRule(r, func(filter singleFilterRule) error {
+		return f.iptables.deleteRule(chain, filter)
+	}); err != nil {
+		return err
+	}
+
+	logger.Debug("ending")
+	return nil
+}
+
+// NetOutExists reports whether all of the rules added by an Open call with the
+// same NetOutRule are in place
+func (f *FirewallOpener) NetOutExists(instance string, r garden.NetOutRule) (bool, error) {
+	chain := f.iptables.instanceChain(instance)
+
+	exists := true
+	err := f.eachFilterRule(r, func(filter singleFilterRule) error {
+		exists = exists && f.iptables.check(chain, filter)
+		return nil
+	})
+
+	return exists, err
+}
+
+func (f *FirewallOpener) eachFilterRule(r garden.NetOutRule, apply func(filter singleFilterRule) error) error {
 	if len(r.Ports) > 0 && !allowsPort(r.Protocol) {
 		return fmt.Errorf("Ports cannot be specified for Protocol %s", strings.ToUpper(protocols[r.Protocol]))
 	}
@@ -32,6 +74,8 @@ func (f *FirewallOpener) Open(logger lager.Logger, instance string, r garden.Net
 		Protocol: r.Protocol,
 		ICMPs:    r.ICMPs,
 		Log:      r.Log,
+
+		family: f.iptables.family,
 	}
 
 	if _, ok := protocols[r.Protocol]; !ok {
@@ -52,13 +96,12 @@ func (f *FirewallOpener) Open(logger lager.Logger, instance string, r garden.Net
 				filter.Networks = &r.Networks[j]
 			}
 
-			if err := f.iptables.prependRule(chain, filter); err != nil {
+			if err := apply(filter); err != nil {
 				return err
 			}
 		}
 	}
 
-	logger.Debug("ending")
 	return nil
 }
 
@@ -266,6 +266,28 @@ var _ = Describe("FirewallOpenner", func() {
 						}))
 					})
 				})
+
+				Context("when the rules are for IPv6", func() {
+					BeforeEach(func() {
+						opener = iptables.NewFirewallOpener(
+							iptables.NewIPv6(fakeRunner, "prefix-"),
+						)
+					})
+
+					It("passes the icmpv6 protocol and type to ip6tables", func() {
+						Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{
+							Protocol: garden.ProtocolICMP,
+							ICMPs: &garden.ICMPControl{
+								Type: 128,
+							},
+						})).To(Succeed())
+
+						Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+							Path: "/sbin/ip6tables",
+							Args: []string{"-w", "-I", "prefix-instance-foo-bar-baz", "1", "--protocol", "icmpv6", "--icmpv6-type", "128", "--jump", "RETURN"},
+						}))
+					})
+				})
 			})
 		})
 
@@ -367,4 +389,95 @@ var _ = Describe("FirewallOpenner", func() {
 			})
 		})
 	})
+
+	Describe("Close", func() {
+		It("deletes the rules added by Open for the same NetOutRule", func() {
+			Expect(opener.Close(logger, "foo-bar-baz", garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Networks: []garden.IPRange{
+					{Start: net.ParseIP("1.2.3.4")},
+					{Start: net.ParseIP("2.2.3.4")},
+				},
+				Ports: []garden.PortRange{{Start: 80, End: 80}},
+			})).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-D", "prefix-instance-foo-bar-baz", "--protocol", "tcp", "--destination", "1.2.3.4", "--destination-port", "80", "--jump", "RETURN"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-D", "prefix-instance-foo-bar-baz", "--protocol", "tcp", "--destination", "2.2.3.4", "--destination-port", "80", "--jump", "RETURN"},
+				},
+			))
+		})
+
+		Context("when an invaild protocol is specified", func() {
+			It("returns an error", func() {
+				Expect(opener.Close(logger, "foo-bar-baz", garden.NetOutRule{
+					Protocol: garden.Protocol(52),
+				})).To(MatchError("invalid protocol: 52"))
+			})
+		})
+
+		Context("when the command returns an error", func() {
+			It("returns a wrapped error, including stderr", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{Path: "/sbin/iptables"},
+					func(cmd *exec.Cmd) error {
+						cmd.Stderr.Write([]byte("stderr contents"))
+						return errors.New("no such rule")
+					},
+				)
+
+				Expect(opener.Close(logger, "foo-bar-baz", garden.NetOutRule{})).
+					To(MatchError("iptables delete: stderr contents"))
+			})
+		})
+	})
+
+	Describe("NetOutExists", func() {
+		rule := garden.NetOutRule{
+			Protocol: garden.ProtocolTCP,
+			Networks: []garden.IPRange{{Start: net.ParseIP("1.2.3.4")}, {Start: net.ParseIP("2.2.3.4")}},
+		}
+
+		It("checks for each of the rule's iptables rules", func() {
+			Expect(opener.NetOutExists("foo-bar-baz", rule)).To(BeTrue())
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-C", "prefix-instance-foo-bar-baz", "--protocol", "tcp", "--destination", "1.2.3.4", "--jump", "RETURN"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-C", "prefix-instance-foo-bar-baz", "--protocol", "tcp", "--destination", "2.2.3.4", "--jump", "RETURN"},
+				},
+			))
+		})
+
+		Context("when one of the iptables rules is missing", func() {
+			It("returns false", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/sbin/iptables",
+						Args: []string{"-w", "-C", "prefix-instance-foo-bar-baz", "--protocol", "tcp", "--destination", "2.2.3.4", "--jump", "RETURN"},
+					},
+					func(cmd *exec.Cmd) error {
+						return errors.New("exit status 1")
+					},
+				)
+
+				Expect(opener.NetOutExists("foo-bar-baz", rule)).To(BeFalse())
+			})
+		})
+
+		Context("when an invaild protocol is specified", func() {
+			It("returns an error", func() {
+				_, err := opener.NetOutExists("foo-bar-baz", garden.NetOutRule{Protocol: garden.Protocol(52)})
+				Expect(err).To(MatchError("invalid protocol: 52"))
+			})
+		})
+	})
 })
@@ -2,241 +2,344 @@ package iptables
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
+	"strings"
 )
 
-const SetupScript = `
-	set -o xtrace
-	set -o nounset
-	set -o errexit
-	shopt -s nullglob
-
-	filter_input_chain="${GARDEN_IPTABLES_FILTER_INPUT_CHAIN}"
-	filter_forward_chain="${GARDEN_IPTABLES_FILTER_FORWARD_CHAIN}"
-	filter_default_chain="${GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN}"
-	filter_instance_prefix="${GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX}"
-	nat_prerouting_chain="${GARDEN_IPTABLES_NAT_PREROUTING_CHAIN}"
-	nat_postrouting_chain="${GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN}"
-	nat_instance_prefix="${GARDEN_IPTABLES_NAT_INSTANCE_PREFIX}"
+// the chain which older versions of garden dispatched all container traffic
+// through; it is removed if still present
+const deprecatedDispatchChain = "garden-dispatch"
 
-	function teardown_deprecated_rules() {
-		# Remove jump to garden-dispatch from INPUT
-		iptables -w -S INPUT 2> /dev/null |
-		grep " -j garden-dispatch" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w
+type Starter struct {
+	iptables        *IPTables
+	allowHostAccess bool
+	embeddedDNS     bool
+	nicPrefix       string
 
-		# Remove jump to garden-dispatch from FORWARD
-		iptables -w -S FORWARD 2> /dev/null |
-		grep " -j garden-dispatch" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w
-
-		# Prune garden-dispatch
-		iptables -w -F garden-dispatch 2> /dev/null || true
+	allowNetworks []string
+	denyNetworks  []string
 
-		# Delete garden-dispatch
-		iptables -w -X garden-dispatch 2> /dev/null || true
-	}
-
-	function teardown_filter() {
-		teardown_deprecated_rules
-
-		# Prune garden-forward chain
-		iptables -w -S ${filter_forward_chain} 2> /dev/null |
-		grep "\-g ${filter_instance_prefix}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w
+	defaultInterface func() (string, error)
+}
 
-		# Prune per-instance chains
-		iptables -w -S 2> /dev/null |
-		grep "^-A ${filter_instance_prefix}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w
+func NewStarter(iptables *IPTables, allowHostAccess, embeddedDNS bool, nicPrefix string, allowNetworks, denyNetworks []string, defaultInterface func() (string, error)) *Starter {
+	return &Starter{
+		iptables:        iptables,
+		allowHostAccess: allowHostAccess,
+		embeddedDNS:     embeddedDNS,
+		nicPrefix:       nicPrefix,
 
-		# Delete per-instance chains
-		iptables -w -S 2> /dev/null |
-		grep "^-N ${filter_instance_prefix}" |
-		sed -e "s/-N/-X/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w || true
+		allowNetworks: allowNetworks,
+		denyNetworks:  denyNetworks,
 
-		# Remove jump to garden-forward from FORWARD
-		iptables -w -S FORWARD 2> /dev/null |
-		grep " -j ${filter_forward_chain}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w || true
+		defaultInterface: defaultInterface,
+	}
+}
 
-		iptables -w -F ${filter_forward_chain} 2> /dev/null || true
-		iptables -w -F ${filter_default_chain} 2> /dev/null || true
+// Start tears down any chains and rules left behind by a previous run,
+// including instance chains, and then creates the global chains afresh
+func (s Starter) Start() error {
+	if err := s.setupFilter(); err != nil {
+		return fmt.Errorf("setting up default chains: %s", err)
+	}
 
-		# Remove jump to filter input chain from INPUT
-		iptables -w -S INPUT 2> /dev/null |
-		grep " -j ${filter_input_chain}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w || true
+	if err := s.setupNat(); err != nil {
+		return fmt.Errorf("setting up default chains: %s", err)
+	}
 
-		# Empty and delete filter input chain
-		iptables -w -F ${filter_input_chain} 2> /dev/null || true
-		iptables -w -X ${filter_input_chain} 2> /dev/null || true
+	if err := s.iptables.run("enable-ip-forwarding", exec.Command("sysctl", "-w", s.iptables.family.forwardingSysctl)); err != nil {
+		return fmt.Errorf("setting up default chains: %s", err)
 	}
 
-	function setup_filter() {
-		teardown_filter
+	// The filter setup flushes the default chain, so the allow rules always
+	// end up ahead of the deny rules, even across restarts.
+	for _, n := range s.allowNetworks {
+		if err := s.iptables.appendRule(s.iptables.defaultChain, allowRule(n)); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range s.denyNetworks {
+		if err := s.iptables.appendRule(s.iptables.defaultChain, rejectRule(n)); err != nil {
+			return err
+		}
+	}
 
-		# Determine interface device to the outside
-		default_interface=$(ip route show | grep default | cut -d' ' -f5 | head -1)
-
-		# Create, or empty existing, filter input chain
-		iptables -w -N ${filter_input_chain} 2> /dev/null || iptables -w -F ${filter_input_chain}
-
-		# Accept inbound packets if default interface is matched by filter prefix
-		iptables -w -I ${filter_input_chain} -i $default_interface --jump ACCEPT
-
-		# Put connection tracking rule in filter input chain
-		# to accept packets related to previously established connections
-		iptables -w -A ${filter_input_chain} -m conntrack --ctstate ESTABLISHED,RELATED --jump ACCEPT
-
-		if [ "${GARDEN_IPTABLES_ALLOW_HOST_ACCESS}" != "true" ]; then
-		iptables -w -A ${filter_input_chain} --jump REJECT --reject-with icmp-host-prohibited
-		else
-		iptables -w -A ${filter_input_chain} --jump ACCEPT
-		fi
-
-		# Forward input traffic via ${filter_input_chain}
-		iptables -w -A INPUT -i ${GARDEN_NETWORK_INTERFACE_PREFIX}+ --jump ${filter_input_chain}
-
-		# Create or flush forward chain
-		iptables -w -N ${filter_forward_chain} 2> /dev/null || iptables -w -F ${filter_forward_chain}
-		iptables -w -A ${filter_forward_chain} -j DROP
-
-		# Create or flush default chain
-		iptables -w -N ${filter_default_chain} 2> /dev/null || iptables -w -F ${filter_default_chain}
-
-		# Always allow established connections to containers
-		iptables -w -A ${filter_default_chain} -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
-
-		# Forward outbound traffic via ${filter_forward_chain}
-		iptables -w -A FORWARD -i ${GARDEN_NETWORK_INTERFACE_PREFIX}+ --jump ${filter_forward_chain}
-
-		# Forward inbound traffic immediately
-		iptables -w -I ${filter_forward_chain} -i $default_interface --jump ACCEPT
-	}
-
-	function teardown_nat() {
-		# Prune prerouting chain
-		iptables -w -t nat -S ${nat_prerouting_chain} 2> /dev/null |
-		grep "\-j ${nat_instance_prefix}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+	return nil
+}
 
-		# Prune per-instance chains
-		iptables -w -t nat -S 2> /dev/null |
-		grep "^-A ${nat_instance_prefix}" |
-		sed -e "s/-A/-D/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+// GlobalChainsExist reports whether the global chains, and the rules binding
+// them to the built-in chains, are all in place
+func (s Starter) GlobalChainsExist() (bool, error) {
+	ipt := s.iptables
 
-		# Delete per-instance chains
-		iptables -w -t nat -S 2> /dev/null |
-		grep "^-N ${nat_instance_prefix}" |
-		sed -e "s/-N/-X/" -e "s/\s\+\$//" |
-		xargs --no-run-if-empty --max-lines=1 iptables -w -t nat || true
-
-		# Flush prerouting chain
-		iptables -w -t nat -F ${nat_prerouting_chain} 2> /dev/null || true
-
-		# Flush postrouting chain
-		iptables -w -t nat -F ${nat_postrouting_chain} 2> /dev/null || true
+	rules, err := ipt.save("inspect-global-chains")
+	if err != nil {
+		return false, err
 	}
 
-	function setup_nat() {
-		teardown_nat
+	filter, nat := rules["filter"], rules["nat"]
+
+	return filter.hasChain(ipt.inputChain) &&
+		filter.hasChain(ipt.forwardChain) &&
+		filter.hasChain(ipt.defaultChain) &&
+		filter.has("INPUT", "-j", ipt.inputChain) &&
+		filter.has("FORWARD", "-j", ipt.forwardChain) &&
+		filter.has(ipt.forwardChain, "-j", "DROP") &&
+		nat.hasChain(ipt.preroutingChain) &&
+		nat.hasChain(ipt.postroutingChain) &&
+		nat.has("PREROUTING", "-j", ipt.preroutingChain) &&
+		nat.has("POSTROUTING", "-j", ipt.postroutingChain), nil
+}
 
-		# Create prerouting chain
-		iptables -w -t nat -N ${nat_prerouting_chain} 2> /dev/null || true
+func (s Starter) teardownDeprecatedRules() error {
+	// Remove jumps to garden-dispatch from INPUT and FORWARD
+	for _, chain := range []string{"INPUT", "FORWARD"} {
+		if err := s.deleteRules("filter", chain, func(r ruleSpec) bool { return r.jumpsTo(deprecatedDispatchChain) }); err != nil {
+			return err
+		}
+	}
 
-		# Bind chain to PREROUTING
-		(iptables -w -t nat -S PREROUTING | grep -q "\-j ${nat_prerouting_chain}\b") ||
-		iptables -w -t nat -A PREROUTING \
-		--jump ${nat_prerouting_chain}
+	// Empty and delete garden-dispatch, if it exists
+	s.iptables.command("-F", deprecatedDispatchChain)
+	s.iptables.command("-X", deprecatedDispatchChain)
 
-		# Bind chain to OUTPUT (for traffic originating from same host)
-		(iptables -w -t nat -S OUTPUT | grep -q "\-j ${nat_prerouting_chain}\b") ||
-		iptables -w -t nat -A OUTPUT \
-		--out-interface "lo" \
-		--jump ${nat_prerouting_chain}
+	return nil
+}
 
-		# Create postrouting chain
-		iptables -w -t nat -N ${nat_postrouting_chain} 2> /dev/null || true
+func (s Starter) teardownFilter() error {
+	ipt := s.iptables
 
-		# Bind chain to POSTROUTING
-		(iptables -w -t nat -S POSTROUTING | grep -q "\-j ${nat_postrouting_chain}\b") ||
-		iptables -w -t nat -A POSTROUTING \
-		--jump ${nat_postrouting_chain}
+	if err := s.teardownDeprecatedRules(); err != nil {
+		return err
 	}
 
-	case "${ACTION}" in
-	setup)
-	setup_filter
-	setup_nat
+	// Prune forward chain
+	if err := s.deleteRules("filter", ipt.forwardChain, func(r ruleSpec) bool { return r.targets("-g", ipt.instanceChainPrefix) }); err != nil {
+		return err
+	}
 
-	# Enable forwarding
-	echo 1 > /proc/sys/net/ipv4/ip_forward
-	;;
-	teardown)
-	teardown_filter
-	teardown_nat
-	;;
-	*)
-	echo "Unknown command: ${1}" 1>&2
-	exit 1
-	;;
-	esac
-`
+	// Empty and delete per-instance chains
+	s.removeInstanceChains("filter")
 
-type Starter struct {
-	iptables        *IPTables
-	allowHostAccess bool
-	nicPrefix       string
+	// Remove jump to forward chain from FORWARD
+	s.deleteRules("filter", "FORWARD", func(r ruleSpec) bool { return r.jumpsTo(ipt.forwardChain) })
+
+	ipt.command("-F", ipt.forwardChain)
+	ipt.command("-F", ipt.defaultChain)
+
+	// Remove jump to input chain from INPUT
+	s.deleteRules("filter", "INPUT", func(r ruleSpec) bool { return r.jumpsTo(ipt.inputChain) })
 
-	denyNetworks []string
+	// Empty and delete input chain
+	ipt.command("-F", ipt.inputChain)
+	ipt.command("-X", ipt.inputChain)
+
+	return nil
 }
 
-func NewStarter(iptables *IPTables, allowHostAccess bool, nicPrefix string, denyNetworks []string) *Starter {
-	return &Starter{
-		iptables:        iptables,
-		allowHostAccess: allowHostAccess,
-		nicPrefix:       nicPrefix,
+func (s Starter) setupFilter() error {
+	ipt := s.iptables
+
+	if err := s.teardownFilter(); err != nil {
+		return err
+	}
+
+	// Determine interface device to the outside
+	defaultInterface, err := s.defaultInterface()
+	if err != nil {
+		return fmt.Errorf("finding default interface: %s", err)
+	}
+
+	// Create, or empty existing, input chain
+	if err := s.createOrFlush(ipt.inputChain); err != nil {
+		return err
+	}
+
+	// Accept inbound packets if default interface is matched by filter prefix
+	if defaultInterface != "" {
+		if err := ipt.command("-I", ipt.inputChain, "-i", defaultInterface, "--jump", "ACCEPT"); err != nil {
+			return err
+		}
+	}
+
+	hostAccess := []string{"--jump", "REJECT", "--reject-with", ipt.family.hostProhibited}
+	if s.allowHostAccess {
+		hostAccess = []string{"--jump", "ACCEPT"}
+	}
+
+	commands := [][]string{
+		// Accept packets related to previously established connections
+		{"-A", ipt.inputChain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "--jump", "ACCEPT"},
+	}
+
+	if s.embeddedDNS {
+		// Accept queries to the DNS responder on the containers' bridge IP even
+		// when host access is denied
+		for _, protocol := range []string{"udp", "tcp"} {
+			commands = append(commands, append([]string{"-A", ipt.inputChain}, dnsMatch(protocol, "ACCEPT")...))
+		}
+	}
+
+	commands = append(commands, [][]string{
+		append([]string{"-A", ipt.inputChain}, hostAccess...),
+		// Forward input traffic via the input chain
+		{"-A", "INPUT", "-i", s.nicPrefix + "+", "--jump", ipt.inputChain},
+	}...)
 
-		denyNetworks: denyNetworks,
+	if err := s.commands(commands...); err != nil {
+		return err
 	}
+
+	// Create or flush forward and default chains
+	for _, chain := range []string{ipt.forwardChain, ipt.defaultChain} {
+		if err := s.createOrFlush(chain); err != nil {
+			return err
+		}
+	}
+
+	commands = [][]string{
+		{"-A", ipt.forwardChain, "-j", "DROP"},
+		// Always allow established connections to containers
+		{"-A", ipt.defaultChain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		// Forward outbound traffic via the forward chain
+		{"-A", "FORWARD", "-i", s.nicPrefix + "+", "--jump", ipt.forwardChain},
+	}
+
+	if defaultInterface != "" {
+		// Forward inbound traffic immediately
+		commands = append(commands, []string{"-I", ipt.forwardChain, "-i", defaultInterface, "--jump", "ACCEPT"})
+	}
+
+	return s.commands(commands...)
 }
 
-func (s Starter) Start() error {
-	cmd := exec.Command("bash", "-c", SetupScript)
-	cmd.Env = []string{
-		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-		"ACTION=setup",
-		fmt.Sprintf("GARDEN_IPTABLES_FILTER_INPUT_CHAIN=%s", s.iptables.inputChain),
-		fmt.Sprintf("GARDEN_IPTABLES_FILTER_FORWARD_CHAIN=%s", s.iptables.forwardChain),
-		fmt.Sprintf("GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN=%s", s.iptables.defaultChain),
-		fmt.Sprintf("GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX=%s", s.iptables.instanceChainPrefix),
-		fmt.Sprintf("GARDEN_IPTABLES_NAT_PREROUTING_CHAIN=%s", s.iptables.preroutingChain),
-		fmt.Sprintf("GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN=%s", s.iptables.postroutingChain),
-		fmt.Sprintf("GARDEN_IPTABLES_NAT_INSTANCE_PREFIX=%s", s.iptables.instanceChainPrefix),
-		fmt.Sprintf("GARDEN_NETWORK_INTERFACE_PREFIX=%s", s.nicPrefix),
-		fmt.Sprintf("GARDEN_IPTABLES_ALLOW_HOST_ACCESS=%t", s.allowHostAccess),
-	}
-
-	if err := s.iptables.run("setup-global-chains", cmd); err != nil {
-		return fmt.Errorf("setting up default chains: %s", err)
+// dnsMatch matches DNS queries to an address of the interface they arrived
+// on, i.e. to the bridge IP of the container which sent them
+func dnsMatch(protocol, target string) []string {
+	return []string{"-p", protocol, "--dport", "53", "-m", "addrtype", "--dst-type", "LOCAL", "--limit-iface-in", "--jump", target}
+}
+
+func (s Starter) teardownNat() error {
+	ipt := s.iptables
+
+	// Prune prerouting chain
+	if err := s.deleteRules("nat", ipt.preroutingChain, func(r ruleSpec) bool { return r.targets("-j", ipt.instanceChainPrefix) }); err != nil {
+		return err
 	}
 
-	for _, n := range s.denyNetworks {
-		if err := s.iptables.appendRule(s.iptables.defaultChain, rejectRule(n)); err != nil {
+	// Empty and delete per-instance chains
+	s.removeInstanceChains("nat")
+
+	ipt.command("-t", "nat", "-F", ipt.preroutingChain)
+	ipt.command("-t", "nat", "-F", ipt.postroutingChain)
+
+	return nil
+}
+
+func (s Starter) setupNat() error {
+	ipt := s.iptables
+
+	if err := s.teardownNat(); err != nil {
+		return err
+	}
+
+	// Create prerouting chain, and bind it to PREROUTING, and to OUTPUT for
+	// traffic originating from the same host
+	ipt.command("-t", "nat", "-N", ipt.preroutingChain)
+
+	if err := s.bind("PREROUTING", ipt.preroutingChain); err != nil {
+		return err
+	}
+
+	if err := s.bind("OUTPUT", ipt.preroutingChain, "--out-interface", "lo"); err != nil {
+		return err
+	}
+
+	// Create postrouting chain, and bind it to POSTROUTING
+	ipt.command("-t", "nat", "-N", ipt.postroutingChain)
+
+	return s.bind("POSTROUTING", ipt.postroutingChain)
+}
+
+// bind adds a jump from a built-in nat chain to one of ours, unless it is
+// already there
+func (s Starter) bind(builtinChain, chain string, matches ...string) error {
+	rules, err := s.iptables.list("nat", builtinChain)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.isRule() && rule.jumpsTo(chain) {
+			return nil
+		}
+	}
+
+	args := append([]string{"-t", "nat", "-A", builtinChain}, matches...)
+	return s.iptables.command(append(args, "--jump", chain)...)
+}
+
+func (s Starter) createOrFlush(chain string) error {
+	if err := s.iptables.command("-N", chain); err != nil {
+		return s.iptables.command("-F", chain)
+	}
+
+	return nil
+}
+
+func (s Starter) commands(commands ...[]string) error {
+	for _, args := range commands {
+		if err := s.iptables.command(args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteRules deletes the rules in the chain for which matches returns true.
+// A chain which doesn't exist has no rules to delete.
+func (s Starter) deleteRules(table, chain string, matches func(ruleSpec) bool) error {
+	rules, err := s.iptables.list(table, chain)
+	if err != nil {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if !rule.isRule() || !matches(rule) {
+			continue
+		}
+
+		if err := s.iptables.command(append([]string{"-t", table}, rule.deletion()...)...); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// removeInstanceChains empties and then deletes all of the instance chains in
+// the table. Failures are ignored so that one chain which can't be removed
+// doesn't prevent the others from being cleaned up.
+func (s Starter) removeInstanceChains(table string) {
+	rules, err := s.iptables.list(table)
+	if err != nil {
+		return
+	}
+
+	var chains []string
+	for _, rule := range rules {
+		if rule.isChain() && strings.HasPrefix(rule.chain(), s.iptables.instanceChainPrefix) {
+			chains = append(chains, rule.chain())
+		}
+	}
+
+	for _, chain := range chains {
+		s.iptables.command("-t", table, "-F", chain)
+	}
+
+	for _, chain := range chains {
+		s.iptables.command("-t", table, "-X", chain)
+	}
+}
@@ -1,8 +1,8 @@
 package iptables_test
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"os/exec"
 
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
@@ -14,60 +14,257 @@ import (
 
 var _ = Describe("Setup", func() {
 	var (
-		fakeRunner   *fake_command_runner.FakeCommandRunner
-		denyNetworks []string
-		starter      *iptables.Starter
+		fakeRunner       *fake_command_runner.FakeCommandRunner
+		allowHostAccess  bool
+		embeddedDNS      bool
+		allowNetworks    []string
+		denyNetworks     []string
+		defaultInterface string
+		defaultIfaceErr  error
+		starter          *iptables.Starter
 	)
 
+	iptablesSpec := func(args ...string) fake_command_runner.CommandSpec {
+		return fake_command_runner.CommandSpec{
+			Path: "/sbin/iptables",
+			Args: append([]string{"-w"}, args...),
+		}
+	}
+
+	// listing stubs the output of iptables -S for the table and chain
+	listing := func(output string, args ...string) {
+		fakeRunner.WhenRunning(iptablesSpec(args...), func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(output))
+			return nil
+		})
+	}
+
 	BeforeEach(func() {
 		fakeRunner = fake_command_runner.New()
+		allowHostAccess = true
+		embeddedDNS = false
+		allowNetworks = nil
+		denyNetworks = nil
+		defaultInterface = "eth0"
+		defaultIfaceErr = nil
 	})
 
 	JustBeforeEach(func() {
 		starter = iptables.NewStarter(
 			iptables.New(fakeRunner, "prefix-"),
-			true,
+			allowHostAccess,
+			embeddedDNS,
 			"the-nic-prefix",
+			allowNetworks,
 			denyNetworks,
+			func() (string, error) { return defaultInterface, defaultIfaceErr },
 		)
 	})
 
-	It("runs the setup script, passing the environment variables", func() {
+	It("sets up the filter chains", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		Expect(fakeRunner).To(HaveExecutedSerially(
+			iptablesSpec("-N", "prefix-input"),
+			iptablesSpec("-I", "prefix-input", "-i", "eth0", "--jump", "ACCEPT"),
+			iptablesSpec("-A", "prefix-input", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "--jump", "ACCEPT"),
+			iptablesSpec("-A", "prefix-input", "--jump", "ACCEPT"),
+			iptablesSpec("-A", "INPUT", "-i", "the-nic-prefix+", "--jump", "prefix-input"),
+			iptablesSpec("-N", "prefix-forward"),
+			iptablesSpec("-N", "prefix-default"),
+			iptablesSpec("-A", "prefix-forward", "-j", "DROP"),
+			iptablesSpec("-A", "prefix-default", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"),
+			iptablesSpec("-A", "FORWARD", "-i", "the-nic-prefix+", "--jump", "prefix-forward"),
+			iptablesSpec("-I", "prefix-forward", "-i", "eth0", "--jump", "ACCEPT"),
+		))
+	})
+
+	It("sets up the nat chains", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		Expect(fakeRunner).To(HaveExecutedSerially(
+			iptablesSpec("-t", "nat", "-N", "prefix-prerouting"),
+			iptablesSpec("-t", "nat", "-A", "PREROUTING", "--jump", "prefix-prerouting"),
+			iptablesSpec("-t", "nat", "-A", "OUTPUT", "--out-interface", "lo", "--jump", "prefix-prerouting"),
+			iptablesSpec("-t", "nat", "-N", "prefix-postrouting"),
+			iptablesSpec("-t", "nat", "-A", "POSTROUTING", "--jump", "prefix-postrouting"),
+		))
+	})
+
+	It("enables ip forwarding", func() {
 		Expect(starter.Start()).To(Succeed())
 
 		Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
-			Path: "bash",
-			Args: []string{"-c", iptables.SetupScript},
-			Env: []string{
-				fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-				"ACTION=setup",
-
-				"GARDEN_IPTABLES_FILTER_INPUT_CHAIN=prefix-input",
-				"GARDEN_IPTABLES_FILTER_FORWARD_CHAIN=prefix-forward",
-				"GARDEN_IPTABLES_FILTER_DEFAULT_CHAIN=prefix-default",
-				"GARDEN_IPTABLES_FILTER_INSTANCE_PREFIX=prefix-instance-",
-				"GARDEN_IPTABLES_NAT_PREROUTING_CHAIN=prefix-prerouting",
-				"GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN=prefix-postrouting",
-				"GARDEN_IPTABLES_NAT_INSTANCE_PREFIX=prefix-instance-",
-				"GARDEN_NETWORK_INTERFACE_PREFIX=the-nic-prefix",
-				"GARDEN_IPTABLES_ALLOW_HOST_ACCESS=true",
-			},
+			Path: "sysctl",
+			Args: []string{"-w", "net.ipv4.ip_forward=1"},
 		}))
 	})
 
-	Context("when running the setup script fails", func() {
+	Context("when host access is not allowed", func() {
 		BeforeEach(func() {
-			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-				Path: "bash",
-				Args: []string{"-c", iptables.SetupScript},
-			}, func(cmd *exec.Cmd) error {
+			allowHostAccess = false
+		})
+
+		It("rejects traffic to the host", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-A", "prefix-input", "--jump", "REJECT", "--reject-with", "icmp-host-prohibited"),
+			))
+		})
+
+		Context("and the embedded DNS responder is used", func() {
+			BeforeEach(func() {
+				embeddedDNS = true
+			})
+
+			It("accepts DNS queries to the bridge IP ahead of the reject", func() {
+				Expect(starter.Start()).To(Succeed())
+
+				Expect(fakeRunner).To(HaveExecutedSerially(
+					iptablesSpec("-A", "prefix-input", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "--jump", "ACCEPT"),
+					iptablesSpec("-A", "prefix-input", "-p", "udp", "--dport", "53", "-m", "addrtype", "--dst-type", "LOCAL", "--limit-iface-in", "--jump", "ACCEPT"),
+					iptablesSpec("-A", "prefix-input", "-p", "tcp", "--dport", "53", "-m", "addrtype", "--dst-type", "LOCAL", "--limit-iface-in", "--jump", "ACCEPT"),
+					iptablesSpec("-A", "prefix-input", "--jump", "REJECT", "--reject-with", "icmp-host-prohibited"),
+				))
+			})
+		})
+	})
+
+	Context("when the input chain already exists", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(iptablesSpec("-N", "prefix-input"), func(*exec.Cmd) error {
+				return errors.New("exit status 1")
+			})
+		})
+
+		It("flushes it", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-N", "prefix-input"),
+				iptablesSpec("-F", "prefix-input"),
+				iptablesSpec("-I", "prefix-input", "-i", "eth0", "--jump", "ACCEPT"),
+			))
+		})
+	})
+
+	Context("when there is no default route", func() {
+		BeforeEach(func() {
+			defaultInterface = ""
+		})
+
+		It("does not accept traffic from the default interface", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			for _, cmd := range fakeRunner.ExecutedCommands() {
+				Expect(cmd.Args).NotTo(ContainElement("-I"), fmt.Sprintf("%v", cmd.Args))
+			}
+		})
+	})
+
+	Context("when finding the default interface fails", func() {
+		BeforeEach(func() {
+			defaultIfaceErr = errors.New("netlink exploded")
+		})
+
+		It("returns the error", func() {
+			Expect(starter.Start()).To(MatchError("setting up default chains: finding default interface: netlink exploded"))
+		})
+	})
+
+	Context("when chains are left from a previous run", func() {
+		BeforeEach(func() {
+			listing("-P INPUT ACCEPT\n-A INPUT -i w+ -j garden-dispatch\n-A INPUT -i the-nic-prefix+ -j prefix-input\n", "-t", "filter", "-S", "INPUT")
+			listing("-P FORWARD ACCEPT\n-A FORWARD -i w+ -j garden-dispatch\n-A FORWARD -i the-nic-prefix+ -j prefix-forward\n", "-t", "filter", "-S", "FORWARD")
+			listing("-N prefix-forward\n-A prefix-forward -s 10.0.0.2/32 -i some-bridge -g prefix-instance-abc\n-A prefix-forward -j DROP\n", "-t", "filter", "-S", "prefix-forward")
+			listing("-P INPUT ACCEPT\n-N prefix-forward\n-N prefix-instance-abc\n-N prefix-instance-abc-log\n-A prefix-instance-abc -g prefix-default\n", "-t", "filter", "-S")
+			listing("-N prefix-prerouting\n-A prefix-prerouting -j prefix-instance-abc\n", "-t", "nat", "-S", "prefix-prerouting")
+			listing("-N prefix-prerouting\n-N prefix-instance-abc\n", "-t", "nat", "-S")
+		})
+
+		It("removes the deprecated garden-dispatch chain", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-t", "filter", "-D", "INPUT", "-i", "w+", "-j", "garden-dispatch"),
+				iptablesSpec("-t", "filter", "-D", "FORWARD", "-i", "w+", "-j", "garden-dispatch"),
+				iptablesSpec("-F", "garden-dispatch"),
+				iptablesSpec("-X", "garden-dispatch"),
+			))
+		})
+
+		It("removes the filter instance chains", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-t", "filter", "-D", "prefix-forward", "-s", "10.0.0.2/32", "-i", "some-bridge", "-g", "prefix-instance-abc"),
+				iptablesSpec("-t", "filter", "-F", "prefix-instance-abc"),
+				iptablesSpec("-t", "filter", "-F", "prefix-instance-abc-log"),
+				iptablesSpec("-t", "filter", "-X", "prefix-instance-abc"),
+				iptablesSpec("-t", "filter", "-X", "prefix-instance-abc-log"),
+			))
+		})
+
+		It("unbinds and removes the global filter chains", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-t", "filter", "-D", "FORWARD", "-i", "the-nic-prefix+", "-j", "prefix-forward"),
+				iptablesSpec("-F", "prefix-forward"),
+				iptablesSpec("-F", "prefix-default"),
+				iptablesSpec("-t", "filter", "-D", "INPUT", "-i", "the-nic-prefix+", "-j", "prefix-input"),
+				iptablesSpec("-F", "prefix-input"),
+				iptablesSpec("-X", "prefix-input"),
+			))
+		})
+
+		It("removes the nat instance chains", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				iptablesSpec("-t", "nat", "-D", "prefix-prerouting", "-j", "prefix-instance-abc"),
+				iptablesSpec("-t", "nat", "-F", "prefix-instance-abc"),
+				iptablesSpec("-t", "nat", "-X", "prefix-instance-abc"),
+				iptablesSpec("-t", "nat", "-F", "prefix-prerouting"),
+				iptablesSpec("-t", "nat", "-F", "prefix-postrouting"),
+			))
+		})
+
+		It("does not rebind the nat chains which are already bound", func() {
+			listing("-P PREROUTING ACCEPT\n-A PREROUTING -j prefix-prerouting\n", "-t", "nat", "-S", "PREROUTING")
+
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).NotTo(HaveExecutedSerially(
+				iptablesSpec("-t", "nat", "-A", "PREROUTING", "--jump", "prefix-prerouting"),
+			))
+		})
+
+		Context("when deleting a deprecated rule fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(iptablesSpec("-t", "filter", "-D", "INPUT", "-i", "w+", "-j", "garden-dispatch"), func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("bad rule"))
+					return errors.New("exit status 1")
+				})
+			})
+
+			It("returns the error", func() {
+				Expect(starter.Start()).To(MatchError(ContainSubstring("bad rule")))
+			})
+		})
+	})
+
+	Context("when a setup command fails", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(iptablesSpec("-A", "prefix-forward", "-j", "DROP"), func(cmd *exec.Cmd) error {
 				cmd.Stderr.Write([]byte("oh no!"))
-				return fmt.Errorf("exit status something")
+				return errors.New("exit status something")
 			})
 		})
 
 		It("returns the error", func() {
-			Expect(starter.Start()).To(MatchError(ContainSubstring("oh no!")))
+			Expect(starter.Start()).To(MatchError("setting up default chains: iptables -A prefix-forward -j DROP: oh no!"))
 		})
 	})
 
@@ -81,8 +278,7 @@ var _ = Describe("Setup", func() {
 
 			Expect(fakeRunner).To(HaveExecutedSerially(
 				fake_command_runner.CommandSpec{
-					Path: "bash",
-					Args: []string{"-c", iptables.SetupScript},
+					Path: "sysctl",
 				},
 				fake_command_runner.CommandSpec{
 					Path: "/sbin/iptables",
@@ -97,9 +293,7 @@ var _ = Describe("Setup", func() {
 
 		Context("when the first command fails", func() {
 			BeforeEach(func() {
-				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-					Path: "/sbin/iptables",
-				}, func(cmd *exec.Cmd) error {
+				fakeRunner.WhenRunning(iptablesSpec("-A", "prefix-default", "--destination", "1.2.3.4/11", "--jump", "REJECT"), func(cmd *exec.Cmd) error {
 					cmd.Stderr.Write([]byte("oh banana error!"))
 					return fmt.Errorf("exit status something")
 				})
@@ -112,7 +306,111 @@ var _ = Describe("Setup", func() {
 			It("does not try to apply the rest of the deny rules", func() {
 				starter.Start()
 
-				Expect(fakeRunner.ExecutedCommands()).To(HaveLen(2))
+				Expect(fakeRunner).NotTo(HaveExecutedSerially(
+					iptablesSpec("-A", "prefix-default", "--destination", "5.6.7.8/33", "--jump", "REJECT"),
+				))
+			})
+		})
+	})
+
+	Context("when allowNetworks is set", func() {
+		BeforeEach(func() {
+			allowNetworks = []string{"10.1.2.3/32"}
+			denyNetworks = []string{"10.0.0.0/8"}
+		})
+
+		It("allows the networks ahead of the denied networks", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-A", "prefix-default", "--destination", "10.1.2.3/32", "--jump", "RETURN"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{"-w", "-A", "prefix-default", "--destination", "10.0.0.0/8", "--jump", "REJECT"},
+				},
+			))
+		})
+
+		Context("when allowing a network fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(iptablesSpec("-A", "prefix-default", "--destination", "10.1.2.3/32", "--jump", "RETURN"), func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("oh allow error!"))
+					return fmt.Errorf("exit status something")
+				})
+			})
+
+			It("returns the error", func() {
+				Expect(starter.Start()).To(MatchError(ContainSubstring("oh allow error!")))
+			})
+
+			It("does not apply the deny rules", func() {
+				starter.Start()
+
+				Expect(fakeRunner).NotTo(HaveExecutedSerially(
+					iptablesSpec("-A", "prefix-default", "--destination", "10.0.0.0/8", "--jump", "REJECT"),
+				))
+			})
+		})
+	})
+
+	Describe("GlobalChainsExist", func() {
+		var saved string
+
+		BeforeEach(func() {
+			saved = `*nat
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+:prefix-prerouting - [0:0]
+:prefix-postrouting - [0:0]
+-A PREROUTING -j prefix-prerouting
+-A OUTPUT -o lo -j prefix-prerouting
+-A POSTROUTING -j prefix-postrouting
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:prefix-input - [0:0]
+:prefix-forward - [0:0]
+:prefix-default - [0:0]
+-A INPUT -i the-nic-prefix+ -j prefix-input
+-A FORWARD -i the-nic-prefix+ -j prefix-forward
+-A prefix-forward -i eth0 -j ACCEPT
+-A prefix-forward -j DROP
+COMMIT
+`
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "iptables-save",
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(saved))
+				return nil
+			})
+		})
+
+		It("returns true when the chains are set up and bound", func() {
+			Expect(starter.GlobalChainsExist()).To(BeTrue())
+		})
+
+		Context("when the built-in chains have been flushed", func() {
+			BeforeEach(func() {
+				saved = "*nat\n:prefix-prerouting - [0:0]\n:prefix-postrouting - [0:0]\nCOMMIT\n*filter\n:prefix-input - [0:0]\n:prefix-forward - [0:0]\n:prefix-default - [0:0]\n-A prefix-forward -j DROP\nCOMMIT\n"
+			})
+
+			It("returns false", func() {
+				Expect(starter.GlobalChainsExist()).To(BeFalse())
+			})
+		})
+
+		Context("when the chains do not exist", func() {
+			BeforeEach(func() {
+				saved = "*nat\nCOMMIT\n*filter\nCOMMIT\n"
+			})
+
+			It("returns false", func() {
+				Expect(starter.GlobalChainsExist()).To(BeFalse())
 			})
 		})
 	})
@@ -3,84 +3,207 @@ package iptables
 import (
 	"fmt"
 	"net"
-	"os/exec"
+	"strings"
 
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
 	"github.com/pivotal-golang/lager"
 )
 
+const (
+	LogMethodKernel = "kernel"
+	LogMethodNFLog  = "nflog"
+
+	nflogGroup = "1"
+
+	// the kernel truncates LOG prefixes longer than 29 characters
+	maxLogPrefixLen = 28
+)
+
 type InstanceChainCreator struct {
-	iptables *IPTables
+	iptables    *IPTables
+	logMethod   string
+	embeddedDNS bool
 }
 
-func NewInstanceChainCreator(iptables *IPTables) *InstanceChainCreator {
+func NewInstanceChainCreator(iptables *IPTables, logMethod string, embeddedDNS bool) *InstanceChainCreator {
 	return &InstanceChainCreator{
-		iptables: iptables,
+		iptables:    iptables,
+		logMethod:   logMethod,
+		embeddedDNS: embeddedDNS,
+	}
+}
+
+// Create adds the instance's chains and the rules binding them in a single
+// iptables-restore transaction, so a failure leaves no partial chains behind
+func (cc *InstanceChainCreator) Create(logger lager.Logger, handle, instanceId, bridgeName string, ip net.IP, network *net.IPNet) error {
+	instanceChain := cc.iptables.instanceChain(instanceId)
+	logChain := cc.iptables.logChain(instanceId)
+
+	nat := restoreTable{
+		name: "nat",
+		lines: []string{
+			// Create nat instance chain
+			declareChain(instanceChain),
+			// Bind nat instance chain to nat prerouting chain
+			fmt.Sprintf("-A %s --jump %s", cc.iptables.preroutingChain, instanceChain),
+			// Enable NAT for traffic coming from containers. The rule is tagged with
+			// the instance id so that Destroy can remove it again.
+			fmt.Sprintf("-A %s --source %s ! --destination %s -m comment --comment %s --jump MASQUERADE",
+				cc.iptables.postroutingChain, network.String(), network.String(), instanceId),
+		},
 	}
+
+	filter := restoreTable{
+		name: "filter",
+		lines: []string{
+			// Create log chain, used by NetOut rules which request logging
+			declareChain(logChain),
+			// Log new connections with the configured method
+			fmt.Sprintf("-A %s -m conntrack --ctstate NEW,UNTRACKED,INVALID %s", logChain, cc.logFlags(handle)),
+			// Then allow them through as a non-logging rule would
+			fmt.Sprintf("-A %s --jump RETURN", logChain),
+
+			// Create filter instance chain
+			declareChain(instanceChain),
+			// Allow intra-subnet traffic (Linux ethernet bridging goes through ip stack)
+			fmt.Sprintf("-A %s -s %s -d %s -j ACCEPT", instanceChain, network.String(), network.String()),
+			// Otherwise, use the default filter chain
+			fmt.Sprintf("-A %s --goto %s", instanceChain, cc.iptables.defaultChain),
+			// Bind filter instance chain to filter forward chain
+			fmt.Sprintf("-I %s 2 --in-interface %s --source %s --goto %s", cc.iptables.forwardChain, bridgeName, ip.String(), instanceChain),
+		},
+	}
+
+	return cc.iptables.restore("create-instance-chains", nat, filter)
 }
 
-func (cc *InstanceChainCreator) Create(logger lager.Logger, instanceId, bridgeName string, ip net.IP, network *net.IPNet) error {
+// Override applies a container's exceptions to the global firewall settings.
+// Host access is decided in the input chain, which containers' traffic to the
+// host goes through, by a rule tagged with the instance id. Deny networks are
+// rejected in the instance chain, behind any NetOut rules as the global deny
+// networks are. Queries to the embedded DNS responder are still accepted when
+// host access is denied.
+func (cc *InstanceChainCreator) Override(logger lager.Logger, instanceId, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error {
 	instanceChain := cc.iptables.instanceChain(instanceId)
 
-	commands := []*exec.Cmd{
-		// Create nat instance chain
-		exec.Command("iptables", "--wait", "--table", "nat", "-N", instanceChain),
-		// Bind nat instance chain to nat prerouting chain
-		exec.Command("iptables", "--wait", "--table", "nat", "-A", cc.iptables.preroutingChain, "--jump", instanceChain),
-		// Enable NAT for traffic coming from containers
-		exec.Command("sh", "-c", fmt.Sprintf(
-			`(iptables --wait --table nat -S %s | grep "\-j MASQUERADE\b" | grep -q -F -- "-s %s") || iptables --wait --table nat -A %s --source %s ! --destination %s --jump MASQUERADE`,
-			cc.iptables.postroutingChain, network.String(), cc.iptables.postroutingChain,
-			network.String(), network.String(),
-		)),
-
-		// Create filter instance chain
-		exec.Command("iptables", "--wait", "-N", instanceChain),
-		// Allow intra-subnet traffic (Linux ethernet bridging goes through ip stack)
-		exec.Command("iptables", "--wait", "-A", instanceChain, "-s", network.String(), "-d", network.String(), "-j", "ACCEPT"),
-		// Otherwise, use the default filter chain
-		exec.Command("iptables", "--wait", "-A", instanceChain, "--goto", cc.iptables.defaultChain),
-		// Bind filter instance chain to filter forward chain
-		exec.Command("iptables", "--wait", "-I", cc.iptables.forwardChain, "2", "--in-interface", bridgeName, "--source", ip.String(), "--goto", instanceChain),
+	filter := restoreTable{name: "filter"}
+	for _, network := range overrides.DenyNetworks {
+		filter.lines = append(filter.lines, fmt.Sprintf("-I %s 1 --destination %s --jump REJECT", instanceChain, network))
 	}
 
-	for _, cmd := range commands {
-		if err := cc.iptables.run("create-instance-chains", cmd); err != nil {
-			return err
+	if overrides.HostAccess != nil {
+		// replies to connections from the host are still accepted when access
+		// is denied
+		hostAccess := fmt.Sprintf("-m conntrack --ctstate NEW,UNTRACKED,INVALID --jump REJECT --reject-with %s", cc.iptables.family.hostProhibited)
+		if *overrides.HostAccess {
+			hostAccess = "--jump ACCEPT"
+		}
+
+		filter.lines = append(filter.lines, fmt.Sprintf("-I %s 1 --in-interface %s --source %s -m comment --comment %s %s",
+			cc.iptables.inputChain, bridgeName, ip.String(), instanceId, hostAccess))
+
+		if !*overrides.HostAccess && cc.embeddedDNS {
+			for _, protocol := range []string{"udp", "tcp"} {
+				filter.lines = append(filter.lines, fmt.Sprintf("-I %s 1 --in-interface %s --source %s -m comment --comment %s %s",
+					cc.iptables.inputChain, bridgeName, ip.String(), instanceId, strings.Join(dnsMatch(protocol, "ACCEPT"), " ")))
+			}
 		}
 	}
 
-	return nil
+	return cc.iptables.restore("override-instance-chains", filter)
 }
 
+// Destroy removes whichever of the instance's chains and rules still exist in
+// a single iptables-restore transaction, so it can safely be called again
 func (cc *InstanceChainCreator) Destroy(logger lager.Logger, instanceId string) error {
 	instanceChain := cc.iptables.instanceChain(instanceId)
+	logChain := cc.iptables.logChain(instanceId)
+
+	rules, err := cc.iptables.save("destroy-instance-chains")
+	if err != nil {
+		return err
+	}
 
-	commands := []*exec.Cmd{
-		// Prune nat prerouting chain
-		exec.Command("sh", "-c", fmt.Sprintf(
-			`iptables --wait --table nat -S %s 2> /dev/null | grep "\-j %s\b" | sed -e "s/-A/-D/" | xargs --no-run-if-empty --max-lines=1 iptables --wait --table nat`,
-			cc.iptables.preroutingChain, instanceChain,
-		)),
-		// Flush nat instance chain
-		exec.Command("sh", "-c", fmt.Sprintf(`iptables --wait --table nat -F %s 2> /dev/null || true`, instanceChain)),
-		// Delete nat instance chain
-		exec.Command("sh", "-c", fmt.Sprintf(`iptables --wait --table nat -X %s 2> /dev/null || true`, instanceChain)),
-		// Prune forward chain
-		exec.Command("sh", "-c", fmt.Sprintf(
-			`iptables --wait -S %s 2> /dev/null | grep "\-g %s\b" | sed -e "s/-A/-D/" | xargs --no-run-if-empty --max-lines=1 iptables --wait`,
-			cc.iptables.forwardChain, instanceChain,
-		)),
-		// Flush instance chain
-		exec.Command("sh", "-c", fmt.Sprintf("iptables --wait -F %s 2> /dev/null || true", instanceChain)),
-		// Delete instance chain
-		exec.Command("sh", "-c", fmt.Sprintf("iptables --wait -X %s 2> /dev/null || true", instanceChain)),
+	nat := restoreTable{name: "nat"}
+	// Prune nat prerouting chain
+	nat.lines = append(nat.lines, rules["nat"].deletions(cc.iptables.preroutingChain, "-j", instanceChain)...)
+	// Remove the instance's masquerade rule
+	nat.lines = append(nat.lines, rules["nat"].deletions(cc.iptables.postroutingChain, "--comment", instanceId)...)
+	// Flush and delete nat instance chain
+	nat.lines = append(nat.lines, rules["nat"].removals(instanceChain)...)
+
+	filter := restoreTable{name: "filter"}
+	// Prune forward chain, including the instance's policy group rule
+	filter.lines = append(filter.lines, rules["filter"].deletions(cc.iptables.forwardChain, "-g", instanceChain)...)
+	filter.lines = append(filter.lines, rules["filter"].deletions(cc.iptables.forwardChain, "--comment", instanceId)...)
+	// Remove the instance's host access overrides
+	filter.lines = append(filter.lines, rules["filter"].deletions(cc.iptables.inputChain, "--comment", instanceId)...)
+	// Flush and delete instance and log chains
+	filter.lines = append(filter.lines, rules["filter"].removals(instanceChain, logChain)...)
+
+	return cc.iptables.restore("destroy-instance-chains", nat, filter)
+}
+
+// InstanceChains returns the ids of the instances which have chains in
+// either table
+func (cc *InstanceChainCreator) InstanceChains() ([]string, error) {
+	rules, err := cc.iptables.save("list-instance-chains")
+	if err != nil {
+		return nil, err
 	}
 
-	for _, cmd := range commands {
-		if err := cc.iptables.run("destroy-instance-chains", cmd); err != nil {
-			return err
+	var instances []string
+	seen := map[string]bool{}
+	for _, table := range []string{"filter", "nat"} {
+		for _, chain := range rules[table].chains {
+			if !strings.HasPrefix(chain, cc.iptables.instanceChainPrefix) {
+				continue
+			}
+
+			instance := strings.TrimSuffix(strings.TrimPrefix(chain, cc.iptables.instanceChainPrefix), "-log")
+			if !seen[instance] {
+				seen[instance] = true
+				instances = append(instances, instance)
+			}
 		}
 	}
 
-	return nil
+	return instances, nil
+}
+
+// InstanceChainsIntact reports whether all of the chains and rules added by
+// Create for the instance are in place
+func (cc *InstanceChainCreator) InstanceChainsIntact(instanceId string) (bool, error) {
+	instanceChain := cc.iptables.instanceChain(instanceId)
+	logChain := cc.iptables.logChain(instanceId)
+
+	rules, err := cc.iptables.save("inspect-instance-chains")
+	if err != nil {
+		return false, err
+	}
+
+	filter, nat := rules["filter"], rules["nat"]
+
+	return nat.hasChain(instanceChain) &&
+		nat.has(cc.iptables.preroutingChain, "-j", instanceChain) &&
+		nat.has(cc.iptables.postroutingChain, "--comment", instanceId) &&
+		filter.hasChain(logChain) &&
+		filter.has(logChain, "-j", "RETURN") &&
+		filter.hasChain(instanceChain) &&
+		filter.has(instanceChain, "-g", cc.iptables.defaultChain) &&
+		filter.has(cc.iptables.forwardChain, "-g", instanceChain), nil
+}
+
+func (cc *InstanceChainCreator) logFlags(handle string) string {
+	prefix := handle
+	if len(prefix) > maxLogPrefixLen {
+		prefix = prefix[:maxLogPrefixLen]
+	}
+	prefix = prefix + " "
+
+	if cc.logMethod == LogMethodNFLog {
+		return fmt.Sprintf("--jump NFLOG --nflog-prefix %q --nflog-group %s", prefix, nflogGroup)
+	}
+
+	return fmt.Sprintf("--jump LOG --log-prefix %q", prefix)
 }
@@ -2,10 +2,11 @@ package iptables_test
 
 import (
 	"errors"
-	"fmt"
+	"io/ioutil"
 	"net"
 	"os/exec"
 
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
 	"github.com/pivotal-golang/lager"
@@ -13,11 +14,10 @@ import (
 
 	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
 	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
-var _ = Describe("Create", func() {
+var _ = Describe("InstanceChainCreator", func() {
 	var (
 		fakeRunner *fake_command_runner.FakeCommandRunner
 		creator    *iptables.InstanceChainCreator
@@ -25,6 +25,9 @@ var _ = Describe("Create", func() {
 		ip         net.IP
 		network    *net.IPNet
 		logger     lager.Logger
+
+		restoreInputs []string
+		restoreErr    error
 	)
 
 	BeforeEach(func() {
@@ -39,136 +42,335 @@ var _ = Describe("Create", func() {
 
 		creator = iptables.NewInstanceChainCreator(
 			iptables.New(fakeRunner, "prefix-"),
+			iptables.LogMethodKernel,
+			false,
 		)
+
+		restoreInputs = nil
+		restoreErr = nil
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "iptables-restore",
+		}, func(cmd *exec.Cmd) error {
+			input, err := ioutil.ReadAll(cmd.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+
+			restoreInputs = append(restoreInputs, string(input))
+
+			if restoreErr != nil {
+				cmd.Stderr.Write([]byte("iptables-restore: line 3 failed"))
+			}
+			return restoreErr
+		})
 	})
 
 	Describe("Create", func() {
-		var specs []fake_command_runner.CommandSpec
+		It("sets up the chains in a single iptables-restore", func() {
+			Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "iptables-restore",
+				Args: []string{"--wait", "--noflush"},
+			}))
+			Expect(fakeRunner.ExecutedCommands()).To(HaveLen(1))
+
+			Expect(restoreInputs).To(Equal([]string{`*nat
+:prefix-instance-some-id - [0:0]
+-A prefix-prerouting --jump prefix-instance-some-id
+-A prefix-postrouting --source 1.2.3.0/28 ! --destination 1.2.3.0/28 -m comment --comment some-id --jump MASQUERADE
+COMMIT
+*filter
+:prefix-instance-some-id-log - [0:0]
+-A prefix-instance-some-id-log -m conntrack --ctstate NEW,UNTRACKED,INVALID --jump LOG --log-prefix "some-handle "
+-A prefix-instance-some-id-log --jump RETURN
+:prefix-instance-some-id - [0:0]
+-A prefix-instance-some-id -s 1.2.3.0/28 -d 1.2.3.0/28 -j ACCEPT
+-A prefix-instance-some-id --goto prefix-default
+-I prefix-forward 2 --in-interface some-bridge --source 1.2.3.4 --goto prefix-instance-some-id
+COMMIT
+`}))
+		})
+
+		Context("when the handle is longer than the kernel log prefix limit", func() {
+			It("truncates the log prefix", func() {
+				Expect(creator.Create(logger, "some-very-long-handle-which-overflows", "some-id", bridgeName, ip, network)).To(Succeed())
+				Expect(restoreInputs[0]).To(ContainSubstring(`--log-prefix "some-very-long-handle-which- "`))
+			})
+		})
+
+		Context("when the log method is nflog", func() {
+			BeforeEach(func() {
+				creator = iptables.NewInstanceChainCreator(
+					iptables.New(fakeRunner, "prefix-"),
+					iptables.LogMethodNFLog,
+					false,
+				)
+			})
+
+			It("logs to the nflog group", func() {
+				Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(Succeed())
+				Expect(restoreInputs[0]).To(ContainSubstring(
+					`-A prefix-instance-some-id-log -m conntrack --ctstate NEW,UNTRACKED,INVALID --jump NFLOG --nflog-prefix "some-handle " --nflog-group 1`,
+				))
+			})
+		})
+
+		Context("when iptables-restore fails", func() {
+			It("returns a wrapped error, including stderr", func() {
+				restoreErr = errors.New("exit status 1")
+
+				Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(
+					MatchError("iptables create-instance-chains: iptables-restore: line 3 failed"),
+				)
+			})
+		})
+	})
+
+	Describe("Override", func() {
+		It("rejects the deny networks in the instance chain", func() {
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{
+				DenyNetworks: []string{"10.0.0.0/8", "192.168.1.1"},
+			})).To(Succeed())
+
+			Expect(restoreInputs).To(Equal([]string{`*filter
+-I prefix-instance-some-id 1 --destination 10.0.0.0/8 --jump REJECT
+-I prefix-instance-some-id 1 --destination 192.168.1.1 --jump REJECT
+COMMIT
+`}))
+		})
+
+		It("allows host access in the input chain", func() {
+			allow := true
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &allow})).To(Succeed())
+
+			Expect(restoreInputs).To(Equal([]string{`*filter
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id --jump ACCEPT
+COMMIT
+`}))
+		})
+
+		It("denies host access to new connections in the input chain", func() {
+			deny := false
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &deny})).To(Succeed())
+
+			Expect(restoreInputs).To(Equal([]string{`*filter
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id -m conntrack --ctstate NEW,UNTRACKED,INVALID --jump REJECT --reject-with icmp-host-prohibited
+COMMIT
+`}))
+		})
+
+		Context("when the embedded DNS responder is used", func() {
+			BeforeEach(func() {
+				creator = iptables.NewInstanceChainCreator(
+					iptables.New(fakeRunner, "prefix-"),
+					iptables.LogMethodKernel,
+					true,
+				)
+			})
+
+			It("accepts DNS queries to the bridge IP ahead of denying host access", func() {
+				deny := false
+				Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &deny})).To(Succeed())
+
+				Expect(restoreInputs).To(Equal([]string{`*filter
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id -m conntrack --ctstate NEW,UNTRACKED,INVALID --jump REJECT --reject-with icmp-host-prohibited
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id -p udp --dport 53 -m addrtype --dst-type LOCAL --limit-iface-in --jump ACCEPT
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id -p tcp --dport 53 -m addrtype --dst-type LOCAL --limit-iface-in --jump ACCEPT
+COMMIT
+`}))
+			})
+
+			It("adds nothing else when host access is allowed", func() {
+				allow := true
+				Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &allow})).To(Succeed())
+
+				Expect(restoreInputs).To(Equal([]string{`*filter
+-I prefix-input 1 --in-interface some-bridge --source 1.2.3.4 -m comment --comment some-id --jump ACCEPT
+COMMIT
+`}))
+			})
+		})
+
+		It("does nothing when there are no overrides", func() {
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{})).To(Succeed())
+			Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("Destroy", func() {
+		var (
+			saved   string
+			saveErr error
+		)
 
 		BeforeEach(func() {
-			specs = []fake_command_runner.CommandSpec{
-				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "--table", "nat", "-N", "prefix-instance-some-id"},
-				},
-				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "--table", "nat", "-A", "prefix-prerouting",
-						"--jump", "prefix-instance-some-id"},
-				},
-				fake_command_runner.CommandSpec{
-					Path: "sh",
-					Args: []string{"-c", fmt.Sprintf(
-						`(iptables --wait --table nat -S %s | grep "\-j MASQUERADE\b" | grep -q -F -- "-s %s") || iptables --wait --table nat -A %s --source %s ! --destination %s --jump MASQUERADE`,
-						"prefix-postrouting", network.String(), "prefix-postrouting",
-						network.String(), network.String(),
-					)},
-				},
-				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "-N", "prefix-instance-some-id"},
-				},
-				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "-A", "prefix-instance-some-id",
-						"-s", network.String(), "-d", network.String(), "-j", "ACCEPT"},
-				},
+			saveErr = nil
+			saved = `# Generated by iptables-save
+*nat
+:PREROUTING ACCEPT [0:0]
+:prefix-prerouting - [0:0]
+:prefix-postrouting - [0:0]
+:prefix-instance-other-id - [0:0]
+:prefix-instance-some-id - [0:0]
+-A prefix-prerouting -j prefix-instance-other-id
+-A prefix-prerouting -j prefix-instance-some-id
+-A prefix-postrouting -s 1.2.3.0/28 ! -d 1.2.3.0/28 -m comment --comment other-id -j MASQUERADE
+-A prefix-postrouting -s 1.2.3.0/28 ! -d 1.2.3.0/28 -m comment --comment "some-id" -j MASQUERADE
+-A prefix-instance-some-id -d 5.6.7.8/32 -p tcp -m tcp --dport 22 -j DNAT --to-destination 1.2.3.4:33
+COMMIT
+*filter
+:FORWARD ACCEPT [0:0]
+:prefix-input - [0:0]
+:prefix-forward - [0:0]
+:prefix-instance-some-id - [0:0]
+:prefix-instance-some-id-log - [0:0]
+-A prefix-input -s 1.2.3.5/32 -i some-bridge -m comment --comment other-id -j ACCEPT
+-A prefix-input -s 1.2.3.4/32 -i some-bridge -m comment --comment some-id -j ACCEPT
+-A prefix-forward -s 1.2.3.0/28 -d 1.2.3.5/32 -m conntrack --ctstate NEW,UNTRACKED,INVALID -m set ! --match-set prefix-s-tenant-a src -m comment --comment other-id -j DROP
+-A prefix-forward -s 1.2.3.0/28 -d 1.2.3.4/32 -m conntrack --ctstate NEW,UNTRACKED,INVALID -m set ! --match-set prefix-s-tenant-a src -m comment --comment some-id -j DROP
+-A prefix-forward -s 1.2.3.5/32 -i some-bridge -g prefix-instance-other-id
+-A prefix-forward -s 1.2.3.4/32 -i some-bridge -g prefix-instance-some-id
+-A prefix-forward -j DROP
+-A prefix-instance-some-id -s 1.2.3.0/28 -d 1.2.3.0/28 -j ACCEPT
+-A prefix-instance-some-id -g prefix-default
+COMMIT
+`
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "iptables-save",
+			}, func(cmd *exec.Cmd) error {
+				if saveErr != nil {
+					cmd.Stderr.Write([]byte("iptables-save failed"))
+					return saveErr
+				}
+
+				cmd.Stdout.Write([]byte(saved))
+				return nil
+			})
+		})
+
+		It("tears down the instance's chains and rules in a single iptables-restore", func() {
+			Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
 				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "-A", "prefix-instance-some-id",
-						"--goto", "prefix-default"},
+					Path: "iptables-save",
 				},
 				fake_command_runner.CommandSpec{
-					Path: "iptables",
-					Args: []string{"--wait", "-I", "prefix-forward", "2", "--in-interface", bridgeName,
-						"--source", ip.String(), "--goto", "prefix-instance-some-id"},
+					Path: "iptables-restore",
+					Args: []string{"--wait", "--noflush"},
 				},
-			}
+			))
+
+			Expect(restoreInputs).To(Equal([]string{`*nat
+-D prefix-prerouting -j prefix-instance-some-id
+-D prefix-postrouting -s 1.2.3.0/28 ! -d 1.2.3.0/28 -m comment --comment "some-id" -j MASQUERADE
+-F prefix-instance-some-id
+-X prefix-instance-some-id
+COMMIT
+*filter
+-D prefix-forward -s 1.2.3.4/32 -i some-bridge -g prefix-instance-some-id
+-D prefix-forward -s 1.2.3.0/28 -d 1.2.3.4/32 -m conntrack --ctstate NEW,UNTRACKED,INVALID -m set ! --match-set prefix-s-tenant-a src -m comment --comment some-id -j DROP
+-D prefix-input -s 1.2.3.4/32 -i some-bridge -m comment --comment some-id -j ACCEPT
+-F prefix-instance-some-id
+-F prefix-instance-some-id-log
+-X prefix-instance-some-id
+-X prefix-instance-some-id-log
+COMMIT
+`}))
 		})
 
-		It("should set up the chain", func() {
-			Expect(creator.Create(logger, "some-id", bridgeName, ip, network)).To(Succeed())
-			Expect(fakeRunner).To(HaveExecutedSerially(specs...))
+		Context("when the instance has already been torn down", func() {
+			BeforeEach(func() {
+				saved = "*nat\n:prefix-prerouting - [0:0]\nCOMMIT\n*filter\n:prefix-forward - [0:0]\n-A prefix-forward -j DROP\nCOMMIT\n"
+			})
+
+			It("does not run iptables-restore", func() {
+				Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+				Expect(restoreInputs).To(BeEmpty())
+			})
 		})
 
-		DescribeTable("iptables failures",
-			func(specIndex int, errorString string) {
-				fakeRunner.WhenRunning(specs[specIndex], func(cmd *exec.Cmd) error {
-					cmd.Stderr.Write([]byte("iptables failed"))
-					return errors.New("Exit status blah")
-				})
+		Context("when iptables-save fails", func() {
+			It("returns a wrapped error, including stderr", func() {
+				saveErr = errors.New("exit status 1")
 
-				Expect(creator.Create(logger, "some-id", bridgeName, ip, network)).To(MatchError(errorString))
-			},
-			Entry("create nat instance chain", 0, "iptables create-instance-chains: iptables failed"),
-			Entry("bind nat instance chain to nat prerouting chain", 1, "iptables create-instance-chains: iptables failed"),
-			Entry("enable NAT for traffic coming from containers", 2, "iptables create-instance-chains: iptables failed"),
-		)
+				Expect(creator.Destroy(logger, "some-id")).To(MatchError("iptables destroy-instance-chains: iptables-save failed"))
+			})
+		})
 	})
 
-	Describe("ContainerTeardown", func() {
-		var specs []fake_command_runner.CommandSpec
+	Describe("inspecting the instance chains", func() {
+		var saved string
 
-		Describe("nat chain", func() {
-			BeforeEach(func() {
-				specs = []fake_command_runner.CommandSpec{
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf(
-							`iptables --wait --table nat -S %s 2> /dev/null | grep "\-j %s\b" | sed -e "s/-A/-D/" | xargs --no-run-if-empty --max-lines=1 iptables --wait --table nat`,
-							"prefix-prerouting", "prefix-instance-some-id",
-						)},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf(
-							`iptables --wait --table nat -F %s 2> /dev/null || true`,
-							"prefix-instance-some-id",
-						)},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf(
-							`iptables --wait --table nat -X %s 2> /dev/null || true`,
-							"prefix-instance-some-id",
-						)},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf(
-							`iptables --wait -S %s 2> /dev/null | grep "\-g %s\b" | sed -e "s/-A/-D/" | xargs --no-run-if-empty --max-lines=1 iptables --wait`,
-							"prefix-forward", "prefix-instance-some-id",
-						)},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf("iptables --wait -F %s 2> /dev/null || true", "prefix-instance-some-id")},
-					},
-					fake_command_runner.CommandSpec{
-						Path: "sh",
-						Args: []string{"-c", fmt.Sprintf("iptables --wait -X %s 2> /dev/null || true", "prefix-instance-some-id")},
-					},
-				}
+		BeforeEach(func() {
+			saved = `*nat
+:PREROUTING ACCEPT [0:0]
+:prefix-prerouting - [0:0]
+:prefix-postrouting - [0:0]
+:prefix-instance-some-id - [0:0]
+:prefix-instance-nat-only - [0:0]
+-A prefix-prerouting -j prefix-instance-some-id
+-A prefix-postrouting -s 1.2.3.0/28 ! -d 1.2.3.0/28 -m comment --comment some-id -j MASQUERADE
+COMMIT
+*filter
+:FORWARD ACCEPT [0:0]
+:prefix-forward - [0:0]
+:prefix-default - [0:0]
+:prefix-instance-some-id - [0:0]
+:prefix-instance-some-id-log - [0:0]
+:prefix-instance-other-id-log - [0:0]
+-A prefix-forward -s 1.2.3.4/32 -i some-bridge -g prefix-instance-some-id
+-A prefix-forward -j DROP
+-A prefix-instance-some-id -s 1.2.3.0/28 -d 1.2.3.0/28 -j ACCEPT
+-A prefix-instance-some-id -g prefix-default
+-A prefix-instance-some-id-log -m conntrack --ctstate NEW,UNTRACKED,INVALID -j LOG --log-prefix "some-handle "
+-A prefix-instance-some-id-log -j RETURN
+COMMIT
+`
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "iptables-save",
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(saved))
+				return nil
 			})
+		})
 
-			It("should tear down the chain", func() {
-				Expect(creator.Destroy(logger, "some-id")).To(Succeed())
-				Expect(fakeRunner).To(HaveExecutedSerially(specs...))
+		Describe("InstanceChains", func() {
+			It("returns the id of each instance with a chain in either table", func() {
+				Expect(creator.InstanceChains()).To(ConsistOf("some-id", "other-id", "nat-only"))
 			})
+		})
 
-			DescribeTable("iptables failures",
-				func(specIndex int, errorString string) {
-					fakeRunner.WhenRunning(specs[specIndex], func(cmd *exec.Cmd) error {
-						cmd.Stderr.Write([]byte("iptables failed"))
-						return errors.New("exit status foo")
-					})
+		Describe("InstanceChainsIntact", func() {
+			It("returns true when all of the instance's chains and rules exist", func() {
+				Expect(creator.InstanceChainsIntact("some-id")).To(BeTrue())
+			})
 
-					Expect(creator.Destroy(logger, "some-id")).To(MatchError(errorString))
-				},
-				Entry("prune prerouting chain", 0, "iptables destroy-instance-chains: iptables failed"),
-				Entry("flush instance chain", 1, "iptables destroy-instance-chains: iptables failed"),
-				Entry("delete instance chain", 2, "iptables destroy-instance-chains: iptables failed"),
-			)
+			It("returns false when the instance has no chains", func() {
+				Expect(creator.InstanceChainsIntact("missing-id")).To(BeFalse())
+			})
+
+			Context("when the chains have been flushed", func() {
+				BeforeEach(func() {
+					saved = `*nat
+:prefix-prerouting - [0:0]
+:prefix-postrouting - [0:0]
+:prefix-instance-some-id - [0:0]
+COMMIT
+*filter
+:prefix-forward - [0:0]
+:prefix-default - [0:0]
+:prefix-instance-some-id - [0:0]
+:prefix-instance-some-id-log - [0:0]
+COMMIT
+`
+				})
+
+				It("returns false", func() {
+					Expect(creator.InstanceChainsIntact("some-id")).To(BeFalse())
+				})
+			})
 		})
 	})
 })
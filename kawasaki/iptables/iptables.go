@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry/gunk/command_runner"
@@ -16,9 +17,40 @@ var protocols = map[garden.Protocol]string{
 	garden.ProtocolUDP:  "udp",
 }
 
+// family holds the differences between iptables and ip6tables
+type family struct {
+	name, binary, restoreBinary, saveBinary string
+
+	forwardingSysctl string
+	hostProhibited   string
+	icmp, icmpType   string
+}
+
+var (
+	ipv4 = family{
+		name: "iptables", binary: "/sbin/iptables", restoreBinary: "iptables-restore", saveBinary: "iptables-save",
+
+		forwardingSysctl: "net.ipv4.ip_forward=1",
+		hostProhibited:   "icmp-host-prohibited",
+		icmp:             "icmp",
+		icmpType:         "--icmp-type",
+	}
+
+	ipv6 = family{
+		name: "ip6tables", binary: "/sbin/ip6tables", restoreBinary: "ip6tables-restore", saveBinary: "ip6tables-save",
+
+		forwardingSysctl: "net.ipv6.conf.all.forwarding=1",
+		hostProhibited:   "icmp6-adm-prohibited",
+		icmp:             "icmpv6",
+		icmpType:         "--icmpv6-type",
+	}
+)
+
 type IPTables struct {
 	runner                                                                                         command_runner.CommandRunner
+	family                                                                                         family
 	preroutingChain, postroutingChain, inputChain, forwardChain, defaultChain, instanceChainPrefix string
+	setPrefix                                                                                      string
 }
 
 type Chains struct {
@@ -26,8 +58,19 @@ type Chains struct {
 }
 
 func New(runner command_runner.CommandRunner, chainPrefix string) *IPTables {
+	return newIPTables(runner, ipv4, chainPrefix)
+}
+
+// NewIPv6 returns an IPTables which manages the equivalent chains with
+// ip6tables
+func NewIPv6(runner command_runner.CommandRunner, chainPrefix string) *IPTables {
+	return newIPTables(runner, ipv6, chainPrefix)
+}
+
+func newIPTables(runner command_runner.CommandRunner, family family, chainPrefix string) *IPTables {
 	return &IPTables{
 		runner: runner,
+		family: family,
 
 		preroutingChain:     chainPrefix + "prerouting",
 		postroutingChain:    chainPrefix + "postrouting",
@@ -35,6 +78,7 @@ func New(runner command_runner.CommandRunner, chainPrefix string) *IPTables {
 		forwardChain:        chainPrefix + "forward",
 		defaultChain:        chainPrefix + "default",
 		instanceChainPrefix: chainPrefix + "instance-",
+		setPrefix:           chainPrefix,
 	}
 }
 
@@ -53,28 +97,247 @@ func (iptables *IPTables) run(action string, cmd *exec.Cmd) error {
 	cmd.Stderr = &buff
 
 	if err := iptables.runner.Run(cmd); err != nil {
-		return fmt.Errorf("iptables %s: %s", action, buff.String())
+		return fmt.Errorf("%s %s: %s", iptables.family.name, action, buff.String())
 	}
 
 	return nil
 }
 
+func (iptables *IPTables) command(args ...string) error {
+	return iptables.run(strings.Join(args, " "), exec.Command(iptables.family.binary, append([]string{"-w"}, args...)...))
+}
+
+// list returns the rules of a table, or of a single chain in it, in the
+// iptables -S format
+func (iptables *IPTables) list(table string, chain ...string) ([]ruleSpec, error) {
+	var output bytes.Buffer
+	cmd := exec.Command(iptables.family.binary, append([]string{"-w", "-t", table, "-S"}, chain...)...)
+	cmd.Stdout = &output
+
+	if err := iptables.run("list", cmd); err != nil {
+		return nil, err
+	}
+
+	var rules []ruleSpec
+	for _, line := range strings.Split(output.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 {
+			rules = append(rules, ruleSpec(fields))
+		}
+	}
+
+	return rules, nil
+}
+
+// ruleSpec is a line of iptables -S output, e.g. "-A INPUT -i w+ -j w--input"
+type ruleSpec []string
+
+func (r ruleSpec) isRule() bool {
+	return r[0] == "-A"
+}
+
+func (r ruleSpec) isChain() bool {
+	return r[0] == "-N"
+}
+
+func (r ruleSpec) chain() string {
+	return r[1]
+}
+
+// targets reports whether the rule has the option (e.g. "-j" or "-g") set to
+// a chain starting with prefix
+func (r ruleSpec) targets(option, prefix string) bool {
+	for i := 2; i < len(r)-1; i++ {
+		if r[i] == option && strings.HasPrefix(r[i+1], prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jumpsTo reports whether the rule jumps to exactly the given chain
+func (r ruleSpec) jumpsTo(chain string) bool {
+	for i := 2; i < len(r)-1; i++ {
+		if r[i] == "-j" && r[i+1] == chain {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r ruleSpec) deletion() []string {
+	return append([]string{"-D"}, r[1:]...)
+}
+
 func (iptables *IPTables) instanceChain(instanceId string) string {
 	return iptables.instanceChainPrefix + instanceId
 }
 
+func (iptables *IPTables) logChain(instanceId string) string {
+	return iptables.instanceChain(instanceId) + "-log"
+}
+
 func (iptables *IPTables) appendRule(chain string, rule rule) error {
-	return iptables.run("append", exec.Command("/sbin/iptables", append([]string{"-w", "-A", chain}, rule.flags(chain)...)...))
+	return iptables.run("append", exec.Command(iptables.family.binary, append([]string{"-w", "-A", chain}, rule.flags(chain)...)...))
 }
 
 func (iptables *IPTables) prependRule(chain string, rule rule) error {
-	return iptables.run("prepend", exec.Command("/sbin/iptables", append([]string{"-w", "-I", chain, "1"}, rule.flags(chain)...)...))
+	return iptables.run("prepend", exec.Command(iptables.family.binary, append([]string{"-w", "-I", chain, "1"}, rule.flags(chain)...)...))
+}
+
+func (iptables *IPTables) deleteRule(chain string, rule rule) error {
+	return iptables.run("delete", exec.Command(iptables.family.binary, append([]string{"-w", "-D", chain}, rule.flags(chain)...)...))
+}
+
+// check reports whether chain contains the rule
+func (iptables *IPTables) check(chain string, rule rule) bool {
+	return iptables.run("check", exec.Command(iptables.family.binary, append([]string{"-w", "-C", chain}, rule.flags(chain)...)...)) == nil
+}
+
+// restoreTable is a section of iptables-restore input, which is committed
+// atomically
+type restoreTable struct {
+	name  string
+	lines []string
+}
+
+func declareChain(chain string) string {
+	return fmt.Sprintf(":%s - [0:0]", chain)
+}
+
+func (iptables *IPTables) restore(action string, tables ...restoreTable) error {
+	var input bytes.Buffer
+	for _, table := range tables {
+		if len(table.lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&input, "*%s\n", table.name)
+		for _, line := range table.lines {
+			fmt.Fprintln(&input, line)
+		}
+		fmt.Fprintln(&input, "COMMIT")
+	}
+
+	if input.Len() == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(iptables.family.restoreBinary, "--wait", "--noflush")
+	cmd.Stdin = &input
+
+	return iptables.run(action, cmd)
+}
+
+// savedTable is a table as listed by iptables-save
+type savedTable struct {
+	chains []string
+	rules  []string
+}
+
+func (iptables *IPTables) save(action string) (map[string]savedTable, error) {
+	var output bytes.Buffer
+	cmd := exec.Command(iptables.family.saveBinary)
+	cmd.Stdout = &output
+
+	if err := iptables.run(action, cmd); err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]savedTable)
+
+	var name string
+	for _, line := range strings.Split(output.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "*"):
+			name = line[1:]
+		case strings.HasPrefix(line, ":"):
+			table := tables[name]
+			table.chains = append(table.chains, strings.Fields(line[1:])[0])
+			tables[name] = table
+		case strings.HasPrefix(line, "-A "):
+			table := tables[name]
+			table.rules = append(table.rules, line)
+			tables[name] = table
+		}
+	}
+
+	return tables, nil
+}
+
+// matching returns the rules in chain which have the given option set to
+// value, e.g. "-j" to a particular chain
+func (t savedTable) matching(chain, option, value string) []string {
+	var rules []string
+	for _, rule := range t.rules {
+		fields := strings.Fields(rule)
+		if fields[1] != chain {
+			continue
+		}
+
+		for i := 2; i < len(fields)-1; i++ {
+			if fields[i] == option && strings.Trim(fields[i+1], `"`) == value {
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+
+	return rules
 }
 
-func natRule(destination string, destinationPort uint32, containerIP string, containerPort uint32) rule {
+func (t savedTable) has(chain, option, value string) bool {
+	return len(t.matching(chain, option, value)) > 0
+}
+
+// deletions returns restore lines deleting the rules in chain which have the
+// given option set to value
+func (t savedTable) deletions(chain, option, value string) []string {
+	var lines []string
+	for _, rule := range t.matching(chain, option, value) {
+		lines = append(lines, "-D"+strings.TrimPrefix(rule, "-A"))
+	}
+
+	return lines
+}
+
+func (t savedTable) hasChain(chain string) bool {
+	for _, savedChain := range t.chains {
+		if savedChain == chain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removals returns restore lines flushing and then deleting those of the
+// given chains which exist
+func (t savedTable) removals(chains ...string) []string {
+	var existing []string
+	for _, chain := range chains {
+		if t.hasChain(chain) {
+			existing = append(existing, chain)
+		}
+	}
+
+	var lines []string
+	for _, chain := range existing {
+		lines = append(lines, "-F "+chain)
+	}
+
+	for _, chain := range existing {
+		lines = append(lines, "-X "+chain)
+	}
+
+	return lines
+}
+
+func natRule(protocol, destination string, destinationPort uint32, containerIP string, containerPort uint32) rule {
 	return iptablesFlags([]string{
 		"--table", "nat",
-		"--protocol", "tcp",
+		"--protocol", protocol,
 		"--destination", destination,
 		"--destination-port", fmt.Sprintf("%d", destinationPort),
 		"--jump", "DNAT",
@@ -82,6 +345,13 @@ func natRule(destination string, destinationPort uint32, containerIP string, con
 	})
 }
 
+func allowRule(destination string) rule {
+	return iptablesFlags([]string{
+		"--destination", destination,
+		"--jump", "RETURN",
+	})
+}
+
 func rejectRule(destination string) rule {
 	return iptablesFlags([]string{
 		"--destination", destination,
@@ -95,10 +365,15 @@ type singleFilterRule struct {
 	Ports    *garden.PortRange
 	ICMPs    *garden.ICMPControl
 	Log      bool
+
+	family family
 }
 
 func (r singleFilterRule) flags(chain string) (params []string) {
 	protocolString := protocols[r.Protocol]
+	if r.Protocol == garden.ProtocolICMP {
+		protocolString = r.family.icmp
+	}
 
 	params = append(params, "--protocol", protocolString)
 
@@ -128,7 +403,7 @@ func (r singleFilterRule) flags(chain string) (params []string) {
 			icmpType = fmt.Sprintf("%d/%d", r.ICMPs.Type, *r.ICMPs.Code)
 		}
 
-		params = append(params, "--icmp-type", icmpType)
+		params = append(params, r.family.icmpType, icmpType)
 	}
 
 	if r.Log {
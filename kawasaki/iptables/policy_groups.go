@@ -0,0 +1,199 @@
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+const ipsetBinary = "ipset"
+
+// PolicyGroups restricts the intra-subnet traffic to and from the members of
+// policy groups using three ipsets per group: one holding the IPs of the
+// group's members, a list of the member sets of the groups its members may
+// reach, i.e. its own and those the network policies allow, and a list of the
+// member sets of the groups which may reach its members.
+//
+// Traffic from a member is restricted in its instance chain. Traffic to a
+// member is restricted by a rule in the forward chain ahead of the other
+// containers' instance chains, so that containers in no group, whose
+// instance chains accept all intra-subnet traffic, cannot reach it either.
+type PolicyGroups struct {
+	iptables *IPTables
+	policies kawasaki.NetworkPolicies
+}
+
+func NewPolicyGroups(iptables *IPTables, policies kawasaki.NetworkPolicies) *PolicyGroups {
+	return &PolicyGroups{
+		iptables: iptables,
+		policies: policies,
+	}
+}
+
+// Start brings the reachable groups of every group which has been seen
+// before, or which has a policy, in line with the current policies, so that
+// policies which have since been removed no longer apply
+func (p *PolicyGroups) Start() error {
+	existing, err := p.reachSets()
+	if err != nil {
+		return fmt.Errorf("setting up policy groups: %s", err)
+	}
+
+	groups := map[string]bool{}
+	for _, group := range existing {
+		groups[group] = true
+	}
+
+	for from, tos := range p.policies {
+		groups[from] = true
+		for _, to := range tos {
+			groups[to] = true
+		}
+	}
+
+	var names []string
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	var commands []string
+	for _, group := range names {
+		commands = append(commands, p.declareGroup(group)...)
+	}
+
+	for _, group := range names {
+		commands = append(commands,
+			fmt.Sprintf("flush %s", p.reachSet(group)), fmt.Sprintf("add %s %s", p.reachSet(group), p.memberSet(group)),
+			fmt.Sprintf("flush %s", p.sourceSet(group)), fmt.Sprintf("add %s %s", p.sourceSet(group), p.memberSet(group)),
+		)
+		for _, to := range p.policies[group] {
+			commands = append(commands, fmt.Sprintf("add %s %s", p.reachSet(group), p.memberSet(to)))
+		}
+	}
+
+	// the source sets are only added to once they have all been flushed
+	for _, group := range names {
+		for _, to := range p.policies[group] {
+			commands = append(commands, fmt.Sprintf("add %s %s", p.sourceSet(to), p.memberSet(group)))
+		}
+	}
+
+	if err := p.restore("start-policy-groups", commands); err != nil {
+		return fmt.Errorf("setting up policy groups: %s", err)
+	}
+
+	return nil
+}
+
+// Join adds the IP to its group's member set and replaces the instance
+// chain's unconditional intra-subnet rule with rules which only accept
+// connections to the members of the groups it may reach. Replies to
+// connections from other containers are still accepted. New connections to
+// the IP from the subnet are dropped unless they come from a member of a
+// group which may reach it, by a forward chain rule tagged with the instance
+// id so that it goes with the instance chains.
+func (p *PolicyGroups) Join(logger lager.Logger, instanceId, group string, ip net.IP, network *net.IPNet) error {
+	commands := append(p.declareGroup(group), fmt.Sprintf("add %s %s", p.memberSet(group), ip.String()))
+	if err := p.restore("join-policy-group", commands); err != nil {
+		return err
+	}
+
+	instanceChain := p.iptables.instanceChain(instanceId)
+	intraSubnet := fmt.Sprintf("-s %s -d %s", network.String(), network.String())
+
+	return p.iptables.restore("join-policy-group", restoreTable{
+		name: "filter",
+		lines: []string{
+			fmt.Sprintf("-D %s %s -j ACCEPT", instanceChain, intraSubnet),
+			fmt.Sprintf("-I %s 1 %s -m set --match-set %s dst -j ACCEPT", instanceChain, intraSubnet, p.reachSet(group)),
+			fmt.Sprintf("-I %s 2 %s -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT", instanceChain, intraSubnet),
+			fmt.Sprintf("-I %s 3 %s -j DROP", instanceChain, intraSubnet),
+			fmt.Sprintf("-I %s 1 -s %s -d %s -m conntrack --ctstate NEW,UNTRACKED,INVALID -m set ! --match-set %s src -m comment --comment %s -j DROP",
+				p.iptables.forwardChain, network.String(), ip.String(), p.sourceSet(group), instanceId),
+		},
+	})
+}
+
+// Leave removes the IP from its group's member set. The rules added by Join
+// go with the instance chain.
+func (p *PolicyGroups) Leave(logger lager.Logger, group string, ip net.IP) error {
+	return p.restore("leave-policy-group", []string{fmt.Sprintf("del %s %s", p.memberSet(group), ip.String())})
+}
+
+func (p *PolicyGroups) memberSet(group string) string {
+	return p.iptables.setPrefix + "g-" + group
+}
+
+func (p *PolicyGroups) reachSet(group string) string {
+	return p.iptables.setPrefix + "r-" + group
+}
+
+func (p *PolicyGroups) sourceSet(group string) string {
+	return p.iptables.setPrefix + "s-" + group
+}
+
+// declareGroup returns the commands creating the group's sets, with its own
+// member set reachable and allowed to reach it, if they do not already exist
+func (p *PolicyGroups) declareGroup(group string) []string {
+	return []string{
+		fmt.Sprintf("create %s hash:ip", p.memberSet(group)),
+		fmt.Sprintf("create %s list:set", p.reachSet(group)),
+		fmt.Sprintf("add %s %s", p.reachSet(group), p.memberSet(group)),
+		fmt.Sprintf("create %s list:set", p.sourceSet(group)),
+		fmt.Sprintf("add %s %s", p.sourceSet(group), p.memberSet(group)),
+	}
+}
+
+// reachSets returns the groups which have a reach set
+func (p *PolicyGroups) reachSets() ([]string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command(ipsetBinary, "list", "-name")
+	cmd.Stdout = &output
+
+	if err := p.run("list-policy-groups", cmd); err != nil {
+		return nil, err
+	}
+
+	prefix := p.reachSet("")
+
+	var groups []string
+	for _, name := range strings.Fields(output.String()) {
+		if strings.HasPrefix(name, prefix) {
+			groups = append(groups, strings.TrimPrefix(name, prefix))
+		}
+	}
+
+	return groups, nil
+}
+
+// restore runs the commands with ipset restore, ignoring sets which already
+// exist and entries which are already present or absent
+func (p *PolicyGroups) restore(action string, commands []string) error {
+	var input bytes.Buffer
+	for _, command := range commands {
+		fmt.Fprintln(&input, command)
+	}
+
+	cmd := exec.Command(ipsetBinary, "restore", "-exist")
+	cmd.Stdin = &input
+
+	return p.run(action, cmd)
+}
+
+func (p *PolicyGroups) run(action string, cmd *exec.Cmd) error {
+	var buff bytes.Buffer
+	cmd.Stderr = &buff
+
+	if err := p.iptables.runner.Run(cmd); err != nil {
+		return fmt.Errorf("ipset %s: %s", action, buff.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package iptables_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os/exec"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PolicyGroups", func() {
+	var (
+		fakeRunner   *fake_command_runner.FakeCommandRunner
+		policyGroups *iptables.PolicyGroups
+		policies     kawasaki.NetworkPolicies
+		logger       lager.Logger
+
+		existingSets   string
+		ipsetInputs    []string
+		ipsetErr       error
+		iptablesInputs []string
+	)
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		policies = kawasaki.NetworkPolicies{}
+
+		existingSets = ""
+		ipsetInputs = nil
+		ipsetErr = nil
+		iptablesInputs = nil
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "ipset",
+			Args: []string{"restore", "-exist"},
+		}, func(cmd *exec.Cmd) error {
+			input, err := ioutil.ReadAll(cmd.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+
+			ipsetInputs = append(ipsetInputs, string(input))
+
+			if ipsetErr != nil {
+				cmd.Stderr.Write([]byte("ipset v6.29: Kernel error received"))
+			}
+			return ipsetErr
+		})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "ipset",
+			Args: []string{"list", "-name"},
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(existingSets))
+			return nil
+		})
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "iptables-restore",
+		}, func(cmd *exec.Cmd) error {
+			input, err := ioutil.ReadAll(cmd.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+
+			iptablesInputs = append(iptablesInputs, string(input))
+			return nil
+		})
+	})
+
+	JustBeforeEach(func() {
+		policyGroups = iptables.NewPolicyGroups(iptables.New(fakeRunner, "prefix-"), policies)
+	})
+
+	Describe("Join", func() {
+		var (
+			ip      net.IP
+			network *net.IPNet
+		)
+
+		BeforeEach(func() {
+			var err error
+			ip, network, err = net.ParseCIDR("10.0.0.2/24")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the group's sets and adds the IP to its members", func() {
+			Expect(policyGroups.Join(logger, "some-id", "tenant-a", ip, network)).To(Succeed())
+
+			Expect(ipsetInputs).To(Equal([]string{`create prefix-g-tenant-a hash:ip
+create prefix-r-tenant-a list:set
+add prefix-r-tenant-a prefix-g-tenant-a
+create prefix-s-tenant-a list:set
+add prefix-s-tenant-a prefix-g-tenant-a
+add prefix-g-tenant-a 10.0.0.2
+`}))
+		})
+
+		It("replaces the instance chain's intra-subnet rule with the group's rules", func() {
+			Expect(policyGroups.Join(logger, "some-id", "tenant-a", ip, network)).To(Succeed())
+
+			Expect(iptablesInputs).To(HaveLen(1))
+			Expect(iptablesInputs[0]).To(ContainSubstring(`-D prefix-instance-some-id -s 10.0.0.0/24 -d 10.0.0.0/24 -j ACCEPT
+-I prefix-instance-some-id 1 -s 10.0.0.0/24 -d 10.0.0.0/24 -m set --match-set prefix-r-tenant-a dst -j ACCEPT
+-I prefix-instance-some-id 2 -s 10.0.0.0/24 -d 10.0.0.0/24 -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+-I prefix-instance-some-id 3 -s 10.0.0.0/24 -d 10.0.0.0/24 -j DROP
+`))
+		})
+
+		It("drops new connections to the IP from the subnet, unless they come from a group which may reach it, ahead of the other containers' instance chains", func() {
+			Expect(policyGroups.Join(logger, "some-id", "tenant-a", ip, network)).To(Succeed())
+
+			Expect(iptablesInputs).To(Equal([]string{`*filter
+-D prefix-instance-some-id -s 10.0.0.0/24 -d 10.0.0.0/24 -j ACCEPT
+-I prefix-instance-some-id 1 -s 10.0.0.0/24 -d 10.0.0.0/24 -m set --match-set prefix-r-tenant-a dst -j ACCEPT
+-I prefix-instance-some-id 2 -s 10.0.0.0/24 -d 10.0.0.0/24 -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+-I prefix-instance-some-id 3 -s 10.0.0.0/24 -d 10.0.0.0/24 -j DROP
+-I prefix-forward 1 -s 10.0.0.0/24 -d 10.0.0.2 -m conntrack --ctstate NEW,UNTRACKED,INVALID -m set ! --match-set prefix-s-tenant-a src -m comment --comment some-id -j DROP
+COMMIT
+`}))
+		})
+
+		Context("when ipset fails", func() {
+			BeforeEach(func() {
+				ipsetErr = errors.New("exit status 1")
+			})
+
+			It("returns a wrapped error, including stderr", func() {
+				Expect(policyGroups.Join(logger, "some-id", "tenant-a", ip, network)).To(
+					MatchError("ipset join-policy-group: ipset v6.29: Kernel error received"),
+				)
+			})
+
+			It("does not change the instance chain", func() {
+				Expect(policyGroups.Join(logger, "some-id", "tenant-a", ip, network)).NotTo(Succeed())
+				Expect(iptablesInputs).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Leave", func() {
+		It("removes the IP from the group's members", func() {
+			Expect(policyGroups.Leave(logger, "tenant-a", net.ParseIP("10.0.0.2"))).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "ipset",
+				Args: []string{"restore", "-exist"},
+			}))
+			Expect(ipsetInputs).To(Equal([]string{"del prefix-g-tenant-a 10.0.0.2\n"}))
+		})
+	})
+
+	Describe("Start", func() {
+		BeforeEach(func() {
+			existingSets = "prefix-g-tenant-a\nprefix-r-tenant-a\nprefix-g-tenant-c\nprefix-r-tenant-c\nother-r-tenant-d\n"
+			policies = kawasaki.NetworkPolicies{"tenant-a": {"tenant-b"}}
+		})
+
+		It("resets the groups' reachable and source sets to the current policies", func() {
+			Expect(policyGroups.Start()).To(Succeed())
+
+			Expect(ipsetInputs).To(Equal([]string{`create prefix-g-tenant-a hash:ip
+create prefix-r-tenant-a list:set
+add prefix-r-tenant-a prefix-g-tenant-a
+create prefix-s-tenant-a list:set
+add prefix-s-tenant-a prefix-g-tenant-a
+create prefix-g-tenant-b hash:ip
+create prefix-r-tenant-b list:set
+add prefix-r-tenant-b prefix-g-tenant-b
+create prefix-s-tenant-b list:set
+add prefix-s-tenant-b prefix-g-tenant-b
+create prefix-g-tenant-c hash:ip
+create prefix-r-tenant-c list:set
+add prefix-r-tenant-c prefix-g-tenant-c
+create prefix-s-tenant-c list:set
+add prefix-s-tenant-c prefix-g-tenant-c
+flush prefix-r-tenant-a
+add prefix-r-tenant-a prefix-g-tenant-a
+flush prefix-s-tenant-a
+add prefix-s-tenant-a prefix-g-tenant-a
+add prefix-r-tenant-a prefix-g-tenant-b
+flush prefix-r-tenant-b
+add prefix-r-tenant-b prefix-g-tenant-b
+flush prefix-s-tenant-b
+add prefix-s-tenant-b prefix-g-tenant-b
+flush prefix-r-tenant-c
+add prefix-r-tenant-c prefix-g-tenant-c
+flush prefix-s-tenant-c
+add prefix-s-tenant-c prefix-g-tenant-c
+add prefix-s-tenant-b prefix-g-tenant-a
+`}))
+		})
+
+		Context("when ipset fails", func() {
+			It("returns a wrapped error", func() {
+				ipsetErr = errors.New("exit status 1")
+
+				Expect(policyGroups.Start()).To(
+					MatchError("setting up policy groups: ipset start-policy-groups: ipset v6.29: Kernel error received"),
+				)
+			})
+		})
+	})
+})
@@ -13,13 +13,48 @@ func NewPortForwarder(iptables *IPTables) *PortForwarder {
 }
 
 func (p *PortForwarder) Forward(spec kawasaki.PortForwarderSpec) error {
-	return p.iptables.appendRule(
-		p.iptables.instanceChain(spec.InstanceID),
-		natRule(
-			spec.ExternalIP.String(),
-			spec.FromPort,
-			spec.ContainerIP.String(),
-			spec.ToPort,
-		),
-	)
+	return p.eachNatRule(spec, p.iptables.appendRule)
+}
+
+// Unforward removes the rules added by a Forward call with the same spec
+func (p *PortForwarder) Unforward(spec kawasaki.PortForwarderSpec) error {
+	return p.eachNatRule(spec, p.iptables.deleteRule)
+}
+
+// PortForwardExists reports whether all of the rules added by a Forward call
+// with the same spec are in place
+func (p *PortForwarder) PortForwardExists(spec kawasaki.PortForwarderSpec) (bool, error) {
+	exists := true
+	err := p.eachNatRule(spec, func(chain string, rule rule) error {
+		exists = exists && p.iptables.check(chain, rule)
+		return nil
+	})
+
+	return exists, err
+}
+
+func (p *PortForwarder) eachNatRule(spec kawasaki.PortForwarderSpec, apply func(chain string, rule rule) error) error {
+	portCount := spec.PortCount
+	if portCount == 0 {
+		portCount = 1
+	}
+
+	// DNAT to a port range balances across it rather than mapping port for
+	// port, so each port in the range gets its own rule
+	for i := uint32(0); i < portCount; i++ {
+		if err := apply(
+			p.iptables.instanceChain(spec.InstanceID),
+			natRule(
+				protocols[spec.Protocol],
+				spec.ExternalIP.String(),
+				spec.FromPort+i,
+				spec.ContainerIP.String(),
+				spec.ToPort+i,
+			),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -1,8 +1,11 @@
 package iptables_test
 
 import (
+	"errors"
 	"net"
+	"os/exec"
 
+	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/iptables"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
@@ -28,6 +31,7 @@ var _ = Describe("PortForwarder", func() {
 	It("adds a NAT rule to forward the port", func() {
 		Expect(forwarder.Forward(kawasaki.PortForwarderSpec{
 			InstanceID:  "some-instance",
+			Protocol:    garden.ProtocolTCP,
 			ExternalIP:  net.ParseIP("5.6.7.8"),
 			ContainerIP: net.ParseIP("1.2.3.4"),
 			FromPort:    22,
@@ -50,4 +54,148 @@ var _ = Describe("PortForwarder", func() {
 			},
 		))
 	})
+
+	It("uses the requested protocol", func() {
+		Expect(forwarder.Forward(kawasaki.PortForwarderSpec{
+			InstanceID:  "some-instance",
+			Protocol:    garden.ProtocolUDP,
+			ExternalIP:  net.ParseIP("5.6.7.8"),
+			ContainerIP: net.ParseIP("1.2.3.4"),
+			FromPort:    53,
+			ToPort:      53,
+		})).To(Succeed())
+
+		Expect(fakeRunner).To(HaveExecutedSerially(
+			fake_command_runner.CommandSpec{
+				Path: "/sbin/iptables",
+				Args: []string{
+					"-w",
+					"-A", "prefix-instance-some-instance",
+					"--table", "nat",
+					"--protocol", "udp",
+					"--destination", "5.6.7.8",
+					"--destination-port", "53",
+					"--jump", "DNAT",
+					"--to-destination", "1.2.3.4:53",
+				},
+			},
+		))
+	})
+
+	It("forwards each port in a range", func() {
+		Expect(forwarder.Forward(kawasaki.PortForwarderSpec{
+			InstanceID:  "some-instance",
+			Protocol:    garden.ProtocolTCP,
+			ExternalIP:  net.ParseIP("5.6.7.8"),
+			ContainerIP: net.ParseIP("1.2.3.4"),
+			FromPort:    22,
+			ToPort:      33,
+			PortCount:   2,
+		})).To(Succeed())
+
+		Expect(fakeRunner).To(HaveExecutedSerially(
+			fake_command_runner.CommandSpec{
+				Path: "/sbin/iptables",
+				Args: []string{
+					"-w",
+					"-A", "prefix-instance-some-instance",
+					"--table", "nat",
+					"--protocol", "tcp",
+					"--destination", "5.6.7.8",
+					"--destination-port", "22",
+					"--jump", "DNAT",
+					"--to-destination", "1.2.3.4:33",
+				},
+			},
+			fake_command_runner.CommandSpec{
+				Path: "/sbin/iptables",
+				Args: []string{
+					"-w",
+					"-A", "prefix-instance-some-instance",
+					"--table", "nat",
+					"--protocol", "tcp",
+					"--destination", "5.6.7.8",
+					"--destination-port", "23",
+					"--jump", "DNAT",
+					"--to-destination", "1.2.3.4:34",
+				},
+			},
+		))
+	})
+
+	Describe("Unforward", func() {
+		It("deletes the NAT rule for each forwarded port", func() {
+			Expect(forwarder.Unforward(kawasaki.PortForwarderSpec{
+				InstanceID:  "some-instance",
+				Protocol:    garden.ProtocolTCP,
+				ExternalIP:  net.ParseIP("5.6.7.8"),
+				ContainerIP: net.ParseIP("1.2.3.4"),
+				FromPort:    22,
+				ToPort:      33,
+			})).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{
+						"-w",
+						"-D", "prefix-instance-some-instance",
+						"--table", "nat",
+						"--protocol", "tcp",
+						"--destination", "5.6.7.8",
+						"--destination-port", "22",
+						"--jump", "DNAT",
+						"--to-destination", "1.2.3.4:33",
+					},
+				},
+			))
+		})
+	})
+
+	Describe("PortForwardExists", func() {
+		var spec kawasaki.PortForwarderSpec
+
+		BeforeEach(func() {
+			spec = kawasaki.PortForwarderSpec{
+				InstanceID:  "some-instance",
+				Protocol:    garden.ProtocolTCP,
+				ExternalIP:  net.ParseIP("5.6.7.8"),
+				ContainerIP: net.ParseIP("1.2.3.4"),
+				FromPort:    22,
+				ToPort:      33,
+			}
+		})
+
+		It("checks for the NAT rule", func() {
+			Expect(forwarder.PortForwardExists(spec)).To(BeTrue())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+					Args: []string{
+						"-w",
+						"-C", "prefix-instance-some-instance",
+						"--table", "nat",
+						"--protocol", "tcp",
+						"--destination", "5.6.7.8",
+						"--destination-port", "22",
+						"--jump", "DNAT",
+						"--to-destination", "1.2.3.4:33",
+					},
+				},
+			))
+		})
+
+		Context("when the rule does not exist", func() {
+			It("returns false", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "/sbin/iptables",
+				}, func(*exec.Cmd) error {
+					return errors.New("exit status 1")
+				})
+
+				Expect(forwarder.PortForwardExists(spec)).To(BeFalse())
+			})
+		})
+	})
 })
@@ -0,0 +1,316 @@
+package kawasaki
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
+	"github.com/pivotal-golang/lager"
+)
+
+// NamedNetworkPrefix introduces a network spec which joins a named network,
+// e.g. "name:tenant-a", or "name:tenant-a/28" to size its subnet if this is
+// the first container to join
+const NamedNetworkPrefix = "name:"
+
+// AcquireFunc acquires a subnet and IP for a container joining a named
+// network. It is passed the network's subnet, or nil if the network does not
+// exist yet.
+type AcquireFunc func(subnet *net.IPNet) (*net.IPNet, net.IP, error)
+
+//go:generate counterfeiter . NamedNetworkRegistry
+
+type NamedNetworkRegistry interface {
+	Join(log lager.Logger, name, handle string, acquire AcquireFunc) (*net.IPNet, net.IP, error)
+	Leave(log lager.Logger, name, handle string)
+	Record(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP)
+	Forget(log lager.Logger, handle string, subnet *net.IPNet)
+}
+
+// NamedNetwork is a subnet shared by the containers which have joined it by
+// name
+type NamedNetwork struct {
+	Subnet  string            `json:"subnet"`
+	Members map[string]string `json:"members"` // handle -> container IP
+}
+
+// Allocation is the subnet and IP of a container's attachment which is not
+// on a named network
+type Allocation struct {
+	Subnet string `json:"subnet"`
+	IP     string `json:"ip"`
+}
+
+// NamedNetworks keeps track of which containers are members of each named
+// network. The subnet is allocated when the first member joins and, as the
+// subnet pool releases a subnet along with its last IP, it is freed again
+// when the last member leaves.
+//
+// The subnets of containers on no named network are recorded too, so that
+// every container's subnet can be recovered, rather than later being handed
+// to a named network while it is still in use.
+//
+// The networks are saved to the state file, if any, after every change so
+// that they can be recovered when guardian restarts.
+type NamedNetworks struct {
+	stateFilePath string
+
+	networks    map[string]NamedNetwork
+	allocations map[string][]Allocation // handle -> allocations
+	mu          sync.Mutex
+}
+
+// namedNetworksState is the contents of the state file
+type namedNetworksState struct {
+	Networks    map[string]NamedNetwork `json:"networks"`
+	Allocations map[string][]Allocation `json:"allocations"`
+}
+
+// NewNamedNetworks loads the named networks from the state file, if it exists
+func NewNamedNetworks(stateFilePath string) (*NamedNetworks, error) {
+	n := &NamedNetworks{
+		stateFilePath: stateFilePath,
+		networks:      map[string]NamedNetwork{},
+		allocations:   map[string][]Allocation{},
+	}
+
+	if stateFilePath == "" {
+		return n, nil
+	}
+
+	stateFile, err := os.Open(stateFilePath)
+	if os.IsNotExist(err) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening named networks state file: %s", err)
+	}
+	defer stateFile.Close()
+
+	var state namedNetworksState
+	if err := json.NewDecoder(stateFile).Decode(&state); err != nil {
+		return nil, fmt.Errorf("parsing named networks state file: %s", err)
+	}
+
+	if state.Networks != nil {
+		n.networks = state.Networks
+	}
+
+	if state.Allocations != nil {
+		n.allocations = state.Allocations
+	}
+
+	return n, nil
+}
+
+// Recover re-allocates the subnet and IP of each member of the named
+// networks, and of each container on no named network, in the pool
+func (n *NamedNetworks) Recover(log lager.Logger, pool subnets.Pool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for name, network := range n.networks {
+		_, subnet, err := net.ParseCIDR(network.Subnet)
+		if err != nil {
+			return fmt.Errorf("parsing subnet of named network %s: %s", name, err)
+		}
+
+		for handle, ip := range network.Members {
+			if err := pool.Remove(subnet, net.ParseIP(ip)); err != nil {
+				log.Error("recover-member-failed", err, lager.Data{"network": name, "handle": handle})
+			}
+		}
+	}
+
+	for handle, allocations := range n.allocations {
+		for _, allocation := range allocations {
+			_, subnet, err := net.ParseCIDR(allocation.Subnet)
+			if err != nil {
+				return fmt.Errorf("parsing subnet of container %s: %s", handle, err)
+			}
+
+			if err := pool.Remove(subnet, net.ParseIP(allocation.IP)); err != nil {
+				log.Error("recover-allocation-failed", err, lager.Data{"handle": handle, "subnet": allocation.Subnet})
+			}
+		}
+	}
+
+	return nil
+}
+
+// RestoreDNS adds the bridge of each member of the named networks, and of
+// each container on no named network, to the DNS responder, so that the
+// containers which were running before guardian restarted can still resolve
+// names
+func (n *NamedNetworks) RestoreDNS(log lager.Logger, responder DNSResponder) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for name, network := range n.networks {
+		_, subnet, err := net.ParseCIDR(network.Subnet)
+		if err != nil {
+			return fmt.Errorf("parsing subnet of named network %s: %s", name, err)
+		}
+
+		for range network.Members {
+			responder.Add(log, subnets.GatewayIP(subnet))
+		}
+	}
+
+	for handle, allocations := range n.allocations {
+		for _, allocation := range allocations {
+			_, subnet, err := net.ParseCIDR(allocation.Subnet)
+			if err != nil {
+				return fmt.Errorf("parsing subnet of container %s: %s", handle, err)
+			}
+
+			responder.Add(log, subnets.GatewayIP(subnet))
+		}
+	}
+
+	return nil
+}
+
+// Join adds the container to the named network using the subnet and IP
+// returned by acquire
+func (n *NamedNetworks) Join(log lager.Logger, name, handle string, acquire AcquireFunc) (*net.IPNet, net.IP, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	network, exists := n.networks[name]
+
+	var existing *net.IPNet
+	if exists {
+		var err error
+		if _, existing, err = net.ParseCIDR(network.Subnet); err != nil {
+			return nil, nil, fmt.Errorf("parsing subnet of named network %s: %s", name, err)
+		}
+	}
+
+	if network.Members == nil {
+		network.Members = map[string]string{}
+	}
+
+	subnet, ip, err := acquire(existing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("joined-named-network", lager.Data{"network": name, "handle": handle, "subnet": subnet.String(), "new": !exists})
+
+	network.Subnet = subnet.String()
+	network.Members[handle] = ip.String()
+	n.networks[name] = network
+
+	n.save(log)
+
+	return subnet, ip, nil
+}
+
+// Leave removes the container from the named network, forgetting the network
+// once it has no members
+func (n *NamedNetworks) Leave(log lager.Logger, name, handle string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	network, exists := n.networks[name]
+	if !exists {
+		return
+	}
+
+	delete(network.Members, handle)
+	if len(network.Members) == 0 {
+		log.Info("named-network-empty", lager.Data{"network": name})
+		delete(n.networks, name)
+	}
+
+	n.save(log)
+}
+
+// Record records the subnet and IP of one of the container's attachments
+// which is not on a named network
+func (n *NamedNetworks) Record(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.allocations[handle] = append(n.allocations[handle], Allocation{Subnet: subnet.String(), IP: ip.String()})
+
+	n.save(log)
+}
+
+// Forget forgets the container's attachment in the subnet once it has been
+// released
+func (n *NamedNetworks) Forget(log lager.Logger, handle string, subnet *net.IPNet) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var remaining []Allocation
+	for _, allocation := range n.allocations[handle] {
+		if allocation.Subnet != subnet.String() {
+			remaining = append(remaining, allocation)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(n.allocations, handle)
+	} else {
+		n.allocations[handle] = remaining
+	}
+
+	n.save(log)
+}
+
+// Allocations returns the current allocations of containers on no named
+// network
+func (n *NamedNetworks) Allocations() map[string][]Allocation {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	allocations := map[string][]Allocation{}
+	for handle, a := range n.allocations {
+		allocations[handle] = append([]Allocation{}, a...)
+	}
+
+	return allocations
+}
+
+// Networks returns the current named networks
+func (n *NamedNetworks) Networks() map[string]NamedNetwork {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	networks := map[string]NamedNetwork{}
+	for name, network := range n.networks {
+		members := map[string]string{}
+		for handle, ip := range network.Members {
+			members[handle] = ip
+		}
+
+		networks[name] = NamedNetwork{Subnet: network.Subnet, Members: members}
+	}
+
+	return networks
+}
+
+// save writes the networks to the state file. Failing to do so only affects
+// recovery after a restart, so the error is logged rather than failing the
+// container's creation or destruction.
+func (n *NamedNetworks) save(log lager.Logger) {
+	if n.stateFilePath == "" {
+		return
+	}
+
+	stateFile, err := os.Create(n.stateFilePath)
+	if err != nil {
+		log.Error("save-named-networks-failed", err, lager.Data{"path": n.stateFilePath})
+		return
+	}
+	defer stateFile.Close()
+
+	if err := json.NewEncoder(stateFile).Encode(namedNetworksState{Networks: n.networks, Allocations: n.allocations}); err != nil {
+		log.Error("save-named-networks-failed", err, lager.Data{"path": n.stateFilePath})
+	}
+}
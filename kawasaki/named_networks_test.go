@@ -0,0 +1,264 @@
+package kawasaki_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/fakes"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets/fake_subnet_pool"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("NamedNetworks", func() {
+	var (
+		tmpDir        string
+		stateFilePath string
+		namedNetworks *kawasaki.NamedNetworks
+		logger        *lagertest.TestLogger
+
+		subnet *net.IPNet
+		ips    []net.IP
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "named-networks")
+		Expect(err).NotTo(HaveOccurred())
+
+		stateFilePath = filepath.Join(tmpDir, "networks.json")
+		logger = lagertest.NewTestLogger("test")
+
+		_, subnet, err = net.ParseCIDR("10.0.0.0/28")
+		Expect(err).NotTo(HaveOccurred())
+		ips = []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		namedNetworks, err = kawasaki.NewNamedNetworks(stateFilePath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	join := func(name, handle string) *net.IPNet {
+		var existing *net.IPNet
+		_, _, err := namedNetworks.Join(logger, name, handle, func(s *net.IPNet) (*net.IPNet, net.IP, error) {
+			existing = s
+			ip := ips[0]
+			ips = ips[1:]
+			return subnet, ip, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		return existing
+	}
+
+	Describe("Join", func() {
+		It("acquires a new subnet for the first member", func() {
+			Expect(join("tenant-a", "handle-1")).To(BeNil())
+		})
+
+		It("passes the network's subnet when later members join", func() {
+			join("tenant-a", "handle-1")
+			Expect(join("tenant-a", "handle-2")).To(Equal(subnet))
+		})
+
+		It("keeps different names apart", func() {
+			join("tenant-a", "handle-1")
+			Expect(join("tenant-b", "handle-2")).To(BeNil())
+		})
+
+		It("records the members", func() {
+			join("tenant-a", "handle-1")
+			join("tenant-a", "handle-2")
+
+			Expect(namedNetworks.Networks()).To(Equal(map[string]kawasaki.NamedNetwork{
+				"tenant-a": {
+					Subnet:  "10.0.0.0/28",
+					Members: map[string]string{"handle-1": "10.0.0.2", "handle-2": "10.0.0.3"},
+				},
+			}))
+		})
+
+		Context("when acquiring fails", func() {
+			It("returns the error and does not create the network", func() {
+				_, _, err := namedNetworks.Join(logger, "tenant-a", "handle-1", func(*net.IPNet) (*net.IPNet, net.IP, error) {
+					return nil, nil, errors.New("no subnets")
+				})
+				Expect(err).To(MatchError("no subnets"))
+
+				Expect(namedNetworks.Networks()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Leave", func() {
+		It("removes the member", func() {
+			join("tenant-a", "handle-1")
+			join("tenant-a", "handle-2")
+
+			namedNetworks.Leave(logger, "tenant-a", "handle-1")
+
+			Expect(namedNetworks.Networks()["tenant-a"].Members).To(Equal(map[string]string{"handle-2": "10.0.0.3"}))
+		})
+
+		It("forgets the network when the last member leaves", func() {
+			join("tenant-a", "handle-1")
+
+			namedNetworks.Leave(logger, "tenant-a", "handle-1")
+
+			Expect(namedNetworks.Networks()).To(BeEmpty())
+			Expect(join("tenant-a", "handle-2")).To(BeNil())
+		})
+	})
+
+	Describe("Record", func() {
+		It("records the allocations of containers on no named network", func() {
+			_, otherSubnet, err := net.ParseCIDR("10.0.1.0/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			namedNetworks.Record(logger, "handle-1", subnet, net.ParseIP("10.0.0.2"))
+			namedNetworks.Record(logger, "handle-1", otherSubnet, net.ParseIP("10.0.1.2"))
+
+			Expect(namedNetworks.Allocations()).To(Equal(map[string][]kawasaki.Allocation{
+				"handle-1": {
+					{Subnet: "10.0.0.0/28", IP: "10.0.0.2"},
+					{Subnet: "10.0.1.0/30", IP: "10.0.1.2"},
+				},
+			}))
+			Expect(namedNetworks.Networks()).To(BeEmpty())
+		})
+	})
+
+	Describe("Forget", func() {
+		var otherSubnet *net.IPNet
+
+		BeforeEach(func() {
+			var err error
+			_, otherSubnet, err = net.ParseCIDR("10.0.1.0/30")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("forgets the allocation in the subnet", func() {
+			namedNetworks.Record(logger, "handle-1", subnet, net.ParseIP("10.0.0.2"))
+			namedNetworks.Record(logger, "handle-1", otherSubnet, net.ParseIP("10.0.1.2"))
+
+			namedNetworks.Forget(logger, "handle-1", subnet)
+
+			Expect(namedNetworks.Allocations()).To(Equal(map[string][]kawasaki.Allocation{
+				"handle-1": {{Subnet: "10.0.1.0/30", IP: "10.0.1.2"}},
+			}))
+		})
+
+		It("forgets the container once it has no allocations", func() {
+			namedNetworks.Record(logger, "handle-1", subnet, net.ParseIP("10.0.0.2"))
+
+			namedNetworks.Forget(logger, "handle-1", subnet)
+
+			Expect(namedNetworks.Allocations()).To(BeEmpty())
+		})
+	})
+
+	Describe("state", func() {
+		It("is restored by a new registry using the same state file", func() {
+			join("tenant-a", "handle-1")
+			namedNetworks.Record(logger, "handle-2", subnet, net.ParseIP("10.0.0.5"))
+
+			restored, err := kawasaki.NewNamedNetworks(stateFilePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored.Networks()).To(Equal(namedNetworks.Networks()))
+			Expect(restored.Allocations()).To(Equal(namedNetworks.Allocations()))
+		})
+
+		Context("when the state file is corrupt", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(stateFilePath, []byte("{not json"), 0644)).To(Succeed())
+			})
+
+			It("fails to load", func() {
+				_, err := kawasaki.NewNamedNetworks(stateFilePath)
+				Expect(err).To(MatchError(ContainSubstring("parsing named networks state file")))
+			})
+		})
+
+		Context("when there is no state file path", func() {
+			BeforeEach(func() {
+				stateFilePath = ""
+			})
+
+			It("keeps the networks in memory", func() {
+				join("tenant-a", "handle-1")
+				Expect(namedNetworks.Networks()).To(HaveKey("tenant-a"))
+			})
+		})
+	})
+
+	Describe("Recover", func() {
+		It("re-allocates each member's IP in the pool", func() {
+			join("tenant-a", "handle-1")
+			join("tenant-a", "handle-2")
+
+			fakePool := new(fake_subnet_pool.FakePool)
+			Expect(namedNetworks.Recover(logger, fakePool)).To(Succeed())
+
+			Expect(fakePool.RemoveCallCount()).To(Equal(2))
+			var recovered []string
+			for i := 0; i < fakePool.RemoveCallCount(); i++ {
+				s, ip := fakePool.RemoveArgsForCall(i)
+				Expect(s.String()).To(Equal("10.0.0.0/28"))
+				recovered = append(recovered, ip.String())
+			}
+			Expect(recovered).To(ConsistOf("10.0.0.2", "10.0.0.3"))
+		})
+
+		It("re-allocates the IP of each container on no named network in the pool", func() {
+			_, otherSubnet, err := net.ParseCIDR("10.0.1.0/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			join("tenant-a", "handle-1")
+			namedNetworks.Record(logger, "handle-2", otherSubnet, net.ParseIP("10.0.1.2"))
+
+			fakePool := new(fake_subnet_pool.FakePool)
+			Expect(namedNetworks.Recover(logger, fakePool)).To(Succeed())
+
+			Expect(fakePool.RemoveCallCount()).To(Equal(2))
+			var recovered []string
+			for i := 0; i < fakePool.RemoveCallCount(); i++ {
+				s, ip := fakePool.RemoveArgsForCall(i)
+				recovered = append(recovered, s.String()+" "+ip.String())
+			}
+			Expect(recovered).To(ConsistOf("10.0.0.0/28 10.0.0.2", "10.0.1.0/30 10.0.1.2"))
+		})
+	})
+
+	Describe("RestoreDNS", func() {
+		It("adds the bridge of each member and each container on no named network to the responder", func() {
+			_, otherSubnet, err := net.ParseCIDR("10.0.1.0/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			join("tenant-a", "handle-1")
+			join("tenant-a", "handle-2")
+			namedNetworks.Record(logger, "handle-3", otherSubnet, net.ParseIP("10.0.1.2"))
+
+			fakeResponder := new(fakes.FakeDNSResponder)
+			Expect(namedNetworks.RestoreDNS(logger, fakeResponder)).To(Succeed())
+
+			Expect(fakeResponder.AddCallCount()).To(Equal(3))
+			var bridgeIPs []string
+			for i := 0; i < fakeResponder.AddCallCount(); i++ {
+				_, bridgeIP := fakeResponder.AddArgsForCall(i)
+				bridgeIPs = append(bridgeIPs, bridgeIP.String())
+			}
+			Expect(bridgeIPs).To(ConsistOf("10.0.0.1", "10.0.0.1", "10.0.1.1"))
+		})
+	})
+})
@@ -0,0 +1,66 @@
+package kawasaki
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// NetworkSharers records which containers share the network of each peer as
+// a file per sharer in a directory per peer. The peer's poststop hook runs
+// outside of the daemon, so it checks the peer's directory to leave the
+// network in place while other containers still use it.
+type NetworkSharers struct {
+	dir string
+}
+
+func NewNetworkSharers(dir string) *NetworkSharers {
+	return &NetworkSharers{dir: dir}
+}
+
+// Dir returns the directory in which the sharers of a peer's network are
+// recorded
+func (s *NetworkSharers) Dir(peer string) string {
+	return filepath.Join(s.dir, peer)
+}
+
+// Add records that a container shares the network of a peer
+func (s *NetworkSharers) Add(peer, handle string) error {
+	if err := os.MkdirAll(s.Dir(peer), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(s.Dir(peer), handle), nil, 0600)
+}
+
+// Remove records that a container no longer shares the network of a peer
+func (s *NetworkSharers) Remove(peer, handle string) error {
+	if err := os.Remove(filepath.Join(s.Dir(peer), handle)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// the directory is left in place while other sharers remain in it
+	os.Remove(s.Dir(peer))
+	return nil
+}
+
+// Forget removes the record of a peer's sharers once its network is gone
+func (s *NetworkSharers) Forget(peer string) error {
+	return os.RemoveAll(s.Dir(peer))
+}
+
+// HasNetworkSharers returns whether any container is recorded as sharing the
+// network whose sharers are recorded in dir. A dir which does not exist has
+// no sharers.
+func HasNetworkSharers(dir string) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(entries) > 0, nil
+}
@@ -0,0 +1,190 @@
+package kawasaki
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+)
+
+const (
+	MinMTU = 68
+	MaxMTU = 65535
+)
+
+// NetworkSpec is a container's network spec given as a JSON object, e.g.
+// {"network": "tenant-a", "subnet": "/28", "mtu": 1400}, which can carry
+// options the string syntax has no room for. Its first attachment is given
+// by the top-level options, and any further ones by Attachments.
+type NetworkSpec struct {
+	// Mode is "none", "host" or "container:<handle>", as in the string
+	// syntax, and may not be combined with any other option
+	Mode string `json:"mode"`
+
+	NetworkAttachmentSpec
+
+	// DNSServers replace the DNS servers given by the host or the container's
+	// properties
+	DNSServers []string `json:"dns_servers"`
+
+	Attachments []NetworkAttachmentSpec `json:"attachments"`
+}
+
+// NetworkAttachmentSpec gives one of the attachments of a JSON network spec
+type NetworkAttachmentSpec struct {
+	// Network names a named network to join
+	Network string `json:"network"`
+
+	// Subnet is a subnet in CIDR notation, or a bare prefix length such as
+	// "/28" for a dynamic subnet of that size
+	Subnet string `json:"subnet"`
+
+	// IP is the container's address in a Subnet given in CIDR notation
+	IP string `json:"ip"`
+
+	// MTU replaces the MTU of the attachment's interfaces
+	MTU int `json:"mtu"`
+}
+
+var (
+	networkSpecOptions           = []string{"mode", "network", "subnet", "ip", "mtu", "dns_servers", "attachments"}
+	networkAttachmentSpecOptions = []string{"network", "subnet", "ip", "mtu"}
+)
+
+// IsJSONNetworkSpec returns true if the network spec is a JSON object rather
+// than a spec in the string syntax
+func IsJSONNetworkSpec(spec string) bool {
+	return strings.HasPrefix(spec, "{")
+}
+
+// ParseNetworkSpec parses and validates a JSON network spec
+func ParseNetworkSpec(spec string) (NetworkSpec, error) {
+	var options map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(spec), &options); err != nil {
+		return NetworkSpec{}, fmt.Errorf("invalid JSON network spec: %s", err)
+	}
+
+	if err := checkOptions(options, networkSpecOptions); err != nil {
+		return NetworkSpec{}, err
+	}
+
+	var attachments []map[string]json.RawMessage
+	if raw, ok := options["attachments"]; ok {
+		if err := json.Unmarshal(raw, &attachments); err != nil {
+			return NetworkSpec{}, fmt.Errorf("invalid JSON network spec: attachments: %s", err)
+		}
+	}
+
+	for i, attachment := range attachments {
+		if err := checkOptions(attachment, networkAttachmentSpecOptions); err != nil {
+			return NetworkSpec{}, fmt.Errorf("attachment %d: %s", i+1, err)
+		}
+	}
+
+	var networkSpec NetworkSpec
+	if err := json.Unmarshal([]byte(spec), &networkSpec); err != nil {
+		return NetworkSpec{}, fmt.Errorf("invalid JSON network spec: %s", err)
+	}
+
+	if networkSpec.Mode != "" {
+		if len(options) > 1 {
+			return NetworkSpec{}, fmt.Errorf("network spec mode '%s' cannot be combined with other options", networkSpec.Mode)
+		}
+
+		if !validNetworkMode(networkSpec.Mode) {
+			return NetworkSpec{}, fmt.Errorf("network spec mode '%s' must be '%s', '%s' or '%s<handle>'", networkSpec.Mode, gardener.NetworkModeNone, gardener.NetworkModeHost, gardener.NetworkPeerPrefix)
+		}
+
+		return networkSpec, nil
+	}
+
+	for _, server := range networkSpec.DNSServers {
+		if net.ParseIP(server) == nil {
+			return NetworkSpec{}, fmt.Errorf("network spec dns server '%s' is not an IP address", server)
+		}
+	}
+
+	if err := networkSpec.NetworkAttachmentSpec.validate(); err != nil {
+		return NetworkSpec{}, err
+	}
+
+	for i, attachment := range networkSpec.Attachments {
+		if err := attachment.validate(); err != nil {
+			return NetworkSpec{}, fmt.Errorf("attachment %d: %s", i+1, err)
+		}
+	}
+
+	return networkSpec, nil
+}
+
+func (a NetworkAttachmentSpec) validate() error {
+	if a.MTU != 0 && (a.MTU < MinMTU || a.MTU > MaxMTU) {
+		return fmt.Errorf("network spec mtu %d must be between %d and %d", a.MTU, MinMTU, MaxMTU)
+	}
+
+	if a.IP == "" {
+		return nil
+	}
+
+	ip := net.ParseIP(a.IP)
+	if ip == nil {
+		return fmt.Errorf("network spec ip '%s' is not an IP address", a.IP)
+	}
+
+	_, subnet, err := net.ParseCIDR(a.Subnet)
+	if err != nil {
+		return fmt.Errorf("network spec ip '%s' requires a subnet in CIDR notation", a.IP)
+	}
+
+	if !subnet.Contains(ip) {
+		return fmt.Errorf("network spec ip '%s' is not in subnet '%s'", a.IP, a.Subnet)
+	}
+
+	return nil
+}
+
+// subnetSpec returns the attachment's subnet and IP in the string syntax
+// understood by ParseSpec
+func (a NetworkAttachmentSpec) subnetSpec() string {
+	if a.IP == "" {
+		return a.Subnet
+	}
+
+	_, subnet, _ := net.ParseCIDR(a.Subnet)
+	ones, _ := subnet.Mask.Size()
+	return fmt.Sprintf("%s/%d", a.IP, ones)
+}
+
+func checkOptions(options map[string]json.RawMessage, known []string) error {
+	var unknown []string
+	for name := range options {
+		if !contains(known, name) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown network spec option '%s': must be one of %s", unknown[0], strings.Join(known, ", "))
+	}
+
+	return nil
+}
+
+func validNetworkMode(mode string) bool {
+	return mode == gardener.NetworkModeNone || mode == gardener.NetworkModeHost ||
+		(strings.HasPrefix(mode, gardener.NetworkPeerPrefix) && mode != gardener.NetworkPeerPrefix)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
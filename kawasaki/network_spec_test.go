@@ -0,0 +1,59 @@
+package kawasaki_test
+
+import (
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseNetworkSpec", func() {
+	It("parses the options of the first attachment and of any others", func() {
+		spec, err := kawasaki.ParseNetworkSpec(`{
+			"network": "tenant-a",
+			"subnet": "/28",
+			"mtu": 1400,
+			"dns_servers": ["1.1.1.1"],
+			"attachments": [{"subnet": "10.9.0.0/30", "ip": "10.9.0.2"}]
+		}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(spec).To(Equal(kawasaki.NetworkSpec{
+			NetworkAttachmentSpec: kawasaki.NetworkAttachmentSpec{
+				Network: "tenant-a",
+				Subnet:  "/28",
+				MTU:     1400,
+			},
+			DNSServers: []string{"1.1.1.1"},
+			Attachments: []kawasaki.NetworkAttachmentSpec{
+				{Subnet: "10.9.0.0/30", IP: "10.9.0.2"},
+			},
+		}))
+	})
+
+	It("parses a network mode", func() {
+		spec, err := kawasaki.ParseNetworkSpec(`{"mode": "container:app"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Mode).To(Equal("container:app"))
+	})
+
+	DescribeTable("rejecting invalid specs",
+		func(spec, expectedErr string) {
+			_, err := kawasaki.ParseNetworkSpec(spec)
+			Expect(err).To(MatchError(expectedErr))
+		},
+		Entry("malformed JSON", `{"subnet": `, "invalid JSON network spec: unexpected end of JSON input"),
+		Entry("an unknown option", `{"subnets": "/28"}`, "unknown network spec option 'subnets': must be one of mode, network, subnet, ip, mtu, dns_servers, attachments"),
+		Entry("an unknown attachment option", `{"attachments": [{"mode": "host"}]}`, "attachment 1: unknown network spec option 'mode': must be one of network, subnet, ip, mtu"),
+		Entry("a mode with other options", `{"mode": "none", "mtu": 1400}`, "network spec mode 'none' cannot be combined with other options"),
+		Entry("an unknown mode", `{"mode": "bridge"}`, "network spec mode 'bridge' must be 'none', 'host' or 'container:<handle>'"),
+		Entry("a peer mode without a handle", `{"mode": "container:"}`, "network spec mode 'container:' must be 'none', 'host' or 'container:<handle>'"),
+		Entry("an MTU out of range", `{"mtu": 10}`, "network spec mtu 10 must be between 68 and 65535"),
+		Entry("an invalid DNS server", `{"dns_servers": ["dns.example.com"]}`, "network spec dns server 'dns.example.com' is not an IP address"),
+		Entry("an invalid IP", `{"subnet": "10.0.0.0/24", "ip": "10.0.0"}`, "network spec ip '10.0.0' is not an IP address"),
+		Entry("an IP without a static subnet", `{"subnet": "/28", "ip": "10.0.0.5"}`, "network spec ip '10.0.0.5' requires a subnet in CIDR notation"),
+		Entry("an IP outside its subnet", `{"subnet": "10.0.0.0/24", "ip": "10.0.1.5"}`, "network spec ip '10.0.1.5' is not in subnet '10.0.0.0/24'"),
+		Entry("an invalid attachment", `{"attachments": [{"mtu": 70000}]}`, "attachment 1: network spec mtu 70000 must be between 68 and 65535"),
+	)
+})
@@ -9,6 +9,7 @@ import (
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
 	"github.com/pivotal-golang/lager"
 )
@@ -17,6 +18,7 @@ import (
 const containerIpKey = gardener.ContainerIPKey
 const bridgeIpKey = gardener.BridgeIPKey
 const externalIpKey = gardener.ExternalIPKey
+const containerIpv6Key = gardener.ContainerIPv6Key
 
 // kawasaki-specific state properties
 const hostIntfKey = "kawasaki.host-interface"
@@ -27,6 +29,22 @@ const iptablePrefixKey = "kawasaki.iptable-prefix"
 const iptableInstanceKey = "kawasaki.iptable-inst"
 const mtuKey = "kawasaki.mtu"
 const dnsServerKey = "kawasaki.dns-servers"
+const netOutRulesKey = "kawasaki.net-out-rules"
+const ipv6PoolKey = "kawasaki.ipv6-pool"
+const bridgeIpv6Key = "kawasaki.bridge-ipv6"
+const subnetIpv6Key = "kawasaki.subnet-ipv6"
+const networkNameKey = "kawasaki.network-name"
+const attachmentsKey = "kawasaki.attachments"
+const networkModeKey = "kawasaki.network-mode"
+const networkPeerKey = "kawasaki.network-peer"
+const policyGroupKey = "kawasaki.policy-group"
+const firewallOverridesKey = "kawasaki.firewall-overrides"
+
+// AttachmentSeparator separates the attachments in a container's network
+// spec, e.g. "name:tenant-a,name:management". Each attachment is given its
+// own interface, bridge and instance chain, and the first carries the
+// container's default route.
+const AttachmentSeparator = ","
 
 //go:generate counterfeiter . NetnsMgr
 
@@ -46,6 +64,8 @@ type SpecParser interface {
 
 type ConfigCreator interface {
 	Create(log lager.Logger, handle string, subnet *net.IPNet, ip net.IP) (NetworkConfig, error)
+	FirewallBackend() string
+	IPv6Pool() *net.IPNet
 }
 
 //go:generate counterfeiter . Configurer
@@ -66,26 +86,75 @@ type ConfigStore interface {
 
 type PortPool interface {
 	Acquire() (uint32, error)
+	AcquireRange(size uint32) (uint32, error)
+	Release(port uint32)
 }
 
 //go:generate counterfeiter . PortForwarder
 
 type PortForwarder interface {
 	Forward(spec PortForwarderSpec) error
+	Unforward(spec PortForwarderSpec) error
 }
 
 type PortForwarderSpec struct {
 	InstanceID  string
+	Protocol    garden.Protocol
 	FromPort    uint32
 	ToPort      uint32
+	PortCount   uint32
 	ContainerIP net.IP
 	ExternalIP  net.IP
 }
 
+// maxPort is the highest TCP or UDP port
+const maxPort = 65535
+
+var netInProtocols = map[garden.Protocol]string{
+	garden.ProtocolTCP: "tcp",
+	garden.ProtocolUDP: "udp",
+}
+
 //go:generate counterfeiter . FirewallOpener
 
 type FirewallOpener interface {
 	Open(log lager.Logger, instance string, rule garden.NetOutRule) error
+	Close(log lager.Logger, instance string, rule garden.NetOutRule) error
+}
+
+//go:generate counterfeiter . DNSResponder
+
+// DNSResponder answers DNS queries from the containers on each bridge which
+// has containers added to it
+type DNSResponder interface {
+	Add(log lager.Logger, bridgeIP net.IP)
+	Remove(log lager.Logger, bridgeIP net.IP)
+}
+
+const (
+	FirewallBackendIPTables = "iptables"
+	FirewallBackendNFTables = "nftables"
+)
+
+//go:generate counterfeiter . Firewall
+
+// Firewall is a packet filtering backend, which sets up the global chains on
+// Start and manages the rules for each container
+type Firewall interface {
+	Start() error
+	InstanceChainCreator
+	PortForwarder
+	FirewallOpener
+	FirewallInspector
+	PolicyGroupEnforcer
+}
+
+// attachment is one of a container's additional network attachments, as
+// stored under attachmentsKey. The first attachment is stored in the
+// container's other kawasaki properties, as for a container with only one.
+type attachment struct {
+	Config      NetworkConfig
+	NetworkName string
 }
 
 type Networker struct {
@@ -99,6 +168,13 @@ type Networker struct {
 	portForwarder  PortForwarder
 	portPool       PortPool
 	firewallOpener FirewallOpener
+	namedNetworks  NamedNetworkRegistry
+	dnsResponder   DNSResponder    // optional
+	networkSharers *NetworkSharers // optional
+
+	// allowHostAccessOverride lets containers' properties grant host access,
+	// rather than only deny it
+	allowHostAccessOverride bool
 }
 
 func New(
@@ -111,6 +187,10 @@ func New(
 	portPool PortPool,
 	portForwarder PortForwarder,
 	firewallOpener FirewallOpener,
+	namedNetworks NamedNetworkRegistry,
+	dnsResponder DNSResponder,
+	networkSharers *NetworkSharers,
+	allowHostAccessOverride bool,
 ) *Networker {
 	return &Networker{
 		kawasakiBinPath: kawasakiBinPath,
@@ -125,11 +205,17 @@ func New(
 		portPool:      portPool,
 
 		firewallOpener: firewallOpener,
+		namedNetworks:  namedNetworks,
+		dnsResponder:   dnsResponder,
+		networkSharers: networkSharers,
+
+		allowHostAccessOverride: allowHostAccessOverride,
 	}
 }
 
 // Hook provides path and appropriate arguments to the kawasaki executable that
-// applies the network configuration after the network namesapce creation.
+// applies the network configuration after the network namesapce creation, and
+// which tears it down again once the container has stopped.
 func (n *Networker) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks, error) {
 	log = log.Session("network", lager.Data{
 		"handle": handle,
@@ -139,26 +225,120 @@ func (n *Networker) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks
 	log.Info("started")
 	defer log.Info("finished")
 
-	subnetReq, ipReq, err := n.specParser.Parse(log, spec)
+	var networkSpec NetworkSpec
+	jsonSpec := IsJSONNetworkSpec(spec)
+	if jsonSpec {
+		var err error
+		if networkSpec, err = ParseNetworkSpec(spec); err != nil {
+			log.Error("parse-failed", err)
+			return gardener.Hooks{}, err
+		}
+
+		if networkSpec.Mode != "" {
+			spec = networkSpec.Mode
+			jsonSpec = false
+		}
+	}
+
+	if spec == gardener.NetworkModeNone || spec == gardener.NetworkModeHost {
+		return n.networkModeHooks(log, handle, spec)
+	}
+
+	if strings.HasPrefix(spec, gardener.NetworkPeerPrefix) {
+		return n.networkPeerHooks(log, handle, strings.TrimPrefix(spec, gardener.NetworkPeerPrefix))
+	}
+
+	var (
+		attachmentSpecs []attachmentSpec
+		err             error
+	)
+	if jsonSpec {
+		attachmentSpecs, err = n.parseJSONAttachments(log, networkSpec)
+	} else {
+		attachmentSpecs, err = n.parseAttachments(log, spec)
+	}
 	if err != nil {
-		log.Error("parse-failed", err)
 		return gardener.Hooks{}, err
 	}
 
-	subnet, ip, err := n.subnetPool.Acquire(log, subnetReq, ipReq)
+	containerDNS, err := loadContainerDNS(n.configStore, handle)
 	if err != nil {
-		log.Error("acquire-failed", err)
+		log.Error("load-dns-properties-failed", err)
 		return gardener.Hooks{}, err
 	}
 
-	config, err := n.configCreator.Create(log, handle, subnet, ip)
+	if len(networkSpec.DNSServers) > 0 {
+		containerDNS.servers = nil
+		for _, server := range networkSpec.DNSServers {
+			containerDNS.servers = append(containerDNS.servers, net.ParseIP(server))
+		}
+	}
+
+	policyGroup, err := loadPolicyGroup(n.configStore, handle)
 	if err != nil {
-		log.Error("create-config-failed", err)
-		return gardener.Hooks{}, fmt.Errorf("create network config: %s", err)
+		log.Error("load-policy-group-failed", err)
+		return gardener.Hooks{}, err
+	}
+
+	if policyGroup != "" && n.configCreator.FirewallBackend() == FirewallBackendNFTables {
+		err := fmt.Errorf("invalid %s property: policy groups require the '%s' firewall backend", PolicyGroupProperty, FirewallBackendIPTables)
+		log.Error("load-policy-group-failed", err)
+		return gardener.Hooks{}, err
+	}
+
+	// the policy groups' sets only hold IPv4 addresses, so a group would leave
+	// its members' IPv6 traffic unrestricted
+	if policyGroup != "" && n.configCreator.IPv6Pool() != nil {
+		err := fmt.Errorf("invalid %s property: policy groups are not supported with an IPv6 network pool", PolicyGroupProperty)
+		log.Error("load-policy-group-failed", err)
+		return gardener.Hooks{}, err
+	}
+
+	overrides, err := loadFirewallOverrides(n.configStore, handle, n.allowHostAccessOverride)
+	if err != nil {
+		log.Error("load-firewall-overrides-failed", err)
+		return gardener.Hooks{}, err
+	}
+
+	// each attachment is stored as soon as it is acquired, so that Destroy
+	// releases it if a later attachment fails
+	var (
+		configs     []NetworkConfig
+		attachments []attachment
+	)
+	for i, req := range attachmentSpecs {
+		config, err := n.attach(log, handle, req)
+		if err != nil {
+			return gardener.Hooks{}, err
+		}
+
+		config.PolicyGroup = policyGroup
+		config.Overrides = overrides
+		if req.mtu != 0 {
+			config.Mtu = req.mtu
+		}
+
+		if i == 0 {
+			if len(containerDNS.servers) > 0 {
+				config.DNSServers = containerDNS.servers
+			}
+
+			save(n.configStore, handle, config)
+			if req.named {
+				n.configStore.Set(handle, networkNameKey, req.networkName)
+			}
+		} else {
+			config.NoDefaultRoute = true
+			attachments = append(attachments, attachment{Config: config, NetworkName: req.networkName})
+			setAttachments(n.configStore, handle, attachments)
+		}
+
+		log.Info("config-create", lager.Data{"config": config})
+		configs = append(configs, config)
 	}
-	log.Info("config-create", lager.Data{"config": config})
 
-	save(n.configStore, handle, config)
+	setAttachmentInfo(n.configStore, handle, configs)
+	config := configs[0]
 
 	args := []string{
 		n.kawasakiBinPath,
@@ -172,77 +352,569 @@ func (n *Networker) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks
 		fmt.Sprintf("--mtu=%d", config.Mtu),
 		fmt.Sprintf("--iptable-prefix=%s", config.IPTablePrefix),
 		fmt.Sprintf("--iptable-instance=%s", config.IPTableInstance),
+		fmt.Sprintf("--iptable-log-method=%s", config.IPTableLogMethod),
+		fmt.Sprintf("--firewall-backend=%s", config.FirewallBackend),
+	}
+
+	if config.PolicyGroup != "" {
+		args = append(args, fmt.Sprintf("--policy-group=%s", config.PolicyGroup))
+	}
+
+	if config.Overrides.HostAccess != nil {
+		args = append(args, fmt.Sprintf("--host-access=%t", *config.Overrides.HostAccess))
+	}
+
+	for _, network := range config.Overrides.DenyNetworks {
+		args = append(args, fmt.Sprintf("--deny-network=%s", network))
+	}
+
+	if config.IPv6Pool != nil {
+		args = append(args,
+			fmt.Sprintf("--ipv6-pool=%s", config.IPv6Pool.String()),
+			fmt.Sprintf("--bridge-ipv6=%s", config.BridgeIPv6),
+			fmt.Sprintf("--container-ipv6=%s", config.ContainerIPv6),
+			fmt.Sprintf("--subnet-ipv6=%s", config.SubnetIPv6.String()),
+		)
 	}
 
 	for _, dnsServer := range config.DNSServers {
 		args = append(args, fmt.Sprintf("--dns-server=%s", dnsServer.String()))
 	}
 
+	for _, entry := range containerDNS.extraHosts {
+		args = append(args, fmt.Sprintf("--extra-host=%s", entry))
+	}
+
+	for _, domain := range containerDNS.searchDomains {
+		args = append(args, fmt.Sprintf("--dns-search=%s", domain))
+	}
+
+	for _, option := range containerDNS.options {
+		args = append(args, fmt.Sprintf("--dns-option=%s", option))
+	}
+
+	for _, attachment := range attachments {
+		attachmentJson, err := json.Marshal(attachment.Config)
+		if err != nil {
+			// a NetworkConfig only contains marshallable types, so this would
+			// be a programming error
+			panic(err)
+		}
+
+		args = append(args, fmt.Sprintf("--attachment=%s", attachmentJson))
+	}
+
+	if n.dnsResponder != nil {
+		for _, cfg := range configs {
+			n.dnsResponder.Add(log, cfg.BridgeIP)
+		}
+		args = append(args, "--embedded-dns")
+	}
+
+	// the poststop hook tears the network down as soon as the container
+	// stops, so it does not linger if guardian is not running to destroy it
+	teardownArgs := append(append([]string{}, args...), "--teardown")
+	if n.networkSharers != nil {
+		teardownArgs = append(teardownArgs, fmt.Sprintf("--network-sharers-dir=%s", n.networkSharers.Dir(handle)))
+	}
+
 	return gardener.Hooks{
 		Prestart: gardener.Hook{
 			Path: n.kawasakiBinPath,
 			Args: args,
 		},
+		Poststop: gardener.Hook{
+			Path: n.kawasakiBinPath,
+			Args: teardownArgs,
+		},
 	}, nil
 }
 
+// networkModeHooks records that a container is in a network mode, in which it
+// is given no interface or address by kawasaki and so needs no hooks
+func (n *Networker) networkModeHooks(log lager.Logger, handle, mode string) (gardener.Hooks, error) {
+	log.Info("network-mode", lager.Data{"mode": mode})
+
+	n.configStore.Set(handle, networkModeKey, mode)
+
+	// the container's info expects these to exist
+	n.configStore.Set(handle, containerIpKey, "")
+	n.configStore.Set(handle, bridgeIpKey, "")
+	n.configStore.Set(handle, externalIpKey, "")
+
+	return gardener.Hooks{}, nil
+}
+
+// networkPeerHooks records that a container shares the network namespace of a
+// peer, and so is given no network resources of its own. Its NetIn and NetOut
+// rules are applied to the peer's network.
+func (n *Networker) networkPeerHooks(log lager.Logger, handle, peer string) (gardener.Hooks, error) {
+	log.Info("network-peer", lager.Data{"peer": peer})
+
+	// a peer which itself shares another container's network is resolved to
+	// the container which owns the network
+	if owner := n.networkPeer(peer); owner != "" {
+		peer = owner
+	}
+
+	cfg, err := n.load(peer)
+	if err != nil {
+		log.Error("load-peer-failed", err)
+		return gardener.Hooks{}, fmt.Errorf("cannot share the network of %s: %s", peer, err)
+	}
+
+	// the peer's poststop hook leaves its network in place while it has
+	// sharers
+	if n.networkSharers != nil {
+		if err := n.networkSharers.Add(peer, handle); err != nil {
+			log.Error("record-network-sharer-failed", err)
+			return gardener.Hooks{}, err
+		}
+	}
+
+	n.configStore.Set(handle, networkPeerKey, peer)
+	n.configStore.Set(handle, containerIpKey, cfg.ContainerIP.String())
+	n.configStore.Set(handle, bridgeIpKey, cfg.BridgeIP.String())
+	n.configStore.Set(handle, externalIpKey, cfg.ExternalIP.String())
+
+	return gardener.Hooks{}, nil
+}
+
+// attachmentSpec is one of the attachments given in a container's network spec
+type attachmentSpec struct {
+	networkName string
+	named       bool
+	subnetReq   subnets.SubnetSelector
+	ipReq       subnets.IPSelector
+	prefixLen   int // 0 unless the spec gives the subnet's size
+	mtu         int // 0 unless given by a JSON network spec
+}
+
+// parseAttachments parses each of the attachments in a network spec, so that
+// an invalid spec is rejected before any of them is acquired
+func (n *Networker) parseAttachments(log lager.Logger, spec string) ([]attachmentSpec, error) {
+	var (
+		specs  []attachmentSpec
+		joined = map[string]bool{}
+	)
+	for _, part := range strings.Split(spec, AttachmentSeparator) {
+		networkName, rest, named := parseNetworkName(strings.TrimSpace(part))
+		if named && networkName == "" {
+			return nil, fmt.Errorf("network spec %s%s does not name a network", NamedNetworkPrefix, rest)
+		}
+
+		if named {
+			if joined[networkName] {
+				return nil, fmt.Errorf("network spec %s joins network %s more than once", spec, networkName)
+			}
+
+			joined[networkName] = true
+		}
+
+		subnetReq, ipReq, err := n.specParser.Parse(log, rest)
+		if err != nil {
+			log.Error("parse-failed", err)
+			return nil, err
+		}
+
+		specs = append(specs, attachmentSpec{
+			networkName: networkName,
+			named:       named,
+			subnetReq:   subnetReq,
+			ipReq:       ipReq,
+			prefixLen:   requestedPrefixLen(rest),
+		})
+	}
+
+	return specs, nil
+}
+
+// parseJSONAttachments parses each of the attachments in a JSON network spec,
+// so that an invalid spec is rejected before any of them is acquired
+func (n *Networker) parseJSONAttachments(log lager.Logger, networkSpec NetworkSpec) ([]attachmentSpec, error) {
+	var (
+		specs  []attachmentSpec
+		joined = map[string]bool{}
+	)
+	for _, attachment := range append([]NetworkAttachmentSpec{networkSpec.NetworkAttachmentSpec}, networkSpec.Attachments...) {
+		if attachment.Network != "" {
+			if joined[attachment.Network] {
+				return nil, fmt.Errorf("network spec joins network %s more than once", attachment.Network)
+			}
+
+			joined[attachment.Network] = true
+		}
+
+		subnetReq, ipReq, err := n.specParser.Parse(log, attachment.subnetSpec())
+		if err != nil {
+			log.Error("parse-failed", err)
+			return nil, err
+		}
+
+		specs = append(specs, attachmentSpec{
+			networkName: attachment.Network,
+			named:       attachment.Network != "",
+			subnetReq:   subnetReq,
+			ipReq:       ipReq,
+			prefixLen:   requestedPrefixLen(attachment.Subnet),
+			mtu:         attachment.MTU,
+		})
+	}
+
+	return specs, nil
+}
+
+// attach acquires a subnet and IP for an attachment, joining its named
+// network if it has one, and creates its configuration
+func (n *Networker) attach(log lager.Logger, handle string, spec attachmentSpec) (NetworkConfig, error) {
+	var (
+		subnet *net.IPNet
+		ip     net.IP
+		err    error
+	)
+	if spec.named {
+		subnetReq := spec.subnetReq
+		subnet, ip, err = n.namedNetworks.Join(log, spec.networkName, handle, func(existing *net.IPNet) (*net.IPNet, net.IP, error) {
+			if existing != nil {
+				if ones, _ := existing.Mask.Size(); spec.prefixLen != 0 && spec.prefixLen != ones {
+					return nil, nil, fmt.Errorf("named network %s has a /%d subnet, not the requested /%d", spec.networkName, ones, spec.prefixLen)
+				}
+
+				subnetReq = subnets.ExistingSubnetSelector{IPNet: existing}
+			}
+
+			return n.subnetPool.Acquire(log, handle, subnetReq, spec.ipReq)
+		})
+	} else {
+		subnet, ip, err = n.subnetPool.Acquire(log, handle, spec.subnetReq, spec.ipReq)
+	}
+	if err != nil {
+		log.Error("acquire-failed", err)
+		return NetworkConfig{}, err
+	}
+
+	if !spec.named {
+		n.namedNetworks.Record(log, handle, subnet, ip)
+	}
+
+	config, err := n.configCreator.Create(log, handle, subnet, ip)
+	if err != nil {
+		log.Error("create-config-failed", err)
+		return NetworkConfig{}, fmt.Errorf("create network config: %s", err)
+	}
+
+	return config, nil
+}
+
+// SupportsNetworkModes returns true, as the networker gives containers in
+// the none and host modes, and those sharing another container's network, no
+// network of their own
+func (n *Networker) SupportsNetworkModes() bool {
+	return true
+}
+
 // Capacity returns the number of subnets this network can host
 func (n *Networker) Capacity() uint64 {
 	return uint64(n.subnetPool.Capacity())
 }
 
-func (n *Networker) NetIn(log lager.Logger, handle string, externalPort, containerPort uint32) (uint32, uint32, error) {
-	cfg, err := load(n.configStore, handle)
+func (n *Networker) NetIn(log lager.Logger, handle string, spec gardener.NetInSpec) (uint32, uint32, error) {
+	cfg, err := n.load(handle)
 	if err != nil {
 		return 0, 0, err
 	}
 
+	protocol, ok := netInProtocols[spec.Protocol]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid protocol for NetIn: %d", spec.Protocol)
+	}
+
+	portCount := spec.PortCount
+	if portCount == 0 {
+		portCount = 1
+	}
+
+	// the range is checked before any ports are acquired, bounding the count
+	// first so that the checks themselves cannot overflow
+	if portCount > maxPort || spec.HostPort > maxPort-portCount+1 || spec.ContainerPort > maxPort-portCount+1 {
+		return 0, 0, fmt.Errorf("port range of %d ports exceeds %d", portCount, maxPort)
+	}
+
+	externalPort := spec.HostPort
 	if externalPort == 0 {
-		externalPort, err = n.portPool.Acquire()
+		externalPort, err = n.acquirePorts(portCount)
 		if err != nil {
 			return 0, 0, err
 		}
+
+		defer func() {
+			if err != nil {
+				n.releasePorts(externalPort, portCount)
+			}
+		}()
 	}
 
+	containerPort := spec.ContainerPort
 	if containerPort == 0 {
 		containerPort = externalPort
 	}
 
-	err = n.portForwarder.Forward(PortForwarderSpec{
-		InstanceID:  cfg.IPTableInstance,
-		FromPort:    externalPort,
-		ToPort:      containerPort,
-		ContainerIP: cfg.ContainerIP,
-		ExternalIP:  cfg.ExternalIP,
-	})
-
-	if err != nil {
+	if err = n.forwardPorts(log, cfg, spec.Protocol, externalPort, containerPort, portCount); err != nil {
 		return 0, 0, err
 	}
 
-	addPortMapping(log, n.configStore, handle, garden.PortMapping{
-		HostPort:      externalPort,
-		ContainerPort: containerPort,
-	})
+	var mappings []gardener.PortMapping
+	for i := uint32(0); i < portCount; i++ {
+		mappings = append(mappings, gardener.PortMapping{
+			HostPort:      externalPort + i,
+			ContainerPort: containerPort + i,
+			Protocol:      protocol,
+		})
+	}
+
+	addPortMappings(log, n.configStore, handle, mappings...)
 
 	return externalPort, containerPort, nil
 }
 
+// RemoveNetIn removes the port mapping with the given host port and protocol,
+// releasing the host port back to the pool
+func (n *Networker) RemoveNetIn(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error {
+	log = log.Session("remove-net-in", lager.Data{"handle": handle, "hostPort": hostPort})
+
+	cfg, err := n.load(handle)
+	if err != nil {
+		return err
+	}
+
+	protocolName, ok := netInProtocols[protocol]
+	if !ok {
+		return fmt.Errorf("invalid protocol for NetIn: %d", protocol)
+	}
+
+	mappings := portMappings(log, n.configStore, handle)
+	for i, mapping := range mappings {
+		if mapping.HostPort != hostPort || mapping.Protocol != protocolName {
+			continue
+		}
+
+		if err := n.portForwarder.Unforward(PortForwarderSpec{
+			InstanceID:  cfg.IPTableInstance,
+			Protocol:    protocol,
+			FromPort:    mapping.HostPort,
+			ToPort:      mapping.ContainerPort,
+			PortCount:   1,
+			ContainerIP: cfg.ContainerIP,
+			ExternalIP:  cfg.ExternalIP,
+		}); err != nil {
+			log.Error("unforward-failed", err)
+			return err
+		}
+
+		n.portPool.Release(mapping.HostPort)
+		setPortMappings(n.configStore, handle, append(mappings[:i], mappings[i+1:]...))
+
+		return nil
+	}
+
+	return fmt.Errorf("no %s port mapping found for host port %d", protocolName, hostPort)
+}
+
+// forwardPorts forwards each port in the range with its own rule. If one
+// fails, the rules already added are removed, so that none are left pointing
+// at ports which are released and may be given to another container.
+func (n *Networker) forwardPorts(log lager.Logger, cfg NetworkConfig, protocol garden.Protocol, externalPort, containerPort, portCount uint32) error {
+	spec := func(i uint32) PortForwarderSpec {
+		return PortForwarderSpec{
+			InstanceID:  cfg.IPTableInstance,
+			Protocol:    protocol,
+			FromPort:    externalPort + i,
+			ToPort:      containerPort + i,
+			PortCount:   1,
+			ContainerIP: cfg.ContainerIP,
+			ExternalIP:  cfg.ExternalIP,
+		}
+	}
+
+	for i := uint32(0); i < portCount; i++ {
+		if err := n.portForwarder.Forward(spec(i)); err != nil {
+			log.Error("forward-failed", err, lager.Data{"port": externalPort + i})
+
+			for j := uint32(0); j < i; j++ {
+				if err := n.portForwarder.Unforward(spec(j)); err != nil {
+					log.Error("unforward-failed", err, lager.Data{"port": externalPort + j})
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *Networker) acquirePorts(portCount uint32) (uint32, error) {
+	if portCount == 1 {
+		return n.portPool.Acquire()
+	}
+
+	return n.portPool.AcquireRange(portCount)
+}
+
+func (n *Networker) releasePorts(firstPort, portCount uint32) {
+	for port := firstPort; port < firstPort+portCount; port++ {
+		n.portPool.Release(port)
+	}
+}
+
 func (n *Networker) NetOut(log lager.Logger, handle string, rule garden.NetOutRule) error {
-	cfg, err := load(n.configStore, handle)
+	cfg, err := n.load(handle)
+	if err != nil {
+		return err
+	}
+
+	if err := n.firewallOpener.Open(log, cfg.IPTableInstance, rule); err != nil {
+		return err
+	}
+
+	entries := netOutEntries(log, n.configStore, handle)
+
+	nextID := 1
+	for _, entry := range entries {
+		if entry.ID >= nextID {
+			nextID = entry.ID + 1
+		}
+	}
+
+	setNetOutEntries(n.configStore, handle, append(entries, gardener.NetOutEntry{ID: nextID, Rule: rule}))
+
+	return nil
+}
+
+// NetOutRules returns the NetOut rules which have been applied to the container
+func (n *Networker) NetOutRules(log lager.Logger, handle string) ([]gardener.NetOutEntry, error) {
+	if _, err := n.load(handle); err != nil {
+		return nil, err
+	}
+
+	return netOutEntries(log, n.configStore, handle), nil
+}
+
+// RemoveNetOut removes the NetOut rule with the given ID from the container
+func (n *Networker) RemoveNetOut(log lager.Logger, handle string, id int) error {
+	log = log.Session("remove-net-out", lager.Data{"handle": handle, "id": id})
+
+	cfg, err := n.load(handle)
 	if err != nil {
 		return err
 	}
 
-	return n.firewallOpener.Open(log, cfg.IPTableInstance, rule)
+	entries := netOutEntries(log, n.configStore, handle)
+	for i, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+
+		if err := n.firewallOpener.Close(log, cfg.IPTableInstance, entry.Rule); err != nil {
+			log.Error("close-failed", err)
+			return err
+		}
+
+		setNetOutEntries(n.configStore, handle, append(entries[:i], entries[i+1:]...))
+
+		return nil
+	}
+
+	return fmt.Errorf("no net out rule found with id %d", id)
 }
 
+// Destroy tears down the container's network and releases its subnets, IPs
+// and ports. The container's poststop hook has usually torn the network down
+// already by the time Destroy is called, so each step must succeed for a
+// network which is already gone.
 func (n *Networker) Destroy(log lager.Logger, handle string) error {
-	cfg, err := load(n.configStore, handle)
+	if n.networkMode(handle) != "" {
+		return nil
+	}
+
+	if peer := n.networkPeer(handle); peer != "" {
+		return n.destroySharer(log, handle, peer)
+	}
+
+	cfg, err := n.load(handle)
 	if err != nil {
 		return err
 	}
 
+	// the container's ports are released even if tearing its network down
+	// fails, so that they are not leaked. Ports outside of the pool's range
+	// (i.e. explicitly requested host ports) are ignored by the pool.
+	defer func() {
+		for _, mapping := range portMappings(log, n.configStore, handle) {
+			n.portPool.Release(mapping.HostPort)
+		}
+	}()
+
+	for _, attachment := range loadAttachments(log, n.configStore, handle) {
+		if err := n.detach(log, handle, attachment.Config, attachment.NetworkName); err != nil {
+			return err
+		}
+	}
+
+	networkName, _ := n.configStore.Get(handle, networkNameKey)
+	if err := n.detach(log, handle, cfg, networkName); err != nil {
+		return err
+	}
+
+	if n.networkSharers != nil {
+		if err := n.networkSharers.Forget(handle); err != nil {
+			log.Error("forget-network-sharers-failed", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destroySharer removes the port forwards a container sharing its peer's
+// network added to the peer's network, and releases their ports
+func (n *Networker) destroySharer(log lager.Logger, handle, peer string) error {
+	cfg, loadErr := n.load(peer)
+	for _, mapping := range portMappings(log, n.configStore, handle) {
+		protocol, ok := netInProtocol(mapping.Protocol)
+
+		// the forwards went with the peer's network if it has been destroyed
+		if loadErr == nil && ok {
+			if err := n.portForwarder.Unforward(PortForwarderSpec{
+				InstanceID:  cfg.IPTableInstance,
+				Protocol:    protocol,
+				FromPort:    mapping.HostPort,
+				ToPort:      mapping.ContainerPort,
+				PortCount:   1,
+				ContainerIP: cfg.ContainerIP,
+				ExternalIP:  cfg.ExternalIP,
+			}); err != nil {
+				log.Error("unforward-failed", err)
+				return err
+			}
+		}
+
+		n.portPool.Release(mapping.HostPort)
+	}
+
+	if n.networkSharers != nil {
+		if err := n.networkSharers.Remove(peer, handle); err != nil {
+			log.Error("remove-network-sharer-failed", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detach tears down an attachment's configuration and releases its subnet
+// and IP, leaving its named network if it has one
+func (n *Networker) detach(log lager.Logger, handle string, cfg NetworkConfig, networkName string) error {
 	if err := n.configurer.Destroy(log, cfg); err != nil {
 		log.Error("destroy-config-failed", err)
 		return err
@@ -253,30 +925,259 @@ func (n *Networker) Destroy(log lager.Logger, handle string) error {
 		return err
 	}
 
+	if networkName != "" {
+		n.namedNetworks.Leave(log, networkName, handle)
+	} else {
+		n.namedNetworks.Forget(log, handle, cfg.Subnet)
+	}
+
+	if n.dnsResponder != nil {
+		n.dnsResponder.Remove(log, cfg.BridgeIP)
+	}
+
 	return nil
 }
 
-func addPortMapping(logger lager.Logger, configStore ConfigStore, handle string, newMapping garden.PortMapping) {
+func (n *Networker) networkMode(handle string) string {
+	mode, err := n.configStore.Get(handle, networkModeKey)
+	if err != nil {
+		return ""
+	}
+
+	return mode
+}
+
+func (n *Networker) networkPeer(handle string) string {
+	peer, err := n.configStore.Get(handle, networkPeerKey)
+	if err != nil {
+		return ""
+	}
+
+	return peer
+}
+
+// load loads the container's network config, which is its peer's for a
+// container sharing another's network, failing with a clear error for a
+// container in a network mode, which has none
+func (n *Networker) load(handle string) (NetworkConfig, error) {
+	if mode := n.networkMode(handle); mode != "" {
+		return NetworkConfig{}, fmt.Errorf("container is in network mode %s, which has no network config", mode)
+	}
+
+	if peer := n.networkPeer(handle); peer != "" {
+		return load(n.configStore, peer)
+	}
+
+	return load(n.configStore, handle)
+}
+
+// parseNetworkName splits a named network spec into the network's name and
+// the remaining spec, which may give the prefix length of the network's
+// subnet, e.g. "name:tenant-a/28" gives "tenant-a" and "/28"
+func parseNetworkName(spec string) (string, string, bool) {
+	if !strings.HasPrefix(spec, NamedNetworkPrefix) {
+		return "", spec, false
+	}
+
+	name := strings.TrimPrefix(spec, NamedNetworkPrefix)
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i], name[i:], true
+	}
+
+	return name, "", true
+}
+
+// requestedPrefixLen returns the prefix length of the subnet a spec asks for,
+// either as a bare prefix length such as "/28" or in CIDR notation, or 0 if
+// it does not give one
+func requestedPrefixLen(spec string) int {
+	if strings.HasPrefix(spec, "/") {
+		prefixLen, _ := strconv.Atoi(spec[1:])
+		return prefixLen
+	}
+
+	if _, subnet, err := net.ParseCIDR(spec); err == nil {
+		ones, _ := subnet.Mask.Size()
+		return ones
+	}
+
+	return 0
+}
+
+// containerDNS holds the DNS settings given in a container's properties
+type containerDNS struct {
+	servers       []net.IP
+	extraHosts    []dns.HostEntry
+	searchDomains []string
+	options       []string
+}
+
+func loadContainerDNS(configStore ConfigStore, handle string) (containerDNS, error) {
+	property := func(name string) []string {
+		value, err := configStore.Get(handle, name)
+		if err != nil {
+			return nil
+		}
+
+		return dns.SplitList(value)
+	}
+
+	settings := containerDNS{
+		searchDomains: property(dns.SearchDomainsProperty),
+		options:       property(dns.OptionsProperty),
+	}
+
+	for _, server := range property(dns.ServersProperty) {
+		ip := net.ParseIP(server)
+		if ip == nil {
+			return containerDNS{}, fmt.Errorf("invalid %s property: '%s' is not a valid IP address", dns.ServersProperty, server)
+		}
+
+		settings.servers = append(settings.servers, ip)
+	}
+
+	for _, host := range property(dns.ExtraHostsProperty) {
+		entry, err := dns.ParseHostEntry(host)
+		if err != nil {
+			return containerDNS{}, fmt.Errorf("invalid %s property: %s", dns.ExtraHostsProperty, err)
+		}
+
+		settings.extraHosts = append(settings.extraHosts, entry)
+	}
+
+	return settings, nil
+}
+
+// loadPolicyGroup returns the policy group named by the container's
+// PolicyGroupProperty, or "" if it has none
+func loadPolicyGroup(configStore ConfigStore, handle string) (string, error) {
+	group, err := configStore.Get(handle, PolicyGroupProperty)
+	if err != nil || group == "" {
+		return "", nil
+	}
+
+	if err := ValidatePolicyGroup(group); err != nil {
+		return "", fmt.Errorf("invalid %s property: %s", PolicyGroupProperty, err)
+	}
+
+	return group, nil
+}
+
+func addPortMappings(logger lager.Logger, configStore ConfigStore, handle string, newMappings ...gardener.PortMapping) {
+	setPortMappings(configStore, handle, append(portMappings(logger, configStore, handle), newMappings...))
+}
+
+func setPortMappings(configStore ConfigStore, handle string, mappings []gardener.PortMapping) {
+	if mappings == nil {
+		mappings = []gardener.PortMapping{}
+	}
+
+	mappingsJson, err := json.Marshal(mappings)
+	if err != nil {
+		// Since the object we are marshalling here is always going to be
+		// valid, this would be a programming error
+		panic(err)
+	}
+
+	configStore.Set(handle, gardener.MappedPortsKey, string(mappingsJson))
+}
+
+func portMappings(logger lager.Logger, configStore ConfigStore, handle string) []gardener.PortMapping {
 	currentMappingsJson, err := configStore.Get(handle, gardener.MappedPortsKey)
 	if err != nil {
-		log := logger.Session("net-in", lager.Data{"handle": handle})
+		log := logger.Session("port-mappings", lager.Data{"handle": handle})
 		log.Debug(fmt.Sprintf("ConfigStore fails to get key: %s. Possibly it is not yet initialized.", gardener.MappedPortsKey))
 	}
 
-	currentMappings := []garden.PortMapping{}
+	currentMappings := []gardener.PortMapping{}
 
 	// If unmarshall fails, we get a default empty struct
 	json.Unmarshal([]byte(currentMappingsJson), &currentMappings)
 
-	updatedMappings := append(currentMappings, newMapping)
-	updatedMappingsJson, err := json.Marshal(updatedMappings)
+	return currentMappings
+}
+
+func setNetOutEntries(configStore ConfigStore, handle string, entries []gardener.NetOutEntry) {
+	if entries == nil {
+		entries = []gardener.NetOutEntry{}
+	}
+
+	entriesJson, err := json.Marshal(entries)
 	if err != nil {
-		// Since the object we are marshalling here is always going to be
-		// valid, this would be a programming error
+		// NetOutRules only contain marshallable types, so this would be a
+		// programming error
+		panic(err)
+	}
+
+	configStore.Set(handle, netOutRulesKey, string(entriesJson))
+}
+
+func netOutEntries(logger lager.Logger, configStore ConfigStore, handle string) []gardener.NetOutEntry {
+	entriesJson, err := configStore.Get(handle, netOutRulesKey)
+	if err != nil {
+		log := logger.Session("net-out-entries", lager.Data{"handle": handle})
+		log.Debug(fmt.Sprintf("ConfigStore fails to get key: %s. Possibly it is not yet initialized.", netOutRulesKey))
+	}
+
+	entries := []gardener.NetOutEntry{}
+
+	// If unmarshall fails, we get a default empty list
+	json.Unmarshal([]byte(entriesJson), &entries)
+
+	return entries
+}
+
+func setAttachments(configStore ConfigStore, handle string, attachments []attachment) {
+	attachmentsJson, err := json.Marshal(attachments)
+	if err != nil {
+		// NetworkConfigs only contain marshallable types, so this would be a
+		// programming error
+		panic(err)
+	}
+
+	configStore.Set(handle, attachmentsKey, string(attachmentsJson))
+}
+
+func loadAttachments(logger lager.Logger, configStore ConfigStore, handle string) []attachment {
+	attachmentsJson, err := configStore.Get(handle, attachmentsKey)
+	if err != nil || attachmentsJson == "" {
+		return nil
+	}
+
+	var attachments []attachment
+	if err := json.Unmarshal([]byte(attachmentsJson), &attachments); err != nil {
+		logger.Error("unmarshal-attachments-failed", err, lager.Data{"handle": handle})
+		return nil
+	}
+
+	for i := range attachments {
+		attachments[i].Config.ContainerHandle = handle
+	}
+
+	return attachments
+}
+
+// setAttachmentInfo records every attachment of the container, including the
+// first, in the property reported in the container's info
+func setAttachmentInfo(configStore ConfigStore, handle string, configs []NetworkConfig) {
+	var info []gardener.NetworkAttachment
+	for _, config := range configs {
+		info = append(info, gardener.NetworkAttachment{
+			Interface:    config.ContainerIntf,
+			ContainerIP:  config.ContainerIP.String(),
+			HostIP:       config.BridgeIP.String(),
+			Subnet:       config.Subnet.String(),
+			DefaultRoute: !config.NoDefaultRoute,
+		})
+	}
+
+	infoJson, err := json.Marshal(info)
+	if err != nil {
+		// this would be a programming error, as above
 		panic(err)
 	}
 
-	configStore.Set(handle, gardener.MappedPortsKey, string(updatedMappingsJson))
+	configStore.Set(handle, gardener.AttachmentsKey, string(infoJson))
 }
 
 func getAll(config ConfigStore, handle string, key ...string) (vals []string, err error) {
@@ -308,6 +1209,27 @@ func save(config ConfigStore, handle string, netConfig NetworkConfig) {
 		dnsServers = append(dnsServers, dnsServer.String())
 	}
 	config.Set(handle, dnsServerKey, strings.Join(dnsServers, ", "))
+
+	if netConfig.IPv6Pool != nil {
+		config.Set(handle, ipv6PoolKey, netConfig.IPv6Pool.String())
+		config.Set(handle, bridgeIpv6Key, netConfig.BridgeIPv6.String())
+		config.Set(handle, containerIpv6Key, netConfig.ContainerIPv6.String())
+		config.Set(handle, subnetIpv6Key, netConfig.SubnetIPv6.String())
+	}
+
+	if netConfig.PolicyGroup != "" {
+		config.Set(handle, policyGroupKey, netConfig.PolicyGroup)
+	}
+
+	if !netConfig.Overrides.empty() {
+		overridesJson, err := json.Marshal(netConfig.Overrides)
+		if err != nil {
+			// this would be a programming error, as for the port mappings
+			panic(err)
+		}
+
+		config.Set(handle, firewallOverridesKey, string(overridesJson))
+	}
 }
 
 func load(config ConfigStore, handle string) (NetworkConfig, error) {
@@ -340,7 +1262,8 @@ func load(config ConfigStore, handle string) (NetworkConfig, error) {
 		dnsServers = append(dnsServers, ip)
 	}
 
-	return NetworkConfig{
+	netConfig := NetworkConfig{
+		ContainerHandle: handle,
 		HostIntf:        vals[0],
 		ContainerIntf:   vals[1],
 		BridgeName:      vals[2],
@@ -352,5 +1275,32 @@ func load(config ConfigStore, handle string) (NetworkConfig, error) {
 		IPTableInstance: vals[7],
 		Mtu:             mtu,
 		DNSServers:      dnsServers,
-	}, nil
+	}
+
+	// IPv6 is optional, so containers created without it have none of its
+	// keys
+	if vals, err := getAll(config, handle, ipv6PoolKey, bridgeIpv6Key, containerIpv6Key, subnetIpv6Key); err == nil && vals[0] != "" {
+		if _, netConfig.IPv6Pool, err = net.ParseCIDR(vals[0]); err != nil {
+			return NetworkConfig{}, err
+		}
+
+		if _, netConfig.SubnetIPv6, err = net.ParseCIDR(vals[3]); err != nil {
+			return NetworkConfig{}, err
+		}
+
+		netConfig.BridgeIPv6 = net.ParseIP(vals[1])
+		netConfig.ContainerIPv6 = net.ParseIP(vals[2])
+	}
+
+	if group, err := config.Get(handle, policyGroupKey); err == nil {
+		netConfig.PolicyGroup = group
+	}
+
+	if overridesJson, err := config.Get(handle, firewallOverridesKey); err == nil && overridesJson != "" {
+		if err := json.Unmarshal([]byte(overridesJson), &netConfig.Overrides); err != nil {
+			return NetworkConfig{}, err
+		}
+	}
+
+	return netConfig, nil
 }
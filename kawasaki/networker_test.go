@@ -1,18 +1,25 @@
 package kawasaki_test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/guardian/gardener"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/dns"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/fakes"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets/fake_subnet_pool"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
@@ -28,12 +35,34 @@ var _ = Describe("Networker", func() {
 		fakePortForwarder  *fakes.FakePortForwarder
 		fakePortPool       *fakes.FakePortPool
 		fakeFirewallOpener *fakes.FakeFirewallOpener
+		fakeNamedNetworks  *fakes.FakeNamedNetworkRegistry
 		networker          *kawasaki.Networker
 		logger             lager.Logger
 		networkConfig      kawasaki.NetworkConfig
 		config             map[string]string
+		networkSharers     *kawasaki.NetworkSharers
+
+		allowHostAccessOverride bool
 	)
 
+	newNetworker := func(dnsResponder kawasaki.DNSResponder) *kawasaki.Networker {
+		return kawasaki.New(
+			"/path/to/kawasaki",
+			fakeSpecParser,
+			fakeSubnetPool,
+			fakeConfigCreator,
+			fakeConfigurer,
+			fakeConfigStore,
+			fakePortPool,
+			fakePortForwarder,
+			fakeFirewallOpener,
+			fakeNamedNetworks,
+			dnsResponder,
+			networkSharers,
+			allowHostAccessOverride,
+		)
+	}
+
 	BeforeEach(func() {
 		fakeSpecParser = new(fakes.FakeSpecParser)
 		fakeSubnetPool = new(fake_subnet_pool.FakePool)
@@ -43,23 +72,17 @@ var _ = Describe("Networker", func() {
 		fakePortForwarder = new(fakes.FakePortForwarder)
 		fakePortPool = new(fakes.FakePortPool)
 		fakeFirewallOpener = new(fakes.FakeFirewallOpener)
+		fakeNamedNetworks = new(fakes.FakeNamedNetworkRegistry)
 
 		logger = lagertest.NewTestLogger("test")
-		networker = kawasaki.New(
-			"/path/to/kawasaki",
-			fakeSpecParser,
-			fakeSubnetPool,
-			fakeConfigCreator,
-			fakeConfigurer,
-			fakeConfigStore,
-			fakePortPool,
-			fakePortForwarder,
-			fakeFirewallOpener,
-		)
+		allowHostAccessOverride = false
+		networkSharers = nil
+		networker = newNetworker(nil)
 
 		ip, subnet, err := net.ParseCIDR("123.123.123.12/24")
 		Expect(err).NotTo(HaveOccurred())
 		networkConfig = kawasaki.NetworkConfig{
+			ContainerHandle: "some-handle",
 			HostIntf:        "banana-iface",
 			ContainerIntf:   "container-of-bananas-iface",
 			IPTablePrefix:   "bananas-",
@@ -112,14 +135,15 @@ var _ = Describe("Networker", func() {
 			Expect(err).To(MatchError("no parsey"))
 		})
 
-		It("acquires a subnet and IP", func() {
+		It("acquires a subnet and IP for the container", func() {
 			someSubnetRequest := subnets.DynamicSubnetSelector
 			someIpRequest := subnets.DynamicIPSelector
 			fakeSpecParser.ParseReturns(someSubnetRequest, someIpRequest, nil)
 
 			networker.Hooks(logger, "some-handle", "1.2.3.4/30")
 			Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(1))
-			_, sr, ir := fakeSubnetPool.AcquireArgsForCall(0)
+			_, handle, sr, ir := fakeSubnetPool.AcquireArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
 			Expect(sr).To(Equal(someSubnetRequest))
 			Expect(ir).To(Equal(someIpRequest))
 		})
@@ -160,6 +184,50 @@ var _ = Describe("Networker", func() {
 			Expect(config["kawasaki.dns-servers"]).To(Equal("8.8.8.8, 8.8.4.4"))
 		})
 
+		Context("when the config has IPv6 addresses", func() {
+			BeforeEach(func() {
+				_, networkConfig.IPv6Pool, _ = net.ParseCIDR("fd00::/64")
+				_, networkConfig.SubnetIPv6, _ = net.ParseCIDR("fd00::7b7b:7b00/120")
+				networkConfig.BridgeIPv6 = net.ParseIP("fd00::7b7b:7b01")
+				networkConfig.ContainerIPv6 = net.ParseIP("fd00::7b7b:7b0c")
+				fakeConfigCreator.CreateReturns(networkConfig, nil)
+			})
+
+			It("stores them, including the container's address as a property", func() {
+				config := make(map[string]string)
+				fakeConfigStore.SetStub = func(handle, name, value string) {
+					config[name] = value
+				}
+
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(config[gardener.ContainerIPv6Key]).To(Equal("fd00::7b7b:7b0c"))
+				Expect(config["kawasaki.bridge-ipv6"]).To(Equal("fd00::7b7b:7b01"))
+				Expect(config["kawasaki.subnet-ipv6"]).To(Equal("fd00::7b7b:7b00/120"))
+				Expect(config["kawasaki.ipv6-pool"]).To(Equal("fd00::/64"))
+			})
+
+			It("passes them as flags to the binary", func() {
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(hooks.Prestart.Args).To(ContainElement("--ipv6-pool=fd00::/64"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--bridge-ipv6=fd00::7b7b:7b01"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--container-ipv6=fd00::7b7b:7b0c"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--subnet-ipv6=fd00::7b7b:7b00/120"))
+			})
+		})
+
+		It("does not pass IPv6 flags when the config has no IPv6 addresses", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, arg := range hooks.Prestart.Args {
+				Expect(arg).NotTo(ContainSubstring("ipv6"))
+			}
+		})
+
 		Context("when the configuration can't be created", func() {
 			It("returns a wrapped error", func() {
 				fakeConfigCreator.CreateReturns(kawasaki.NetworkConfig{}, errors.New("bad config"))
@@ -175,7 +243,35 @@ var _ = Describe("Networker", func() {
 			Expect(hooks.Prestart.Path).To(Equal("/path/to/kawasaki"))
 		})
 
+		It("returns a poststop hook which tears the network down with the same config", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Poststop.Path).To(Equal("/path/to/kawasaki"))
+			Expect(hooks.Poststop.Args).To(Equal(append(hooks.Prestart.Args, "--teardown")))
+			Expect(hooks.Prestart.Args).NotTo(ContainElement("--teardown"))
+		})
+
+		Context("when the networker records the containers which share each network", func() {
+			BeforeEach(func() {
+				networkSharers = kawasaki.NewNetworkSharers("/path/to/sharers")
+				networker = newNetworker(nil)
+			})
+
+			It("tells the poststop hook where the container's sharers are recorded", func() {
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(hooks.Poststop.Args).To(ContainElement("--network-sharers-dir=/path/to/sharers/some-handle"))
+				Expect(strings.Join(hooks.Prestart.Args, " ")).NotTo(ContainSubstring("--network-sharers-dir"))
+			})
+		})
+
 		It("passes the config as flags to the binary", func() {
+			networkConfig.IPTableLogMethod = "nflog"
+			networkConfig.FirewallBackend = "nftables"
+			fakeConfigCreator.CreateReturns(networkConfig, nil)
+
 			hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
 			Expect(err).NotTo(HaveOccurred())
 
@@ -188,196 +284,1543 @@ var _ = Describe("Networker", func() {
 			Expect(hooks.Prestart.Args).To(ContainElement("--subnet=" + networkConfig.Subnet.String()))
 			Expect(hooks.Prestart.Args).To(ContainElement("--iptable-instance=" + networkConfig.IPTableInstance))
 			Expect(hooks.Prestart.Args).To(ContainElement("--iptable-prefix=" + networkConfig.IPTablePrefix))
+			Expect(hooks.Prestart.Args).To(ContainElement("--iptable-log-method=nflog"))
+			Expect(hooks.Prestart.Args).To(ContainElement("--firewall-backend=nftables"))
 			Expect(hooks.Prestart.Args).To(ContainElement("--mtu=" + strconv.Itoa(networkConfig.Mtu)))
 			for _, dnsServer := range networkConfig.DNSServers {
 				Expect(hooks.Prestart.Args).To(ContainElement("--dns-server=" + dnsServer.String()))
 			}
 		})
-	})
 
-	Describe("Capacity", func() {
-		BeforeEach(func() {
-			fakeSubnetPool.CapacityReturns(9000)
-		})
+		Context("when the container's properties give DNS settings", func() {
+			BeforeEach(func() {
+				config[dns.ServersProperty] = "1.1.1.1"
+				config[dns.ExtraHostsProperty] = "db.internal:10.1.1.1, v6.internal:fd00::1"
+				config[dns.SearchDomainsProperty] = "svc.internal,internal"
+				config[dns.OptionsProperty] = "ndots:2"
+			})
 
-		It("delegates to subnetPool for capacity", func() {
-			cap := networker.Capacity()
+			It("passes them as flags to the binary", func() {
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
 
-			Expect(fakeSubnetPool.CapacityCallCount()).To(Equal(1))
-			Expect(cap).To(BeEquivalentTo(9000))
-		})
-	})
+				Expect(hooks.Prestart.Args).To(ContainElement("--extra-host=db.internal:10.1.1.1"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--extra-host=v6.internal:fd00::1"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--dns-search=svc.internal"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--dns-search=internal"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--dns-option=ndots:2"))
+			})
 
-	Describe("Destroy", func() {
-		It("should destroy the configuration", func() {
-			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+			It("uses the container's DNS servers in place of the configured ones", func() {
+				stored := make(map[string]string)
+				fakeConfigStore.SetStub = func(handle, name, value string) {
+					stored[name] = value
+				}
 
-			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(1))
-			_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
-			Expect(netConfig).To(Equal(networkConfig))
-		})
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
 
-		Context("when the configuration is not destroyed", func() {
-			It("should return the error", func() {
-				fakeConfigurer.DestroyReturns(errors.New("spiderman-error"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--dns-server=1.1.1.1"))
+				Expect(hooks.Prestart.Args).NotTo(ContainElement("--dns-server=8.8.8.8"))
+				Expect(stored["kawasaki.dns-servers"]).To(Equal("1.1.1.1"))
+			})
 
-				err := networker.Destroy(logger, "some-handle")
-				Expect(err).To(MatchError("spiderman-error"))
+			Context("when a DNS server is invalid", func() {
+				BeforeEach(func() {
+					config[dns.ServersProperty] = "banana"
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid dns.servers property: 'banana' is not a valid IP address"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when an extra host is invalid", func() {
+				BeforeEach(func() {
+					config[dns.ExtraHostsProperty] = "db.internal"
+				})
+
+				It("returns an error", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid dns.extra-hosts property: invalid host entry 'db.internal': must be hostname:ip"))
+				})
 			})
 		})
 
-		It("releases the subnet", func() {
-			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+		Context("when the container is in a policy group", func() {
+			var stored map[string]string
 
-			Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(1))
-			actualSubnet, actualIp := fakeSubnetPool.ReleaseArgsForCall(0)
+			BeforeEach(func() {
+				config[kawasaki.PolicyGroupProperty] = "tenant-a"
 
-			Expect(actualIp).To(Equal(networkConfig.ContainerIP))
-			Expect(actualSubnet).To(Equal(networkConfig.Subnet))
-		})
+				stored = make(map[string]string)
+				fakeConfigStore.SetStub = func(handle, name, value string) {
+					stored[name] = value
+				}
+			})
 
-		Context("when releasing subnet fails", func() {
-			Context("when the error indicates the subnet is already gone", func() {
-				It("should return nil (no error)", func() {
-					fakeSubnetPool.ReleaseReturns(subnets.ErrReleasedUnallocatedSubnet)
-					Expect(networker.Destroy(logger, "some-handle")).To(BeNil())
+			It("passes the group to the binary", func() {
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(hooks.Prestart.Args).To(ContainElement("--policy-group=tenant-a"))
+			})
+
+			It("stores the group, so that it is left on Destroy", func() {
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stored["kawasaki.policy-group"]).To(Equal("tenant-a"))
+			})
+
+			Context("when the group is invalid", func() {
+				BeforeEach(func() {
+					config[kawasaki.PolicyGroupProperty] = "tenant a"
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.policy-group property: policy group 'tenant a' must only contain letters, digits, '_', '.' and '-'"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
 				})
 			})
 
-			Context("when the error is generic", func() {
-				It("should return the error", func() {
-					fakeSubnetPool.ReleaseReturns(errors.New("oh no"))
-					Expect(networker.Destroy(logger, "some-handle")).To(MatchError("oh no"))
+			Context("when the firewall backend is nftables", func() {
+				BeforeEach(func() {
+					fakeConfigCreator.FirewallBackendReturns(kawasaki.FirewallBackendNFTables)
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.policy-group property: policy groups require the 'iptables' firewall backend"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+					Expect(stored).NotTo(HaveKey("kawasaki.iptable-inst"))
+				})
+			})
+
+			Context("when there is an IPv6 network pool", func() {
+				BeforeEach(func() {
+					_, ipv6Pool, err := net.ParseCIDR("fd00::/48")
+					Expect(err).NotTo(HaveOccurred())
+					fakeConfigCreator.IPv6PoolReturns(ipv6Pool)
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.policy-group property: policy groups are not supported with an IPv6 network pool"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+					Expect(stored).NotTo(HaveKey("kawasaki.iptable-inst"))
 				})
 			})
 		})
-	})
 
-	Describe("NetOut", func() {
-		It("delegates to FirewallOpener", func() {
-			rule := garden.NetOutRule{Protocol: garden.ProtocolICMP}
+		Context("when the container's properties override the firewall settings", func() {
+			var stored map[string]string
 
-			fakeFirewallOpener.OpenReturns(errors.New("potato"))
-			Expect(networker.NetOut(lagertest.NewTestLogger(""), "some-handle", rule)).To(MatchError("potato"))
+			BeforeEach(func() {
+				config[kawasaki.HostAccessProperty] = "true"
+				config[kawasaki.DenyNetworksProperty] = "10.1.0.0/16, 192.168.1.1"
 
-			_, chainArg, ruleArg := fakeFirewallOpener.OpenArgsForCall(0)
-			Expect(chainArg).To(Equal(networkConfig.IPTableInstance))
-			Expect(ruleArg).To(Equal(rule))
+				allowHostAccessOverride = true
+				networker = newNetworker(nil)
+
+				stored = make(map[string]string)
+				fakeConfigStore.SetStub = func(handle, name, value string) {
+					stored[name] = value
+				}
+			})
+
+			It("passes the overrides to the binary", func() {
+				hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(hooks.Prestart.Args).To(ContainElement("--host-access=true"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--deny-network=10.1.0.0/16"))
+				Expect(hooks.Prestart.Args).To(ContainElement("--deny-network=192.168.1.1"))
+			})
+
+			It("stores the overrides, so that they can be re-applied", func() {
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stored["kawasaki.firewall-overrides"]).To(MatchJSON(`{"HostAccess":true,"DenyNetworks":["10.1.0.0/16","192.168.1.1"]}`))
+			})
+
+			Context("when the server does not allow host access to be granted", func() {
+				BeforeEach(func() {
+					allowHostAccessOverride = false
+					networker = newNetworker(nil)
+				})
+
+				It("refuses to grant host access, before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.host-access property: host access may only be granted to containers when the server allows it with -allowHostAccessOverride"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				})
+
+				It("still allows host access to be denied", func() {
+					config[kawasaki.HostAccessProperty] = "false"
+
+					hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hooks.Prestart.Args).To(ContainElement("--host-access=false"))
+				})
+			})
+
+			Context("when host access is not a boolean", func() {
+				BeforeEach(func() {
+					config[kawasaki.HostAccessProperty] = "sometimes"
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.host-access property: 'sometimes' must be 'true' or 'false'"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when a deny network is invalid", func() {
+				BeforeEach(func() {
+					config[kawasaki.DenyNetworksProperty] = "10.1.0.0/33"
+				})
+
+				It("returns an error before acquiring a subnet", func() {
+					_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+					Expect(err).To(MatchError("invalid network.deny-networks property: '10.1.0.0/33' is not an IP address or CIDR block"))
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		It("does not pass a policy group when the container is not in one", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, arg := range hooks.Prestart.Args {
+				Expect(arg).NotTo(HavePrefix("--policy-group"))
+			}
 		})
 	})
 
-	Describe("NetIn", func() {
+	Describe("Hook with a named network", func() {
 		var (
-			externalPort  uint32
-			containerPort uint32
-			handle        string
+			someIP     net.IP
+			someSubnet *net.IPNet
 		)
 
 		BeforeEach(func() {
-			externalPort = 123
-			containerPort = 456
+			var err error
+			someIP, someSubnet, err = net.ParseCIDR("10.0.0.2/28")
+			Expect(err).NotTo(HaveOccurred())
 
-			handle = "some-handle"
+			fakeSpecParser.ParseReturns(subnets.DynamicSubnetSelector, subnets.DynamicIPSelector, nil)
+			fakeSubnetPool.AcquireReturns(someSubnet, someIP, nil)
+			fakeNamedNetworks.JoinStub = func(_ lager.Logger, _, _ string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error) {
+				return acquire(nil)
+			}
 		})
 
-		It("calls the PortForwarder with correct parameters", func() {
-			_, _, err := networker.NetIn(logger, handle, externalPort, containerPort)
+		It("parses the rest of the spec", func() {
+			_, err := networker.Hooks(logger, "some-handle", "name:tenant-a/28")
 			Expect(err).NotTo(HaveOccurred())
-			Expect(fakePortForwarder.ForwardCallCount()).To(Equal(1))
-
-			actualSpec := fakePortForwarder.ForwardArgsForCall(0)
-			Expect(actualSpec.InstanceID).To(Equal(networkConfig.IPTableInstance))
-			Expect(actualSpec.ContainerIP).To(Equal(networkConfig.ContainerIP))
-			Expect(actualSpec.ExternalIP).To(Equal(networkConfig.ExternalIP))
-			Expect(actualSpec.FromPort).To(Equal(externalPort))
-			Expect(actualSpec.ToPort).To(Equal(containerPort))
 
-			Expect(fakePortPool.AcquireCallCount()).To(Equal(0))
+			_, spec := fakeSpecParser.ParseArgsForCall(0)
+			Expect(spec).To(Equal("/28"))
 		})
 
-		Context("when external port is not specified", func() {
-			It("acquires a random port from the pool", func() {
-				fakePortPool.AcquireReturns(externalPort, nil)
+		It("joins the named network", func() {
+			_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
+			Expect(err).NotTo(HaveOccurred())
 
-				actualHostPort, actualContainerPort, err := networker.NetIn(logger, handle, 0, containerPort)
-				Expect(err).NotTo(HaveOccurred())
+			Expect(fakeNamedNetworks.JoinCallCount()).To(Equal(1))
+			_, name, handle, _ := fakeNamedNetworks.JoinArgsForCall(0)
+			Expect(name).To(Equal("tenant-a"))
+			Expect(handle).To(Equal("some-handle"))
 
-				Expect(actualHostPort).To(Equal(externalPort))
-				Expect(actualContainerPort).To(Equal(containerPort))
+			_, handle, subnet, ip := fakeConfigCreator.CreateArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+			Expect(subnet).To(Equal(someSubnet))
+			Expect(ip).To(Equal(someIP))
+		})
 
-				Expect(fakePortPool.AcquireCallCount()).To(Equal(1))
-				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(1))
-				spec := fakePortForwarder.ForwardArgsForCall(0)
+		It("stores the network name", func() {
+			_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
+			Expect(err).NotTo(HaveOccurred())
 
-				Expect(spec.FromPort).To(Equal(externalPort))
-				Expect(spec.ToPort).To(Equal(containerPort))
-			})
+			stored := map[string]string{}
+			for i := 0; i < fakeConfigStore.SetCallCount(); i++ {
+				_, key, value := fakeConfigStore.SetArgsForCall(i)
+				stored[key] = value
+			}
+			Expect(stored).To(HaveKeyWithValue("kawasaki.network-name", "tenant-a"))
 		})
 
-		Context("when port pool fails to acquire", func() {
-			var err error
+		Context("when this is the first container to join", func() {
+			It("acquires a subnet using the parsed selector", func() {
+				_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, subnetReq, _ := fakeSubnetPool.AcquireArgsForCall(0)
+				Expect(subnetReq).To(Equal(subnets.DynamicSubnetSelector))
+			})
+		})
 
+		Context("when the network already exists", func() {
 			BeforeEach(func() {
-				fakePortPool.AcquireReturns(0, fmt.Errorf("Oh no!"))
-				_, _, err = networker.NetIn(logger, handle, 0, containerPort)
+				fakeNamedNetworks.JoinStub = func(_ lager.Logger, _, _ string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error) {
+					return acquire(someSubnet)
+				}
 			})
 
-			It("returns the error", func() {
-				Expect(err).To(MatchError("Oh no!"))
+			It("acquires an IP in the network's subnet", func() {
+				_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, subnetReq, ipReq := fakeSubnetPool.AcquireArgsForCall(0)
+				Expect(subnetReq).To(Equal(subnets.ExistingSubnetSelector{IPNet: someSubnet}))
+				Expect(ipReq).To(Equal(subnets.DynamicIPSelector))
 			})
 
-			It("does not add a new port mapping", func() {
-				Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
+			It("accepts a spec giving the network's prefix length", func() {
+				_, err := networker.Hooks(logger, "some-handle", "name:tenant-a/28")
+				Expect(err).NotTo(HaveOccurred())
 			})
 
-			It("does not do port forwarding", func() {
-				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(0))
+			Context("when the spec gives a different prefix length", func() {
+				It("returns an error without acquiring an IP", func() {
+					_, err := networker.Hooks(logger, "some-handle", "name:tenant-a/24")
+					Expect(err).To(MatchError("named network tenant-a has a /28 subnet, not the requested /24"))
+
+					Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				})
 			})
 		})
 
-		Context("when container port is not specified", func() {
-			It("aquires a port from the pool", func() {
-				actualHostPort, actualContainerPort, err := networker.NetIn(logger, handle, externalPort, 0)
-				Expect(err).ToNot(HaveOccurred())
+		Context("when joining the network fails", func() {
+			It("returns the error", func() {
+				fakeNamedNetworks.JoinStub = nil
+				fakeNamedNetworks.JoinReturns(nil, nil, errors.New("full"))
 
-				Expect(actualHostPort).To(Equal(externalPort))
-				Expect(actualContainerPort).To(Equal(externalPort))
+				_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
+				Expect(err).To(MatchError("full"))
+				Expect(fakeConfigCreator.CreateCallCount()).To(Equal(0))
 			})
 		})
 
-		It("stores port mapping in ConfigStore", func() {
-			_, _, err := networker.NetIn(logger, handle, externalPort, containerPort)
-			Expect(err).NotTo(HaveOccurred())
+		Context("when the spec has no name", func() {
+			It("returns an error", func() {
+				_, err := networker.Hooks(logger, "some-handle", "name:/28")
+				Expect(err).To(MatchError("network spec name:/28 does not name a network"))
+			})
+		})
 
-			Expect(fakeConfigStore.SetCallCount()).To(Equal(1))
+		It("does not join a named network for other specs", func() {
+			_, err := networker.Hooks(logger, "some-handle", "10.0.0.0/28")
+			Expect(err).NotTo(HaveOccurred())
 
-			actualHandle, actualName, actualValue := fakeConfigStore.SetArgsForCall(0)
-			Expect(actualHandle).To(Equal(handle))
-			Expect(actualName).To(Equal(gardener.MappedPortsKey))
-			Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456}]`))
+			Expect(fakeNamedNetworks.JoinCallCount()).To(Equal(0))
 		})
 
-		It("stores a list of port mappings in ConfigStore", func() {
-			_, _, err := networker.NetIn(logger, handle, externalPort, containerPort)
+		It("records the subnet of a container on no named network, so that it can be recovered", func() {
+			_, err := networker.Hooks(logger, "some-handle", "10.0.0.0/28")
 			Expect(err).NotTo(HaveOccurred())
 
-			config[gardener.MappedPortsKey] = `[{"HostPort":123,"ContainerPort":456}]`
+			Expect(fakeNamedNetworks.RecordCallCount()).To(Equal(1))
+			_, handle, subnet, ip := fakeNamedNetworks.RecordArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+			Expect(subnet).To(Equal(someSubnet))
+			Expect(ip).To(Equal(someIP))
+		})
 
-			_, _, err = networker.NetIn(logger, handle, 654, 987)
+		It("does not record the subnet of a container on a named network separately", func() {
+			_, err := networker.Hooks(logger, "some-handle", "name:tenant-a")
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(fakeConfigStore.SetCallCount()).To(Equal(2))
-
+			Expect(fakeNamedNetworks.RecordCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Hook with a JSON network spec", func() {
+		var stored map[string]string
+
+		BeforeEach(func() {
+			fakeSpecParser.ParseReturns(subnets.DynamicSubnetSelector, subnets.DynamicIPSelector, nil)
+			fakeNamedNetworks.JoinStub = func(_ lager.Logger, _, _ string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error) {
+				return acquire(nil)
+			}
+
+			stored = map[string]string{}
+			fakeConfigStore.SetStub = func(handle, name, value string) {
+				stored[name] = value
+			}
+		})
+
+		It("parses the subnet and IP of each attachment", func() {
+			_, err := networker.Hooks(logger, "some-handle", `{"subnet": "10.0.0.0/24", "ip": "10.0.0.5", "attachments": [{"network": "management", "subnet": "/28"}]}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeSpecParser.ParseCallCount()).To(Equal(2))
+			_, spec := fakeSpecParser.ParseArgsForCall(0)
+			Expect(spec).To(Equal("10.0.0.5/24"))
+			_, spec = fakeSpecParser.ParseArgsForCall(1)
+			Expect(spec).To(Equal("/28"))
+
+			Expect(fakeNamedNetworks.JoinCallCount()).To(Equal(1))
+			_, name, _, _ := fakeNamedNetworks.JoinArgsForCall(0)
+			Expect(name).To(Equal("management"))
+		})
+
+		It("joins the named network the spec gives", func() {
+			_, err := networker.Hooks(logger, "some-handle", `{"network": "tenant-a"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeNamedNetworks.JoinCallCount()).To(Equal(1))
+			Expect(stored["kawasaki.network-name"]).To(Equal("tenant-a"))
+		})
+
+		It("gives each attachment the MTU the spec gives", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", `{"mtu": 1400, "attachments": [{"network": "management", "mtu": 9000}]}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).To(ContainElement("--mtu=1400"))
+			Expect(stored["kawasaki.mtu"]).To(Equal("1400"))
+
+			var attachment kawasaki.NetworkConfig
+			for _, arg := range hooks.Prestart.Args {
+				if strings.HasPrefix(arg, "--attachment=") {
+					Expect(json.Unmarshal([]byte(strings.TrimPrefix(arg, "--attachment=")), &attachment)).To(Succeed())
+				}
+			}
+			Expect(attachment.Mtu).To(Equal(9000))
+		})
+
+		It("replaces the container's DNS servers with those the spec gives", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", `{"dns_servers": ["1.1.1.1"]}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).To(ContainElement("--dns-server=1.1.1.1"))
+			Expect(hooks.Prestart.Args).NotTo(ContainElement("--dns-server=8.8.8.8"))
+		})
+
+		It("applies the network mode the spec gives", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", `{"mode": "none"}`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks).To(Equal(gardener.Hooks{}))
+			Expect(stored["kawasaki.network-mode"]).To(Equal("none"))
+			Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+		})
+
+		Context("when the spec is invalid", func() {
+			It("returns an error before acquiring anything", func() {
+				_, err := networker.Hooks(logger, "some-handle", `{"subnet": "/28", "colour": "blue"}`)
+				Expect(err).To(MatchError("unknown network spec option 'colour': must be one of mode, network, subnet, ip, mtu, dns_servers, attachments"))
+				Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the spec joins the same named network twice", func() {
+			It("returns an error before acquiring anything", func() {
+				_, err := networker.Hooks(logger, "some-handle", `{"network": "tenant-a", "attachments": [{"network": "tenant-a"}]}`)
+				Expect(err).To(MatchError("network spec joins network tenant-a more than once"))
+				Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Hook with several attachments", func() {
+		var (
+			managementConfig kawasaki.NetworkConfig
+			stored           map[string]string
+		)
+
+		BeforeEach(func() {
+			ip, subnet, err := net.ParseCIDR("10.9.0.6/30")
+			Expect(err).NotTo(HaveOccurred())
+			managementConfig = kawasaki.NetworkConfig{
+				ContainerHandle: "some-handle",
+				HostIntf:        "mgmt-iface-0",
+				ContainerIntf:   "mgmt-iface-1",
+				IPTablePrefix:   "bananas-",
+				IPTableInstance: "mgmt-table",
+				BridgeName:      "mgmt-bridge",
+				BridgeIP:        net.ParseIP("10.9.0.5"),
+				ContainerIP:     ip,
+				ExternalIP:      net.ParseIP("128.128.90.90"),
+				Subnet:          subnet,
+				Mtu:             1500,
+			}
+
+			fakeConfigCreator.CreateStub = func(_ lager.Logger, _ string, _ *net.IPNet, _ net.IP) (kawasaki.NetworkConfig, error) {
+				if fakeConfigCreator.CreateCallCount() == 1 {
+					return networkConfig, nil
+				}
+
+				return managementConfig, nil
+			}
+
+			fakeSpecParser.ParseReturns(subnets.DynamicSubnetSelector, subnets.DynamicIPSelector, nil)
+			fakeNamedNetworks.JoinStub = func(_ lager.Logger, _, _ string, acquire kawasaki.AcquireFunc) (*net.IPNet, net.IP, error) {
+				return acquire(nil)
+			}
+
+			stored = map[string]string{}
+			fakeConfigStore.SetStub = func(handle, name, value string) {
+				Expect(handle).To(Equal("some-handle"))
+				stored[name] = value
+			}
+		})
+
+		It("parses the spec of each attachment", func() {
+			_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30, name:management/30")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeSpecParser.ParseCallCount()).To(Equal(2))
+			_, spec := fakeSpecParser.ParseArgsForCall(0)
+			Expect(spec).To(Equal("1.2.3.4/30"))
+			_, spec = fakeSpecParser.ParseArgsForCall(1)
+			Expect(spec).To(Equal("/30"))
+		})
+
+		It("acquires a subnet and IP and creates a config for each attachment", func() {
+			_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,name:management")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(2))
+			Expect(fakeConfigCreator.CreateCallCount()).To(Equal(2))
+
+			Expect(fakeNamedNetworks.JoinCallCount()).To(Equal(1))
+			_, name, _, _ := fakeNamedNetworks.JoinArgsForCall(0)
+			Expect(name).To(Equal("management"))
+		})
+
+		It("stores the first attachment as the container's network config", func() {
+			_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,name:management")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stored[gardener.ContainerIPKey]).To(Equal(networkConfig.ContainerIP.String()))
+			Expect(stored["kawasaki.iptable-inst"]).To(Equal(networkConfig.IPTableInstance))
+			Expect(stored).NotTo(HaveKey("kawasaki.network-name"))
+		})
+
+		It("passes the other attachments to the binary without a default route", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,name:management")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).To(ContainElement("--container-interface=" + networkConfig.ContainerIntf))
+
+			var attachments []kawasaki.NetworkConfig
+			for _, arg := range hooks.Prestart.Args {
+				if strings.HasPrefix(arg, "--attachment=") {
+					var attachment kawasaki.NetworkConfig
+					Expect(json.Unmarshal([]byte(strings.TrimPrefix(arg, "--attachment=")), &attachment)).To(Succeed())
+					attachments = append(attachments, attachment)
+				}
+			}
+
+			Expect(attachments).To(HaveLen(1))
+			Expect(attachments[0].ContainerIntf).To(Equal("mgmt-iface-1"))
+			Expect(attachments[0].BridgeName).To(Equal("mgmt-bridge"))
+			Expect(attachments[0].IPTableInstance).To(Equal("mgmt-table"))
+			Expect(attachments[0].ContainerIP.Equal(managementConfig.ContainerIP)).To(BeTrue())
+			Expect(attachments[0].Subnet.String()).To(Equal("10.9.0.4/30"))
+			Expect(attachments[0].NoDefaultRoute).To(BeTrue())
+		})
+
+		It("records every attachment in the container's info", func() {
+			_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,name:management")
+			Expect(err).NotTo(HaveOccurred())
+
+			var info []gardener.NetworkAttachment
+			Expect(json.Unmarshal([]byte(stored[gardener.AttachmentsKey]), &info)).To(Succeed())
+			Expect(info).To(Equal([]gardener.NetworkAttachment{
+				{
+					Interface:    networkConfig.ContainerIntf,
+					ContainerIP:  "123.123.123.12",
+					HostIP:       "123.123.123.1",
+					Subnet:       "123.123.123.0/24",
+					DefaultRoute: true,
+				},
+				{
+					Interface:   "mgmt-iface-1",
+					ContainerIP: "10.9.0.6",
+					HostIP:      "10.9.0.5",
+					Subnet:      "10.9.0.4/30",
+				},
+			}))
+		})
+
+		Context("when a later attachment cannot be acquired", func() {
+			It("returns the error, having stored the earlier attachments for Destroy to release", func() {
+				fakeSubnetPool.AcquireStub = func(_ lager.Logger, _ string, _ subnets.SubnetSelector, _ subnets.IPSelector) (*net.IPNet, net.IP, error) {
+					if fakeSubnetPool.AcquireCallCount() == 2 {
+						return nil, nil, errors.New("exhausted")
+					}
+
+					return networkConfig.Subnet, networkConfig.ContainerIP, nil
+				}
+
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,/30")
+				Expect(err).To(MatchError("exhausted"))
+				Expect(stored["kawasaki.iptable-inst"]).To(Equal(networkConfig.IPTableInstance))
+			})
+		})
+
+		Context("when an attachment cannot be parsed", func() {
+			It("returns the error before acquiring any attachment", func() {
+				fakeSpecParser.ParseStub = func(_ lager.Logger, spec string) (subnets.SubnetSelector, subnets.IPSelector, error) {
+					if spec == "bad" {
+						return nil, nil, errors.New("no parsey")
+					}
+
+					return subnets.DynamicSubnetSelector, subnets.DynamicIPSelector, nil
+				}
+
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,bad")
+				Expect(err).To(MatchError("no parsey"))
+				Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the spec joins the same named network twice", func() {
+			It("returns an error", func() {
+				_, err := networker.Hooks(logger, "some-handle", "name:tenant-a,name:tenant-a/28")
+				Expect(err).To(MatchError("network spec name:tenant-a,name:tenant-a/28 joins network tenant-a more than once"))
+			})
+		})
+
+		Describe("Destroy", func() {
+			BeforeEach(func() {
+				managementConfig.NoDefaultRoute = true
+				attachmentsJson, err := json.Marshal([]map[string]interface{}{
+					{"Config": managementConfig, "NetworkName": "management"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				config["kawasaki.attachments"] = string(attachmentsJson)
+			})
+
+			It("destroys the configuration of each attachment", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeConfigurer.DestroyCallCount()).To(Equal(2))
+				_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
+				Expect(netConfig.ContainerHandle).To(Equal("some-handle"))
+				Expect(netConfig.BridgeName).To(Equal("mgmt-bridge"))
+				Expect(netConfig.IPTableInstance).To(Equal("mgmt-table"))
+				_, netConfig = fakeConfigurer.DestroyArgsForCall(1)
+				Expect(netConfig).To(Equal(networkConfig))
+			})
+
+			It("releases the subnet of each attachment", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(2))
+				subnet, ip := fakeSubnetPool.ReleaseArgsForCall(0)
+				Expect(subnet.String()).To(Equal("10.9.0.4/30"))
+				Expect(ip.Equal(managementConfig.ContainerIP)).To(BeTrue())
+			})
+
+			It("leaves each attachment's named network", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeNamedNetworks.LeaveCallCount()).To(Equal(1))
+				_, name, handle := fakeNamedNetworks.LeaveArgsForCall(0)
+				Expect(name).To(Equal("management"))
+				Expect(handle).To(Equal("some-handle"))
+			})
+
+			It("forgets the subnet of each attachment on no named network", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeNamedNetworks.ForgetCallCount()).To(Equal(1))
+				_, handle, subnet := fakeNamedNetworks.ForgetArgsForCall(0)
+				Expect(handle).To(Equal("some-handle"))
+				Expect(subnet).To(Equal(networkConfig.Subnet))
+			})
+
+			Context("with the embedded DNS responder", func() {
+				var fakeDNSResponder *fakes.FakeDNSResponder
+
+				BeforeEach(func() {
+					fakeDNSResponder = new(fakes.FakeDNSResponder)
+					networker = newNetworker(fakeDNSResponder)
+				})
+
+				It("removes the bridge of each attachment from the responder", func() {
+					Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+					Expect(fakeDNSResponder.RemoveCallCount()).To(Equal(2))
+					_, bridgeIP := fakeDNSResponder.RemoveArgsForCall(0)
+					Expect(bridgeIP).To(Equal(managementConfig.BridgeIP))
+					_, bridgeIP = fakeDNSResponder.RemoveArgsForCall(1)
+					Expect(bridgeIP).To(Equal(networkConfig.BridgeIP))
+				})
+			})
+		})
+
+		Context("with the embedded DNS responder", func() {
+			var fakeDNSResponder *fakes.FakeDNSResponder
+
+			BeforeEach(func() {
+				fakeDNSResponder = new(fakes.FakeDNSResponder)
+				networker = newNetworker(fakeDNSResponder)
+			})
+
+			It("adds the bridge of each attachment to the responder", func() {
+				_, err := networker.Hooks(logger, "some-handle", "1.2.3.4/30,name:management")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeDNSResponder.AddCallCount()).To(Equal(2))
+				_, bridgeIP := fakeDNSResponder.AddArgsForCall(0)
+				Expect(bridgeIP).To(Equal(networkConfig.BridgeIP))
+				_, bridgeIP = fakeDNSResponder.AddArgsForCall(1)
+				Expect(bridgeIP).To(Equal(managementConfig.BridgeIP))
+			})
+		})
+	})
+
+	DescribeTable("Hook with a network mode", func(mode string) {
+		stored := map[string]string{}
+		fakeConfigStore.SetStub = func(handle, name, value string) {
+			Expect(handle).To(Equal("some-handle"))
+			stored[name] = value
+		}
+
+		hooks, err := networker.Hooks(logger, "some-handle", mode)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hooks).To(Equal(gardener.Hooks{}))
+
+		Expect(fakeSpecParser.ParseCallCount()).To(Equal(0))
+		Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+		Expect(fakeConfigCreator.CreateCallCount()).To(Equal(0))
+
+		Expect(stored).To(Equal(map[string]string{
+			"kawasaki.network-mode": mode,
+			gardener.ContainerIPKey: "",
+			gardener.BridgeIPKey:    "",
+			gardener.ExternalIPKey:  "",
+		}))
+	},
+		Entry("none", "none"),
+		Entry("host", "host"),
+	)
+
+	Context("when the container is in a network mode", func() {
+		BeforeEach(func() {
+			config = map[string]string{"kawasaki.network-mode": "none"}
+		})
+
+		It("has nothing to destroy", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(0))
+			Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(0))
+		})
+
+		It("does not support NetIn", func() {
+			_, _, err := networker.NetIn(logger, "some-handle", gardener.NetInSpec{HostPort: 8080, Protocol: garden.ProtocolTCP})
+			Expect(err).To(MatchError("container is in network mode none, which has no network config"))
+		})
+
+		It("does not support NetOut", func() {
+			err := networker.NetOut(logger, "some-handle", garden.NetOutRule{})
+			Expect(err).To(MatchError("container is in network mode none, which has no network config"))
+		})
+	})
+
+	Context("when the container shares a peer's network", func() {
+		var sidecar, stored map[string]string
+
+		BeforeEach(func() {
+			sidecar = map[string]string{}
+			stored = map[string]string{}
+			fakeConfigStore.GetStub = func(handle, name string) (string, error) {
+				switch handle {
+				case "app":
+					return config[name], nil
+				case "sidecar":
+					return sidecar[name], nil
+				default:
+					return "", errors.New("no such container")
+				}
+			}
+
+			fakeConfigStore.SetStub = func(handle, name, value string) {
+				Expect(handle).To(Equal("sidecar"))
+				stored[name] = value
+			}
+		})
+
+		Describe("Hook", func() {
+			It("allocates no network resources", func() {
+				hooks, err := networker.Hooks(logger, "sidecar", "container:app")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hooks).To(Equal(gardener.Hooks{}))
+
+				Expect(fakeSpecParser.ParseCallCount()).To(Equal(0))
+				Expect(fakeSubnetPool.AcquireCallCount()).To(Equal(0))
+				Expect(fakeConfigCreator.CreateCallCount()).To(Equal(0))
+			})
+
+			It("records the peer and reports the peer's addresses", func() {
+				_, err := networker.Hooks(logger, "sidecar", "container:app")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(stored).To(Equal(map[string]string{
+					"kawasaki.network-peer": "app",
+					gardener.ContainerIPKey: networkConfig.ContainerIP.String(),
+					gardener.BridgeIPKey:    networkConfig.BridgeIP.String(),
+					gardener.ExternalIPKey:  networkConfig.ExternalIP.String(),
+				}))
+			})
+
+			Context("when the peer itself shares another container's network", func() {
+				It("shares the network of the container which owns it", func() {
+					config["kawasaki.network-peer"] = "owner"
+					_, err := networker.Hooks(logger, "sidecar", "container:app")
+					Expect(err).To(MatchError("cannot share the network of owner: no such container"))
+				})
+			})
+
+			Context("when the peer has no network config", func() {
+				It("returns an error", func() {
+					_, err := networker.Hooks(logger, "sidecar", "container:missing")
+					Expect(err).To(MatchError("cannot share the network of missing: no such container"))
+				})
+			})
+		})
+
+		Context("once the container shares its peer's network", func() {
+			BeforeEach(func() {
+				sidecar["kawasaki.network-peer"] = "app"
+			})
+
+			It("forwards ports to the peer's network", func() {
+				_, _, err := networker.NetIn(logger, "sidecar", gardener.NetInSpec{HostPort: 8080, ContainerPort: 8081, Protocol: garden.ProtocolTCP})
+				Expect(err).NotTo(HaveOccurred())
+
+				spec := fakePortForwarder.ForwardArgsForCall(0)
+				Expect(spec.InstanceID).To(Equal(networkConfig.IPTableInstance))
+				Expect(spec.ContainerIP).To(Equal(networkConfig.ContainerIP))
+
+				Expect(stored).To(HaveKeyWithValue(gardener.MappedPortsKey, `[{"HostPort":8080,"ContainerPort":8081,"Protocol":"tcp"}]`))
+			})
+
+			It("opens NetOut rules in the peer's instance chain", func() {
+				Expect(networker.NetOut(logger, "sidecar", garden.NetOutRule{})).To(Succeed())
+
+				_, instance, _ := fakeFirewallOpener.OpenArgsForCall(0)
+				Expect(instance).To(Equal(networkConfig.IPTableInstance))
+			})
+
+			Describe("Destroy", func() {
+				BeforeEach(func() {
+					sidecar[gardener.MappedPortsKey] = `[{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"}]`
+				})
+
+				It("removes its port forwards from the peer's network and releases the ports", func() {
+					Expect(networker.Destroy(logger, "sidecar")).To(Succeed())
+
+					Expect(fakePortForwarder.UnforwardCallCount()).To(Equal(1))
+					spec := fakePortForwarder.UnforwardArgsForCall(0)
+					Expect(spec.InstanceID).To(Equal(networkConfig.IPTableInstance))
+					Expect(spec.FromPort).To(BeEquivalentTo(60000))
+
+					Expect(fakePortPool.ReleaseCallCount()).To(Equal(1))
+					Expect(fakePortPool.ReleaseArgsForCall(0)).To(BeEquivalentTo(60000))
+				})
+
+				It("does not tear down the peer's network", func() {
+					Expect(networker.Destroy(logger, "sidecar")).To(Succeed())
+
+					Expect(fakeConfigurer.DestroyCallCount()).To(Equal(0))
+					Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when the networker records the containers which share each network", func() {
+			var sharersDir string
+
+			BeforeEach(func() {
+				var err error
+				sharersDir, err = ioutil.TempDir("", "network-sharers")
+				Expect(err).NotTo(HaveOccurred())
+
+				networkSharers = kawasaki.NewNetworkSharers(sharersDir)
+				networker = newNetworker(nil)
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(sharersDir)).To(Succeed())
+			})
+
+			It("records the container as a sharer of the peer's network, so that the peer's poststop hook leaves it in place", func() {
+				_, err := networker.Hooks(logger, "sidecar", "container:app")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(filepath.Join(sharersDir, "app", "sidecar")).To(BeAnExistingFile())
+
+				shared, err := kawasaki.HasNetworkSharers(networkSharers.Dir("app"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(shared).To(BeTrue())
+			})
+
+			It("no longer records the container once it is destroyed", func() {
+				_, err := networker.Hooks(logger, "sidecar", "container:app")
+				Expect(err).NotTo(HaveOccurred())
+
+				sidecar["kawasaki.network-peer"] = "app"
+				Expect(networker.Destroy(logger, "sidecar")).To(Succeed())
+
+				shared, err := kawasaki.HasNetworkSharers(networkSharers.Dir("app"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(shared).To(BeFalse())
+			})
+
+			It("forgets the peer's sharers once the peer is destroyed", func() {
+				Expect(networkSharers.Add("app", "sidecar")).To(Succeed())
+
+				Expect(networker.Destroy(logger, "app")).To(Succeed())
+				Expect(networkSharers.Dir("app")).NotTo(BeADirectory())
+			})
+		})
+	})
+
+	Describe("with the embedded DNS responder", func() {
+		var fakeDNSResponder *fakes.FakeDNSResponder
+
+		BeforeEach(func() {
+			fakeDNSResponder = new(fakes.FakeDNSResponder)
+			networker = newNetworker(fakeDNSResponder)
+		})
+
+		It("adds the container's bridge to the responder", func() {
+			_, err := networker.Hooks(logger, "some-handle", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeDNSResponder.AddCallCount()).To(Equal(1))
+			_, bridgeIP := fakeDNSResponder.AddArgsForCall(0)
+			Expect(bridgeIP).To(Equal(networkConfig.BridgeIP))
+		})
+
+		It("tells the hook to use the responder", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).To(ContainElement("--embedded-dns"))
+		})
+
+		It("removes the container's bridge from the responder on Destroy", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakeDNSResponder.RemoveCallCount()).To(Equal(1))
+			_, bridgeIP := fakeDNSResponder.RemoveArgsForCall(0)
+			Expect(bridgeIP).To(Equal(networkConfig.BridgeIP))
+		})
+	})
+
+	Context("without the embedded DNS responder", func() {
+		It("does not tell the hook to use it", func() {
+			hooks, err := networker.Hooks(logger, "some-handle", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).NotTo(ContainElement("--embedded-dns"))
+		})
+	})
+
+	Describe("Capacity", func() {
+		BeforeEach(func() {
+			fakeSubnetPool.CapacityReturns(9000)
+		})
+
+		It("delegates to subnetPool for capacity", func() {
+			cap := networker.Capacity()
+
+			Expect(fakeSubnetPool.CapacityCallCount()).To(Equal(1))
+			Expect(cap).To(BeEquivalentTo(9000))
+		})
+	})
+
+	Describe("Destroy", func() {
+		It("should destroy the configuration", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(1))
+			_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
+			Expect(netConfig).To(Equal(networkConfig))
+		})
+
+		It("loads any IPv6 configuration", func() {
+			config["kawasaki.ipv6-pool"] = "fd00::/64"
+			config["kawasaki.subnet-ipv6"] = "fd00::7b7b:7b00/120"
+			config["kawasaki.bridge-ipv6"] = "fd00::7b7b:7b01"
+			config[gardener.ContainerIPv6Key] = "fd00::7b7b:7b0c"
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
+			Expect(netConfig.IPv6Pool.String()).To(Equal("fd00::/64"))
+			Expect(netConfig.SubnetIPv6.String()).To(Equal("fd00::7b7b:7b00/120"))
+			Expect(netConfig.BridgeIPv6).To(Equal(net.ParseIP("fd00::7b7b:7b01")))
+			Expect(netConfig.ContainerIPv6).To(Equal(net.ParseIP("fd00::7b7b:7b0c")))
+		})
+
+		It("loads the container's firewall overrides", func() {
+			config["kawasaki.firewall-overrides"] = `{"HostAccess":false,"DenyNetworks":null}`
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
+			Expect(*netConfig.Overrides.HostAccess).To(BeFalse())
+		})
+
+		It("loads the container's policy group, so that it is left", func() {
+			config["kawasaki.policy-group"] = "tenant-a"
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			_, netConfig := fakeConfigurer.DestroyArgsForCall(0)
+			Expect(netConfig.PolicyGroup).To(Equal("tenant-a"))
+		})
+
+		Context("when the configuration is not destroyed", func() {
+			It("should return the error", func() {
+				fakeConfigurer.DestroyReturns(errors.New("spiderman-error"))
+
+				err := networker.Destroy(logger, "some-handle")
+				Expect(err).To(MatchError("spiderman-error"))
+			})
+		})
+
+		It("releases the subnet", func() {
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(1))
+			actualSubnet, actualIp := fakeSubnetPool.ReleaseArgsForCall(0)
+
+			Expect(actualIp).To(Equal(networkConfig.ContainerIP))
+			Expect(actualSubnet).To(Equal(networkConfig.Subnet))
+		})
+
+		It("leaves the container's named network", func() {
+			config["kawasaki.network-name"] = "tenant-a"
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakeNamedNetworks.LeaveCallCount()).To(Equal(1))
+			_, name, handle := fakeNamedNetworks.LeaveArgsForCall(0)
+			Expect(name).To(Equal("tenant-a"))
+			Expect(handle).To(Equal("some-handle"))
+		})
+
+		Context("when the container is not in a named network", func() {
+			It("does not leave one", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+				Expect(fakeNamedNetworks.LeaveCallCount()).To(Equal(0))
+			})
+		})
+
+		It("releases the mapped ports", func() {
+			config[gardener.MappedPortsKey] = `[{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"},{"HostPort":60001,"ContainerPort":8081,"Protocol":"udp"}]`
+
+			Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+			Expect(fakePortPool.ReleaseCallCount()).To(Equal(2))
+			Expect(fakePortPool.ReleaseArgsForCall(0)).To(BeEquivalentTo(60000))
+			Expect(fakePortPool.ReleaseArgsForCall(1)).To(BeEquivalentTo(60001))
+		})
+
+		Context("when no ports are mapped", func() {
+			It("does not release any ports", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+				Expect(fakePortPool.ReleaseCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the network cannot be torn down", func() {
+			It("still releases the mapped ports", func() {
+				config[gardener.MappedPortsKey] = `[{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"}]`
+				fakeConfigurer.DestroyReturns(errors.New("spiderman-error"))
+
+				Expect(networker.Destroy(logger, "some-handle")).To(MatchError("spiderman-error"))
+
+				Expect(fakePortPool.ReleaseCallCount()).To(Equal(1))
+				Expect(fakePortPool.ReleaseArgsForCall(0)).To(BeEquivalentTo(60000))
+			})
+		})
+
+		Context("when the poststop hook has already torn the network down", func() {
+			BeforeEach(func() {
+				Expect(kawasaki.Teardown(logger, fakeConfigurer, networkConfig, nil)).To(Succeed())
+			})
+
+			It("tears it down again, as tearing down a network which is gone is a no-op", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeConfigurer.DestroyCallCount()).To(Equal(2))
+				_, netConfig := fakeConfigurer.DestroyArgsForCall(1)
+				Expect(netConfig).To(Equal(networkConfig))
+			})
+
+			It("still releases the subnet, as the hook does not", func() {
+				Expect(networker.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeSubnetPool.ReleaseCallCount()).To(Equal(1))
+				actualSubnet, actualIp := fakeSubnetPool.ReleaseArgsForCall(0)
+				Expect(actualSubnet).To(Equal(networkConfig.Subnet))
+				Expect(actualIp).To(Equal(networkConfig.ContainerIP))
+			})
+		})
+
+		Context("when releasing subnet fails", func() {
+			Context("when the error indicates the subnet is already gone", func() {
+				It("should return nil (no error)", func() {
+					fakeSubnetPool.ReleaseReturns(subnets.ErrReleasedUnallocatedSubnet)
+					Expect(networker.Destroy(logger, "some-handle")).To(BeNil())
+				})
+			})
+
+			Context("when the error is generic", func() {
+				It("should return the error", func() {
+					fakeSubnetPool.ReleaseReturns(errors.New("oh no"))
+					Expect(networker.Destroy(logger, "some-handle")).To(MatchError("oh no"))
+				})
+			})
+		})
+	})
+
+	Describe("NetOut", func() {
+		It("delegates to FirewallOpener", func() {
+			rule := garden.NetOutRule{Protocol: garden.ProtocolICMP}
+
+			fakeFirewallOpener.OpenReturns(errors.New("potato"))
+			Expect(networker.NetOut(lagertest.NewTestLogger(""), "some-handle", rule)).To(MatchError("potato"))
+
+			_, chainArg, ruleArg := fakeFirewallOpener.OpenArgsForCall(0)
+			Expect(chainArg).To(Equal(networkConfig.IPTableInstance))
+			Expect(ruleArg).To(Equal(rule))
+		})
+
+		Context("when the rule is applied", func() {
+			BeforeEach(func() {
+				fakeConfigStore.SetStub = func(handle, name, value string) {
+					config[name] = value
+				}
+			})
+
+			It("records the rule with a new id", func() {
+				tcpRule := garden.NetOutRule{Protocol: garden.ProtocolTCP}
+				udpRule := garden.NetOutRule{Protocol: garden.ProtocolUDP}
+
+				Expect(networker.NetOut(logger, "some-handle", tcpRule)).To(Succeed())
+				Expect(networker.NetOut(logger, "some-handle", udpRule)).To(Succeed())
+
+				Expect(networker.NetOutRules(logger, "some-handle")).To(Equal([]gardener.NetOutEntry{
+					{ID: 1, Rule: tcpRule},
+					{ID: 2, Rule: udpRule},
+				}))
+			})
+		})
+
+		Context("when the FirewallOpener fails", func() {
+			It("does not record the rule", func() {
+				fakeFirewallOpener.OpenReturns(errors.New("potato"))
+				Expect(networker.NetOut(logger, "some-handle", garden.NetOutRule{})).NotTo(Succeed())
+
+				Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("RemoveNetOut", func() {
+		var rule garden.NetOutRule
+
+		BeforeEach(func() {
+			rule = garden.NetOutRule{Protocol: garden.ProtocolTCP, Ports: []garden.PortRange{{Start: 80, End: 80}}}
+
+			fakeConfigStore.SetStub = func(handle, name, value string) {
+				config[name] = value
+			}
+
+			Expect(networker.NetOut(logger, "some-handle", garden.NetOutRule{Protocol: garden.ProtocolICMP})).To(Succeed())
+			Expect(networker.NetOut(logger, "some-handle", rule)).To(Succeed())
+		})
+
+		It("closes the rule with the given id", func() {
+			Expect(networker.RemoveNetOut(logger, "some-handle", 2)).To(Succeed())
+
+			Expect(fakeFirewallOpener.CloseCallCount()).To(Equal(1))
+			_, instanceArg, ruleArg := fakeFirewallOpener.CloseArgsForCall(0)
+			Expect(instanceArg).To(Equal(networkConfig.IPTableInstance))
+			Expect(ruleArg).To(Equal(rule))
+		})
+
+		It("stops tracking the rule", func() {
+			Expect(networker.RemoveNetOut(logger, "some-handle", 2)).To(Succeed())
+
+			Expect(networker.NetOutRules(logger, "some-handle")).To(Equal([]gardener.NetOutEntry{
+				{ID: 1, Rule: garden.NetOutRule{Protocol: garden.ProtocolICMP}},
+			}))
+		})
+
+		Context("when no rule has the given id", func() {
+			It("returns an error", func() {
+				Expect(networker.RemoveNetOut(logger, "some-handle", 3)).To(MatchError("no net out rule found with id 3"))
+				Expect(fakeFirewallOpener.CloseCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the FirewallOpener fails to close the rule", func() {
+			BeforeEach(func() {
+				fakeFirewallOpener.CloseReturns(errors.New("potato"))
+			})
+
+			It("returns the error and keeps tracking the rule", func() {
+				Expect(networker.RemoveNetOut(logger, "some-handle", 2)).To(MatchError("potato"))
+				Expect(networker.NetOutRules(logger, "some-handle")).To(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("RemoveNetIn", func() {
+		BeforeEach(func() {
+			config[gardener.MappedPortsKey] = `[{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"},{"HostPort":60000,"ContainerPort":53,"Protocol":"udp"}]`
+
+			fakeConfigStore.SetStub = func(handle, name, value string) {
+				config[name] = value
+			}
+		})
+
+		It("removes the forwarding rule for the mapping", func() {
+			Expect(networker.RemoveNetIn(logger, "some-handle", 60000, garden.ProtocolUDP)).To(Succeed())
+
+			Expect(fakePortForwarder.UnforwardCallCount()).To(Equal(1))
+			Expect(fakePortForwarder.UnforwardArgsForCall(0)).To(Equal(kawasaki.PortForwarderSpec{
+				InstanceID:  networkConfig.IPTableInstance,
+				Protocol:    garden.ProtocolUDP,
+				FromPort:    60000,
+				ToPort:      53,
+				PortCount:   1,
+				ContainerIP: networkConfig.ContainerIP,
+				ExternalIP:  networkConfig.ExternalIP,
+			}))
+		})
+
+		It("releases the host port", func() {
+			Expect(networker.RemoveNetIn(logger, "some-handle", 60000, garden.ProtocolTCP)).To(Succeed())
+
+			Expect(fakePortPool.ReleaseCallCount()).To(Equal(1))
+			Expect(fakePortPool.ReleaseArgsForCall(0)).To(BeEquivalentTo(60000))
+		})
+
+		It("removes the mapping from the mapped ports property", func() {
+			Expect(networker.RemoveNetIn(logger, "some-handle", 60000, garden.ProtocolTCP)).To(Succeed())
+
+			Expect(config[gardener.MappedPortsKey]).To(MatchJSON(`[{"HostPort":60000,"ContainerPort":53,"Protocol":"udp"}]`))
+		})
+
+		Context("when there is no mapping for the port", func() {
+			It("returns an error", func() {
+				Expect(networker.RemoveNetIn(logger, "some-handle", 60001, garden.ProtocolTCP)).To(MatchError("no tcp port mapping found for host port 60001"))
+				Expect(fakePortForwarder.UnforwardCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the PortForwarder fails", func() {
+			BeforeEach(func() {
+				fakePortForwarder.UnforwardReturns(errors.New("oh no"))
+			})
+
+			It("returns the error and keeps the mapping", func() {
+				Expect(networker.RemoveNetIn(logger, "some-handle", 60000, garden.ProtocolTCP)).To(MatchError("oh no"))
+
+				Expect(fakePortPool.ReleaseCallCount()).To(Equal(0))
+				Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("NetIn", func() {
+		var (
+			externalPort  uint32
+			containerPort uint32
+			handle        string
+		)
+
+		BeforeEach(func() {
+			externalPort = 123
+			containerPort = 456
+
+			handle = "some-handle"
+		})
+
+		tcpSpec := func(hostPort, containerPort uint32) gardener.NetInSpec {
+			return gardener.NetInSpec{
+				HostPort:      hostPort,
+				ContainerPort: containerPort,
+				Protocol:      garden.ProtocolTCP,
+			}
+		}
+
+		It("calls the PortForwarder with correct parameters", func() {
+			_, _, err := networker.NetIn(logger, handle, tcpSpec(externalPort, containerPort))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakePortForwarder.ForwardCallCount()).To(Equal(1))
+
+			actualSpec := fakePortForwarder.ForwardArgsForCall(0)
+			Expect(actualSpec.InstanceID).To(Equal(networkConfig.IPTableInstance))
+			Expect(actualSpec.ContainerIP).To(Equal(networkConfig.ContainerIP))
+			Expect(actualSpec.ExternalIP).To(Equal(networkConfig.ExternalIP))
+			Expect(actualSpec.Protocol).To(Equal(garden.ProtocolTCP))
+			Expect(actualSpec.FromPort).To(Equal(externalPort))
+			Expect(actualSpec.ToPort).To(Equal(containerPort))
+			Expect(actualSpec.PortCount).To(BeEquivalentTo(1))
+
+			Expect(fakePortPool.AcquireCallCount()).To(Equal(0))
+		})
+
+		Context("when external port is not specified", func() {
+			It("acquires a random port from the pool", func() {
+				fakePortPool.AcquireReturns(externalPort, nil)
+
+				actualHostPort, actualContainerPort, err := networker.NetIn(logger, handle, tcpSpec(0, containerPort))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(actualHostPort).To(Equal(externalPort))
+				Expect(actualContainerPort).To(Equal(containerPort))
+
+				Expect(fakePortPool.AcquireCallCount()).To(Equal(1))
+				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(1))
+				spec := fakePortForwarder.ForwardArgsForCall(0)
+
+				Expect(spec.FromPort).To(Equal(externalPort))
+				Expect(spec.ToPort).To(Equal(containerPort))
+			})
+		})
+
+		Context("when port pool fails to acquire", func() {
+			var err error
+
+			BeforeEach(func() {
+				fakePortPool.AcquireReturns(0, fmt.Errorf("Oh no!"))
+				_, _, err = networker.NetIn(logger, handle, tcpSpec(0, containerPort))
+			})
+
+			It("returns the error", func() {
+				Expect(err).To(MatchError("Oh no!"))
+			})
+
+			It("does not add a new port mapping", func() {
+				Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
+			})
+
+			It("does not do port forwarding", func() {
+				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when container port is not specified", func() {
+			It("aquires a port from the pool", func() {
+				actualHostPort, actualContainerPort, err := networker.NetIn(logger, handle, tcpSpec(externalPort, 0))
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(actualHostPort).To(Equal(externalPort))
+				Expect(actualContainerPort).To(Equal(externalPort))
+			})
+		})
+
+		It("stores port mapping in ConfigStore", func() {
+			_, _, err := networker.NetIn(logger, handle, tcpSpec(externalPort, containerPort))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeConfigStore.SetCallCount()).To(Equal(1))
+
+			actualHandle, actualName, actualValue := fakeConfigStore.SetArgsForCall(0)
+			Expect(actualHandle).To(Equal(handle))
+			Expect(actualName).To(Equal(gardener.MappedPortsKey))
+			Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456,"Protocol":"tcp"}]`))
+		})
+
+		It("stores a list of port mappings in ConfigStore", func() {
+			_, _, err := networker.NetIn(logger, handle, tcpSpec(externalPort, containerPort))
+			Expect(err).NotTo(HaveOccurred())
+
+			config[gardener.MappedPortsKey] = `[{"HostPort":123,"ContainerPort":456,"Protocol":"tcp"}]`
+
+			_, _, err = networker.NetIn(logger, handle, tcpSpec(654, 987))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeConfigStore.SetCallCount()).To(Equal(2))
+
 			_, _, actualValue := fakeConfigStore.SetArgsForCall(1)
-			Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456},{"HostPort":654,"ContainerPort":987}]`))
+			Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456,"Protocol":"tcp"},{"HostPort":654,"ContainerPort":987,"Protocol":"tcp"}]`))
+		})
+
+		Context("when the protocol is UDP", func() {
+			It("forwards and stores the UDP port", func() {
+				_, _, err := networker.NetIn(logger, handle, gardener.NetInSpec{
+					HostPort:      externalPort,
+					ContainerPort: containerPort,
+					Protocol:      garden.ProtocolUDP,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakePortForwarder.ForwardArgsForCall(0).Protocol).To(Equal(garden.ProtocolUDP))
+
+				_, _, actualValue := fakeConfigStore.SetArgsForCall(0)
+				Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456,"Protocol":"udp"}]`))
+			})
+		})
+
+		Context("when the protocol is neither TCP nor UDP", func() {
+			It("returns an error without forwarding", func() {
+				_, _, err := networker.NetIn(logger, handle, gardener.NetInSpec{
+					HostPort: externalPort,
+					Protocol: garden.ProtocolICMP,
+				})
+				Expect(err).To(MatchError(ContainSubstring("invalid protocol for NetIn")))
+				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a port range is requested", func() {
+			var spec gardener.NetInSpec
+
+			BeforeEach(func() {
+				spec = gardener.NetInSpec{
+					HostPort:      externalPort,
+					ContainerPort: containerPort,
+					PortCount:     3,
+					Protocol:      garden.ProtocolTCP,
+				}
+			})
+
+			It("forwards each port in the range", func() {
+				_, _, err := networker.NetIn(logger, handle, spec)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakePortForwarder.ForwardCallCount()).To(Equal(3))
+				for i := 0; i < 3; i++ {
+					actualSpec := fakePortForwarder.ForwardArgsForCall(i)
+					Expect(actualSpec.FromPort).To(Equal(externalPort + uint32(i)))
+					Expect(actualSpec.ToPort).To(Equal(containerPort + uint32(i)))
+					Expect(actualSpec.PortCount).To(BeEquivalentTo(1))
+				}
+			})
+
+			Context("when forwarding a port part way through the range fails", func() {
+				BeforeEach(func() {
+					spec.HostPort = 0
+					fakePortPool.AcquireRangeReturns(60000, nil)
+					fakePortForwarder.ForwardStub = func(spec kawasaki.PortForwarderSpec) error {
+						if spec.FromPort == 60002 {
+							return errors.New("Oh no!")
+						}
+
+						return nil
+					}
+				})
+
+				It("returns the error", func() {
+					_, _, err := networker.NetIn(logger, handle, spec)
+					Expect(err).To(MatchError("Oh no!"))
+				})
+
+				It("removes the rules already added, one per port", func() {
+					networker.NetIn(logger, handle, spec)
+
+					Expect(fakePortForwarder.UnforwardCallCount()).To(Equal(2))
+					for i := 0; i < 2; i++ {
+						actualSpec := fakePortForwarder.UnforwardArgsForCall(i)
+						Expect(actualSpec.FromPort).To(BeEquivalentTo(60000 + i))
+						Expect(actualSpec.ToPort).To(Equal(containerPort + uint32(i)))
+						Expect(actualSpec.PortCount).To(BeEquivalentTo(1))
+					}
+				})
+
+				It("releases the ports once the rules are removed", func() {
+					fakePortForwarder.UnforwardStub = func(kawasaki.PortForwarderSpec) error {
+						Expect(fakePortPool.ReleaseCallCount()).To(Equal(0))
+						return nil
+					}
+
+					networker.NetIn(logger, handle, spec)
+					Expect(fakePortPool.ReleaseCallCount()).To(Equal(3))
+				})
+
+				It("does not add any port mappings", func() {
+					networker.NetIn(logger, handle, spec)
+					Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
+				})
+			})
+
+			It("stores a mapping for each port in the range", func() {
+				_, _, err := networker.NetIn(logger, handle, spec)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, actualValue := fakeConfigStore.SetArgsForCall(0)
+				Expect(actualValue).To(Equal(`[{"HostPort":123,"ContainerPort":456,"Protocol":"tcp"},{"HostPort":124,"ContainerPort":457,"Protocol":"tcp"},{"HostPort":125,"ContainerPort":458,"Protocol":"tcp"}]`))
+			})
+
+			Context("when the external port is not specified", func() {
+				It("acquires a contiguous range from the pool", func() {
+					spec.HostPort = 0
+					fakePortPool.AcquireRangeReturns(60000, nil)
+
+					actualHostPort, _, err := networker.NetIn(logger, handle, spec)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(actualHostPort).To(BeEquivalentTo(60000))
+
+					Expect(fakePortPool.AcquireRangeCallCount()).To(Equal(1))
+					Expect(fakePortPool.AcquireRangeArgsForCall(0)).To(BeEquivalentTo(3))
+					Expect(fakePortPool.AcquireCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the range exceeds the highest port", func() {
+				It("returns an error", func() {
+					spec.ContainerPort = 65534
+
+					_, _, err := networker.NetIn(logger, handle, spec)
+					Expect(err).To(MatchError(ContainSubstring("exceeds 65535")))
+					Expect(fakePortForwarder.ForwardCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the port count is larger than any range of ports", func() {
+				It("returns an error without acquiring any ports", func() {
+					spec.HostPort = 0
+					spec.ContainerPort = 0
+					spec.PortCount = 4294967295
+
+					_, _, err := networker.NetIn(logger, handle, spec)
+					Expect(err).To(MatchError("port range of 4294967295 ports exceeds 65535"))
+					Expect(fakePortPool.AcquireRangeCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the host port range exceeds the highest port", func() {
+				It("returns an error without acquiring any ports", func() {
+					spec.HostPort = 65535
+
+					_, _, err := networker.NetIn(logger, handle, spec)
+					Expect(err).To(MatchError("port range of 3 ports exceeds 65535"))
+					Expect(fakePortPool.AcquireRangeCallCount()).To(Equal(0))
+					Expect(fakePortForwarder.ForwardCallCount()).To(Equal(0))
+				})
+			})
 		})
 
 		Context("when the PortForwarder fails", func() {
 			var err error
 
 			BeforeEach(func() {
+				fakePortPool.AcquireReturns(60000, nil)
 				fakePortForwarder.ForwardReturns(fmt.Errorf("Oh no!"))
-				_, _, err = networker.NetIn(logger, handle, 0, 0)
+				_, _, err = networker.NetIn(logger, handle, tcpSpec(0, 0))
 			})
 
 			It("returns an error", func() {
@@ -387,6 +1830,11 @@ var _ = Describe("Networker", func() {
 			It("does not add the new port mapping", func() {
 				Expect(fakeConfigStore.SetCallCount()).To(Equal(0))
 			})
+
+			It("releases the port it acquired", func() {
+				Expect(fakePortPool.ReleaseCallCount()).To(Equal(1))
+				Expect(fakePortPool.ReleaseArgsForCall(0)).To(BeEquivalentTo(60000))
+			})
 		})
 
 		Context("when handle does not exist", func() {
@@ -395,7 +1843,7 @@ var _ = Describe("Networker", func() {
 			})
 
 			It("returns an error", func() {
-				_, _, err := networker.NetIn(logger, "nonexistent", 0, 0)
+				_, _, err := networker.NetIn(logger, "nonexistent", tcpSpec(0, 0))
 				Expect(err).To(MatchError("Handle does not exist"))
 			})
 		})
@@ -0,0 +1,19 @@
+package nftables
+
+// Firewall provides kawasaki's packet filtering and NAT on top of nftables
+type Firewall struct {
+	*Starter
+	*InstanceChainCreator
+	*PortForwarder
+	*FirewallOpener
+	PolicyGroups
+}
+
+func NewFirewall(nftables *NFTables, logMethod string, allowHostAccess, embeddedDNS bool, nicPrefix string, allowNetworks, denyNetworks []string, defaultInterface func() (string, error)) *Firewall {
+	return &Firewall{
+		Starter:              NewStarter(nftables, allowHostAccess, embeddedDNS, nicPrefix, allowNetworks, denyNetworks, defaultInterface),
+		InstanceChainCreator: NewInstanceChainCreator(nftables, logMethod, embeddedDNS),
+		PortForwarder:        NewPortForwarder(nftables),
+		FirewallOpener:       NewFirewallOpener(nftables),
+	}
+}
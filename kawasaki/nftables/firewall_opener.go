@@ -0,0 +1,120 @@
+package nftables
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/pivotal-golang/lager"
+)
+
+type FirewallOpener struct {
+	nftables *NFTables
+}
+
+func NewFirewallOpener(nftables *NFTables) *FirewallOpener {
+	return &FirewallOpener{
+		nftables: nftables,
+	}
+}
+
+func (f *FirewallOpener) Open(logger lager.Logger, instance string, r garden.NetOutRule) error {
+	chain := f.nftables.instanceChain(instance)
+	logChain := f.nftables.logChain(instance)
+
+	logger = logger.Session("prepend-filter-rule", lager.Data{"rule": r, "instance": instance, "chain": chain})
+	logger.Debug("started")
+
+	if err := eachFilterRule(r, func(filter singleFilterRule) error {
+		return f.nftables.prependRule(chain, append(filter.expression(logChain), comment(filter.comment(logChain))...))
+	}); err != nil {
+		return err
+	}
+
+	logger.Debug("ending")
+	return nil
+}
+
+// Close removes the rules added by an Open call with the same NetOutRule
+func (f *FirewallOpener) Close(logger lager.Logger, instance string, r garden.NetOutRule) error {
+	chain := f.nftables.instanceChain(instance)
+	logChain := f.nftables.logChain(instance)
+
+	logger = logger.Session("delete-filter-rule", lager.Data{"rule": r, "instance": instance, "chain": chain})
+	logger.Debug("started")
+
+	if err := eachFilterRule(r, func(filter singleFilterRule) error {
+		deleted, err := f.nftables.deleteRules(chain, filter.comment(logChain), 1)
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return fmt.Errorf("nft delete: no rule matching %s", strings.Join(filter.expression(logChain), " "))
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	logger.Debug("ending")
+	return nil
+}
+
+// NetOutExists reports whether all of the rules added by an Open call with the
+// same NetOutRule are in place
+func (f *FirewallOpener) NetOutExists(instance string, r garden.NetOutRule) (bool, error) {
+	listing, ok := f.nftables.listChain(f.nftables.instanceChain(instance))
+	logChain := f.nftables.logChain(instance)
+
+	exists := ok
+	err := eachFilterRule(r, func(filter singleFilterRule) error {
+		exists = exists && hasStatement(listing, comment(filter.comment(logChain))...)
+		return nil
+	})
+
+	return exists, err
+}
+
+func eachFilterRule(r garden.NetOutRule, apply func(filter singleFilterRule) error) error {
+	if len(r.Ports) > 0 && !allowsPort(r.Protocol) {
+		return fmt.Errorf("Ports cannot be specified for Protocol %s", strings.ToUpper(protocols[r.Protocol]))
+	}
+
+	filter := singleFilterRule{
+		Protocol: r.Protocol,
+		ICMPs:    r.ICMPs,
+		Log:      r.Log,
+	}
+
+	if _, ok := protocols[r.Protocol]; !ok {
+		return fmt.Errorf("invalid protocol: %d", r.Protocol)
+	}
+
+	// It should still loop once even if there are no networks or ports.
+	for j := 0; j < len(r.Networks) || j == 0; j++ {
+		for i := 0; i < len(r.Ports) || i == 0; i++ {
+
+			// Preserve nils unless there are ports specified
+			if len(r.Ports) > 0 {
+				filter.Ports = &r.Ports[i]
+			}
+
+			// Preserve nils unless there are networks specified
+			if len(r.Networks) > 0 {
+				filter.Networks = &r.Networks[j]
+			}
+
+			if err := apply(filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func allowsPort(p garden.Protocol) bool {
+	return p == garden.ProtocolTCP || p == garden.ProtocolUDP
+}
@@ -0,0 +1,175 @@
+package nftables_test
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("FirewallOpener", func() {
+	var (
+		fakeRunner *fake_command_runner.FakeCommandRunner
+		opener     *nftables.FirewallOpener
+		logger     lager.Logger
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeRunner = fake_command_runner.New()
+
+		opener = nftables.NewFirewallOpener(
+			nftables.New(fakeRunner, "prefix-"),
+		)
+	})
+
+	// openedRule returns the expression and comment of the single rule Open added
+	openedRule := func() []string {
+		Expect(fakeRunner.ExecutedCommands()).To(HaveLen(1))
+		args := fakeRunner.ExecutedCommands()[0].Args
+		Expect(args[1:6]).To(Equal([]string{"insert", "rule", "ip", "prefix-garden", "prefix-instance-foo-bar-baz"}))
+		return args[6:]
+	}
+
+	Describe("Open", func() {
+		Context("when all parameters are defaulted", func() {
+			It("returns all traffic", func() {
+				Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{})).To(Succeed())
+				Expect(openedRule()[:1]).To(Equal([]string{"return"}))
+			})
+		})
+
+		It("matches the protocol", func() {
+			Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{Protocol: garden.ProtocolUDP})).To(Succeed())
+			Expect(openedRule()[:4]).To(Equal([]string{"ip", "protocol", "udp", "return"}))
+		})
+
+		It("matches a range of destination IPs and ports", func() {
+			Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Networks: []garden.IPRange{{Start: net.ParseIP("1.2.3.4"), End: net.ParseIP("2.2.3.4")}},
+				Ports:    []garden.PortRange{{Start: 12, End: 24}},
+			})).To(Succeed())
+
+			Expect(openedRule()[:7]).To(Equal([]string{"ip", "daddr", "1.2.3.4-2.2.3.4", "tcp", "dport", "12-24", "return"}))
+		})
+
+		It("matches the icmp type and code", func() {
+			var code garden.ICMPCode = 3
+			Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{
+				Protocol: garden.ProtocolICMP,
+				ICMPs:    &garden.ICMPControl{Type: 8, Code: &code},
+			})).To(Succeed())
+
+			Expect(openedRule()[:7]).To(Equal([]string{"icmp", "type", "8", "icmp", "code", "3", "return"}))
+		})
+
+		It("goes to the log chain when logging is requested", func() {
+			Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{Log: true})).To(Succeed())
+			Expect(openedRule()[:2]).To(Equal([]string{"goto", "prefix-instance-foo-bar-baz-log"}))
+		})
+
+		It("tags the rule with a comment", func() {
+			Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{})).To(Succeed())
+			Expect(openedRule()[1]).To(Equal("comment"))
+		})
+
+		Context("when a portrange is specified for ProtocolALL", func() {
+			It("returns a nice error message", func() {
+				Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{
+					Protocol: garden.ProtocolAll,
+					Ports:    []garden.PortRange{{Start: 1, End: 5}},
+				})).To(MatchError("Ports cannot be specified for Protocol ALL"))
+			})
+		})
+
+		Context("when an invaild protocol is specified", func() {
+			It("returns an error", func() {
+				Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{
+					Protocol: garden.Protocol(52),
+				})).To(MatchError("invalid protocol: 52"))
+			})
+		})
+
+		Context("when the command returns an error", func() {
+			It("returns a wrapped error, including stderr", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{Path: "nft"},
+					func(cmd *exec.Cmd) error {
+						cmd.Stderr.Write([]byte("stderr contents"))
+						return errors.New("badly laid nftable")
+					},
+				)
+
+				Expect(opener.Open(logger, "foo-bar-baz", garden.NetOutRule{})).
+					To(MatchError("nft prepend: stderr contents"))
+			})
+		})
+	})
+
+	Describe("Close", func() {
+		It("deletes the rule added by Open", func() {
+			rule := garden.NetOutRule{Protocol: garden.ProtocolTCP}
+			Expect(opener.Open(logger, "foo-bar-baz", rule)).To(Succeed())
+			tag := openedRule()[len(openedRule())-1]
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-instance-foo-bar-baz"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("\t\tip protocol tcp return comment " + tag + " # handle 7\n"))
+				return nil
+			})
+
+			Expect(opener.Close(logger, "foo-bar-baz", rule)).To(Succeed())
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"delete", "rule", "ip", "prefix-garden", "prefix-instance-foo-bar-baz", "handle", "7"},
+			}))
+		})
+
+		Context("when the rule is not in the chain", func() {
+			It("returns an error", func() {
+				Expect(opener.Close(logger, "foo-bar-baz", garden.NetOutRule{Protocol: garden.ProtocolTCP})).
+					To(MatchError("nft delete: no rule matching ip protocol tcp return"))
+			})
+		})
+	})
+
+	Describe("NetOutExists", func() {
+		var listing string
+
+		BeforeEach(func() {
+			listing = ""
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"list", "chain", "ip", "prefix-garden", "prefix-instance-foo-bar-baz"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(listing))
+				return nil
+			})
+		})
+
+		It("returns true when the rule added by Open is in the chain", func() {
+			rule := garden.NetOutRule{Protocol: garden.ProtocolTCP}
+			Expect(opener.Open(logger, "foo-bar-baz", rule)).To(Succeed())
+			tag := openedRule()[len(openedRule())-1]
+
+			listing = "\t\tip protocol tcp return comment " + tag + "\n"
+			Expect(opener.NetOutExists("foo-bar-baz", rule)).To(BeTrue())
+		})
+
+		It("returns false when the rule is not in the chain", func() {
+			listing = "\t\tgoto prefix-default\n"
+			Expect(opener.NetOutExists("foo-bar-baz", garden.NetOutRule{Protocol: garden.ProtocolTCP})).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,164 @@
+package nftables
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+type Starter struct {
+	nftables        *NFTables
+	allowHostAccess bool
+	embeddedDNS     bool
+	nicPrefix       string
+
+	allowNetworks []string
+	denyNetworks  []string
+
+	defaultInterface func() (string, error)
+}
+
+func NewStarter(nftables *NFTables, allowHostAccess, embeddedDNS bool, nicPrefix string, allowNetworks, denyNetworks []string, defaultInterface func() (string, error)) *Starter {
+	return &Starter{
+		nftables:        nftables,
+		allowHostAccess: allowHostAccess,
+		embeddedDNS:     embeddedDNS,
+		nicPrefix:       nicPrefix,
+
+		allowNetworks: allowNetworks,
+		denyNetworks:  denyNetworks,
+
+		defaultInterface: defaultInterface,
+	}
+}
+
+// Start recreates the table and its global chains. The commands are applied
+// as a single transaction, so the host is never left with half of the
+// chains, e.g. forwarding container traffic into a chain which does not yet
+// drop it.
+func (s Starter) Start() error {
+	nft := s.nftables
+	interfaces := fmt.Sprintf("%q", s.nicPrefix+"*")
+
+	// Determine interface device to the outside
+	defaultInterface, err := s.defaultInterface()
+	if err != nil {
+		return fmt.Errorf("finding default interface: %s", err)
+	}
+
+	// Accept packets from the default interface if it is matched by the
+	// interface prefix, ahead of any other rule
+	var acceptDefaultInterface []string
+	if defaultInterface != "" {
+		acceptDefaultInterface = []string{"iifname", fmt.Sprintf("%q", defaultInterface), "accept"}
+	}
+
+	hostAccess := []string{"reject", "with", "icmp", "type", "host-prohibited"}
+	if s.allowHostAccess {
+		hostAccess = []string{"accept"}
+	}
+
+	commands := [][]string{
+		// Tear down everything left by a previous run, including instance
+		// chains. Adding the table first means the delete always succeeds.
+		{"add", "table", family, nft.table},
+		{"delete", "table", family, nft.table},
+		{"add", "table", family, nft.table},
+
+		// Filter inbound traffic from containers via the input chain
+		{"add", "chain", family, nft.table, "input", "{", "type", "filter", "hook", "input", "priority", "filter", ";", "policy", "accept", ";", "}"},
+		{"add", "chain", family, nft.table, nft.inputChain},
+	}
+
+	if acceptDefaultInterface != nil {
+		commands = append(commands, append([]string{"add", "rule", family, nft.table, nft.inputChain}, acceptDefaultInterface...))
+	}
+
+	commands = append(commands, []string{"add", "rule", family, nft.table, nft.inputChain, "ct", "state", "established,related", "accept"})
+
+	if s.embeddedDNS {
+		// Accept queries to the DNS responder on the containers' bridge IP even
+		// when host access is denied
+		for _, protocol := range []string{"udp", "tcp"} {
+			commands = append(commands, append([]string{"add", "rule", family, nft.table, nft.inputChain}, dnsRule(protocol)...))
+		}
+	}
+
+	commands = append(commands, [][]string{
+		append([]string{"add", "rule", family, nft.table, nft.inputChain}, hostAccess...),
+		{"add", "rule", family, nft.table, "input", "iifname", interfaces, "jump", nft.inputChain},
+
+		// Filter outbound traffic from containers via the forward chain; instance
+		// rules are inserted ahead of the drop
+		{"add", "chain", family, nft.table, "forward", "{", "type", "filter", "hook", "forward", "priority", "filter", ";", "policy", "accept", ";", "}"},
+		{"add", "chain", family, nft.table, nft.forwardChain},
+	}...)
+
+	if acceptDefaultInterface != nil {
+		// Forward inbound traffic immediately
+		commands = append(commands, append([]string{"add", "rule", family, nft.table, nft.forwardChain}, acceptDefaultInterface...))
+	}
+
+	commands = append(commands, [][]string{
+		{"add", "rule", family, nft.table, nft.forwardChain, "drop"},
+		{"add", "rule", family, nft.table, "forward", "iifname", interfaces, "jump", nft.forwardChain},
+
+		// Always allow established connections to containers
+		{"add", "chain", family, nft.table, nft.defaultChain},
+		{"add", "rule", family, nft.table, nft.defaultChain, "ct", "state", "established,related", "accept"},
+
+		// Bind prerouting chain to PREROUTING, and to OUTPUT for traffic
+		// originating from the same host
+		{"add", "chain", family, nft.table, "prerouting", "{", "type", "nat", "hook", "prerouting", "priority", "dstnat", ";", "}"},
+		{"add", "chain", family, nft.table, "output", "{", "type", "nat", "hook", "output", "priority", "dstnat", ";", "}"},
+		{"add", "chain", family, nft.table, nft.preroutingChain},
+		{"add", "rule", family, nft.table, "prerouting", "jump", nft.preroutingChain},
+		{"add", "rule", family, nft.table, "output", "oifname", `"lo"`, "jump", nft.preroutingChain},
+
+		// Bind postrouting chain to POSTROUTING
+		{"add", "chain", family, nft.table, "postrouting", "{", "type", "nat", "hook", "postrouting", "priority", "srcnat", ";", "}"},
+		{"add", "chain", family, nft.table, nft.postroutingChain},
+		{"add", "rule", family, nft.table, "postrouting", "jump", nft.postroutingChain},
+	}...)
+
+	// The default chain is recreated above, so the allow rules always end up
+	// ahead of the deny rules, even across restarts.
+	for _, n := range s.allowNetworks {
+		commands = append(commands, append([]string{"add", "rule", family, nft.table, nft.defaultChain}, allowRule(n)...))
+	}
+
+	for _, n := range s.denyNetworks {
+		commands = append(commands, append([]string{"add", "rule", family, nft.table, nft.defaultChain}, rejectRule(n)...))
+	}
+
+	if err := nft.runScript("setup-global-chains", commands); err != nil {
+		return fmt.Errorf("setting up default chains: %s", err)
+	}
+
+	if err := nft.runner.Run(exec.Command("sysctl", "-w", "net.ipv4.ip_forward=1")); err != nil {
+		return fmt.Errorf("enabling ip forwarding: %s", err)
+	}
+
+	return nil
+}
+
+// dnsRule accepts DNS queries to an address of the interface they arrived
+// on, i.e. to the bridge IP of the container which sent them
+func dnsRule(protocol string) []string {
+	return []string{protocol, "dport", "53", "fib", "daddr", ".", "iif", "type", "local", "accept"}
+}
+
+// GlobalChainsExist reports whether the global chains, and the rules binding
+// them to the hooked chains, are all in place
+func (s Starter) GlobalChainsExist() (bool, error) {
+	nft := s.nftables
+
+	if _, ok := nft.listChain(nft.defaultChain); !ok {
+		return false, nil
+	}
+
+	return nft.chainHas("input", "jump", nft.inputChain) &&
+		nft.chainHas("forward", "jump", nft.forwardChain) &&
+		nft.chainHas(nft.forwardChain, "drop") &&
+		nft.chainHas("prerouting", "jump", nft.preroutingChain) &&
+		nft.chainHas("postrouting", "jump", nft.postroutingChain), nil
+}
@@ -0,0 +1,261 @@
+package nftables_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Setup", func() {
+	var (
+		fakeRunner       *fake_command_runner.FakeCommandRunner
+		allowHostAccess  bool
+		embeddedDNS      bool
+		allowNetworks    []string
+		denyNetworks     []string
+		defaultInterface string
+		defaultIfaceErr  error
+		starter          *nftables.Starter
+		script           []string
+		scriptErr        error
+	)
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		allowHostAccess = false
+		embeddedDNS = false
+		allowNetworks = nil
+		denyNetworks = nil
+		defaultInterface = ""
+		defaultIfaceErr = nil
+
+		script = nil
+		scriptErr = nil
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "nft",
+			Args: []string{"-f", "-"},
+		}, func(cmd *exec.Cmd) error {
+			contents, err := ioutil.ReadAll(cmd.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+
+			script = strings.Split(strings.TrimSpace(string(contents)), "\n")
+			if scriptErr != nil {
+				cmd.Stderr.Write([]byte("no such file"))
+			}
+
+			return scriptErr
+		})
+	})
+
+	JustBeforeEach(func() {
+		starter = nftables.NewStarter(
+			nftables.New(fakeRunner, "prefix-"),
+			allowHostAccess,
+			embeddedDNS,
+			"w",
+			allowNetworks,
+			denyNetworks,
+			func() (string, error) { return defaultInterface, defaultIfaceErr },
+		)
+	})
+
+	It("applies the chains as a single transaction", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		nftCommands := 0
+		for _, cmd := range fakeRunner.ExecutedCommands() {
+			if cmd.Path == "nft" {
+				nftCommands++
+			}
+		}
+
+		Expect(nftCommands).To(Equal(1))
+	})
+
+	It("recreates the table", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		Expect(script[:3]).To(Equal([]string{
+			"add table ip prefix-garden",
+			"delete table ip prefix-garden",
+			"add table ip prefix-garden",
+		}))
+	})
+
+	It("sends container traffic through the input and forward chains", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		Expect(script).To(ContainElement("add rule ip prefix-garden prefix-input reject with icmp type host-prohibited"))
+		Expect(script).To(ContainElement(`add rule ip prefix-garden input iifname "w*" jump prefix-input`))
+		Expect(script).To(ContainElement(`add rule ip prefix-garden forward iifname "w*" jump prefix-forward`))
+	})
+
+	It("enables ip forwarding", func() {
+		Expect(starter.Start()).To(Succeed())
+
+		Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: "sysctl",
+			Args: []string{"-w", "net.ipv4.ip_forward=1"},
+		}))
+	})
+
+	Context("when the default interface is matched by the interface prefix", func() {
+		BeforeEach(func() {
+			defaultInterface = "w0"
+		})
+
+		It("accepts traffic from it ahead of the other input and forward rules", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			Expect(script).To(ContainElement(`add rule ip prefix-garden prefix-input iifname "w0" accept`))
+			Expect(script).To(ContainElement(`add rule ip prefix-garden prefix-forward iifname "w0" accept`))
+			Expect(indexOf(script, `add rule ip prefix-garden prefix-input iifname "w0" accept`)).To(BeNumerically("<", indexOf(script, "add rule ip prefix-garden prefix-input ct state established,related accept")))
+			Expect(indexOf(script, `add rule ip prefix-garden prefix-forward iifname "w0" accept`)).To(BeNumerically("<", indexOf(script, "add rule ip prefix-garden prefix-forward drop")))
+		})
+	})
+
+	Context("when the default interface is not matched by the interface prefix", func() {
+		It("does not accept traffic from any interface", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			for _, line := range script {
+				Expect(line).NotTo(MatchRegexp(`iifname "[^"]+" accept`))
+			}
+		})
+	})
+
+	Context("when the default interface cannot be determined", func() {
+		BeforeEach(func() {
+			defaultIfaceErr = errors.New("no routes")
+		})
+
+		It("returns an error without changing anything", func() {
+			Expect(starter.Start()).To(MatchError("finding default interface: no routes"))
+			Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Context("when allowHostAccess is true", func() {
+		BeforeEach(func() {
+			allowHostAccess = true
+		})
+
+		It("accepts traffic to the host", func() {
+			Expect(starter.Start()).To(Succeed())
+			Expect(script).To(ContainElement("add rule ip prefix-garden prefix-input accept"))
+		})
+	})
+
+	Context("when the embedded DNS responder is used", func() {
+		BeforeEach(func() {
+			embeddedDNS = true
+		})
+
+		It("accepts DNS queries to the bridge IP ahead of rejecting traffic to the host", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			established := indexOf(script, "add rule ip prefix-garden prefix-input ct state established,related accept")
+			udp := indexOf(script, "add rule ip prefix-garden prefix-input udp dport 53 fib daddr . iif type local accept")
+			tcp := indexOf(script, "add rule ip prefix-garden prefix-input tcp dport 53 fib daddr . iif type local accept")
+			reject := indexOf(script, "add rule ip prefix-garden prefix-input reject with icmp type host-prohibited")
+
+			Expect(established).To(BeNumerically(">=", 0))
+			Expect(udp).To(BeNumerically(">", established))
+			Expect(tcp).To(BeNumerically(">", udp))
+			Expect(reject).To(BeNumerically(">", tcp))
+		})
+	})
+
+	Context("when allowNetworks and denyNetworks are specified", func() {
+		BeforeEach(func() {
+			allowNetworks = []string{"10.0.1.0/24"}
+			denyNetworks = []string{"10.0.0.0/8"}
+		})
+
+		It("returns the allowed networks before rejecting the denied networks", func() {
+			Expect(starter.Start()).To(Succeed())
+
+			allow := indexOf(script, "add rule ip prefix-garden prefix-default ip daddr 10.0.1.0/24 return")
+			reject := indexOf(script, "add rule ip prefix-garden prefix-default ip daddr 10.0.0.0/8 reject")
+			Expect(allow).To(BeNumerically(">=", 0))
+			Expect(reject).To(BeNumerically(">", allow))
+		})
+	})
+
+	Context("when the transaction fails", func() {
+		BeforeEach(func() {
+			scriptErr = errors.New("exit status 1")
+		})
+
+		It("returns a wrapped error, including stderr", func() {
+			Expect(starter.Start()).To(MatchError("setting up default chains: nft setup-global-chains: no such file"))
+		})
+
+		It("does not enable ip forwarding", func() {
+			starter.Start()
+			Expect(fakeRunner).NotTo(HaveExecutedSerially(fake_command_runner.CommandSpec{Path: "sysctl"}))
+		})
+	})
+
+	Describe("GlobalChainsExist", func() {
+		var listings map[string]string
+
+		BeforeEach(func() {
+			listings = map[string]string{
+				"input":              "\t\tiifname \"w*\" jump prefix-input\n",
+				"forward":            "\t\tiifname \"w*\" jump prefix-forward\n",
+				"prefix-forward":     "\t\tdrop\n",
+				"prefix-default":     "\t\tct state established,related accept\n",
+				"prerouting":         "\t\tjump prefix-prerouting\n",
+				"postrouting":        "\t\tjump prefix-postrouting\n",
+				"prefix-prerouting":  "",
+				"prefix-postrouting": "",
+			}
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "nft"}, func(cmd *exec.Cmd) error {
+				listing, ok := listings[cmd.Args[len(cmd.Args)-1]]
+				if !ok {
+					return errors.New("No such file or directory")
+				}
+
+				cmd.Stdout.Write([]byte(listing))
+				return nil
+			})
+		})
+
+		It("returns true when the chains are set up and bound", func() {
+			Expect(starter.GlobalChainsExist()).To(BeTrue())
+		})
+
+		Context("when a hooked chain no longer jumps to its global chain", func() {
+			It("returns false", func() {
+				listings["forward"] = ""
+				Expect(starter.GlobalChainsExist()).To(BeFalse())
+			})
+		})
+
+		Context("when the table has been deleted", func() {
+			It("returns false", func() {
+				listings = map[string]string{}
+				Expect(starter.GlobalChainsExist()).To(BeFalse())
+			})
+		})
+	})
+})
+
+func indexOf(lines []string, line string) int {
+	for i, l := range lines {
+		if l == line {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,207 @@
+package nftables
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	LogMethodKernel = "kernel"
+	LogMethodNFLog  = "nflog"
+
+	nflogGroup = "1"
+)
+
+type InstanceChainCreator struct {
+	nftables    *NFTables
+	logMethod   string
+	embeddedDNS bool
+}
+
+func NewInstanceChainCreator(nftables *NFTables, logMethod string, embeddedDNS bool) *InstanceChainCreator {
+	return &InstanceChainCreator{
+		nftables:    nftables,
+		logMethod:   logMethod,
+		embeddedDNS: embeddedDNS,
+	}
+}
+
+func (cc *InstanceChainCreator) Create(logger lager.Logger, handle, instanceId, bridgeName string, ip net.IP, network *net.IPNet) error {
+	nft := cc.nftables
+	instanceChain := nft.instanceChain(instanceId)
+	logChain := nft.logChain(instanceId)
+	natChain := nft.natChain(instanceId)
+
+	// rules added to the shared chains are tagged with the instance id so
+	// that Destroy can find them
+	tag := comment(instanceId)
+
+	commands := [][]string{
+		// Create nat instance chain
+		{"add", "chain", family, nft.table, natChain},
+		// Bind nat instance chain to nat prerouting chain
+		append([]string{"add", "rule", family, nft.table, nft.preroutingChain, "jump", natChain}, tag...),
+		// Enable NAT for traffic coming from containers
+		append([]string{"add", "rule", family, nft.table, nft.postroutingChain,
+			"ip", "saddr", network.String(), "ip", "daddr", "!=", network.String(), "masquerade"}, tag...),
+
+		// Create log chain, used by NetOut rules which request logging
+		{"add", "chain", family, nft.table, logChain},
+		// Log new connections with the configured method
+		append([]string{"add", "rule", family, nft.table, logChain, "ct", "state", "new,untracked,invalid"}, cc.logStatement(handle)...),
+		// Then allow them through as a non-logging rule would
+		{"add", "rule", family, nft.table, logChain, "return"},
+
+		// Create filter instance chain
+		{"add", "chain", family, nft.table, instanceChain},
+		// Allow intra-subnet traffic (Linux ethernet bridging goes through ip stack)
+		{"add", "rule", family, nft.table, instanceChain, "ip", "saddr", network.String(), "ip", "daddr", network.String(), "accept"},
+		// Otherwise, use the default filter chain
+		{"add", "rule", family, nft.table, instanceChain, "goto", nft.defaultChain},
+		// Bind filter instance chain to filter forward chain
+		append([]string{"insert", "rule", family, nft.table, nft.forwardChain,
+			"iifname", fmt.Sprintf("%q", bridgeName), "ip", "saddr", ip.String(), "goto", instanceChain}, tag...),
+	}
+
+	for _, args := range commands {
+		if err := nft.run("create-instance-chains", args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Override applies a container's exceptions to the global firewall settings:
+// host access in the input chain, with a rule tagged so that Destroy can find
+// it, and deny networks in the instance chain, behind any NetOut rules.
+// Queries to the embedded DNS responder are still accepted when host access
+// is denied.
+func (cc *InstanceChainCreator) Override(logger lager.Logger, instanceId, bridgeName string, ip net.IP, overrides kawasaki.FirewallOverrides) error {
+	nft := cc.nftables
+
+	for _, network := range overrides.DenyNetworks {
+		if err := nft.prependRule(nft.instanceChain(instanceId), rejectRule(network)); err != nil {
+			return err
+		}
+	}
+
+	if overrides.HostAccess == nil {
+		return nil
+	}
+
+	// replies to connections from the host are still accepted when access is
+	// denied
+	hostAccess := []string{"ct", "state", "new,untracked,invalid", "reject", "with", "icmp", "type", "host-prohibited"}
+	if *overrides.HostAccess {
+		hostAccess = []string{"accept"}
+	}
+
+	source := []string{"iifname", fmt.Sprintf("%q", bridgeName), "ip", "saddr", ip.String()}
+	rule := append(append(source, hostAccess...), comment(instanceId)...)
+	if err := nft.prependRule(nft.inputChain, rule); err != nil {
+		return err
+	}
+
+	if *overrides.HostAccess || !cc.embeddedDNS {
+		return nil
+	}
+
+	for _, protocol := range []string{"udp", "tcp"} {
+		rule := append(append(append([]string{}, source...), dnsRule(protocol)...), comment(instanceId)...)
+		if err := nft.prependRule(nft.inputChain, rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cc *InstanceChainCreator) Destroy(logger lager.Logger, instanceId string) error {
+	nft := cc.nftables
+
+	// Unbind the instance's chains first, as chains cannot be deleted while
+	// they are still referenced. Like the chains themselves, the rules may
+	// already be gone, along with the whole table, which is not an error.
+	// Otherwise carry on tearing down what can be, and return the first error.
+	var firstErr error
+	for _, chain := range []string{nft.preroutingChain, nft.postroutingChain, nft.forwardChain, nft.inputChain} {
+		if _, err := nft.deleteRules(chain, instanceId, 0); err != nil && !notExist(err) {
+			logger.Error("unbind-instance-chains-failed", err, lager.Data{"chain": chain})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	for _, chain := range []string{nft.natChain(instanceId), nft.instanceChain(instanceId), nft.logChain(instanceId)} {
+		if err := nft.removeChain(chain); err != nil {
+			logger.Error("remove-instance-chain-failed", err, lager.Data{"chain": chain})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// InstanceChains returns the ids of the instances which have any chains in
+// the table
+func (cc *InstanceChainCreator) InstanceChains() ([]string, error) {
+	nft := cc.nftables
+
+	listing, err := nft.output("list", "list", "table", family, nft.table)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "chain" || !strings.HasPrefix(fields[1], nft.instanceChainPrefix) {
+			continue
+		}
+
+		instance := strings.TrimPrefix(fields[1], nft.instanceChainPrefix)
+		instance = strings.TrimSuffix(strings.TrimSuffix(instance, "-log"), "-nat")
+		if !seen[instance] {
+			seen[instance] = true
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// InstanceChainsIntact reports whether all of the chains and rules added by
+// Create for the instance are in place
+func (cc *InstanceChainCreator) InstanceChainsIntact(instanceId string) (bool, error) {
+	nft := cc.nftables
+	tag := comment(instanceId)
+
+	if _, ok := nft.listChain(nft.natChain(instanceId)); !ok {
+		return false, nil
+	}
+
+	return nft.chainHas(nft.preroutingChain, append([]string{"jump", nft.natChain(instanceId)}, tag...)...) &&
+		nft.chainHas(nft.postroutingChain, tag...) &&
+		nft.chainHas(nft.logChain(instanceId), "return") &&
+		nft.chainHas(nft.instanceChain(instanceId), "goto", nft.defaultChain) &&
+		nft.chainHas(nft.forwardChain, append([]string{"goto", nft.instanceChain(instanceId)}, tag...)...), nil
+}
+
+func (cc *InstanceChainCreator) logStatement(handle string) []string {
+	prefix := fmt.Sprintf("%q", handle+" ")
+
+	if cc.logMethod == LogMethodNFLog {
+		return []string{"log", "prefix", prefix, "group", nflogGroup}
+	}
+
+	return []string{"log", "prefix", prefix}
+}
@@ -0,0 +1,462 @@
+package nftables_test
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InstanceChainCreator", func() {
+	var (
+		fakeRunner *fake_command_runner.FakeCommandRunner
+		creator    *nftables.InstanceChainCreator
+		bridgeName string
+		ip         net.IP
+		network    *net.IPNet
+		logger     *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+
+		bridgeName = "some-bridge"
+		ip, network, err = net.ParseCIDR("1.2.3.4/28")
+		Expect(err).NotTo(HaveOccurred())
+
+		creator = nftables.NewInstanceChainCreator(
+			nftables.New(fakeRunner, "prefix-"),
+			nftables.LogMethodKernel,
+			false,
+		)
+	})
+
+	Describe("Create", func() {
+		It("should set up the chains", func() {
+			Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(Succeed())
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "chain", "ip", "prefix-garden", "prefix-instance-some-id-nat"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-prerouting",
+						"jump", "prefix-instance-some-id-nat", "comment", `"some-id"`},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-postrouting",
+						"ip", "saddr", "1.2.3.0/28", "ip", "daddr", "!=", "1.2.3.0/28", "masquerade", "comment", `"some-id"`},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "chain", "ip", "prefix-garden", "prefix-instance-some-id-log"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-instance-some-id-log",
+						"ct", "state", "new,untracked,invalid", "log", "prefix", `"some-handle "`},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-instance-some-id-log", "return"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "chain", "ip", "prefix-garden", "prefix-instance-some-id"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-instance-some-id",
+						"ip", "saddr", "1.2.3.0/28", "ip", "daddr", "1.2.3.0/28", "accept"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-instance-some-id", "goto", "prefix-default"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-forward",
+						"iifname", `"some-bridge"`, "ip", "saddr", "1.2.3.4", "goto", "prefix-instance-some-id", "comment", `"some-id"`},
+				},
+			))
+		})
+
+		Context("when the log method is nflog", func() {
+			BeforeEach(func() {
+				creator = nftables.NewInstanceChainCreator(
+					nftables.New(fakeRunner, "prefix-"),
+					nftables.LogMethodNFLog,
+					false,
+				)
+			})
+
+			It("logs to the nflog group", func() {
+				Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(Succeed())
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"add", "rule", "ip", "prefix-garden", "prefix-instance-some-id-log",
+						"ct", "state", "new,untracked,invalid", "log", "prefix", `"some-handle "`, "group", "1"},
+				}))
+			})
+		})
+
+		Context("when a command fails", func() {
+			It("returns a wrapped error, including stderr", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "nft"}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("nft failed"))
+					return errors.New("exit status 1")
+				})
+
+				Expect(creator.Create(logger, "some-handle", "some-id", bridgeName, ip, network)).To(MatchError("nft create-instance-chains: nft failed"))
+			})
+		})
+	})
+
+	Describe("Override", func() {
+		It("rejects the deny networks in the instance chain", func() {
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{
+				DenyNetworks: []string{"10.0.0.0/8"},
+			})).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-instance-some-id", "ip", "daddr", "10.0.0.0/8", "reject"},
+			}))
+		})
+
+		It("decides host access in the input chain, with a rule tagged with the instance id", func() {
+			deny := false
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &deny})).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-input",
+					"iifname", `"some-bridge"`, "ip", "saddr", "1.2.3.4",
+					"ct", "state", "new,untracked,invalid", "reject", "with", "icmp", "type", "host-prohibited", "comment", `"some-id"`},
+			}))
+		})
+
+		Context("when the embedded DNS responder is used", func() {
+			BeforeEach(func() {
+				creator = nftables.NewInstanceChainCreator(
+					nftables.New(fakeRunner, "prefix-"),
+					nftables.LogMethodKernel,
+					true,
+				)
+			})
+
+			It("accepts DNS queries to the bridge IP ahead of denying host access", func() {
+				deny := false
+				Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &deny})).To(Succeed())
+
+				Expect(fakeRunner).To(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "nft",
+						Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-input",
+							"iifname", `"some-bridge"`, "ip", "saddr", "1.2.3.4",
+							"ct", "state", "new,untracked,invalid", "reject", "with", "icmp", "type", "host-prohibited", "comment", `"some-id"`},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "nft",
+						Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-input",
+							"iifname", `"some-bridge"`, "ip", "saddr", "1.2.3.4",
+							"udp", "dport", "53", "fib", "daddr", ".", "iif", "type", "local", "accept", "comment", `"some-id"`},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "nft",
+						Args: []string{"insert", "rule", "ip", "prefix-garden", "prefix-input",
+							"iifname", `"some-bridge"`, "ip", "saddr", "1.2.3.4",
+							"tcp", "dport", "53", "fib", "daddr", ".", "iif", "type", "local", "accept", "comment", `"some-id"`},
+					},
+				))
+			})
+
+			It("adds nothing else when host access is allowed", func() {
+				allow := true
+				Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{HostAccess: &allow})).To(Succeed())
+				Expect(fakeRunner.ExecutedCommands()).To(HaveLen(1))
+			})
+		})
+
+		It("does nothing when there are no overrides", func() {
+			Expect(creator.Override(logger, "some-id", bridgeName, ip, kawasaki.FirewallOverrides{})).To(Succeed())
+			Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("Destroy", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-forward"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`table ip prefix-garden {
+	chain prefix-forward { # handle 4
+		iifname "some-bridge" ip saddr 1.2.3.5 goto prefix-instance-other-id comment "other-id" # handle 20
+		iifname "some-bridge" ip saddr 1.2.3.4 goto prefix-instance-some-id comment "some-id" # handle 21
+		drop # handle 9
+	}
+}
+`))
+				return nil
+			})
+		})
+
+		It("unbinds the instance's chains", func() {
+			Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-forward"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "rule", "ip", "prefix-garden", "prefix-forward", "handle", "21"},
+				},
+			))
+
+			for _, cmd := range fakeRunner.ExecutedCommands() {
+				Expect(cmd.Args).NotTo(ContainElement("20"))
+			}
+		})
+
+		It("removes the instance's host access override", func() {
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-input"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(`table ip prefix-garden {
+	chain prefix-input { # handle 2
+		iifname "some-bridge" ip saddr 1.2.3.4 accept comment "some-id" # handle 30
+		ct state established,related accept # handle 5
+	}
+}
+`))
+				return nil
+			})
+
+			Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"delete", "rule", "ip", "prefix-garden", "prefix-input", "handle", "30"},
+			}))
+		})
+
+		It("flushes and deletes the instance's chains", func() {
+			Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"flush", "chain", "ip", "prefix-garden", "prefix-instance-some-id-nat"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id-nat"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"flush", "chain", "ip", "prefix-garden", "prefix-instance-some-id"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"flush", "chain", "ip", "prefix-garden", "prefix-instance-some-id-log"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id-log"},
+				},
+			))
+		})
+
+		Context("when the chains have already been deleted", func() {
+			It("succeeds", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Error: No such file or directory"))
+					return errors.New("exit status 1")
+				})
+
+				Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+			})
+		})
+
+		Context("when the table has already been deleted", func() {
+			It("succeeds", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-prerouting"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Error: No such file or directory; did you mean table 'prefix-garden' in family ip?"))
+					return errors.New("exit status 1")
+				})
+
+				Expect(creator.Destroy(logger, "some-id")).To(Succeed())
+			})
+		})
+
+		Context("when listing a chain fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-prerouting"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Operation not permitted"))
+					return errors.New("exit status 1")
+				})
+			})
+
+			It("returns the error", func() {
+				Expect(creator.Destroy(logger, "some-id")).To(MatchError("nft list: Operation not permitted"))
+			})
+
+			It("logs the error", func() {
+				creator.Destroy(logger, "some-id")
+				Expect(errorLogs(logger)).To(ContainElement("test.unbind-instance-chains-failed"))
+			})
+
+			It("still deletes the instance's chains", func() {
+				creator.Destroy(logger, "some-id")
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id"},
+				}))
+			})
+		})
+
+		Context("when deleting a chain fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id-nat"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("Device or resource busy"))
+					return errors.New("exit status 1")
+				})
+			})
+
+			It("returns the error", func() {
+				Expect(creator.Destroy(logger, "some-id")).To(MatchError("nft delete-chain: Device or resource busy"))
+			})
+
+			It("logs the error", func() {
+				creator.Destroy(logger, "some-id")
+				Expect(errorLogs(logger)).To(ContainElement("test.remove-instance-chain-failed"))
+			})
+
+			It("still deletes the instance's other chains", func() {
+				creator.Destroy(logger, "some-id")
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "chain", "ip", "prefix-garden", "prefix-instance-some-id-log"},
+				}))
+			})
+		})
+	})
+
+	Describe("inspecting the instance chains", func() {
+		var listings map[string]string
+
+		BeforeEach(func() {
+			listings = map[string]string{
+				"prefix-garden": `table ip prefix-garden {
+	chain prefix-forward {
+	}
+
+	chain prefix-instance-some-id-nat {
+	}
+
+	chain prefix-instance-some-id-log {
+	}
+
+	chain prefix-instance-some-id {
+	}
+
+	chain prefix-instance-other-id-log {
+	}
+}
+`,
+				"prefix-prerouting":           "\t\tjump prefix-instance-some-id-nat comment \"some-id\"\n",
+				"prefix-postrouting":          "\t\tip saddr 1.2.3.0/28 ip daddr != 1.2.3.0/28 masquerade comment \"some-id\"\n",
+				"prefix-instance-some-id-nat": "",
+				"prefix-instance-some-id-log": "\t\tct state new,untracked,invalid log prefix \"some-handle \"\n\t\treturn\n",
+				"prefix-instance-some-id":     "\t\tip saddr 1.2.3.0/28 ip daddr 1.2.3.0/28 accept\n\t\tgoto prefix-default\n",
+				"prefix-forward":              "\t\tiifname \"some-bridge\" ip saddr 1.2.3.4 goto prefix-instance-some-id comment \"some-id\"\n\t\tdrop\n",
+			}
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "nft"}, func(cmd *exec.Cmd) error {
+				listing, ok := listings[cmd.Args[len(cmd.Args)-1]]
+				if !ok {
+					return errors.New("No such file or directory")
+				}
+
+				cmd.Stdout.Write([]byte(listing))
+				return nil
+			})
+		})
+
+		Describe("InstanceChains", func() {
+			It("returns the id of each instance with a chain in the table", func() {
+				Expect(creator.InstanceChains()).To(Equal([]string{"some-id", "other-id"}))
+			})
+
+			It("lists the table", func() {
+				creator.InstanceChains()
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"list", "table", "ip", "prefix-garden"},
+				}))
+			})
+		})
+
+		Describe("InstanceChainsIntact", func() {
+			It("returns true when all of the instance's chains and rules exist", func() {
+				Expect(creator.InstanceChainsIntact("some-id")).To(BeTrue())
+			})
+
+			It("returns false when the instance has no chains", func() {
+				Expect(creator.InstanceChainsIntact("other-id")).To(BeFalse())
+			})
+
+			Context("when the forward chain no longer binds the instance chain", func() {
+				It("returns false", func() {
+					listings["prefix-forward"] = "\t\tdrop\n"
+					Expect(creator.InstanceChainsIntact("some-id")).To(BeFalse())
+				})
+			})
+		})
+	})
+})
+
+func errorLogs(logger *lagertest.TestLogger) []string {
+	var messages []string
+	for _, log := range logger.TestSink.Logs() {
+		if log.LogLevel == lager.ERROR {
+			messages = append(messages, log.Message)
+		}
+	}
+
+	return messages
+}
@@ -0,0 +1,275 @@
+package nftables
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// all of kawasaki's chains live in a single table of this family, so tearing
+// the table down removes every rule garden has added
+const family = "ip"
+
+var protocols = map[garden.Protocol]string{
+	garden.ProtocolAll:  "all",
+	garden.ProtocolTCP:  "tcp",
+	garden.ProtocolICMP: "icmp",
+	garden.ProtocolUDP:  "udp",
+}
+
+var handlePattern = regexp.MustCompile(`# handle (\d+)$`)
+
+type NFTables struct {
+	runner                                                                                         command_runner.CommandRunner
+	table                                                                                          string
+	preroutingChain, postroutingChain, inputChain, forwardChain, defaultChain, instanceChainPrefix string
+}
+
+func New(runner command_runner.CommandRunner, chainPrefix string) *NFTables {
+	return &NFTables{
+		runner: runner,
+		table:  chainPrefix + "garden",
+
+		preroutingChain:     chainPrefix + "prerouting",
+		postroutingChain:    chainPrefix + "postrouting",
+		inputChain:          chainPrefix + "input",
+		forwardChain:        chainPrefix + "forward",
+		defaultChain:        chainPrefix + "default",
+		instanceChainPrefix: chainPrefix + "instance-",
+	}
+}
+
+func (nft *NFTables) run(action string, args ...string) error {
+	_, err := nft.output(action, args...)
+	return err
+}
+
+func (nft *NFTables) output(action string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("nft", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := nft.runner.Run(cmd); err != nil {
+		return "", fmt.Errorf("nft %s: %s", action, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// runScript applies the commands, one per line, as a single transaction, so
+// that either all of them take effect or none do
+func (nft *NFTables) runScript(action string, commands [][]string) error {
+	var script bytes.Buffer
+	for _, args := range commands {
+		fmt.Fprintln(&script, strings.Join(args, " "))
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = &script
+	cmd.Stderr = &stderr
+
+	if err := nft.runner.Run(cmd); err != nil {
+		return fmt.Errorf("nft %s: %s", action, stderr.String())
+	}
+
+	return nil
+}
+
+// notExist reports whether nft failed because the table, chain or rule it was
+// given does not exist
+func notExist(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "no such file or directory")
+}
+
+func (nft *NFTables) instanceChain(instanceId string) string {
+	return nft.instanceChainPrefix + instanceId
+}
+
+func (nft *NFTables) logChain(instanceId string) string {
+	return nft.instanceChain(instanceId) + "-log"
+}
+
+// nat statements may only be used in chains reached from a nat hook, so each
+// instance gets a separate chain for its port forwarding rules
+func (nft *NFTables) natChain(instanceId string) string {
+	return nft.instanceChain(instanceId) + "-nat"
+}
+
+// removeChain flushes and deletes a chain, ignoring chains which are already
+// gone so that destroying an instance is idempotent
+func (nft *NFTables) removeChain(chain string) error {
+	if err := nft.run("flush-chain", "flush", "chain", family, nft.table, chain); err != nil {
+		if notExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if err := nft.run("delete-chain", "delete", "chain", family, nft.table, chain); err != nil && !notExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (nft *NFTables) appendRule(chain string, rule []string) error {
+	return nft.run("append", append([]string{"add", "rule", family, nft.table, chain}, rule...)...)
+}
+
+func (nft *NFTables) prependRule(chain string, rule []string) error {
+	return nft.run("prepend", append([]string{"insert", "rule", family, nft.table, chain}, rule...)...)
+}
+
+// deleteRules deletes the rules in the chain which carry the given comment.
+// nftables can only delete rules by handle, so rules which need to be deleted
+// individually are tagged with a comment when they are added.
+func (nft *NFTables) deleteRules(chain, comment string, limit int) (int, error) {
+	listing, err := nft.output("list", "--handle", "list", "chain", family, nft.table, chain)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, line := range strings.Split(listing, "\n") {
+		if limit > 0 && deleted == limit {
+			break
+		}
+
+		if !strings.Contains(line, fmt.Sprintf("comment %q", comment)) {
+			continue
+		}
+
+		match := handlePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		if err := nft.run("delete", "delete", "rule", family, nft.table, chain, "handle", match[1]); err != nil {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// listChain returns the chain as listed by nft, and whether it could be
+// listed at all
+func (nft *NFTables) listChain(chain string) (string, bool) {
+	listing, err := nft.output("list", "list", "chain", family, nft.table, chain)
+	return listing, err == nil
+}
+
+// hasStatement reports whether any rule in a listing contains the given
+// sequence of words, e.g. "jump" followed by a chain
+func hasStatement(listing string, words ...string) bool {
+	statement := strings.Join(words, " ")
+
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+len(words) <= len(fields); i++ {
+			if strings.Join(fields[i:i+len(words)], " ") == statement {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// chainHas lists the chain and reports whether it contains the statement
+func (nft *NFTables) chainHas(chain string, words ...string) bool {
+	listing, ok := nft.listChain(chain)
+	return ok && hasStatement(listing, words...)
+}
+
+func comment(text string) []string {
+	return []string{"comment", fmt.Sprintf("%q", text)}
+}
+
+func natRule(protocol, destination string, destinationPort uint32, containerIP string, containerPort uint32) []string {
+	rule := []string{
+		"ip", "daddr", destination,
+		protocol, "dport", fmt.Sprintf("%d", destinationPort),
+		"dnat", "to", fmt.Sprintf("%s:%d", containerIP, containerPort),
+	}
+
+	return append(rule, comment(natComment(protocol, destinationPort))...)
+}
+
+func natComment(protocol string, destinationPort uint32) string {
+	return fmt.Sprintf("%s-%d", protocol, destinationPort)
+}
+
+func allowRule(destination string) []string {
+	return []string{"ip", "daddr", destination, "return"}
+}
+
+func rejectRule(destination string) []string {
+	return []string{"ip", "daddr", destination, "reject"}
+}
+
+type singleFilterRule struct {
+	Protocol garden.Protocol
+	Networks *garden.IPRange
+	Ports    *garden.PortRange
+	ICMPs    *garden.ICMPControl
+	Log      bool
+}
+
+func (r singleFilterRule) expression(logChain string) (params []string) {
+	protocolString := protocols[r.Protocol]
+
+	network := r.Networks
+	if network != nil {
+		if network.Start != nil && network.End != nil {
+			params = append(params, "ip", "daddr", network.Start.String()+"-"+network.End.String())
+		} else if network.Start != nil {
+			params = append(params, "ip", "daddr", network.Start.String())
+		} else if network.End != nil {
+			params = append(params, "ip", "daddr", network.End.String())
+		}
+	}
+
+	ports := r.Ports
+	if ports != nil {
+		if ports.End != ports.Start {
+			params = append(params, protocolString, "dport", fmt.Sprintf("%d-%d", ports.Start, ports.End))
+		} else {
+			params = append(params, protocolString, "dport", fmt.Sprintf("%d", ports.Start))
+		}
+	} else if r.Protocol != garden.ProtocolAll && r.ICMPs == nil {
+		params = append(params, "ip", "protocol", protocolString)
+	}
+
+	if r.ICMPs != nil {
+		params = append(params, "icmp", "type", fmt.Sprintf("%d", r.ICMPs.Type))
+		if r.ICMPs.Code != nil {
+			params = append(params, "icmp", "code", fmt.Sprintf("%d", *r.ICMPs.Code))
+		}
+	}
+
+	if r.Log {
+		params = append(params, "goto", logChain)
+	} else {
+		params = append(params, "return")
+	}
+
+	return params
+}
+
+// comment identifies the rule so that it can later be deleted. The expression
+// is hashed as comments are limited to 128 characters.
+func (r singleFilterRule) comment(logChain string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(r.expression(logChain), " "))))
+}
@@ -0,0 +1,13 @@
+package nftables_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNftables(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NFTables Suite")
+}
@@ -0,0 +1,24 @@
+package nftables
+
+import (
+	"errors"
+	"net"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// ErrPolicyGroupsUnsupported is returned when a container joins a policy
+// group, which relies on ipsets, under the nftables backend
+var ErrPolicyGroupsUnsupported = errors.New("policy groups require the 'iptables' firewall backend")
+
+// PolicyGroups rejects containers joining policy groups
+type PolicyGroups struct{}
+
+func (PolicyGroups) Join(logger lager.Logger, instanceId, group string, ip net.IP, network *net.IPNet) error {
+	return ErrPolicyGroupsUnsupported
+}
+
+// Leave succeeds, as no container can have joined a group
+func (PolicyGroups) Leave(logger lager.Logger, group string, ip net.IP) error {
+	return nil
+}
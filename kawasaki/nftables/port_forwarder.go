@@ -0,0 +1,81 @@
+package nftables
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+)
+
+type PortForwarder struct {
+	nftables *NFTables
+}
+
+func NewPortForwarder(nftables *NFTables) *PortForwarder {
+	return &PortForwarder{
+		nftables: nftables,
+	}
+}
+
+func (p *PortForwarder) Forward(spec kawasaki.PortForwarderSpec) error {
+	for i := uint32(0); i < portCount(spec); i++ {
+		if err := p.nftables.appendRule(
+			p.nftables.natChain(spec.InstanceID),
+			natRule(
+				protocols[spec.Protocol],
+				spec.ExternalIP.String(),
+				spec.FromPort+i,
+				spec.ContainerIP.String(),
+				spec.ToPort+i,
+			),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unforward removes the rules added by a Forward call with the same spec
+func (p *PortForwarder) Unforward(spec kawasaki.PortForwarderSpec) error {
+	for i := uint32(0); i < portCount(spec); i++ {
+		deleted, err := p.nftables.deleteRules(
+			p.nftables.natChain(spec.InstanceID),
+			natComment(protocols[spec.Protocol], spec.FromPort+i),
+			1,
+		)
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return fmt.Errorf("nft delete: no %s rule forwarding port %d", protocols[spec.Protocol], spec.FromPort+i)
+		}
+	}
+
+	return nil
+}
+
+// PortForwardExists reports whether all of the rules added by a Forward call
+// with the same spec are in place
+func (p *PortForwarder) PortForwardExists(spec kawasaki.PortForwarderSpec) (bool, error) {
+	listing, ok := p.nftables.listChain(p.nftables.natChain(spec.InstanceID))
+	if !ok {
+		return false, nil
+	}
+
+	for i := uint32(0); i < portCount(spec); i++ {
+		if !hasStatement(listing, comment(natComment(protocols[spec.Protocol], spec.FromPort+i))...) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func portCount(spec kawasaki.PortForwarderSpec) uint32 {
+	if spec.PortCount == 0 {
+		return 1
+	}
+
+	return spec.PortCount
+}
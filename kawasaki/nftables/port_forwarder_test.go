@@ -0,0 +1,151 @@
+package nftables_test
+
+import (
+	"net"
+	"os/exec"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/nftables"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PortForwarder", func() {
+	var (
+		fakeRunner *fake_command_runner.FakeCommandRunner
+		forwarder  *nftables.PortForwarder
+		spec       kawasaki.PortForwarderSpec
+	)
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		forwarder = nftables.NewPortForwarder(
+			nftables.New(fakeRunner, "prefix-"),
+		)
+
+		spec = kawasaki.PortForwarderSpec{
+			InstanceID:  "some-instance",
+			Protocol:    garden.ProtocolTCP,
+			ExternalIP:  net.ParseIP("5.6.7.8"),
+			ContainerIP: net.ParseIP("1.2.3.4"),
+			FromPort:    22,
+			ToPort:      33,
+		}
+	})
+
+	Describe("Forward", func() {
+		It("adds a DNAT rule to the instance's nat chain", func() {
+			Expect(forwarder.Forward(spec)).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{
+						"add", "rule", "ip", "prefix-garden", "prefix-instance-some-instance-nat",
+						"ip", "daddr", "5.6.7.8",
+						"tcp", "dport", "22",
+						"dnat", "to", "1.2.3.4:33",
+						"comment", `"tcp-22"`,
+					},
+				},
+			))
+		})
+
+		It("forwards each port in a range", func() {
+			spec.Protocol = garden.ProtocolUDP
+			spec.PortCount = 2
+			Expect(forwarder.Forward(spec)).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{
+						"add", "rule", "ip", "prefix-garden", "prefix-instance-some-instance-nat",
+						"ip", "daddr", "5.6.7.8",
+						"udp", "dport", "22",
+						"dnat", "to", "1.2.3.4:33",
+						"comment", `"udp-22"`,
+					},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{
+						"add", "rule", "ip", "prefix-garden", "prefix-instance-some-instance-nat",
+						"ip", "daddr", "5.6.7.8",
+						"udp", "dport", "23",
+						"dnat", "to", "1.2.3.4:34",
+						"comment", `"udp-23"`,
+					},
+				},
+			))
+		})
+	})
+
+	Describe("Unforward", func() {
+		var listing string
+
+		BeforeEach(func() {
+			listing = `table ip prefix-garden {
+	chain prefix-instance-some-instance-nat { # handle 30
+		ip daddr 5.6.7.8 udp dport 22 dnat to 1.2.3.4:33 comment "udp-22" # handle 31
+		ip daddr 5.6.7.8 tcp dport 22 dnat to 1.2.3.4:33 comment "tcp-22" # handle 32
+	}
+}
+`
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"--handle", "list", "chain", "ip", "prefix-garden", "prefix-instance-some-instance-nat"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(listing))
+				return nil
+			})
+		})
+
+		It("deletes the DNAT rule for the port", func() {
+			Expect(forwarder.Unforward(spec)).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "nft",
+					Args: []string{"delete", "rule", "ip", "prefix-garden", "prefix-instance-some-instance-nat", "handle", "32"},
+				},
+			))
+		})
+
+		Context("when there is no rule for the port", func() {
+			It("returns an error", func() {
+				spec.FromPort = 23
+				Expect(forwarder.Unforward(spec)).To(MatchError("nft delete: no tcp rule forwarding port 23"))
+			})
+		})
+	})
+
+	Describe("PortForwardExists", func() {
+		var listing string
+
+		BeforeEach(func() {
+			listing = "\t\tip daddr 5.6.7.8 tcp dport 22 dnat to 1.2.3.4:33 comment \"tcp-22\"\n"
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "nft",
+				Args: []string{"list", "chain", "ip", "prefix-garden", "prefix-instance-some-instance-nat"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(listing))
+				return nil
+			})
+		})
+
+		It("returns true when the DNAT rule is in the instance's nat chain", func() {
+			Expect(forwarder.PortForwardExists(spec)).To(BeTrue())
+		})
+
+		It("returns false when any of the ports is missing", func() {
+			spec.PortCount = 2
+			Expect(forwarder.PortForwardExists(spec)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package kawasaki
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// PolicyGroupProperty is the container property naming the policy group the
+// container belongs to. Members of a group may reach the other members of
+// the group on their subnet, and the members of any group a network policy
+// allows them to, but no other containers on it. Likewise they may only be
+// reached on their subnet by the members of those groups which may reach
+// them, and not by containers in no group.
+const PolicyGroupProperty = "network.policy-group"
+
+// MaxPolicyGroupLen leaves room for the chain prefix in the names of the
+// ipsets kawasaki keeps for each group, which are limited to 31 characters
+const MaxPolicyGroupLen = 24
+
+var validPolicyGroup = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+//go:generate counterfeiter . PolicyGroupEnforcer
+
+// PolicyGroupEnforcer restricts the intra-subnet traffic of the members of
+// policy groups. Join is called once the member's instance chains exist.
+type PolicyGroupEnforcer interface {
+	Join(logger lager.Logger, instanceChain, group string, ip net.IP, network *net.IPNet) error
+	Leave(logger lager.Logger, group string, ip net.IP) error
+}
+
+// NetworkPolicies maps a policy group to the other groups its members may
+// open connections to. It is a flag.Value, with each policy given in the
+// form <from-group>:<to-group>.
+type NetworkPolicies map[string][]string
+
+func (p NetworkPolicies) String() string {
+	var policies []string
+	for from, tos := range p {
+		for _, to := range tos {
+			policies = append(policies, from+":"+to)
+		}
+	}
+
+	sort.Strings(policies)
+	return strings.Join(policies, ", ")
+}
+
+func (p NetworkPolicies) Set(policy string) error {
+	parts := strings.Split(policy, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("network policy %s is not of the form <from-group>:<to-group>", policy)
+	}
+
+	for _, group := range parts {
+		if err := ValidatePolicyGroup(group); err != nil {
+			return fmt.Errorf("network policy %s: %s", policy, err)
+		}
+	}
+
+	p[parts[0]] = append(p[parts[0]], parts[1])
+	return nil
+}
+
+func ValidatePolicyGroup(group string) error {
+	if !validPolicyGroup.MatchString(group) {
+		return fmt.Errorf("policy group '%s' must only contain letters, digits, '_', '.' and '-'", group)
+	}
+
+	if len(group) > MaxPolicyGroupLen {
+		return fmt.Errorf("policy group '%s' is longer than %d characters", group, MaxPolicyGroupLen)
+	}
+
+	return nil
+}
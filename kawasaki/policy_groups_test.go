@@ -0,0 +1,45 @@
+package kawasaki_test
+
+import (
+	"strings"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NetworkPolicies", func() {
+	var policies kawasaki.NetworkPolicies
+
+	BeforeEach(func() {
+		policies = kawasaki.NetworkPolicies{}
+	})
+
+	It("records each policy against the group it is from", func() {
+		Expect(policies.Set("tenant-a:shared")).To(Succeed())
+		Expect(policies.Set("tenant-a:tenant-b")).To(Succeed())
+		Expect(policies.Set("tenant-b:shared")).To(Succeed())
+
+		Expect(policies).To(Equal(kawasaki.NetworkPolicies{
+			"tenant-a": {"shared", "tenant-b"},
+			"tenant-b": {"shared"},
+		}))
+		Expect(policies.String()).To(Equal("tenant-a:shared, tenant-a:tenant-b, tenant-b:shared"))
+	})
+
+	It("rejects a policy which is not from one group to another", func() {
+		Expect(policies.Set("tenant-a")).To(MatchError("network policy tenant-a is not of the form <from-group>:<to-group>"))
+		Expect(policies.Set("tenant-a:tenant-b:shared")).To(HaveOccurred())
+	})
+
+	It("rejects a policy naming an invalid group", func() {
+		Expect(policies.Set("tenant-a:")).To(MatchError("network policy tenant-a:: policy group '' must only contain letters, digits, '_', '.' and '-'"))
+	})
+
+	It("rejects groups too long to name their ipsets after", func() {
+		group := strings.Repeat("a", kawasaki.MaxPolicyGroupLen+1)
+		Expect(kawasaki.ValidatePolicyGroup(group)).To(MatchError(ContainSubstring("is longer than 24 characters")))
+		Expect(kawasaki.ValidatePolicyGroup(group[1:])).To(Succeed())
+	})
+})
@@ -0,0 +1,106 @@
+package ports
+
+import "sync"
+
+// PersistentPool is a PortPool which saves its state each time a port is
+// acquired or released, so that a daemon which is restarted, even after a
+// crash, does not hand out ports which are still mapped.
+type PersistentPool struct {
+	*PortPool
+
+	stateFilePath string
+	mutex         sync.Mutex
+}
+
+func NewPersistentPool(pool *PortPool, stateFilePath string) *PersistentPool {
+	return &PersistentPool{
+		PortPool:      pool,
+		stateFilePath: stateFilePath,
+	}
+}
+
+// Acquire acquires a port, returning it to the pool if the state cannot be
+// saved
+func (p *PersistentPool) Acquire() (uint32, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	port, err := p.PortPool.Acquire()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := p.save(); err != nil {
+		p.PortPool.Release(port)
+		return 0, err
+	}
+
+	return port, nil
+}
+
+// AcquireRange acquires a range of ports, returning them to the pool if the
+// state cannot be saved
+func (p *PersistentPool) AcquireRange(size uint32) (uint32, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	first, err := p.PortPool.AcquireRange(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := p.save(); err != nil {
+		if size == 0 {
+			size = 1
+		}
+
+		for port := first; port < first+size; port++ {
+			p.PortPool.Release(port)
+		}
+
+		return 0, err
+	}
+
+	return first, nil
+}
+
+// Remove acquires a specific port, returning it to the pool if the state
+// cannot be saved
+func (p *PersistentPool) Remove(port uint32) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.PortPool.Remove(port); err != nil {
+		return err
+	}
+
+	if err := p.save(); err != nil {
+		p.PortPool.Release(port)
+		return err
+	}
+
+	return nil
+}
+
+// Release releases a port. If the state cannot be saved the port is still
+// recorded as acquired, which only keeps it from being handed out after a
+// restart.
+func (p *PersistentPool) Release(port uint32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.PortPool.Release(port)
+	p.save()
+}
+
+// Save saves the pool's state
+func (p *PersistentPool) Save() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.save()
+}
+
+func (p *PersistentPool) save() error {
+	return SaveState(p.stateFilePath, p.PortPool.RefreshState())
+}
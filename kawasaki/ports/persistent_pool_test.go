@@ -0,0 +1,88 @@
+package ports_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/ports"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PersistentPool", func() {
+	var (
+		tmpDir        string
+		stateFilePath string
+		pool          *ports.PersistentPool
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+		stateFilePath = filepath.Join(tmpDir, "port_pool.json")
+
+		portPool, err := ports.NewPool(10000, 5, ports.State{})
+		Expect(err).NotTo(HaveOccurred())
+		pool = ports.NewPersistentPool(portPool, stateFilePath)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	savedState := func() ports.State {
+		state, err := ports.LoadState(stateFilePath)
+		Expect(err).NotTo(HaveOccurred())
+		return state
+	}
+
+	It("saves the state when a port is acquired", func() {
+		_, err := pool.Acquire()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(savedState().Acquired).To(Equal([]uint32{10000}))
+	})
+
+	It("saves the state when a range is acquired", func() {
+		_, err := pool.AcquireRange(2)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(savedState().Acquired).To(Equal([]uint32{10000, 10001}))
+	})
+
+	It("saves the state when a port is removed", func() {
+		Expect(pool.Remove(10003)).To(Succeed())
+
+		Expect(savedState().Acquired).To(Equal([]uint32{10003}))
+	})
+
+	It("saves the state when a port is released", func() {
+		_, err := pool.AcquireRange(2)
+		Expect(err).NotTo(HaveOccurred())
+		pool.Release(10000)
+
+		Expect(savedState().Acquired).To(Equal([]uint32{10001}))
+	})
+
+	Context("when the state cannot be saved", func() {
+		BeforeEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("returns an error and does not keep the port acquired", func() {
+			_, err := pool.Acquire()
+			Expect(err).To(MatchError(ContainSubstring("creating state file")))
+
+			Expect(pool.RefreshState().Acquired).To(BeEmpty())
+		})
+
+		It("returns an error and does not keep the range acquired", func() {
+			_, err := pool.AcquireRange(3)
+			Expect(err).To(MatchError(ContainSubstring("creating state file")))
+
+			Expect(pool.RefreshState().Acquired).To(BeEmpty())
+		})
+	})
+})
@@ -50,6 +50,21 @@ func NewPool(start, size uint32, state State) (*PortPool, error) {
 		i += 1
 	}
 
+	// ports which were still acquired when the state was saved may still be
+	// mapped, so are not handed out again until they are released
+	acquired := make(map[uint32]bool, len(state.Acquired))
+	for _, port := range state.Acquired {
+		acquired[port] = true
+	}
+
+	free := pool[:0]
+	for _, port := range pool {
+		if !acquired[port] {
+			free = append(free, port)
+		}
+	}
+	pool = free
+
 	return &PortPool{
 		start: start,
 		size:  size,
@@ -73,6 +88,56 @@ func (p *PortPool) Acquire() (uint32, error) {
 	return port, nil
 }
 
+// AcquireRange acquires size contiguous ports from the pool and returns the
+// first of them.
+func (p *PortPool) AcquireRange(size uint32) (uint32, error) {
+	if size == 0 {
+		size = 1
+	}
+
+	// no range larger than the pool can be free, and bounding the size keeps
+	// the sums below from overflowing
+	if size > p.size {
+		return 0, PoolExhaustedError{}
+	}
+
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	free := make(map[uint32]bool, len(p.pool))
+	for _, port := range p.pool {
+		free[port] = true
+	}
+
+	for _, first := range p.pool {
+		if first+size > p.start+p.size || !allFree(free, first, size) {
+			continue
+		}
+
+		remaining := make([]uint32, 0, len(p.pool)-int(size))
+		for _, port := range p.pool {
+			if port < first || port >= first+size {
+				remaining = append(remaining, port)
+			}
+		}
+		p.pool = remaining
+
+		return first, nil
+	}
+
+	return 0, PoolExhaustedError{}
+}
+
+func allFree(free map[uint32]bool, first, size uint32) bool {
+	for port := first; port < first+size; port++ {
+		if !free[port] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (p *PortPool) Remove(port uint32) error {
 	idx := 0
 	found := false
@@ -114,11 +179,30 @@ func (p *PortPool) Release(port uint32) {
 	p.pool = append(p.pool, port)
 }
 
+// RefreshState returns the pool's state, from which NewPool recreates a pool
+// which hands out ports in the same order, apart from any released ports,
+// and which does not hand out ports which are still acquired
 func (p *PortPool) RefreshState() State {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
 	if len(p.pool) == 0 {
 		p.state.Offset = 0
 	} else {
 		p.state.Offset = p.pool[0] - p.start
 	}
+
+	free := make(map[uint32]bool, len(p.pool))
+	for _, port := range p.pool {
+		free[port] = true
+	}
+
+	p.state.Acquired = nil
+	for port := p.start; port < p.start+p.size; port++ {
+		if !free[port] {
+			p.state.Acquired = append(p.state.Acquired, port)
+		}
+	}
+
 	return p.state
 }
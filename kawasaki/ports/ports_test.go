@@ -80,6 +80,25 @@ var _ = Describe("Port pool", func() {
 				})
 			})
 
+			It("does not acquire ports which the state records as acquired", func() {
+				initialState.Offset = 1
+				initialState.Acquired = []uint32{10000, 10002}
+
+				pool, err := ports.NewPool(10000, 4, initialState)
+				Expect(err).ToNot(HaveOccurred())
+
+				var acquired []uint32
+				for i := 0; i < 2; i++ {
+					port, err := pool.Acquire()
+					Expect(err).ToNot(HaveOccurred())
+					acquired = append(acquired, port)
+				}
+				Expect(acquired).To(Equal([]uint32{10001, 10003}))
+
+				_, err = pool.Acquire()
+				Expect(err).To(Equal(ports.PoolExhaustedError{}))
+			})
+
 			It("acquired already used ports", func() {
 				startPort := uint32(10000)
 				portOffset := uint32(4)
@@ -101,6 +120,54 @@ var _ = Describe("Port pool", func() {
 		})
 	})
 
+	Describe("acquiring a range", func() {
+		It("returns the first port of a contiguous range", func() {
+			pool, err := ports.NewPool(10000, 5, initialState)
+			Expect(err).ToNot(HaveOccurred())
+
+			first, err := pool.AcquireRange(3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).To(Equal(uint32(10000)))
+
+			next, err := pool.Acquire()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(next).To(Equal(uint32(10003)))
+		})
+
+		It("skips ranges which are not entirely free", func() {
+			pool, err := ports.NewPool(10000, 5, initialState)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(pool.Remove(10001)).To(Succeed())
+
+			first, err := pool.AcquireRange(3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).To(Equal(uint32(10002)))
+		})
+
+		Context("when the range is larger than the pool", func() {
+			It("returns a PoolExhaustedError", func() {
+				pool, err := ports.NewPool(10000, 5, initialState)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = pool.AcquireRange(4294967295)
+				Expect(err).To(Equal(ports.PoolExhaustedError{}))
+			})
+		})
+
+		Context("when no contiguous range of that size is free", func() {
+			It("returns a PoolExhaustedError", func() {
+				pool, err := ports.NewPool(10000, 5, initialState)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(pool.Remove(10002)).To(Succeed())
+
+				_, err = pool.AcquireRange(3)
+				Expect(err).To(Equal(ports.PoolExhaustedError{}))
+			})
+		})
+	})
+
 	Describe("removing", func() {
 		It("acquires a specific port from the pool", func() {
 			pool, err := ports.NewPool(10000, 2, initialState)
@@ -201,6 +268,40 @@ var _ = Describe("Port pool", func() {
 			Expect(newState.Offset).To(BeNumerically("==", 1))
 		})
 
+		It("records the ports which are acquired", func() {
+			pool, err := ports.NewPool(10000, 5, initialState)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = pool.AcquireRange(3)
+			Expect(err).NotTo(HaveOccurred())
+			pool.Release(10001)
+
+			Expect(pool.RefreshState().Acquired).To(Equal([]uint32{10000, 10002}))
+		})
+
+		It("restores a pool which does not hand out the acquired ports", func() {
+			pool, err := ports.NewPool(10000, 3, initialState)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = pool.AcquireRange(2)
+			Expect(err).NotTo(HaveOccurred())
+			pool.Release(10000)
+
+			restored, err := ports.NewPool(10000, 3, pool.RefreshState())
+			Expect(err).ToNot(HaveOccurred())
+
+			var acquired []uint32
+			for i := 0; i < 2; i++ {
+				port, err := restored.Acquire()
+				Expect(err).ToNot(HaveOccurred())
+				acquired = append(acquired, port)
+			}
+			Expect(acquired).To(ConsistOf(uint32(10000), uint32(10002)))
+
+			_, err = restored.Acquire()
+			Expect(err).To(Equal(ports.PoolExhaustedError{}))
+		})
+
 		Context("when port pool is exhausted", func() {
 			It("returns the state reset to offset 0", func() {
 				pool, err := ports.NewPool(10000, 1, initialState)
@@ -7,7 +7,11 @@ import (
 )
 
 type State struct {
+	// Offset from the start of the range of the next port to hand out
 	Offset uint32 `json:"offset"`
+
+	// Acquired are the ports which have been acquired and not yet released
+	Acquired []uint32 `json:"acquired,omitempty"`
 }
 
 func LoadState(filePath string) (State, error) {
@@ -25,13 +29,24 @@ func LoadState(filePath string) (State, error) {
 	return state, nil
 }
 
+// SaveState writes the state to a temporary file which then replaces the
+// state file, so that a crash part way through leaves the previous state
+// rather than a truncated one
 func SaveState(filePath string, state State) error {
-	stateFile, err := os.Create(filePath)
+	tmpFilePath := filePath + ".tmp"
+	stateFile, err := os.Create(tmpFilePath)
 	if err != nil {
 		return fmt.Errorf("creating state file: %s", err)
 	}
 	defer stateFile.Close()
 
-	json.NewEncoder(stateFile).Encode(state)
+	if err := json.NewEncoder(stateFile).Encode(state); err != nil {
+		return fmt.Errorf("writing state file: %s", err)
+	}
+
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		return fmt.Errorf("replacing state file: %s", err)
+	}
+
 	return nil
 }
@@ -40,6 +40,18 @@ var _ = Describe("State", func() {
 			Expect(portPoolState.Offset).To(BeNumerically("==", 10))
 		})
 
+		It("should parse the acquired ports", func() {
+			Expect(ioutil.WriteFile(filePath, []byte(`{
+				"offset": 10,
+				"acquired": [60000, 60002]
+			}`), 0660)).To(Succeed())
+
+			portPoolState, err := ports.LoadState(filePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(portPoolState.Acquired).To(Equal([]uint32{60000, 60002}))
+		})
+
 		Context("when the file does not exist", func() {
 			It("should return a wrapped error", func() {
 				_, err := ports.LoadState("/path/to/not/existing/banana")
@@ -73,6 +85,12 @@ var _ = Describe("State", func() {
 			Expect(string(contents)).To(ContainSubstring("\"offset\":10"))
 		})
 
+		It("should not leave a temporary file behind", func() {
+			Expect(ports.SaveState(filePath, ports.State{Offset: 10})).To(Succeed())
+
+			Expect(filePath + ".tmp").NotTo(BeAnExistingFile())
+		})
+
 		Context("when file can not be created", func() {
 			It("should return a sensible error", func() {
 				state := ports.State{
@@ -0,0 +1,389 @@
+package kawasaki
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/pivotal-golang/clock"
+	"github.com/pivotal-golang/lager"
+)
+
+// FirewallInspector reports whether the rules kawasaki manages are present in
+// the live firewall
+type FirewallInspector interface {
+	GlobalChainsExist() (bool, error)
+	InstanceChains() ([]string, error)
+	InstanceChainsIntact(instanceID string) (bool, error)
+	PortForwardExists(spec PortForwarderSpec) (bool, error)
+	NetOutExists(instance string, rule garden.NetOutRule) (bool, error)
+}
+
+//go:generate counterfeiter . ContainerLister
+
+// ContainerLister lists the containers whose firewall rules are reconciled,
+// and reports whether each is still running
+type ContainerLister interface {
+	Handles() ([]string, error)
+	Info(log lager.Logger, handle string) (gardener.ActualContainerSpec, error)
+}
+
+// Reconciler periodically compares the firewall rules recorded in the config
+// store against the live firewall, re-applying anything which has gone missing
+// and removing the chains of containers which no longer exist. The rules of
+// stopped containers are left alone, as their network has been torn down by
+// the poststop hook. The port forwards of containers sharing another
+// container's network are in their peer's instance chain, so they are
+// reconciled along with it.
+//
+// Drift is only repaired once it has been seen on two consecutive passes, so
+// that rules which are in the middle of being created or destroyed are left
+// alone.
+type Reconciler struct {
+	Interval time.Duration
+	Logger   lager.Logger
+	Clock    clock.Clock
+
+	containers  ContainerLister
+	configStore ConfigStore
+	firewall    Firewall
+
+	suspects map[string]bool
+	stopped  chan struct{}
+}
+
+func NewReconciler(
+	logger lager.Logger,
+	containers ContainerLister,
+	configStore ConfigStore,
+	firewall Firewall,
+	interval time.Duration,
+	clock clock.Clock,
+) *Reconciler {
+	return &Reconciler{
+		Interval: interval,
+		Logger:   logger,
+		Clock:    clock,
+
+		containers:  containers,
+		configStore: configStore,
+		firewall:    firewall,
+
+		suspects: map[string]bool{},
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (r *Reconciler) Start() {
+	logger := r.Logger.Session("firewall-reconciler", lager.Data{"interval": r.Interval.String()})
+	logger.Info("starting")
+	ticker := r.Clock.NewTicker(r.Interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		logger.Info("started")
+		defer logger.Info("finished")
+
+		for {
+			select {
+			case <-ticker.C():
+				if err := r.Reconcile(logger); err != nil {
+					logger.Error("reconcile-failed", err)
+				}
+			case <-r.stopped:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) Stop() {
+	close(r.stopped)
+}
+
+// Reconcile performs a single pass over the firewall. It is not safe to call
+// concurrently with itself.
+func (r *Reconciler) Reconcile(log lager.Logger) error {
+	log = log.Session("reconcile")
+
+	pass := &reconcilePass{
+		log:      log,
+		previous: r.suspects,
+		current:  map[string]bool{},
+	}
+	defer func() { r.suspects = pass.current }()
+
+	restarted, err := r.reconcileGlobalChains(pass)
+	if err != nil {
+		return err
+	}
+
+	handles, err := r.containers.Handles()
+	if err != nil {
+		return fmt.Errorf("listing handles: %s", err)
+	}
+
+	live, err := r.firewall.InstanceChains()
+	if err != nil {
+		return fmt.Errorf("listing instance chains: %s", err)
+	}
+
+	liveInstances := map[string]bool{}
+	for _, instance := range live {
+		liveInstances[instance] = true
+	}
+
+	sharers := map[string][]string{}
+	for _, handle := range handles {
+		if peer, err := r.configStore.Get(handle, networkPeerKey); err == nil && peer != "" {
+			sharers[peer] = append(sharers[peer], handle)
+		}
+	}
+
+	knownInstances := map[string]bool{}
+	for _, handle := range handles {
+		cfg, err := load(r.configStore, handle)
+		if err != nil {
+			// containers without a kawasaki network (e.g. those networked by a
+			// plugin) have no config to reconcile against
+			continue
+		}
+
+		// a container's additional attachments have instance chains of their
+		// own, but its NetIn and NetOut rules are only in its first attachment's
+		attachments := loadAttachments(log, r.configStore, handle)
+
+		// the chains of a stopped container are torn down when it is
+		// destroyed, so they are neither recreated nor orphaned
+		knownInstances[cfg.IPTableInstance] = true
+		for _, attachment := range attachments {
+			knownInstances[attachment.Config.IPTableInstance] = true
+		}
+
+		if !r.running(log, handle) {
+			continue
+		}
+
+		if err := r.reconcileInstance(pass, cfg, sharers[handle], liveInstances[cfg.IPTableInstance], restarted); err != nil {
+			log.Error("reconcile-instance-failed", err, lager.Data{"handle": handle})
+		}
+
+		for _, attachment := range attachments {
+			instance := attachment.Config.IPTableInstance
+			if _, _, err := r.reconcileChains(pass, attachment.Config, liveInstances[instance], restarted); err != nil {
+				log.Error("reconcile-attachment-failed", err, lager.Data{"handle": handle, "instance": instance})
+			}
+		}
+	}
+
+	for _, instance := range live {
+		if knownInstances[instance] {
+			continue
+		}
+
+		if !pass.drift("orphaned-instance-chain", "orphan:"+instance, lager.Data{"instance": instance}) {
+			continue
+		}
+
+		if err := r.firewall.Destroy(log, instance); err != nil {
+			log.Error("destroy-orphan-failed", err, lager.Data{"instance": instance})
+		}
+	}
+
+	return nil
+}
+
+// running reports whether the container is running, treating a container
+// whose state cannot be determined as stopped so that its rules are not
+// recreated
+func (r *Reconciler) running(log lager.Logger, handle string) bool {
+	info, err := r.containers.Info(log, handle)
+	if err != nil {
+		log.Error("container-info-failed", err, lager.Data{"handle": handle})
+		return false
+	}
+
+	return !info.Stopped
+}
+
+func (r *Reconciler) reconcileGlobalChains(pass *reconcilePass) (bool, error) {
+	exist, err := r.firewall.GlobalChainsExist()
+	if err != nil {
+		return false, fmt.Errorf("inspecting global chains: %s", err)
+	}
+
+	if exist || !pass.drift("global-chains-missing", "global", nil) {
+		return false, nil
+	}
+
+	if err := r.firewall.Start(); err != nil {
+		return false, err
+	}
+
+	// setting up the global chains tears down every instance chain, so they
+	// all need recreating regardless of what was there before
+	return true, nil
+}
+
+func (r *Reconciler) reconcileInstance(pass *reconcilePass, cfg NetworkConfig, sharers []string, live, restarted bool) error {
+	handle := cfg.ContainerHandle
+	instance := cfg.IPTableInstance
+
+	recreate, present, err := r.reconcileChains(pass, cfg, live, restarted)
+	if err != nil || !present {
+		return err
+	}
+
+	// the sharers' forwards are to the peer's container IP, and are lost with
+	// the peer's chain if it is recreated
+	specs := forwardSpecs(pass.log, r.configStore, handle, cfg)
+	for _, sharer := range sharers {
+		if r.running(pass.log, sharer) {
+			specs = append(specs, forwardSpecs(pass.log, r.configStore, sharer, cfg)...)
+		}
+	}
+
+	for _, spec := range specs {
+		if !recreate {
+			exists, err := r.firewall.PortForwardExists(spec)
+			if err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("forward:%s:%d:%d", instance, spec.Protocol, spec.FromPort)
+			if exists || !pass.drift("port-forward-missing", key, lager.Data{"handle": handle, "hostPort": spec.FromPort}) {
+				continue
+			}
+		}
+
+		if err := r.firewall.Forward(spec); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range netOutEntries(pass.log, r.configStore, handle) {
+		if !recreate {
+			exists, err := r.firewall.NetOutExists(instance, entry.Rule)
+			if err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("netout:%s:%d", instance, entry.ID)
+			if exists || !pass.drift("net-out-rule-missing", key, lager.Data{"handle": handle, "id": entry.ID}) {
+				continue
+			}
+		}
+
+		if err := r.firewall.Open(pass.log, instance, entry.Rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileChains recreates an instance's chains if they are missing or
+// damaged, returning whether they were recreated (and so whether all of their
+// rules need re-applying) and whether they are now in place
+func (r *Reconciler) reconcileChains(pass *reconcilePass, cfg NetworkConfig, live, restarted bool) (bool, bool, error) {
+	handle := cfg.ContainerHandle
+	instance := cfg.IPTableInstance
+	data := lager.Data{"handle": handle, "instance": instance}
+
+	recreate := restarted
+	if !recreate {
+		intact := false
+		if live {
+			var err error
+			if intact, err = r.firewall.InstanceChainsIntact(instance); err != nil {
+				return false, false, err
+			}
+		}
+
+		if !intact && !pass.drift("instance-chains-missing", "instance:"+instance, data) {
+			return false, false, nil
+		}
+
+		recreate = !intact
+	}
+
+	if recreate {
+		if err := r.firewall.Destroy(pass.log, instance); err != nil {
+			return false, false, err
+		}
+
+		if err := r.firewall.Create(pass.log, handle, instance, cfg.BridgeName, cfg.ContainerIP, cfg.Subnet); err != nil {
+			return false, false, err
+		}
+
+		if cfg.PolicyGroup != "" {
+			if err := r.firewall.Join(pass.log, instance, cfg.PolicyGroup, cfg.ContainerIP, cfg.Subnet); err != nil {
+				return false, false, err
+			}
+		}
+
+		if !cfg.Overrides.empty() {
+			if err := r.firewall.Override(pass.log, instance, cfg.BridgeName, cfg.ContainerIP, cfg.Overrides); err != nil {
+				return false, false, err
+			}
+		}
+	}
+
+	return recreate, true, nil
+}
+
+// forwardSpecs returns the port forwards of the container's port mappings
+// into the network given by cfg, which is its peer's if it shares one
+func forwardSpecs(log lager.Logger, configStore ConfigStore, handle string, cfg NetworkConfig) []PortForwarderSpec {
+	var specs []PortForwarderSpec
+	for _, mapping := range portMappings(log, configStore, handle) {
+		protocol, ok := netInProtocol(mapping.Protocol)
+		if !ok {
+			continue
+		}
+
+		specs = append(specs, PortForwarderSpec{
+			InstanceID:  cfg.IPTableInstance,
+			Protocol:    protocol,
+			FromPort:    mapping.HostPort,
+			ToPort:      mapping.ContainerPort,
+			PortCount:   1,
+			ContainerIP: cfg.ContainerIP,
+			ExternalIP:  cfg.ExternalIP,
+		})
+	}
+
+	return specs
+}
+
+func netInProtocol(name string) (garden.Protocol, bool) {
+	for protocol, protocolName := range netInProtocols {
+		if protocolName == name {
+			return protocol, true
+		}
+	}
+
+	return 0, false
+}
+
+type reconcilePass struct {
+	log      lager.Logger
+	previous map[string]bool
+	current  map[string]bool
+}
+
+// drift logs a difference between the expected and live firewall and
+// returns whether it was also seen on the previous pass
+func (p *reconcilePass) drift(message, key string, data lager.Data) bool {
+	if data == nil {
+		data = lager.Data{}
+	}
+
+	data["repairing"] = p.previous[key]
+	p.log.Info(message, data)
+
+	p.current[key] = true
+	return p.previous[key]
+}
@@ -0,0 +1,485 @@
+package kawasaki_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/clock/fakeclock"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Reconciler", func() {
+	var (
+		fakeContainers  *fakes.FakeContainerLister
+		fakeConfigStore *fakes.FakeConfigStore
+		fakeFirewall    *fakes.FakeFirewall
+		fakeClock       *fakeclock.FakeClock
+		logger          *lagertest.TestLogger
+		config          map[string]map[string]string
+		reconciler      *kawasaki.Reconciler
+	)
+
+	containerConfig := func(instance, ip string) map[string]string {
+		return map[string]string{
+			"kawasaki.host-interface":      "host-" + instance,
+			"kawasaki.container-interface": "container-" + instance,
+			"kawasaki.bridge-interface":    "bridge",
+			gardener.BridgeIPKey:           "10.0.0.1",
+			gardener.ContainerIPKey:        ip,
+			"kawasaki.subnet":              "10.0.0.0/24",
+			"kawasaki.iptable-prefix":      "w-",
+			"kawasaki.iptable-inst":        instance,
+			"kawasaki.mtu":                 "1500",
+			gardener.ExternalIPKey:         "1.2.3.4",
+			"kawasaki.dns-servers":         "",
+		}
+	}
+
+	BeforeEach(func() {
+		fakeContainers = new(fakes.FakeContainerLister)
+		fakeConfigStore = new(fakes.FakeConfigStore)
+		fakeFirewall = new(fakes.FakeFirewall)
+		fakeClock = fakeclock.NewFakeClock(time.Unix(123, 456))
+		logger = lagertest.NewTestLogger("test")
+
+		config = map[string]map[string]string{
+			"some-handle": containerConfig("instance-1", "10.0.0.2"),
+		}
+		config["some-handle"][gardener.MappedPortsKey] = `[{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"}]`
+		netOutRules, err := json.Marshal([]gardener.NetOutEntry{
+			{ID: 3, Rule: garden.NetOutRule{Protocol: garden.ProtocolTCP}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		config["some-handle"]["kawasaki.net-out-rules"] = string(netOutRules)
+
+		fakeContainers.HandlesReturns([]string{"some-handle", "plugin-handle"}, nil)
+		fakeConfigStore.GetStub = func(handle, key string) (string, error) {
+			if v, ok := config[handle][key]; ok {
+				return v, nil
+			}
+
+			return "", fmt.Errorf("no key %s", key)
+		}
+
+		fakeFirewall.GlobalChainsExistReturns(true, nil)
+		fakeFirewall.InstanceChainsReturns([]string{"instance-1"}, nil)
+		fakeFirewall.InstanceChainsIntactReturns(true, nil)
+		fakeFirewall.PortForwardExistsReturns(true, nil)
+		fakeFirewall.NetOutExistsReturns(true, nil)
+
+		reconciler = kawasaki.NewReconciler(logger, fakeContainers, fakeConfigStore, fakeFirewall, time.Minute, fakeClock)
+	})
+
+	reconcileTwice := func() {
+		Expect(reconciler.Reconcile(logger)).To(Succeed())
+		Expect(reconciler.Reconcile(logger)).To(Succeed())
+	}
+
+	Context("when the firewall matches the config store", func() {
+		It("does not change anything", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.StartCallCount()).To(Equal(0))
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(0))
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(0))
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+			Expect(fakeFirewall.OpenCallCount()).To(Equal(0))
+		})
+
+		It("checks the container's port forwards and net out rules", func() {
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+
+			Expect(fakeFirewall.InstanceChainsIntactArgsForCall(0)).To(Equal("instance-1"))
+			Expect(fakeFirewall.PortForwardExistsArgsForCall(0)).To(Equal(kawasaki.PortForwarderSpec{
+				InstanceID:  "instance-1",
+				Protocol:    garden.ProtocolTCP,
+				FromPort:    60000,
+				ToPort:      8080,
+				PortCount:   1,
+				ContainerIP: net.ParseIP("10.0.0.2"),
+				ExternalIP:  net.ParseIP("1.2.3.4"),
+			}))
+
+			instance, rule := fakeFirewall.NetOutExistsArgsForCall(0)
+			Expect(instance).To(Equal("instance-1"))
+			Expect(rule).To(Equal(garden.NetOutRule{Protocol: garden.ProtocolTCP}))
+		})
+	})
+
+	Context("when a port forward is missing", func() {
+		BeforeEach(func() {
+			fakeFirewall.PortForwardExistsReturns(false, nil)
+		})
+
+		It("logs the drift without repairing it on the first pass", func() {
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("port-forward-missing"))
+		})
+
+		It("re-applies it when it is still missing on the next pass", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(1))
+			Expect(fakeFirewall.ForwardArgsForCall(0).FromPort).To(Equal(uint32(60000)))
+		})
+
+		It("does not re-apply it when it reappears before the next pass", func() {
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+			fakeFirewall.PortForwardExistsReturns(true, nil)
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a net out rule is missing", func() {
+		BeforeEach(func() {
+			fakeFirewall.NetOutExistsReturns(false, nil)
+		})
+
+		It("re-opens it", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.OpenCallCount()).To(Equal(1))
+			_, instance, rule := fakeFirewall.OpenArgsForCall(0)
+			Expect(instance).To(Equal("instance-1"))
+			Expect(rule).To(Equal(garden.NetOutRule{Protocol: garden.ProtocolTCP}))
+		})
+	})
+
+	Context("when a container's instance chains are missing", func() {
+		BeforeEach(func() {
+			fakeFirewall.InstanceChainsReturns([]string{}, nil)
+		})
+
+		It("recreates them along with all of the container's rules", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+			_, handle, instance, bridge, ip, subnet := fakeFirewall.CreateArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+			Expect(instance).To(Equal("instance-1"))
+			Expect(bridge).To(Equal("bridge"))
+			Expect(ip).To(Equal(net.ParseIP("10.0.0.2")))
+			Expect(subnet.String()).To(Equal("10.0.0.0/24"))
+
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(1))
+			Expect(fakeFirewall.OpenCallCount()).To(Equal(1))
+		})
+
+		It("does not inspect the individual rules", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.PortForwardExistsCallCount()).To(Equal(0))
+			Expect(fakeFirewall.NetOutExistsCallCount()).To(Equal(0))
+		})
+
+		It("does not join a policy group when the container is not in one", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.JoinCallCount()).To(Equal(0))
+		})
+
+		Context("when the container has firewall overrides", func() {
+			BeforeEach(func() {
+				config["some-handle"]["kawasaki.firewall-overrides"] = `{"HostAccess":true,"DenyNetworks":["10.1.0.0/16"]}`
+			})
+
+			It("re-applies them once the chains are recreated", func() {
+				reconcileTwice()
+
+				Expect(fakeFirewall.OverrideCallCount()).To(Equal(1))
+				_, instance, bridge, ip, overrides := fakeFirewall.OverrideArgsForCall(0)
+				Expect(instance).To(Equal("instance-1"))
+				Expect(bridge).To(Equal("bridge"))
+				Expect(ip).To(Equal(net.ParseIP("10.0.0.2")))
+				Expect(*overrides.HostAccess).To(BeTrue())
+				Expect(overrides.DenyNetworks).To(Equal([]string{"10.1.0.0/16"}))
+			})
+		})
+
+		Context("when the container is in a policy group", func() {
+			BeforeEach(func() {
+				config["some-handle"]["kawasaki.policy-group"] = "tenant-a"
+			})
+
+			It("rejoins the group once the chains are recreated", func() {
+				fakeFirewall.JoinStub = func(lager.Logger, string, string, net.IP, *net.IPNet) error {
+					Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+					return nil
+				}
+
+				reconcileTwice()
+
+				Expect(fakeFirewall.JoinCallCount()).To(Equal(1))
+				_, instance, group, ip, subnet := fakeFirewall.JoinArgsForCall(0)
+				Expect(instance).To(Equal("instance-1"))
+				Expect(group).To(Equal("tenant-a"))
+				Expect(ip).To(Equal(net.ParseIP("10.0.0.2")))
+				Expect(subnet.String()).To(Equal("10.0.0.0/24"))
+			})
+		})
+	})
+
+	Context("when a container's instance chains are damaged", func() {
+		BeforeEach(func() {
+			fakeFirewall.InstanceChainsIntactReturns(false, nil)
+		})
+
+		It("destroys and recreates them", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(1))
+			_, instance := fakeFirewall.DestroyArgsForCall(0)
+			Expect(instance).To(Equal("instance-1"))
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when recreating the instance chains fails", func() {
+		BeforeEach(func() {
+			fakeFirewall.InstanceChainsReturns([]string{}, nil)
+			fakeFirewall.CreateReturns(errors.New("boom"))
+		})
+
+		It("logs the error and does not re-apply the container's rules", func() {
+			reconcileTwice()
+
+			Expect(logger).To(gbytes.Say("reconcile-instance-failed"))
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the global chains are missing", func() {
+		BeforeEach(func() {
+			fakeFirewall.GlobalChainsExistReturns(false, nil)
+		})
+
+		It("sets them up again and recreates every container's chains", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.StartCallCount()).To(Equal(1))
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(1))
+			Expect(fakeFirewall.OpenCallCount()).To(Equal(1))
+		})
+
+		Context("and setting them up fails", func() {
+			It("returns the error", func() {
+				fakeFirewall.StartReturns(errors.New("banana"))
+
+				Expect(reconciler.Reconcile(logger)).To(Succeed())
+				Expect(reconciler.Reconcile(logger)).To(MatchError("banana"))
+			})
+		})
+	})
+
+	Context("when there are chains for an instance with no container", func() {
+		BeforeEach(func() {
+			fakeFirewall.InstanceChainsReturns([]string{"instance-1", "instance-2"}, nil)
+		})
+
+		It("destroys them", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(1))
+			_, instance := fakeFirewall.DestroyArgsForCall(0)
+			Expect(instance).To(Equal("instance-2"))
+		})
+	})
+
+	Context("when a container has additional attachments", func() {
+		BeforeEach(func() {
+			config["some-handle"]["kawasaki.attachments"] = `[{"Config":{"IPTableInstance":"instance-3","BridgeName":"bridge-3","ContainerIP":"10.1.0.2","Subnet":{"IP":"10.1.0.0","Mask":"////AA=="}}}]`
+		})
+
+		It("does not treat their chains as orphaned", func() {
+			fakeFirewall.InstanceChainsReturns([]string{"instance-1", "instance-3"}, nil)
+
+			reconcileTwice()
+
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(0))
+		})
+
+		Context("when an attachment's chains are missing", func() {
+			It("recreates them without re-applying the container's rules", func() {
+				reconcileTwice()
+
+				Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+				_, handle, instance, bridge, ip, subnet := fakeFirewall.CreateArgsForCall(0)
+				Expect(handle).To(Equal("some-handle"))
+				Expect(instance).To(Equal("instance-3"))
+				Expect(bridge).To(Equal("bridge-3"))
+				Expect(ip).To(Equal(net.ParseIP("10.1.0.2")))
+				Expect(subnet.String()).To(Equal("10.1.0.0/24"))
+
+				Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+				Expect(fakeFirewall.OpenCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when a container shares the network of another", func() {
+		BeforeEach(func() {
+			config["sidecar"] = map[string]string{
+				"kawasaki.network-peer": "some-handle",
+				gardener.ContainerIPKey: "10.0.0.2",
+				gardener.MappedPortsKey: `[{"HostPort":60001,"ContainerPort":9090,"Protocol":"udp"}]`,
+			}
+			fakeContainers.HandlesReturns([]string{"some-handle", "sidecar"}, nil)
+		})
+
+		It("checks the sharer's port forwards in its peer's chain", func() {
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+
+			Expect(fakeFirewall.PortForwardExistsCallCount()).To(Equal(2))
+			Expect(fakeFirewall.PortForwardExistsArgsForCall(1)).To(Equal(kawasaki.PortForwarderSpec{
+				InstanceID:  "instance-1",
+				Protocol:    garden.ProtocolUDP,
+				FromPort:    60001,
+				ToPort:      9090,
+				PortCount:   1,
+				ContainerIP: net.ParseIP("10.0.0.2"),
+				ExternalIP:  net.ParseIP("1.2.3.4"),
+			}))
+		})
+
+		Context("when the peer's chains are recreated", func() {
+			BeforeEach(func() {
+				fakeFirewall.InstanceChainsReturns([]string{}, nil)
+			})
+
+			It("re-applies the sharer's port forwards along with the peer's", func() {
+				reconcileTwice()
+
+				Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+				Expect(fakeFirewall.ForwardCallCount()).To(Equal(2))
+				Expect(fakeFirewall.ForwardArgsForCall(0).FromPort).To(BeEquivalentTo(60000))
+
+				spec := fakeFirewall.ForwardArgsForCall(1)
+				Expect(spec.InstanceID).To(Equal("instance-1"))
+				Expect(spec.FromPort).To(BeEquivalentTo(60001))
+				Expect(spec.ToPort).To(BeEquivalentTo(9090))
+				Expect(spec.ContainerIP).To(Equal(net.ParseIP("10.0.0.2")))
+			})
+
+			Context("when the sharer has stopped", func() {
+				BeforeEach(func() {
+					fakeContainers.InfoStub = func(_ lager.Logger, handle string) (gardener.ActualContainerSpec, error) {
+						return gardener.ActualContainerSpec{Stopped: handle == "sidecar"}, nil
+					}
+				})
+
+				It("does not re-apply the sharer's port forwards", func() {
+					reconcileTwice()
+
+					Expect(fakeFirewall.ForwardCallCount()).To(Equal(1))
+					Expect(fakeFirewall.ForwardArgsForCall(0).FromPort).To(BeEquivalentTo(60000))
+				})
+			})
+		})
+	})
+
+	Context("when a container is running", func() {
+		It("asks the containerizer about it", func() {
+			Expect(reconciler.Reconcile(logger)).To(Succeed())
+
+			Expect(fakeContainers.InfoCallCount()).To(Equal(1))
+			_, handle := fakeContainers.InfoArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+		})
+
+		It("recreates its missing chains", func() {
+			fakeFirewall.InstanceChainsReturns([]string{}, nil)
+
+			reconcileTwice()
+
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when a container has stopped", func() {
+		BeforeEach(func() {
+			fakeContainers.InfoReturns(gardener.ActualContainerSpec{Stopped: true}, nil)
+			fakeFirewall.InstanceChainsReturns([]string{}, nil)
+		})
+
+		It("does not recreate its chains or rules", func() {
+			reconcileTwice()
+
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(0))
+			Expect(fakeFirewall.ForwardCallCount()).To(Equal(0))
+			Expect(fakeFirewall.OpenCallCount()).To(Equal(0))
+		})
+
+		It("does not treat any chains left behind as orphaned", func() {
+			fakeFirewall.InstanceChainsReturns([]string{"instance-1"}, nil)
+
+			reconcileTwice()
+
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a container's state cannot be determined", func() {
+		BeforeEach(func() {
+			fakeContainers.InfoReturns(gardener.ActualContainerSpec{}, errors.New("potato"))
+			fakeFirewall.InstanceChainsReturns([]string{}, nil)
+		})
+
+		It("logs the error and leaves its chains alone", func() {
+			reconcileTwice()
+
+			Expect(logger).To(gbytes.Say("container-info-failed"))
+			Expect(fakeFirewall.CreateCallCount()).To(Equal(0))
+			Expect(fakeFirewall.DestroyCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when listing the handles fails", func() {
+		It("returns an error", func() {
+			fakeContainers.HandlesReturns(nil, errors.New("potato"))
+
+			Expect(reconciler.Reconcile(logger)).To(MatchError(ContainSubstring("potato")))
+		})
+	})
+
+	Context("when listing the instance chains fails", func() {
+		It("returns an error", func() {
+			fakeFirewall.InstanceChainsReturns(nil, errors.New("potato"))
+
+			Expect(reconciler.Reconcile(logger)).To(MatchError(ContainSubstring("potato")))
+		})
+	})
+
+	Describe("Start", func() {
+		AfterEach(func() {
+			reconciler.Stop()
+		})
+
+		It("reconciles each time the interval elapses", func() {
+			reconciler.Start()
+
+			Consistently(fakeFirewall.GlobalChainsExistCallCount).Should(Equal(0))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(fakeFirewall.GlobalChainsExistCallCount).Should(Equal(1))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(fakeFirewall.GlobalChainsExistCallCount).Should(Equal(2))
+		})
+	})
+})
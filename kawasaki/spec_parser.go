@@ -1,7 +1,9 @@
 package kawasaki
 
 import (
+	"fmt"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
@@ -14,11 +16,25 @@ func (fn SpecParserFunc) Parse(log lager.Logger, spec string) (subnets.SubnetSel
 	return fn(spec)
 }
 
+// ParseSpec parses a container's network spec: empty for a dynamic /30 subnet,
+// a bare prefix length such as "/28" for a dynamic subnet of that size, or a
+// static subnet in CIDR notation, optionally with the container's IP address
+// in place of the network address.
 func ParseSpec(spec string) (subnets.SubnetSelector, subnets.IPSelector, error) {
 	var ipSelector subnets.IPSelector = subnets.DynamicIPSelector
 	var subnetSelector subnets.SubnetSelector = subnets.DynamicSubnetSelector
 
-	if spec != "" {
+	if strings.HasPrefix(spec, "/") {
+		prefixLen, err := strconv.Atoi(spec[1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid subnet prefix length: %s", spec)
+		}
+
+		subnetSelector, err = subnets.DynamicSubnetSelectorWithPrefixLen(prefixLen)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if spec != "" {
 		specifiedIP, ipn, err := net.ParseCIDR(suffixIfNeeded(spec))
 		if err != nil {
 			return nil, nil, err
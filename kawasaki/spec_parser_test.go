@@ -20,6 +20,32 @@ var _ = Describe("ParseSpec", func() {
 		})
 	})
 
+	Context("when the spec is only a prefix length", func() {
+		It("returns a dynamic subnet of that size and a dynamic ip", func() {
+			subnetReq, ipReq, err := kawasaki.ParseSpec("/28")
+			Expect(err).ToNot(HaveOccurred())
+
+			expected, err := subnets.DynamicSubnetSelectorWithPrefixLen(28)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(subnetReq).To(Equal(expected))
+			Expect(ipReq).To(Equal(subnets.DynamicIPSelector))
+		})
+
+		Context("and the prefix length is not a number", func() {
+			It("returns an error", func() {
+				_, _, err := kawasaki.ParseSpec("/potato")
+				Expect(err).To(MatchError("invalid subnet prefix length: /potato"))
+			})
+		})
+
+		Context("and the prefix length is too long", func() {
+			It("returns an error", func() {
+				_, _, err := kawasaki.ParseSpec("/31")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
 	Context("when the network parameter is not empty", func() {
 		Context("when it contains a prefix length", func() {
 			It("statically allocates the requested subnet ", func() {
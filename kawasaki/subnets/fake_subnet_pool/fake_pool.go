@@ -10,12 +10,13 @@ import (
 )
 
 type FakePool struct {
-	AcquireStub        func(lager.Logger, subnets.SubnetSelector, subnets.IPSelector) (*net.IPNet, net.IP, error)
+	AcquireStub        func(log lager.Logger, handle string, sn subnets.SubnetSelector, ip subnets.IPSelector) (*net.IPNet, net.IP, error)
 	acquireMutex       sync.RWMutex
 	acquireArgsForCall []struct {
-		arg1 lager.Logger
-		arg2 subnets.SubnetSelector
-		arg3 subnets.IPSelector
+		log    lager.Logger
+		handle string
+		sn     subnets.SubnetSelector
+		ip     subnets.IPSelector
 	}
 	acquireReturns struct {
 		result1 *net.IPNet
@@ -48,16 +49,17 @@ type FakePool struct {
 	}
 }
 
-func (fake *FakePool) Acquire(arg1 lager.Logger, arg2 subnets.SubnetSelector, arg3 subnets.IPSelector) (*net.IPNet, net.IP, error) {
+func (fake *FakePool) Acquire(log lager.Logger, handle string, sn subnets.SubnetSelector, ip subnets.IPSelector) (*net.IPNet, net.IP, error) {
 	fake.acquireMutex.Lock()
 	fake.acquireArgsForCall = append(fake.acquireArgsForCall, struct {
-		arg1 lager.Logger
-		arg2 subnets.SubnetSelector
-		arg3 subnets.IPSelector
-	}{arg1, arg2, arg3})
+		log    lager.Logger
+		handle string
+		sn     subnets.SubnetSelector
+		ip     subnets.IPSelector
+	}{log, handle, sn, ip})
 	fake.acquireMutex.Unlock()
 	if fake.AcquireStub != nil {
-		return fake.AcquireStub(arg1, arg2, arg3)
+		return fake.AcquireStub(log, handle, sn, ip)
 	} else {
 		return fake.acquireReturns.result1, fake.acquireReturns.result2, fake.acquireReturns.result3
 	}
@@ -69,10 +71,10 @@ func (fake *FakePool) AcquireCallCount() int {
 	return len(fake.acquireArgsForCall)
 }
 
-func (fake *FakePool) AcquireArgsForCall(i int) (lager.Logger, subnets.SubnetSelector, subnets.IPSelector) {
+func (fake *FakePool) AcquireArgsForCall(i int) (lager.Logger, string, subnets.SubnetSelector, subnets.IPSelector) {
 	fake.acquireMutex.RLock()
 	defer fake.acquireMutex.RUnlock()
-	return fake.acquireArgsForCall[i].arg1, fake.acquireArgsForCall[i].arg2, fake.acquireArgsForCall[i].arg3
+	return fake.acquireArgsForCall[i].log, fake.acquireArgsForCall[i].handle, fake.acquireArgsForCall[i].sn, fake.acquireArgsForCall[i].ip
 }
 
 func (fake *FakePool) AcquireReturns(result1 *net.IPNet, result2 net.IP, result3 error) {
@@ -1,6 +1,10 @@
 package subnets
 
-import "net"
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+)
 
 func equals(a *net.IPNet, b *net.IPNet) bool {
 	aOnes, aBits := a.Mask.Size()
@@ -45,3 +49,55 @@ func max(ipn *net.IPNet) net.IP {
 
 	return net.IP(max).To16()
 }
+
+type ipv4Bounds struct {
+	first, last uint32
+}
+
+// bounds returns the first and last addresses of an IPv4 network as integers
+func bounds(ipn *net.IPNet) (uint32, uint32) {
+	return ipToUint32(ipn.IP), ipToUint32(max(ipn))
+}
+
+// sortedBounds returns the bounds of the given IPv4 networks in order of
+// their first address
+func sortedBounds(networks []*net.IPNet) []ipv4Bounds {
+	var result []ipv4Bounds
+	for _, n := range networks {
+		if n.IP.To4() == nil {
+			continue
+		}
+
+		first, last := bounds(n)
+		result = append(result, ipv4Bounds{first, last})
+	}
+
+	sort.Sort(byFirst(result))
+	return result
+}
+
+type byFirst []ipv4Bounds
+
+func (b byFirst) Len() int           { return len(b) }
+func (b byFirst) Less(i, j int) bool { return b[i].first < b[j].first }
+func (b byFirst) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// blockSize returns the number of addresses in an IPv4 subnet with the given
+// prefix length
+func blockSize(prefixLen int) uint64 {
+	return 1 << uint(8*net.IPv4len-prefixLen)
+}
+
+func alignUp(addr, size uint64) uint64 {
+	return (addr + size - 1) / size * size
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,48 @@
+package subnets
+
+import (
+	"fmt"
+	"net"
+)
+
+// maxIPv6PoolPrefixLen leaves the low 32 bits of each IPv6 address free to
+// hold an IPv4 address
+const maxIPv6PoolPrefixLen = 96
+
+// IPv6 addresses are not allocated separately: a container's IPv6 address is
+// its IPv4 address embedded in the low 32 bits of the IPv6 pool. Each IPv4
+// subnet, and so each bridge, therefore maps onto exactly one IPv6 subnet, and
+// there is no further state to keep or recover.
+
+// ValidateIPv6Pool returns an error unless the pool is an IPv6 network large
+// enough to embed IPv4 addresses in.
+func ValidateIPv6Pool(pool *net.IPNet) error {
+	ones, bits := pool.Mask.Size()
+	if bits != 8*net.IPv6len || pool.IP.To4() != nil {
+		return fmt.Errorf("the IPv6 pool (%s) is not an IPv6 network", pool)
+	}
+
+	if ones > maxIPv6PoolPrefixLen {
+		return fmt.Errorf("the IPv6 pool (%s) must have a prefix length of at most %d", pool, maxIPv6PoolPrefixLen)
+	}
+
+	return nil
+}
+
+// IPv6Address returns the address in the IPv6 pool corresponding to an IPv4
+// address.
+func IPv6Address(pool *net.IPNet, ip net.IP) net.IP {
+	v6 := clone(pool.IP.Mask(pool.Mask).To16())
+	copy(v6[net.IPv6len-net.IPv4len:], ip.To4())
+	return v6
+}
+
+// IPv6Subnet returns the subnet in the IPv6 pool corresponding to an IPv4
+// subnet.
+func IPv6Subnet(pool *net.IPNet, subnet *net.IPNet) *net.IPNet {
+	ones, _ := subnet.Mask.Size()
+	return &net.IPNet{
+		IP:   IPv6Address(pool, subnet.IP),
+		Mask: net.CIDRMask(maxIPv6PoolPrefixLen+ones, 8*net.IPv6len),
+	}
+}
@@ -0,0 +1,50 @@
+package subnets_test
+
+import (
+	"net"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPv6", func() {
+	var pool *net.IPNet
+
+	BeforeEach(func() {
+		pool = subnetPool("fd00:1234::/64")
+	})
+
+	Describe("ValidateIPv6Pool", func() {
+		It("accepts an IPv6 network with room for an IPv4 address", func() {
+			Expect(subnets.ValidateIPv6Pool(pool)).To(Succeed())
+			Expect(subnets.ValidateIPv6Pool(subnetPool("fd00::/96"))).To(Succeed())
+		})
+
+		It("rejects an IPv4 network", func() {
+			Expect(subnets.ValidateIPv6Pool(subnetPool("10.0.0.0/8"))).To(MatchError("the IPv6 pool (10.0.0.0/8) is not an IPv6 network"))
+		})
+
+		It("rejects a network which is too small", func() {
+			Expect(subnets.ValidateIPv6Pool(subnetPool("fd00::/97"))).To(MatchError("the IPv6 pool (fd00::/97) must have a prefix length of at most 96"))
+		})
+	})
+
+	Describe("IPv6Address", func() {
+		It("embeds the IPv4 address in the low bits of the pool", func() {
+			Expect(subnets.IPv6Address(pool, net.ParseIP("10.254.0.2"))).To(Equal(net.ParseIP("fd00:1234::afe:2")))
+		})
+
+		It("ignores any host bits set in the pool", func() {
+			pool.IP = net.ParseIP("fd00:1234::1")
+			Expect(subnets.IPv6Address(pool, net.ParseIP("10.254.0.2"))).To(Equal(net.ParseIP("fd00:1234::afe:2")))
+		})
+	})
+
+	Describe("IPv6Subnet", func() {
+		It("maps the IPv4 subnet onto a subnet of the same size", func() {
+			Expect(subnets.IPv6Subnet(pool, subnetPool("10.254.0.4/30")).String()).To(Equal("fd00:1234::afe:4/126"))
+		})
+	})
+})
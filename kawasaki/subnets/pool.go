@@ -4,21 +4,23 @@ package subnets
 
 import (
 	"fmt"
-	"math"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/pivotal-golang/clock"
 	"github.com/pivotal-golang/lager"
 )
 
 //go:generate counterfeiter -o fake_subnet_pool/fake_pool.go . Pool
 type Pool interface {
-	// Allocates an IP address and associates it with a subnet. The subnet is selected by the given SubnetSelector.
+	// Allocates an IP address for the container with the given handle and associates it with
+	// a subnet. The subnet is selected by the given SubnetSelector.
 	// The IP address is selected by the given IPSelector.
 	// Returns a subnet, an IP address, and a boolean which is true if and only if this is the
 	// first IP address to be associated with this subnet.
 	// If either selector fails, an error is returned.
-	Acquire(lager.Logger, SubnetSelector, IPSelector) (*net.IPNet, net.IP, error)
+	Acquire(log lager.Logger, handle string, sn SubnetSelector, ip IPSelector) (*net.IPNet, net.IP, error)
 
 	// Releases an IP address associated with an allocated subnet. If the subnet has no other IP
 	// addresses associated with it, it is deallocated.
@@ -29,23 +31,32 @@ type Pool interface {
 	// Remove an IP address so it appears to be associated with the given subnet.
 	Remove(*net.IPNet, net.IP) error
 
-	// Returns the number of /30 subnets which can be Acquired by a DynamicSubnetSelector.
+	// Returns the number of subnets the dynamic ranges can host: those already allocated in
+	// them plus the /30 subnets which can still be Acquired by a DynamicSubnetSelector.
 	Capacity() int
 }
 
 type pool struct {
-	allocated    map[string][]net.IP // net.IPNet.String +> seq net.IP
-	dynamicRange *net.IPNet
-	mu           sync.Mutex
+	allocated     map[string][]net.IP // net.IPNet.String +> seq net.IP
+	dynamicRanges []*net.IPNet
+	strategy      AllocationStrategy
+	reserved      []*net.IPNet
+	cooldown      time.Duration
+	clock         clock.Clock
+
+	releasedSubnets map[string]time.Time // net.IPNet.String +> time of release
+	releasedIPs     map[string]time.Time // net.IP.String +> time of release
+
+	mu sync.Mutex
 }
 
 //go:generate counterfeiter . SubnetSelector
 
 // SubnetSelector is a strategy for selecting a subnet.
 type SubnetSelector interface {
-	// Returns a subnet based on a dynamic range and some existing statically-allocated
+	// Returns a subnet based on the dynamic ranges and some existing statically-allocated
 	// subnets. If no suitable subnet can be found, returns an error.
-	SelectSubnet(dynamic *net.IPNet, existing []*net.IPNet) (*net.IPNet, error)
+	SelectSubnet(dynamic []*net.IPNet, existing []*net.IPNet) (*net.IPNet, error)
 }
 
 //go:generate counterfeiter . IPSelector
@@ -57,26 +68,68 @@ type IPSelector interface {
 	SelectIP(subnet *net.IPNet, existing []net.IP) (net.IP, error)
 }
 
-func NewPool(ipNet *net.IPNet) Pool {
-	return &pool{dynamicRange: ipNet, allocated: make(map[string][]net.IP)}
+// NewPool returns a pool which allocates dynamic subnets from the given ranges, filling them
+// in order, and dynamic IPs in any subnet, using the given strategy. Subnets and IPs in the reserved ranges are
+// never allocated dynamically, nor are those released less than the cooldown ago, though
+// any of them may still be requested statically.
+func NewPool(dynamicRanges []*net.IPNet, strategy AllocationStrategy, reserved []*net.IPNet, cooldown time.Duration, clock clock.Clock) Pool {
+	return &pool{
+		dynamicRanges:   dynamicRanges,
+		allocated:       make(map[string][]net.IP),
+		strategy:        strategy,
+		reserved:        reserved,
+		cooldown:        cooldown,
+		clock:           clock,
+		releasedSubnets: make(map[string]time.Time),
+		releasedIPs:     make(map[string]time.Time),
+	}
+}
+
+// ValidateDynamicRanges checks that the dynamic ranges do not overlap
+func ValidateDynamicRanges(dynamicRanges []*net.IPNet) error {
+	for i, a := range dynamicRanges {
+		for _, b := range dynamicRanges[i+1:] {
+			if overlaps(a, b) {
+				return fmt.Errorf("the dynamic allocation ranges %s and %s overlap", a.String(), b.String())
+			}
+		}
+	}
+
+	return nil
 }
 
 // Acquire uses the given subnet and IP selectors to request a subnet, container IP address combination
 // from the pool.
-func (p *pool) Acquire(log lager.Logger, sn SubnetSelector, i IPSelector) (subnet *net.IPNet, ip net.IP, err error) {
+func (p *pool) Acquire(log lager.Logger, handle string, sn SubnetSelector, i IPSelector) (subnet *net.IPNet, ip net.IP, err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if subnet, err = sn.SelectSubnet(p.dynamicRange, existingSubnets(p.allocated)); err != nil {
+	p.expireCooldowns()
+
+	existing := existingSubnets(p.allocated)
+	if dynamic, ok := sn.(dynamicSubnetSelector); ok {
+		unavailable := append(append(existing, p.reserved...), p.coolingSubnets()...)
+		subnet, err = dynamic.selectSubnetWith(p.strategy, handle, p.dynamicRanges, unavailable)
+	} else {
+		subnet, err = sn.SelectSubnet(p.dynamicRanges, existing)
+	}
+	if err != nil {
 		return nil, nil, err
 	}
 
 	ips := p.allocated[subnet.String()]
 	existingIPs := append(ips, NetworkIP(subnet), GatewayIP(subnet), BroadcastIP(subnet))
-	if ip, err = i.SelectIP(subnet, existingIPs); err != nil {
+	if dynamic, ok := i.(dynamicIPSelector); ok {
+		ip, err = dynamic.selectIPWith(p.strategy, handle, subnet, append(existingIPs, p.coolingIPs()...), p.reserved)
+	} else {
+		ip, err = i.SelectIP(subnet, existingIPs)
+	}
+	if err != nil {
 		return nil, nil, err
 	}
 
+	log.Debug("acquired", lager.Data{"handle": handle, "subnet": subnet.String(), "ip": ip.String()})
+
 	p.allocated[subnet.String()] = append(ips, ip)
 	return subnet, ip, err
 }
@@ -111,21 +164,139 @@ func (p *pool) Release(subnet *net.IPNet, ip net.IP) error {
 	if i, found := indexOf(ips, ip); found {
 		if reducedIps, empty := removeIPAtIndex(ips, i); empty {
 			delete(p.allocated, subnetString)
+			p.coolDown(p.releasedSubnets, subnetString)
 		} else {
 			p.allocated[subnetString] = reducedIps
 		}
 
+		p.coolDown(p.releasedIPs, ip.String())
 		return nil
 	}
 
 	return ErrReleasedUnallocatedSubnet
 }
 
-// Capacity returns the number of /30 subnets that can be allocated
-// from the pool's dynamic allocation range.
+// coolDown records that the subnet or IP was released, so that it is not
+// allocated dynamically again until the cooldown has passed
+func (p *pool) coolDown(released map[string]time.Time, key string) {
+	if p.cooldown > 0 {
+		released[key] = p.clock.Now()
+	}
+}
+
+// expireCooldowns forgets the subnets and IPs whose cooldown has passed
+func (p *pool) expireCooldowns() {
+	for _, released := range []map[string]time.Time{p.releasedSubnets, p.releasedIPs} {
+		for key, at := range released {
+			if p.clock.Since(at) >= p.cooldown {
+				delete(released, key)
+			}
+		}
+	}
+}
+
+func (p *pool) coolingSubnets() (result []*net.IPNet) {
+	for key := range p.releasedSubnets {
+		_, ipn, err := net.ParseCIDR(key)
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse a CIDR in the subnet pool: %s", err))
+		}
+
+		result = append(result, ipn)
+	}
+
+	return result
+}
+
+func (p *pool) coolingIPs() (result []net.IP) {
+	for key := range p.releasedIPs {
+		result = append(result, net.ParseIP(key))
+	}
+
+	return result
+}
+
+// Capacity returns the number of subnets that the pool's dynamic allocation
+// ranges can host: those already allocated in them, whatever their size, plus
+// the /30 subnets that can still be allocated dynamically. Larger subnets take
+// the place of several /30s, so the capacity shrinks as they are allocated.
 func (m *pool) Capacity() int {
-	masked, total := m.dynamicRange.Mask.Size()
-	return int(math.Pow(2, float64(total-masked)) / 4)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireCooldowns()
+
+	allocated := 0
+	for _, subnet := range existingSubnets(m.allocated) {
+		for _, r := range m.dynamicRanges {
+			if overlaps(r, subnet) {
+				allocated++
+				break
+			}
+		}
+	}
+
+	return allocated + m.remaining(MaxDynamicPrefixLen)
+}
+
+// remaining returns the number of aligned subnets with the given prefix length
+// in the pool's dynamic allocation ranges which do not overlap an allocated,
+// reserved or cooling down subnet
+func (m *pool) remaining(prefixLen int) int {
+	unavailable := append(append(existingSubnets(m.allocated), m.reserved...), m.coolingSubnets()...)
+
+	remaining := 0
+	for _, r := range m.dynamicRanges {
+		dynamicOnes, bits := r.Mask.Size()
+		if bits != 8*net.IPv4len || prefixLen < dynamicOnes || prefixLen > 8*net.IPv4len {
+			continue
+		}
+
+		first, last := bounds(r)
+		total := (uint64(last) - uint64(first) + 1) / blockSize(prefixLen)
+
+		if used := uint64(usedBlocks(r, prefixLen, unavailable)); used < total {
+			remaining += int(total - used)
+		}
+	}
+
+	return remaining
+}
+
+// usedBlocks returns the number of aligned subnets with the given prefix length
+// in the IPv4 dynamic allocation range which overlap any of the given subnets
+func usedBlocks(dynamicRange *net.IPNet, prefixLen int, subnets []*net.IPNet) int {
+	size := blockSize(prefixLen)
+	first, last := bounds(dynamicRange)
+	// subnets smaller than a block can share one, and subnets may overlap, so
+	// walk them in address order counting only the blocks not counted already
+	used := uint64(0)
+	uncounted := uint64(0)
+	for _, e := range sortedBounds(subnets) {
+		if e.last < first || e.first > last {
+			continue
+		}
+
+		from, to := e.first, e.last
+		if from < first {
+			from = first
+		}
+		if to > last {
+			to = last
+		}
+
+		firstBlock, lastBlock := uint64(from-first)/size, uint64(to-first)/size
+		if firstBlock < uncounted {
+			firstBlock = uncounted
+		}
+
+		if lastBlock >= firstBlock {
+			used += lastBlock - firstBlock + 1
+			uncounted = lastBlock + 1
+		}
+	}
+
+	return int(used)
 }
 
 // Returns the gateway IP of a given subnet, which is always the maximum valid IP
@@ -10,9 +10,11 @@ type StaticSubnetSelector struct {
 	*net.IPNet
 }
 
-func (s StaticSubnetSelector) SelectSubnet(dynamic *net.IPNet, existing []*net.IPNet) (*net.IPNet, error) {
-	if overlaps(dynamic, s.IPNet) {
-		return nil, fmt.Errorf("the requested subnet (%v) overlaps the dynamic allocation range (%v)", s.IPNet.String(), dynamic.String())
+func (s StaticSubnetSelector) SelectSubnet(dynamic []*net.IPNet, existing []*net.IPNet) (*net.IPNet, error) {
+	for _, d := range dynamic {
+		if overlaps(d, s.IPNet) {
+			return nil, fmt.Errorf("the requested subnet (%v) overlaps the dynamic allocation range (%v)", s.IPNet.String(), d.String())
+		}
 	}
 
 	for _, e := range existing {
@@ -24,24 +26,54 @@ func (s StaticSubnetSelector) SelectSubnet(dynamic *net.IPNet, existing []*net.I
 	return s.IPNet, nil
 }
 
+// ExistingSubnetSelector requests a subnet which has already been allocated, so that another IP can
+// be acquired in it (e.g. for a container joining a named network). Returns an error if the subnet
+// is not currently allocated.
+type ExistingSubnetSelector struct {
+	*net.IPNet
+}
+
+func (s ExistingSubnetSelector) SelectSubnet(dynamic []*net.IPNet, existing []*net.IPNet) (*net.IPNet, error) {
+	for _, e := range existing {
+		if equals(s.IPNet, e) {
+			return e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the requested subnet (%v) is not allocated", s.IPNet.String())
+}
+
+// MaxDynamicPrefixLen is the smallest dynamic subnet which can be requested: a
+// /30 holds the network, gateway and broadcast addresses plus one container.
+const MaxDynamicPrefixLen = 30
+
+// dynamicSubnetSelector is the prefix length of the subnet to select
 type dynamicSubnetSelector int
 
-// DynamicSubnetSelector requests the next unallocated ("dynamic") subnet from the dynamic range.
-// Returns an error if there are no remaining subnets in the dynamic range.
-var DynamicSubnetSelector dynamicSubnetSelector = 0
+// DynamicSubnetSelector requests the next unallocated ("dynamic") /30 subnet from the dynamic ranges,
+// in order. Returns an error if there are no remaining subnets in any of the dynamic ranges.
+var DynamicSubnetSelector dynamicSubnetSelector = MaxDynamicPrefixLen
 
-func (dynamicSubnetSelector) SelectSubnet(dynamic *net.IPNet, existing []*net.IPNet) (*net.IPNet, error) {
-	exists := make(map[string]bool)
-	for _, e := range existing {
-		exists[e.String()] = true
+// DynamicSubnetSelectorWithPrefixLen requests the next unallocated ("dynamic") subnet with the given
+// prefix length from the dynamic ranges. Subnets are aligned to their size, so that subnets of
+// different sizes pack into the range without leaving unusable gaps.
+func DynamicSubnetSelectorWithPrefixLen(prefixLen int) (SubnetSelector, error) {
+	if prefixLen < 1 || prefixLen > MaxDynamicPrefixLen {
+		return nil, fmt.Errorf("the requested subnet prefix length (/%d) must be between /1 and /%d", prefixLen, MaxDynamicPrefixLen)
 	}
 
-	min := dynamic.IP
-	mask := net.CIDRMask(30, 32) // /30
-	for ip := min; dynamic.Contains(ip); ip = next(ip) {
-		subnet := &net.IPNet{IP: ip, Mask: mask}
-		ip = next(next(next(ip)))
-		if dynamic.Contains(ip) && !exists[subnet.String()] {
+	return dynamicSubnetSelector(prefixLen), nil
+}
+
+func (d dynamicSubnetSelector) SelectSubnet(dynamic []*net.IPNet, existing []*net.IPNet) (*net.IPNet, error) {
+	return d.selectSubnetWith(FirstFree, "", dynamic, existing)
+}
+
+// selectSubnetWith selects a subnet which does not overlap any of the
+// unavailable ones from the first dynamic range which has room for one
+func (d dynamicSubnetSelector) selectSubnetWith(strategy AllocationStrategy, handle string, dynamic []*net.IPNet, unavailable []*net.IPNet) (*net.IPNet, error) {
+	for _, r := range dynamic {
+		if subnet, err := d.selectSubnetIn(strategy, handle, r, unavailable); err == nil {
 			return subnet, nil
 		}
 	}
@@ -49,6 +81,52 @@ func (dynamicSubnetSelector) SelectSubnet(dynamic *net.IPNet, existing []*net.IP
 	return nil, ErrInsufficientSubnets
 }
 
+// selectSubnetIn selects a subnet in the dynamic range which does not overlap
+// any of the unavailable ones, starting from the block the strategy picks
+func (d dynamicSubnetSelector) selectSubnetIn(strategy AllocationStrategy, handle string, dynamic *net.IPNet, unavailable []*net.IPNet) (*net.IPNet, error) {
+	dynamicOnes, bits := dynamic.Mask.Size()
+	if bits != 8*net.IPv4len || int(d) < dynamicOnes {
+		return nil, ErrInsufficientSubnets
+	}
+
+	size := blockSize(int(d))
+	first, last := bounds(dynamic)
+	blocks := (uint64(last) - uint64(first) + 1) / size
+	scope := fmt.Sprintf("%s:/%d", dynamic.String(), int(d))
+	sorted := sortedBounds(unavailable)
+
+	candidate, found := freeBlock(uint64(first)+strategy.Start(scope, handle, blocks)*size, uint64(last), size, sorted)
+	if !found {
+		candidate, found = freeBlock(uint64(first), uint64(last), size, sorted)
+	}
+
+	if !found {
+		return nil, ErrInsufficientSubnets
+	}
+
+	strategy.Allocated(scope, (candidate-uint64(first))/size)
+	return &net.IPNet{IP: uint32ToIP(uint32(candidate)), Mask: net.CIDRMask(int(d), 8*net.IPv4len)}, nil
+}
+
+// freeBlock returns the first aligned block of the given size at or after
+// the candidate which overlaps none of the unavailable subnets, and whether
+// it ends at or before last
+func freeBlock(candidate, last, size uint64, unavailable []ipv4Bounds) (uint64, bool) {
+	// walk the unavailable subnets in address order, trying the aligned block
+	// before each one and skipping past any it overlaps
+	for _, e := range unavailable {
+		if candidate+size-1 < uint64(e.first) {
+			break
+		}
+
+		if uint64(e.last) >= candidate {
+			candidate = alignUp(uint64(e.last)+1, size)
+		}
+	}
+
+	return candidate, candidate+size-1 <= last
+}
+
 // StaticIPSelector requests a specific ("static") IP address. Returns an error if the IP is already
 // allocated, or if it is outside the given subnet.
 type StaticIPSelector struct {
@@ -83,17 +161,54 @@ type dynamicIPSelector int
 // Returns an error if no more IP addresses remain in the subnet.
 var DynamicIPSelector dynamicIPSelector = 0
 
-func (dynamicIPSelector) SelectIP(subnet *net.IPNet, existing []net.IP) (net.IP, error) {
+func (d dynamicIPSelector) SelectIP(subnet *net.IPNet, existing []net.IP) (net.IP, error) {
+	return d.selectIPWith(FirstFree, "", subnet, existing, nil)
+}
+
+// selectIPWith selects an IP which is not one of the existing IPs and is not
+// in any of the reserved ranges, starting from the IP the strategy picks
+func (dynamicIPSelector) selectIPWith(strategy AllocationStrategy, handle string, subnet *net.IPNet, existing []net.IP, reserved []*net.IPNet) (net.IP, error) {
 	exists := make(map[string]bool)
 	for _, e := range existing {
 		exists[e.String()] = true
 	}
 
-	for i := subnet.IP; subnet.Contains(i); i = next(i) {
-		if !exists[i.String()] {
-			return i, nil
+	free := func(ip net.IP) bool {
+		return !exists[ip.String()] && !containedIn(reserved, ip)
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits != 8*net.IPv4len {
+		for i := subnet.IP; subnet.Contains(i); i = next(i) {
+			if free(i) {
+				return i, nil
+			}
+		}
+
+		return nil, ErrInsufficientIPs
+	}
+
+	first, _ := bounds(subnet)
+	n := blockSize(ones)
+	start := strategy.Start(subnet.String(), handle, n)
+
+	for i := uint64(0); i < n; i++ {
+		index := (start + i) % n
+		if ip := uint32ToIP(first + uint32(index)); free(ip) {
+			strategy.Allocated(subnet.String(), index)
+			return ip, nil
 		}
 	}
 
 	return nil, ErrInsufficientIPs
 }
+
+func containedIn(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
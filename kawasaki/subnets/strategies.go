@@ -0,0 +1,85 @@
+package subnets
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// AllocationStrategy decides where the dynamic selectors start looking for a
+// free subnet in the dynamic range, or a free IP in a subnet. Candidates are
+// tried in address order from the one the strategy picks, wrapping around to
+// the start of the range. The pool calls the strategy with its lock held.
+type AllocationStrategy interface {
+	// Start returns the index, in address order, of the first of the n
+	// candidates in the given scope to try for the container with the given
+	// handle. The scope names the range being allocated from.
+	Start(scope, handle string, n uint64) uint64
+
+	// Allocated records that the candidate with the given index in the scope
+	// has been allocated.
+	Allocated(scope string, index uint64)
+}
+
+const (
+	FirstFreeStrategyName  = "first-free"
+	RoundRobinStrategyName = "round-robin"
+	HashStrategyName       = "hash"
+)
+
+// NewAllocationStrategy returns the strategy with the given name
+func NewAllocationStrategy(name string) (AllocationStrategy, error) {
+	switch name {
+	case FirstFreeStrategyName:
+		return FirstFree, nil
+	case RoundRobinStrategyName:
+		return NewRoundRobin(), nil
+	case HashStrategyName:
+		return HashOfHandle, nil
+	default:
+		return nil, fmt.Errorf("unknown allocation strategy '%s': must be one of '%s', '%s' or '%s'", name, FirstFreeStrategyName, RoundRobinStrategyName, HashStrategyName)
+	}
+}
+
+type firstFree struct{}
+
+// FirstFree allocates the lowest free subnet or IP, so that released ones are
+// reused straight away.
+var FirstFree AllocationStrategy = firstFree{}
+
+func (firstFree) Start(scope, handle string, n uint64) uint64 { return 0 }
+func (firstFree) Allocated(scope string, index uint64)        {}
+
+type roundRobin struct {
+	next map[string]uint64
+}
+
+// NewRoundRobin returns a strategy which allocates the next free subnet or IP
+// after the one last allocated from the same range. A released subnet or IP
+// is therefore only reused once the rest of the range has been handed out,
+// making it the least recently used.
+func NewRoundRobin() AllocationStrategy {
+	return &roundRobin{next: map[string]uint64{}}
+}
+
+func (r *roundRobin) Start(scope, handle string, n uint64) uint64 {
+	return r.next[scope] % n
+}
+
+func (r *roundRobin) Allocated(scope string, index uint64) {
+	r.next[scope] = index + 1
+}
+
+type hashOfHandle struct{}
+
+// HashOfHandle starts from a candidate picked by hashing the container's
+// handle, so that a container re-created with the same handle tends to get
+// the same subnet and IP back, while other containers tend not to.
+var HashOfHandle AllocationStrategy = hashOfHandle{}
+
+func (hashOfHandle) Start(scope, handle string, n uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(handle))
+	return h.Sum64() % n
+}
+
+func (hashOfHandle) Allocated(scope string, index uint64) {}
@@ -3,8 +3,10 @@ package subnets_test
 import (
 	"net"
 	"runtime"
+	"time"
 
 	"github.com/cloudfoundry-incubator/guardian/kawasaki/subnets"
+	"github.com/pivotal-golang/clock/fakeclock"
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
 
@@ -15,14 +17,24 @@ import (
 var _ = Describe("Subnet Pool", func() {
 	var subnetpool subnets.Pool
 	var defaultSubnetPool *net.IPNet
+	var extraSubnetPools []*net.IPNet
 	var logger lager.Logger
+	var strategy subnets.AllocationStrategy
+	var reserved []*net.IPNet
+	var cooldown time.Duration
+	var fakeClock *fakeclock.FakeClock
 
 	BeforeEach(func() {
 		logger = lagertest.NewTestLogger("test")
+		extraSubnetPools = nil
+		strategy = subnets.FirstFree
+		reserved = nil
+		cooldown = 0
+		fakeClock = fakeclock.NewFakeClock(time.Unix(123, 456))
 	})
 
 	JustBeforeEach(func() {
-		subnetpool = subnets.NewPool(defaultSubnetPool)
+		subnetpool = subnets.NewPool(append([]*net.IPNet{defaultSubnetPool}, extraSubnetPools...), strategy, reserved, cooldown, fakeClock)
 	})
 
 	Describe("Capacity", func() {
@@ -49,16 +61,34 @@ var _ = Describe("Subnet Pool", func() {
 			It("returns the correct capacity after allocating subnets", func() {
 				cap := subnetpool.Capacity()
 
-				_, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(subnetpool.Capacity()).To(Equal(cap))
 
-				_, _, err = subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(subnetpool.Capacity()).To(Equal(cap))
 			})
+
+			It("shrinks as larger subnets are allocated in place of several /30s", func() {
+				selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(28)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, err = subnetpool.Acquire(logger, "some-handle", selector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(subnetpool.Capacity()).To(Equal(5))
+			})
+
+			It("does not count static subnets outside the dynamic range", func() {
+				_, static := networkParms("10.3.3.0/29")
+				_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(subnetpool.Capacity()).To(Equal(8))
+			})
 		})
 	})
 
@@ -72,7 +102,7 @@ var _ = Describe("Subnet Pool", func() {
 				It("returns an appropriate error", func() {
 					_, static := networkParms("10.2.3.4/30")
 
-					_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+					_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 					Expect(err).To(MatchError("the requested subnet (10.2.3.4/30) overlaps the dynamic allocation range (10.2.3.0/29)"))
 				})
 			})
@@ -85,7 +115,7 @@ var _ = Describe("Subnet Pool", func() {
 				It("returns an appropriate error", func() {
 					_, static := networkParms("10.2.3.0/24")
 
-					_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+					_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 					Expect(err).To(HaveOccurred())
 					Expect(err).To(MatchError("the requested subnet (10.2.3.0/24) overlaps the dynamic allocation range (10.2.3.4/30)"))
 				})
@@ -102,7 +132,7 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("9.0.0.1")
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).To(Equal(subnets.ErrInvalidIP))
 						})
 
@@ -110,7 +140,7 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("11.0.0.2")
-							subnet, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 
 							Expect(subnet).To(Equal(static))
@@ -121,11 +151,11 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("11.0.0.2")
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 
 							_, static = networkParms("11.0.0.0/8") // make sure we get a new pointer
-							_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).To(Equal(subnets.ErrIPAlreadyAcquired))
 						})
 
@@ -133,7 +163,7 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("11.0.0.2")
-							subnet, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 							Expect(subnet).To(Equal(static))
 							Expect(ip).To(Equal(ip))
@@ -141,7 +171,7 @@ var _ = Describe("Subnet Pool", func() {
 							ip2 := net.ParseIP("11.0.0.3")
 
 							_, static = networkParms("11.0.0.0/8") // make sure we get a new pointer
-							subnet2, ip2, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip2})
+							subnet2, ip2, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip2})
 							Expect(err).ToNot(HaveOccurred())
 							Expect(subnet2).To(Equal(static))
 							Expect(ip2).To(Equal(ip2))
@@ -151,7 +181,7 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("11.0.0.2")
-							subnet, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 							Expect(subnet).To(Equal(static))
 							Expect(ip).To(Equal(ip))
@@ -160,7 +190,7 @@ var _ = Describe("Subnet Pool", func() {
 							Expect(err).ToNot(HaveOccurred())
 
 							_, static = networkParms("11.0.0.0/8") // make sure we get a new pointer
-							subnet, ip, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							subnet, ip, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 							Expect(subnet).To(Equal(static))
 							Expect(ip).To(Equal(ip))
@@ -170,14 +200,14 @@ var _ = Describe("Subnet Pool", func() {
 							_, static := networkParms("11.0.0.0/8")
 
 							ip := net.ParseIP("11.0.0.3")
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).ToNot(HaveOccurred())
 
-							_, ip, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 							Expect(ip.String()).To(Equal("11.0.0.2"))
 
-							_, ip, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 							Expect(ip.String()).To(Equal("11.0.0.4"))
 						})
@@ -186,14 +216,14 @@ var _ = Describe("Subnet Pool", func() {
 							It("fails if a static subnet is requested specifying an IP address which clashes with the gateway IP address", func() {
 								_, static := networkParms("11.0.0.0/8")
 								gateway := net.ParseIP("11.0.0.1")
-								_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: gateway})
+								_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: gateway})
 								Expect(err).To(MatchError(subnets.ErrIPEqualsGateway))
 							})
 
 							It("fails if a static subnet is requested specifying an IP address which clashes with the broadcast IP address", func() {
 								_, static := networkParms("11.0.0.0/8")
 								max := net.ParseIP("11.255.255.255")
-								_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: max})
+								_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: max})
 								Expect(err).To(MatchError(subnets.ErrIPEqualsBroadcast))
 							})
 						})
@@ -203,14 +233,14 @@ var _ = Describe("Subnet Pool", func() {
 						It("does not return an error", func() {
 							_, static := networkParms("11.0.0.0/8")
 
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 						})
 
 						It("returns the first available IP", func() {
 							_, static := networkParms("11.0.0.0/8")
 
-							_, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 
 							Expect(ip.String()).To(Equal("11.0.0.2"))
@@ -222,7 +252,7 @@ var _ = Describe("Subnet Pool", func() {
 							seen := make(map[string]bool)
 							var err error
 							for err == nil {
-								_, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+								_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 
 								if err != nil {
 									Expect(err).To(Equal(subnets.ErrInsufficientIPs))
@@ -240,7 +270,7 @@ var _ = Describe("Subnet Pool", func() {
 							var err error
 							count := 0
 							for err == nil {
-								if _, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector); err != nil {
+								if _, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector); err != nil {
 									Expect(err).To(Equal(subnets.ErrInsufficientIPs))
 								}
 
@@ -253,10 +283,10 @@ var _ = Describe("Subnet Pool", func() {
 						It("causes static alocation to fail if it tries to allocate the same IP afterwards", func() {
 							_, static := networkParms("11.0.0.0/8")
 
-							_, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 
-							_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+							_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 							Expect(err).To(Equal(subnets.ErrIPAlreadyAcquired))
 						})
 					})
@@ -274,7 +304,7 @@ var _ = Describe("Subnet Pool", func() {
 						Expect(err).ToNot(HaveOccurred())
 
 						for i := 0; i < 5; i++ {
-							_, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 
 							ips[i] = ip
@@ -282,7 +312,7 @@ var _ = Describe("Subnet Pool", func() {
 					})
 
 					It("returns an appropriate error", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 						Expect(err).To(HaveOccurred())
 						Expect(err).To(Equal(subnets.ErrInsufficientIPs))
 					})
@@ -292,7 +322,7 @@ var _ = Describe("Subnet Pool", func() {
 							err := subnetpool.Release(static, ips[3])
 							Expect(err).ToNot(HaveOccurred())
 
-							_, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 							Expect(ip).To(Equal(ips[3]))
 						})
@@ -301,7 +331,7 @@ var _ = Describe("Subnet Pool", func() {
 							err := subnetpool.Release(static, ips[3])
 							Expect(err).ToNot(HaveOccurred())
 
-							_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ips[3]})
+							_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ips[3]})
 							Expect(err).ToNot(HaveOccurred())
 						})
 					})
@@ -317,12 +347,12 @@ var _ = Describe("Subnet Pool", func() {
 						_, firstSubnetPool = networkParms("10.9.3.0/30")
 						_, secondSubnetPool = networkParms("10.9.3.0/29")
 
-						_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: firstSubnetPool}, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: firstSubnetPool}, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 					})
 
 					It("returns an appropriate error", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
 						Expect(err).To(MatchError("the requested subnet (10.9.3.0/29) overlaps an existing subnet (10.9.3.0/30)"))
 					})
 				})
@@ -342,12 +372,12 @@ var _ = Describe("Subnet Pool", func() {
 						_, secondSubnetPool = networkParms("10.9.3.0/29")
 						Expect(err).ToNot(HaveOccurred())
 
-						_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: firstSubnetPool}, subnets.DynamicIPSelector)
+						_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: firstSubnetPool}, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 					})
 
 					It("returns an appropriate error", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
 						Expect(err).To(MatchError("the requested subnet (10.9.3.0/29) overlaps an existing subnet (10.9.3.4/30)"))
 					})
 
@@ -356,7 +386,7 @@ var _ = Describe("Subnet Pool", func() {
 							err := subnetpool.Release(firstSubnetPool, firstContainerIP)
 							Expect(err).ToNot(HaveOccurred())
 
-							_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
+							_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: secondSubnetPool}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 						})
 					})
@@ -366,7 +396,7 @@ var _ = Describe("Subnet Pool", func() {
 					It("does not return an error", func() {
 						_, static := networkParms("10.9.3.6/29")
 
-						_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 					})
 				})
@@ -381,7 +411,7 @@ var _ = Describe("Subnet Pool", func() {
 				})
 
 				It("the first request returns an error", func() {
-					_, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+					_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -393,7 +423,7 @@ var _ = Describe("Subnet Pool", func() {
 
 				Context("the first request", func() {
 					It("succeeds, and returns a /30 network within the subnet", func() {
-						subnet, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						Expect(subnet).ToNot(BeNil())
@@ -403,10 +433,10 @@ var _ = Describe("Subnet Pool", func() {
 
 				Context("subsequent requests", func() {
 					It("fails, and return an err", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
-						_, _, err = subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).To(HaveOccurred())
 					})
 				})
@@ -414,11 +444,11 @@ var _ = Describe("Subnet Pool", func() {
 				Context("when an allocated network is released", func() {
 					It("a subsequent allocation succeeds, and returns the first network again", func() {
 						// first
-						subnet, ip, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						// second - will fail (sanity check)
-						_, _, err = subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).To(HaveOccurred())
 
 						// release
@@ -426,7 +456,7 @@ var _ = Describe("Subnet Pool", func() {
 						Expect(err).ToNot(HaveOccurred())
 
 						// third - should work now because of release
-						subnet2, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet2, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						Expect(subnet2).ToNot(BeNil())
@@ -437,10 +467,10 @@ var _ = Describe("Subnet Pool", func() {
 						It("returns gone=false", func() {
 							_, static := networkParms("10.3.3.0/29")
 
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 
-							subnet, ip, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+							subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 
 							err = subnetpool.Release(subnet, ip)
@@ -452,7 +482,7 @@ var _ = Describe("Subnet Pool", func() {
 				Context("when a network is released twice", func() {
 					It("returns an error", func() {
 						// first
-						subnet, ip, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						// release
@@ -474,18 +504,18 @@ var _ = Describe("Subnet Pool", func() {
 
 				Context("the second request", func() {
 					It("succeeds", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
-						_, _, err = subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 					})
 
 					It("returns the second /30 network within the subnet", func() {
-						_, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
-						subnet, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						Expect(subnet).ToNot(BeNil())
@@ -501,19 +531,19 @@ var _ = Describe("Subnet Pool", func() {
 						_, network, err := net.ParseCIDR("10.0.0.0/29")
 						Expect(err).ToNot(HaveOccurred())
 
-						subnetpool := subnets.NewPool(network)
+						subnetpool := subnets.NewPool([]*net.IPNet{network}, subnets.FirstFree, nil, 0, fakeClock)
 
 						out := make(chan *net.IPNet)
 						go func(out chan *net.IPNet) {
 							defer GinkgoRecover()
-							subnet, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+							subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 							out <- subnet
 						}(out)
 
 						go func(out chan *net.IPNet) {
 							defer GinkgoRecover()
-							subnet, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+							subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 							Expect(err).ToNot(HaveOccurred())
 							out <- subnet
 						}(out)
@@ -532,9 +562,9 @@ var _ = Describe("Subnet Pool", func() {
 						_, network, err := net.ParseCIDR("10.0.0.0/29")
 						Expect(err).ToNot(HaveOccurred())
 
-						subnetpool := subnets.NewPool(network)
+						subnetpool := subnets.NewPool([]*net.IPNet{network}, subnets.FirstFree, nil, 0, fakeClock)
 
-						subnet, ip, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+						subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
 						Expect(err).ToNot(HaveOccurred())
 
 						out := make(chan error)
@@ -563,20 +593,20 @@ var _ = Describe("Subnet Pool", func() {
 					Consistently(func() bool {
 						network := subnetPool("10.0.0.0/29")
 
-						subnetpool := subnets.NewPool(network)
+						subnetpool := subnets.NewPool([]*net.IPNet{network}, subnets.FirstFree, nil, 0, fakeClock)
 
 						ip, n1 := networkParms("10.1.0.0/30")
 
 						out := make(chan error)
 						go func(out chan error) {
 							defer GinkgoRecover()
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: n1}, subnets.StaticIPSelector{IP: ip})
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: n1}, subnets.StaticIPSelector{IP: ip})
 							out <- err
 						}(out)
 
 						go func(out chan error) {
 							defer GinkgoRecover()
-							_, _, err := subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: n1}, subnets.StaticIPSelector{IP: ip})
+							_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: n1}, subnets.StaticIPSelector{IP: ip})
 							out <- err
 						}(out)
 
@@ -588,6 +618,138 @@ var _ = Describe("Subnet Pool", func() {
 			})
 		})
 
+		Describe("Dynamic Subnet Allocation with a prefix length", func() {
+			BeforeEach(func() {
+				defaultSubnetPool = subnetPool("10.2.3.0/26")
+			})
+
+			acquire := func(prefixLen int) (*net.IPNet, error) {
+				selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(prefixLen)
+				Expect(err).NotTo(HaveOccurred())
+
+				subnet, _, err := subnetpool.Acquire(logger, "some-handle", selector, subnets.DynamicIPSelector)
+				return subnet, err
+			}
+
+			It("returns a subnet with the requested prefix length", func() {
+				subnet, err := acquire(28)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal("10.2.3.0/28"))
+			})
+
+			It("aligns larger subnets to their size after smaller ones", func() {
+				subnet, err := acquire(30)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal("10.2.3.0/30"))
+
+				subnet, err = acquire(28)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal("10.2.3.16/28"))
+			})
+
+			It("fills the gaps left by smaller subnets before using a new block", func() {
+				_, err := acquire(30)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = acquire(28)
+				Expect(err).NotTo(HaveOccurred())
+
+				subnet, err := acquire(30)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal("10.2.3.4/30"))
+			})
+
+			It("hands out a released block again", func() {
+				selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(27)
+				Expect(err).NotTo(HaveOccurred())
+
+				subnet, ip, err := subnetpool.Acquire(logger, "some-handle", selector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnetpool.Release(subnet, ip)).To(Succeed())
+
+				subnet, err = acquire(28)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal("10.2.3.0/28"))
+			})
+
+			Context("when there is no free aligned block of the requested size", func() {
+				It("returns an error", func() {
+					_, err := acquire(27)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = acquire(30)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = acquire(27)
+					Expect(err).To(Equal(subnets.ErrInsufficientSubnets))
+				})
+			})
+
+			Context("when the requested subnet is larger than the dynamic range", func() {
+				It("returns an error", func() {
+					_, err := acquire(25)
+					Expect(err).To(Equal(subnets.ErrInsufficientSubnets))
+				})
+			})
+
+			Context("when the prefix length is too long to hold a container", func() {
+				It("returns an error", func() {
+					_, err := subnets.DynamicSubnetSelectorWithPrefixLen(31)
+					Expect(err).To(MatchError("the requested subnet prefix length (/31) must be between /1 and /30"))
+				})
+			})
+
+			It("is the default dynamic selector for a /30", func() {
+				selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(30)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(selector).To(Equal(subnets.DynamicSubnetSelector))
+			})
+
+			Describe("Capacity", func() {
+				It("counts the /30 subnets in an empty pool", func() {
+					Expect(subnetpool.Capacity()).To(Equal(16))
+				})
+
+				It("counts the allocated subnets of other sizes, and the /30s still free around them", func() {
+					_, err := acquire(30)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = acquire(28)
+					Expect(err).NotTo(HaveOccurred())
+
+					// the /28 is aligned, leaving three /30s free after the first
+					Expect(subnetpool.Capacity()).To(Equal(2 + 11))
+				})
+			})
+		})
+
+		Describe("Existing Subnet Allocation", func() {
+			BeforeEach(func() {
+				defaultSubnetPool = subnetPool("10.2.3.0/29")
+			})
+
+			Context("when the subnet has been allocated", func() {
+				It("acquires another IP in it", func() {
+					selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(29)
+					Expect(err).NotTo(HaveOccurred())
+
+					subnet, firstIP, err := subnetpool.Acquire(logger, "some-handle", selector, subnets.DynamicIPSelector)
+					Expect(err).NotTo(HaveOccurred())
+
+					sameSubnet, secondIP, err := subnetpool.Acquire(logger, "some-handle", subnets.ExistingSubnetSelector{IPNet: subnet}, subnets.DynamicIPSelector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(sameSubnet.String()).To(Equal("10.2.3.0/29"))
+					Expect(secondIP).NotTo(Equal(firstIP))
+				})
+			})
+
+			Context("when the subnet is not allocated", func() {
+				It("returns an error", func() {
+					_, unallocated := networkParms("10.2.3.0/30")
+
+					_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.ExistingSubnetSelector{IPNet: unallocated}, subnets.DynamicIPSelector)
+					Expect(err).To(MatchError("the requested subnet (10.2.3.0/30) is not allocated"))
+				})
+			})
+		})
+
 		Describe("Removeing", func() {
 			BeforeEach(func() {
 				defaultSubnetPool = subnetPool("10.2.3.0/29")
@@ -618,7 +780,7 @@ var _ = Describe("Subnet Pool", func() {
 					err := subnetpool.Remove(static, ip)
 					Expect(err).ToNot(HaveOccurred())
 
-					_, _, err = subnetpool.Acquire(logger, subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+					_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
 					Expect(err).To(HaveOccurred())
 				})
 
@@ -654,11 +816,11 @@ var _ = Describe("Subnet Pool", func() {
 					err := subnetpool.Remove(static, net.ParseIP("10.2.3.1"))
 					Expect(err).ToNot(HaveOccurred())
 
-					subnet, _, err := subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.StaticIPSelector{IP: net.ParseIP("10.2.3.2")})
+					subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.StaticIPSelector{IP: net.ParseIP("10.2.3.2")})
 					Expect(err).ToNot(HaveOccurred())
 					Expect(subnet.String()).To(Equal("10.2.3.0/30"))
 
-					_, _, err = subnetpool.Acquire(logger, subnets.DynamicSubnetSelector, subnets.StaticIPSelector{IP: net.ParseIP("10.2.3.2")})
+					_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.StaticIPSelector{IP: net.ParseIP("10.2.3.2")})
 					Expect(err).To(Equal(subnets.ErrInsufficientSubnets))
 				})
 			})
@@ -666,6 +828,237 @@ var _ = Describe("Subnet Pool", func() {
 		})
 
 	})
+
+	Describe("Multiple dynamic ranges", func() {
+		BeforeEach(func() {
+			defaultSubnetPool = subnetPool("10.2.3.0/30")
+			extraSubnetPools = []*net.IPNet{subnetPool("10.2.4.0/29")}
+		})
+
+		It("allocates dynamic subnets from each range in order", func() {
+			for _, expected := range []string{"10.2.3.0/30", "10.2.4.0/30", "10.2.4.4/30"} {
+				subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnet.String()).To(Equal(expected))
+			}
+
+			_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).To(Equal(subnets.ErrInsufficientSubnets))
+		})
+
+		It("allocates a dynamic subnet from a later range when it is too big for an earlier one", func() {
+			selector, err := subnets.DynamicSubnetSelectorWithPrefixLen(29)
+			Expect(err).NotTo(HaveOccurred())
+
+			subnet, _, err := subnetpool.Acquire(logger, "some-handle", selector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnet.String()).To(Equal("10.2.4.0/29"))
+		})
+
+		It("sums the capacity of the ranges", func() {
+			Expect(subnetpool.Capacity()).To(Equal(3))
+		})
+
+		It("does not allow static subnets overlapping any of the ranges", func() {
+			_, static := networkParms("10.2.4.4/30")
+
+			_, _, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).To(MatchError("the requested subnet (10.2.4.4/30) overlaps the dynamic allocation range (10.2.4.0/29)"))
+		})
+
+		Describe("ValidateDynamicRanges", func() {
+			It("accepts ranges which do not overlap", func() {
+				Expect(subnets.ValidateDynamicRanges([]*net.IPNet{subnetPool("10.2.3.0/30"), subnetPool("10.2.4.0/29")})).To(Succeed())
+			})
+
+			It("rejects ranges which overlap", func() {
+				Expect(subnets.ValidateDynamicRanges([]*net.IPNet{subnetPool("10.2.0.0/16"), subnetPool("10.2.4.0/29")})).To(
+					MatchError("the dynamic allocation ranges 10.2.0.0/16 and 10.2.4.0/29 overlap"),
+				)
+			})
+		})
+	})
+
+	Describe("Allocation strategies", func() {
+		var static *net.IPNet
+
+		acquire := func(handle string) *net.IPNet {
+			subnet, _, err := subnetpool.Acquire(logger, handle, subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			return subnet
+		}
+
+		acquireIP := func(handle string) net.IP {
+			_, ip, err := subnetpool.Acquire(logger, handle, subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			return ip
+		}
+
+		BeforeEach(func() {
+			defaultSubnetPool = subnetPool("10.2.3.0/28")
+			_, static = networkParms("10.3.3.0/29")
+		})
+
+		Context("when the strategy is round-robin", func() {
+			BeforeEach(func() {
+				strategy = subnets.NewRoundRobin()
+			})
+
+			It("does not reuse a released subnet until the rest of the range has been allocated", func() {
+				first, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(first.String()).To(Equal("10.2.3.0/30"))
+				Expect(subnetpool.Release(first, ip)).To(Succeed())
+
+				Expect(acquire("some-handle").String()).To(Equal("10.2.3.4/30"))
+				Expect(acquire("some-handle").String()).To(Equal("10.2.3.8/30"))
+				Expect(acquire("some-handle").String()).To(Equal("10.2.3.12/30"))
+				Expect(acquire("some-handle").String()).To(Equal("10.2.3.0/30"))
+			})
+
+			It("does not reuse a released IP until the rest of the subnet has been allocated", func() {
+				ip := acquireIP("some-handle")
+				Expect(ip.String()).To(Equal("10.3.3.2"))
+				Expect(subnetpool.Release(static, ip)).To(Succeed())
+
+				Expect(acquireIP("some-handle").String()).To(Equal("10.3.3.3"))
+			})
+		})
+
+		Context("when the strategy is hash", func() {
+			BeforeEach(func() {
+				strategy = subnets.HashOfHandle
+			})
+
+			It("gives a handle the same subnet and IP again once they are released", func() {
+				subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnetpool.Release(subnet, ip)).To(Succeed())
+
+				Expect(acquire("some-handle")).To(Equal(subnet))
+			})
+
+			It("moves on to the next free subnet when the handle's is taken", func() {
+				subnet := acquire("some-handle")
+				Expect(acquire("some-handle")).NotTo(Equal(subnet))
+			})
+		})
+
+		Describe("NewAllocationStrategy", func() {
+			It("returns the strategy with the given name", func() {
+				Expect(subnets.NewAllocationStrategy("first-free")).To(Equal(subnets.FirstFree))
+				Expect(subnets.NewAllocationStrategy("hash")).To(Equal(subnets.HashOfHandle))
+				Expect(subnets.NewAllocationStrategy("round-robin")).To(Equal(subnets.NewRoundRobin()))
+			})
+
+			It("returns an error for an unknown strategy", func() {
+				_, err := subnets.NewAllocationStrategy("random")
+				Expect(err).To(MatchError("unknown allocation strategy 'random': must be one of 'first-free', 'round-robin' or 'hash'"))
+			})
+		})
+	})
+
+	Describe("Reserved ranges", func() {
+		BeforeEach(func() {
+			defaultSubnetPool = subnetPool("10.2.3.0/28")
+			reserved = []*net.IPNet{subnetPool("10.2.3.0/29"), subnetPool("10.3.3.2/31")}
+		})
+
+		It("does not allocate dynamic subnets overlapping them", func() {
+			subnet, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnet.String()).To(Equal("10.2.3.8/30"))
+		})
+
+		It("does not allocate dynamic IPs in them", func() {
+			_, static := networkParms("10.3.3.0/29")
+			_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ip.String()).To(Equal("10.3.3.4"))
+		})
+
+		It("still allows them to be requested statically", func() {
+			_, static := networkParms("10.3.3.0/29")
+			_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: net.ParseIP("10.3.3.2")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ip.String()).To(Equal("10.3.3.2"))
+		})
+
+		It("leaves them out of the capacity", func() {
+			Expect(subnetpool.Capacity()).To(Equal(2))
+		})
+	})
+
+	Describe("Cooldown", func() {
+		BeforeEach(func() {
+			defaultSubnetPool = subnetPool("10.2.3.0/28")
+			cooldown = time.Minute
+		})
+
+		It("does not reallocate a released subnet dynamically until the cooldown has passed", func() {
+			subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnetpool.Release(subnet, ip)).To(Succeed())
+
+			fakeClock.Increment(time.Minute - time.Second)
+			next, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next.String()).To(Equal("10.2.3.4/30"))
+
+			fakeClock.Increment(time.Second)
+			next, _, err = subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next.String()).To(Equal("10.2.3.0/30"))
+		})
+
+		It("does not reallocate a released IP dynamically until the cooldown has passed", func() {
+			_, static := networkParms("10.3.3.0/29")
+			_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnetpool.Release(static, ip)).To(Succeed())
+
+			_, next, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next.String()).To(Equal("10.3.3.3"))
+		})
+
+		It("still allows a released IP to be requested statically", func() {
+			_, static := networkParms("10.3.3.0/29")
+			_, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnetpool.Release(static, ip)).To(Succeed())
+
+			_, _, err = subnetpool.Acquire(logger, "some-handle", subnets.StaticSubnetSelector{IPNet: static}, subnets.StaticIPSelector{IP: ip})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("leaves cooling down subnets out of the capacity until the cooldown has passed", func() {
+			subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subnetpool.Release(subnet, ip)).To(Succeed())
+
+			Expect(subnetpool.Capacity()).To(Equal(3))
+
+			fakeClock.Increment(time.Minute)
+			Expect(subnetpool.Capacity()).To(Equal(4))
+		})
+
+		Context("when there is no cooldown", func() {
+			BeforeEach(func() {
+				cooldown = 0
+			})
+
+			It("reallocates a released subnet straight away", func() {
+				subnet, ip, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subnetpool.Release(subnet, ip)).To(Succeed())
+
+				next, _, err := subnetpool.Acquire(logger, "some-handle", subnets.DynamicSubnetSelector, subnets.DynamicIPSelector)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(next).To(Equal(subnet))
+			})
+		})
+	})
 })
 
 func subnetPool(networkString string) *net.IPNet {
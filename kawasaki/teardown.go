@@ -0,0 +1,46 @@
+package kawasaki
+
+import "github.com/pivotal-golang/lager"
+
+// Teardown tears down the network the prestart hook configured once the
+// container has stopped, so that it does not linger if the daemon is not
+// around to destroy the container. The attachments are torn down before the
+// container's own network. The daemon tears the network down again when it
+// destroys the container, which succeeds as each step is a no-op for a
+// network which is already gone.
+//
+// The network is left in place while other containers share it, as recorded
+// in sharersDir, since tearing it down would cut them off. The daemon tears
+// it down when it destroys the container, which it refuses to do while
+// sharers remain.
+func Teardown(log lager.Logger, configurer Configurer, config NetworkConfig, attachments []NetworkConfig, sharersDir string) error {
+	log = log.Session("teardown")
+
+	if sharersDir != "" {
+		shared, err := HasNetworkSharers(sharersDir)
+		if err != nil {
+			log.Error("check-network-sharers-failed", err)
+			return err
+		}
+
+		if shared {
+			log.Info("network-shared")
+			return nil
+		}
+	}
+
+	for _, attachment := range attachments {
+		attachment.ContainerHandle = config.ContainerHandle
+		if err := configurer.Destroy(log.Session("attachment", lager.Data{"config": attachment}), attachment); err != nil {
+			log.Error("destroy-attachment-failed", err)
+			return err
+		}
+	}
+
+	if err := configurer.Destroy(log, config); err != nil {
+		log.Error("destroy-failed", err)
+		return err
+	}
+
+	return nil
+}
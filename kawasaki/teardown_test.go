@@ -0,0 +1,131 @@
+package kawasaki_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/guardian/kawasaki"
+	"github.com/cloudfoundry-incubator/guardian/kawasaki/fakes"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Teardown", func() {
+	var (
+		fakeConfigurer *fakes.FakeConfigurer
+		logger         lager.Logger
+		config         kawasaki.NetworkConfig
+		attachments    []kawasaki.NetworkConfig
+	)
+
+	BeforeEach(func() {
+		fakeConfigurer = new(fakes.FakeConfigurer)
+		logger = lagertest.NewTestLogger("test")
+
+		config = kawasaki.NetworkConfig{
+			ContainerHandle: "some-handle",
+			BridgeName:      "some-bridge",
+			IPTableInstance: "some-instance",
+		}
+
+		attachments = []kawasaki.NetworkConfig{
+			{BridgeName: "mgmt-bridge", IPTableInstance: "mgmt-instance"},
+		}
+	})
+
+	It("destroys each attachment and then the container's network", func() {
+		Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(Succeed())
+
+		Expect(fakeConfigurer.DestroyCallCount()).To(Equal(2))
+
+		_, attachment := fakeConfigurer.DestroyArgsForCall(0)
+		Expect(attachment.BridgeName).To(Equal("mgmt-bridge"))
+		Expect(attachment.ContainerHandle).To(Equal("some-handle"))
+
+		_, cfg := fakeConfigurer.DestroyArgsForCall(1)
+		Expect(cfg).To(Equal(config))
+	})
+
+	It("does not apply anything", func() {
+		Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(Succeed())
+		Expect(fakeConfigurer.ApplyCallCount()).To(Equal(0))
+	})
+
+	It("succeeds when run again, e.g. by the daemon once the hook has run", func() {
+		Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(Succeed())
+		Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(Succeed())
+
+		Expect(fakeConfigurer.DestroyCallCount()).To(Equal(4))
+	})
+
+	Context("when destroying an attachment fails", func() {
+		BeforeEach(func() {
+			fakeConfigurer.DestroyReturns(errors.New("spiderman-error"))
+		})
+
+		It("returns the error without destroying the container's network", func() {
+			Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(MatchError("spiderman-error"))
+			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when destroying the container's network fails", func() {
+		BeforeEach(func() {
+			fakeConfigurer.DestroyStub = func(_ lager.Logger, cfg kawasaki.NetworkConfig) error {
+				if cfg.BridgeName == "some-bridge" {
+					return errors.New("spiderman-error")
+				}
+
+				return nil
+			}
+		})
+
+		It("returns the error", func() {
+			Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "")).To(MatchError("spiderman-error"))
+		})
+	})
+
+	Context("when other containers share the network", func() {
+		var sharersDir string
+
+		BeforeEach(func() {
+			var err error
+			sharersDir, err = ioutil.TempDir("", "network-sharers")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(sharersDir, "sidecar"), nil, 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(sharersDir)).To(Succeed())
+		})
+
+		It("leaves the network in place", func() {
+			Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, sharersDir)).To(Succeed())
+			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(0))
+		})
+
+		Context("once they no longer share it", func() {
+			BeforeEach(func() {
+				Expect(os.Remove(filepath.Join(sharersDir, "sidecar"))).To(Succeed())
+			})
+
+			It("tears the network down", func() {
+				Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, sharersDir)).To(Succeed())
+				Expect(fakeConfigurer.DestroyCallCount()).To(Equal(2))
+			})
+		})
+	})
+
+	Context("when the directory recording the network's sharers does not exist", func() {
+		It("tears the network down", func() {
+			Expect(kawasaki.Teardown(logger, fakeConfigurer, config, attachments, "/does/not/exist")).To(Succeed())
+			Expect(fakeConfigurer.DestroyCallCount()).To(Equal(2))
+		})
+	})
+})
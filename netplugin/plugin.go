@@ -1,31 +1,81 @@
 package netplugin
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry/gunk/command_runner"
 	"github.com/pivotal-golang/lager"
 )
 
+//go:generate counterfeiter . ConfigStore
+
+type ConfigStore interface {
+	Set(handle string, name string, value string)
+	Get(handle string, name string) (string, error)
+}
+
+// networkSpecKey stores the network spec the container was created with, so
+// that Destroy can run the down action with the same flags as the hooks
+const networkSpecKey = "netplugin.network-spec"
+
+var netInProtocols = map[garden.Protocol]string{
+	garden.ProtocolTCP: "tcp",
+	garden.ProtocolUDP: "udp",
+}
+
+// Plugin is a Networker which delegates to an external network plugin, see
+// ProtocolVersion for the protocol it speaks
 type Plugin struct {
 	path     string
 	extraArg []string
+
+	// resultsDir is where the up hook writes its result for Created to read
+	resultsDir  string
+	runner      command_runner.CommandRunner
+	configStore ConfigStore
+
+	// capacity is the number of containers the plugin's network can host, as
+	// the protocol has no way to ask the plugin
+	capacity uint64
 }
 
-func New(path string, extraArg ...string) *Plugin {
+func New(runner command_runner.CommandRunner, configStore ConfigStore, resultsDir string, capacity uint64, path string, extraArg ...string) *Plugin {
 	return &Plugin{
 		path:     path,
 		extraArg: extraArg,
+
+		resultsDir:  resultsDir,
+		runner:      runner,
+		configStore: configStore,
+
+		capacity: capacity,
 	}
 }
 
 func (p Plugin) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks, error) {
-	pathAndExtraArgs := append([]string{p.path}, p.extraArg...)
 	networkPluginFlags := []string{"--handle", handle, "--network", spec}
 
-	upArgs := append(pathAndExtraArgs, "--action", "up")
-	upArgs = append(upArgs, networkPluginFlags...)
-	downArgs := append(pathAndExtraArgs, "--action", "down")
-	downArgs = append(downArgs, networkPluginFlags...)
+	// a result left over from an earlier container with the same handle must
+	// not be mistaken for this container's
+	if err := os.Remove(p.resultPath(handle)); err != nil && !os.IsNotExist(err) {
+		return gardener.Hooks{}, err
+	}
+
+	p.configStore.Set(handle, networkSpecKey, spec)
+
+	upArgs := p.args(ActionUp, networkPluginFlags...)
+	upArgs = append(upArgs, "--result-file", p.resultPath(handle))
 
 	return gardener.Hooks{
 		Prestart: gardener.Hook{
@@ -34,23 +84,235 @@ func (p Plugin) Hooks(log lager.Logger, handle, spec string) (gardener.Hooks, er
 		},
 		Poststop: gardener.Hook{
 			Path: p.path,
-			Args: downArgs,
+			Args: p.args(ActionDown, networkPluginFlags...),
 		},
 	}, nil
 }
 
-func (Plugin) Capacity() uint64 {
-	return 0
+// Created stores the result of the up hook in the container's properties.
+// Plugins which do not write a result are tolerated, leaving the container
+// without any IPs.
+func (p Plugin) Created(log lager.Logger, handle string) error {
+	log = log.Session("network-plugin-created", lager.Data{"handle": handle})
+
+	output, err := ioutil.ReadFile(p.resultPath(handle))
+	if os.IsNotExist(err) {
+		log.Info("no-result")
+		p.storeIPs(handle, Result{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := parseResult(output)
+	if err != nil {
+		log.Error("parse-result-failed", err)
+		return err
+	}
+
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+
+	p.storeIPs(handle, result)
+	p.storeProperties(handle, result)
+	return nil
+}
+
+// Capacity returns the configured number of containers the plugin's network
+// can host
+func (p Plugin) Capacity() uint64 {
+	return p.capacity
+}
+
+// Destroy tells the plugin to tear down the container's network, and removes
+// the result of the up hook. The poststop hook has usually torn the network
+// down already, but does not run if the container never started, so down is
+// run again; it must succeed for a network which is already torn down.
+func (p Plugin) Destroy(log lager.Logger, handle string) error {
+	log = log.Session("network-plugin-destroy", lager.Data{"handle": handle})
+
+	// a container without a spec never had its hooks created, so has no
+	// network to tear down
+	if spec, err := p.configStore.Get(handle, networkSpecKey); err == nil {
+		if err := p.down(log, handle, spec); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(p.resultPath(handle)); err != nil && !os.IsNotExist(err) {
+		log.Error("remove-result-failed", err)
+		return err
+	}
+
+	return nil
+}
+
+func (p Plugin) NetIn(log lager.Logger, handle string, spec gardener.NetInSpec) (uint32, uint32, error) {
+	log = log.Session("network-plugin-net-in", lager.Data{"handle": handle, "spec": spec})
+
+	protocol, ok := netInProtocols[spec.Protocol]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid protocol for NetIn: %d", spec.Protocol)
+	}
+
+	portCount := spec.PortCount
+	if portCount == 0 {
+		portCount = 1
+	}
+
+	result, err := p.invoke(log, ActionNetIn, nil,
+		"--handle", handle,
+		"--host-port", strconv.FormatUint(uint64(spec.HostPort), 10),
+		"--container-port", strconv.FormatUint(uint64(spec.ContainerPort), 10),
+		"--port-count", strconv.FormatUint(uint64(portCount), 10),
+		"--protocol", protocol,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if result.HostPort == 0 || result.ContainerPort == 0 {
+		return 0, 0, errors.New("network plugin did not return the mapped ports")
+	}
+
+	p.storeProperties(handle, result)
+
+	var mappings []gardener.PortMapping
+	for i := uint32(0); i < portCount; i++ {
+		mappings = append(mappings, gardener.PortMapping{
+			HostPort:      result.HostPort + i,
+			ContainerPort: result.ContainerPort + i,
+			Protocol:      protocol,
+		})
+	}
+
+	if err := p.addPortMappings(handle, mappings); err != nil {
+		return 0, 0, err
+	}
+
+	return result.HostPort, result.ContainerPort, nil
+}
+
+func (p Plugin) NetOut(log lager.Logger, handle string, rule garden.NetOutRule) error {
+	log = log.Session("network-plugin-net-out", lager.Data{"handle": handle})
+
+	ruleJSON, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.invoke(log, ActionNetOut, bytes.NewReader(ruleJSON), "--handle", handle)
+	if err != nil {
+		return err
+	}
+
+	p.storeProperties(handle, result)
+	return nil
 }
 
-func (Plugin) Destroy(log lager.Logger, handle string) error {
+func (p Plugin) RemoveNetIn(log lager.Logger, handle string, hostPort uint32, protocol garden.Protocol) error {
+	return errors.New("removing port mappings is not supported by the network plugin")
+}
+
+func (p Plugin) NetOutRules(log lager.Logger, handle string) ([]gardener.NetOutEntry, error) {
+	return nil, errors.New("listing NetOut rules is not supported by the network plugin")
+}
+
+func (p Plugin) RemoveNetOut(log lager.Logger, handle string, id int) error {
+	return errors.New("removing NetOut rules is not supported by the network plugin")
+}
+
+// down runs the down action, as the poststop hook does. Its output is
+// ignored.
+func (p Plugin) down(log lager.Logger, handle, spec string) error {
+	args := p.args(ActionDown, "--handle", handle, "--network", spec)
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(p.path, args[1:]...)
+	cmd.Stdin = bytes.NewReader(nil)
+	cmd.Stderr = stderr
+
+	if err := p.runner.Run(cmd); err != nil {
+		log.Error("plugin-failed", err, lager.Data{"stderr": stderr.String()})
+		return fmt.Errorf("network plugin %s failed: %s: %s", ActionDown, err, stderr.String())
+	}
+
 	return nil
 }
 
-func (Plugin) NetIn(log lager.Logger, handle string, hostPort, containerPort uint32) (uint32, uint32, error) {
-	return 0, 0, nil
+func (p Plugin) args(action string, flags ...string) []string {
+	args := append([]string{p.path}, p.extraArg...)
+	args = append(args, "--action", action)
+	args = append(args, flags...)
+	return append(args, "--protocol-version", ProtocolVersion)
 }
 
-func (Plugin) NetOut(log lager.Logger, handle string, rule garden.NetOutRule) error {
+// invoke runs the plugin for an action, returning the result it prints
+func (p Plugin) invoke(log lager.Logger, action string, stdin io.Reader, flags ...string) (Result, error) {
+	args := p.args(action, flags...)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.Command(p.path, args[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	runErr := p.runner.Run(cmd)
+
+	result, err := parseResult(stdout.Bytes())
+	if err == nil && result.Error != "" {
+		log.Error("plugin-failed", errors.New(result.Error))
+		return Result{}, errors.New(result.Error)
+	}
+
+	if runErr != nil {
+		log.Error("plugin-failed", runErr, lager.Data{"stderr": stderr.String()})
+		return Result{}, fmt.Errorf("network plugin %s failed: %s: %s", action, runErr, stderr.String())
+	}
+
+	if err != nil {
+		log.Error("parse-result-failed", err)
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// storeIPs stores the IPs given by the up hook. Each is set even when the
+// plugin did not give it, as Info requires them.
+func (p Plugin) storeIPs(handle string, result Result) {
+	p.configStore.Set(handle, gardener.ContainerIPKey, result.ContainerIP)
+	p.configStore.Set(handle, gardener.BridgeIPKey, result.HostIP)
+	p.configStore.Set(handle, gardener.ExternalIPKey, result.ExternalIP)
+}
+
+func (p Plugin) storeProperties(handle string, result Result) {
+	for name, value := range result.Properties {
+		p.configStore.Set(handle, name, value)
+	}
+}
+
+func (p Plugin) addPortMappings(handle string, newMappings []gardener.PortMapping) error {
+	mappings := []gardener.PortMapping{}
+
+	// the container has no mappings until the first NetIn
+	if mappingsJSON, err := p.configStore.Get(handle, gardener.MappedPortsKey); err == nil && mappingsJSON != "" {
+		if err := json.Unmarshal([]byte(mappingsJSON), &mappings); err != nil {
+			return err
+		}
+	}
+
+	mappingsJSON, err := json.Marshal(append(mappings, newMappings...))
+	if err != nil {
+		return err
+	}
+
+	p.configStore.Set(handle, gardener.MappedPortsKey, string(mappingsJSON))
 	return nil
 }
+
+func (p Plugin) resultPath(handle string) string {
+	return filepath.Join(p.resultsDir, handle+".json")
+}
@@ -1,18 +1,76 @@
 package netplugin_test
 
 import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
 	"github.com/cloudfoundry-incubator/guardian/netplugin"
+	"github.com/cloudfoundry-incubator/guardian/netplugin/fakes"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
 
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Plugin", func() {
+	var (
+		fakeRunner      *fake_command_runner.FakeCommandRunner
+		fakeConfigStore *fakes.FakeConfigStore
+		properties      map[string]string
+		resultsDir      string
+		logger          lager.Logger
+		plugin          *netplugin.Plugin
+	)
+
+	BeforeEach(func() {
+		var err error
+		resultsDir, err = ioutil.TempDir("", "netplugin")
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeRunner = fake_command_runner.New()
+		fakeConfigStore = new(fakes.FakeConfigStore)
+		logger = lagertest.NewTestLogger("test")
+
+		properties = map[string]string{}
+		fakeConfigStore.SetStub = func(handle, name, value string) {
+			Expect(handle).To(Equal("some-handle"))
+			properties[name] = value
+		}
+		fakeConfigStore.GetStub = func(handle, name string) (string, error) {
+			value, ok := properties[name]
+			if !ok {
+				return "", errors.New("no such property")
+			}
+
+			return value, nil
+		}
+
+		plugin = netplugin.New(fakeRunner, fakeConfigStore, resultsDir, 42, "some/path")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(resultsDir)).To(Succeed())
+	})
+
+	pluginOutputs := func(output string) {
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "some/path"}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte(output))
+			return nil
+		})
+	}
+
 	Describe("Hooks", func() {
 		It("returns a Hooks struct with the correct path", func() {
-			plugin := netplugin.New("some/path")
-			hooks, err := plugin.Hooks(lagertest.NewTestLogger("test"), "some-handle", "potato")
+			hooks, err := plugin.Hooks(logger, "some-handle", "potato")
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(hooks.Prestart.Path).To(Equal("some/path"))
@@ -20,8 +78,7 @@ var _ = Describe("Plugin", func() {
 		})
 
 		It("uses the plugin name as the first argument", func() {
-			plugin := netplugin.New("some/path")
-			hooks, err := plugin.Hooks(lagertest.NewTestLogger("test"), "some-handle", "potato")
+			hooks, err := plugin.Hooks(logger, "some-handle", "potato")
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(hooks.Prestart.Args[0]).To(Equal("some/path"))
@@ -29,32 +86,257 @@ var _ = Describe("Plugin", func() {
 		})
 
 		It("returns a Hook struct with the correct args", func() {
-			plugin := netplugin.New("some/path")
+			hooks, err := plugin.Hooks(logger, "some-handle", "potato")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hooks.Prestart.Args).To(Equal([]string{
+				"some/path", "--action", "up", "--handle", "some-handle", "--network", "potato",
+				"--protocol-version", "1", "--result-file", filepath.Join(resultsDir, "some-handle.json"),
+			}))
+			Expect(hooks.Poststop.Args).To(Equal([]string{
+				"some/path", "--action", "down", "--handle", "some-handle", "--network", "potato",
+				"--protocol-version", "1",
+			}))
+		})
 
-			hooks, err := plugin.Hooks(
-				lagertest.NewTestLogger("test"),
-				"some-handle",
-				"potato",
-			)
+		It("removes any stale result for the handle", func() {
+			resultPath := filepath.Join(resultsDir, "some-handle.json")
+			Expect(ioutil.WriteFile(resultPath, []byte(`{"version":"1"}`), 0600)).To(Succeed())
+
+			_, err := plugin.Hooks(logger, "some-handle", "potato")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resultPath).NotTo(BeAnExistingFile())
+		})
 
+		It("stores the network spec, so that Destroy can tear the network down", func() {
+			_, err := plugin.Hooks(logger, "some-handle", "potato")
 			Expect(err).NotTo(HaveOccurred())
-			Expect(hooks.Prestart.Args).To(Equal([]string{"some/path", "--action", "up", "--handle", "some-handle", "--network", "potato"}))
-			Expect(hooks.Poststop.Args).To(Equal([]string{"some/path", "--action", "down", "--handle", "some-handle", "--network", "potato"}))
+
+			Expect(properties).To(HaveKeyWithValue("netplugin.network-spec", "potato"))
 		})
 
 		Context("when there are extra args", func() {
 			It("prepends the extra args before the standard hook parameters", func() {
-				plugin := netplugin.New("some/path", "arg1", "arg2")
+				plugin = netplugin.New(fakeRunner, fakeConfigStore, resultsDir, 42, "some/path", "arg1", "arg2")
+
+				hooks, err := plugin.Hooks(logger, "some-handle", "potato")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(hooks.Prestart.Args[:9]).To(Equal([]string{"some/path", "arg1", "arg2", "--action", "up", "--handle", "some-handle", "--network", "potato"}))
+				Expect(hooks.Poststop.Args[:9]).To(Equal([]string{"some/path", "arg1", "arg2", "--action", "down", "--handle", "some-handle", "--network", "potato"}))
+			})
+		})
+	})
+
+	Describe("Created", func() {
+		writeResult := func(result string) {
+			Expect(ioutil.WriteFile(filepath.Join(resultsDir, "some-handle.json"), []byte(result), 0600)).To(Succeed())
+		}
+
+		It("stores the result of the up hook as properties", func() {
+			writeResult(`{"version":"1","container_ip":"10.0.0.2","host_ip":"10.0.0.1","external_ip":"1.2.3.4","properties":{"plugin.network-id":"net-1"}}`)
+
+			Expect(plugin.Created(logger, "some-handle")).To(Succeed())
+			Expect(properties).To(Equal(map[string]string{
+				gardener.ContainerIPKey: "10.0.0.2",
+				gardener.BridgeIPKey:    "10.0.0.1",
+				gardener.ExternalIPKey:  "1.2.3.4",
+				"plugin.network-id":     "net-1",
+			}))
+		})
+
+		Context("when the plugin did not write a result", func() {
+			It("stores empty IPs", func() {
+				Expect(plugin.Created(logger, "some-handle")).To(Succeed())
+				Expect(properties).To(Equal(map[string]string{
+					gardener.ContainerIPKey: "",
+					gardener.BridgeIPKey:    "",
+					gardener.ExternalIPKey:  "",
+				}))
+			})
+		})
+
+		Context("when the result has an error", func() {
+			It("returns it", func() {
+				writeResult(`{"version":"1","error":"no addresses left"}`)
+				Expect(plugin.Created(logger, "some-handle")).To(MatchError("no addresses left"))
+			})
+		})
+
+		Context("when the result is for another protocol version", func() {
+			It("returns an error", func() {
+				writeResult(`{"version":"2"}`)
+				Expect(plugin.Created(logger, "some-handle")).To(MatchError("unsupported network plugin protocol version '2', expected '1'"))
+			})
+		})
+	})
+
+	Describe("NetIn", func() {
+		It("invokes the plugin with the port flags", func() {
+			pluginOutputs(`{"version":"1","host_port":60000,"container_port":8080}`)
+
+			_, _, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{ContainerPort: 8080, Protocol: garden.ProtocolUDP})
+			Expect(err).NotTo(HaveOccurred())
 
-				hooks, err := plugin.Hooks(
-					lagertest.NewTestLogger("test"),
-					"some-handle",
-					"potato",
-				)
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "some/path",
+				Args: []string{
+					"--action", "net-in", "--handle", "some-handle",
+					"--host-port", "0", "--container-port", "8080", "--port-count", "1", "--protocol", "udp",
+					"--protocol-version", "1",
+				},
+			}))
+		})
+
+		It("returns the ports mapped by the plugin and records them", func() {
+			pluginOutputs(`{"version":"1","host_port":60000,"container_port":8080}`)
+			properties[gardener.MappedPortsKey] = `[{"HostPort":50000,"ContainerPort":22,"Protocol":"tcp"}]`
+
+			hostPort, containerPort, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{ContainerPort: 8080, PortCount: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostPort).To(BeEquivalentTo(60000))
+			Expect(containerPort).To(BeEquivalentTo(8080))
+
+			Expect(properties[gardener.MappedPortsKey]).To(MatchJSON(`[
+				{"HostPort":50000,"ContainerPort":22,"Protocol":"tcp"},
+				{"HostPort":60000,"ContainerPort":8080,"Protocol":"tcp"},
+				{"HostPort":60001,"ContainerPort":8081,"Protocol":"tcp"}
+			]`))
+		})
 
+		Context("when the plugin does not return the mapped ports", func() {
+			It("returns an error", func() {
+				pluginOutputs(`{"version":"1"}`)
+
+				_, _, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{})
+				Expect(err).To(MatchError("network plugin did not return the mapped ports"))
+			})
+		})
+
+		Context("when the plugin fails with an error result", func() {
+			It("returns the plugin's error", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "some/path"}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`{"version":"1","error":"port taken"}`))
+					return errors.New("exit status 1")
+				})
+
+				_, _, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{HostPort: 80})
+				Expect(err).To(MatchError("port taken"))
+			})
+		})
+
+		Context("when the plugin fails without a result", func() {
+			It("returns an error including its stderr", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "some/path"}, func(cmd *exec.Cmd) error {
+					cmd.Stderr.Write([]byte("kaboom"))
+					return errors.New("exit status 2")
+				})
+
+				_, _, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{HostPort: 80})
+				Expect(err).To(MatchError("network plugin net-in failed: exit status 2: kaboom"))
+			})
+		})
+
+		Context("when the plugin's output is not a result", func() {
+			It("returns an error", func() {
+				pluginOutputs("potato")
+
+				_, _, err := plugin.NetIn(logger, "some-handle", gardener.NetInSpec{HostPort: 80})
+				Expect(err).To(MatchError(ContainSubstring("invalid network plugin output 'potato'")))
+			})
+		})
+	})
+
+	Describe("NetOut", func() {
+		It("invokes the plugin with the rule on stdin and stores the resulting properties", func() {
+			var stdin []byte
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "some/path"}, func(cmd *exec.Cmd) error {
+				var err error
+				stdin, err = ioutil.ReadAll(cmd.Stdin)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(hooks.Prestart.Args).To(Equal([]string{"some/path", "arg1", "arg2", "--action", "up", "--handle", "some-handle", "--network", "potato"}))
-				Expect(hooks.Poststop.Args).To(Equal([]string{"some/path", "arg1", "arg2", "--action", "down", "--handle", "some-handle", "--network", "potato"}))
+
+				cmd.Stdout.Write([]byte(`{"version":"1","properties":{"plugin.rules":"1"}}`))
+				return nil
+			})
+
+			Expect(plugin.NetOut(logger, "some-handle", garden.NetOutRule{Protocol: garden.ProtocolTCP})).To(Succeed())
+
+			Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "some/path",
+				Args: []string{"--action", "net-out", "--handle", "some-handle", "--protocol-version", "1"},
+			}))
+
+			var rule garden.NetOutRule
+			Expect(json.Unmarshal(stdin, &rule)).To(Succeed())
+			Expect(rule).To(Equal(garden.NetOutRule{Protocol: garden.ProtocolTCP}))
+			Expect(properties).To(HaveKeyWithValue("plugin.rules", "1"))
+		})
+	})
+
+	It("does not support removing port mappings or NetOut rules", func() {
+		Expect(plugin.RemoveNetIn(logger, "some-handle", 8080, garden.ProtocolTCP)).To(MatchError("removing port mappings is not supported by the network plugin"))
+
+		_, err := plugin.NetOutRules(logger, "some-handle")
+		Expect(err).To(MatchError("listing NetOut rules is not supported by the network plugin"))
+
+		Expect(plugin.RemoveNetOut(logger, "some-handle", 1)).To(MatchError("removing NetOut rules is not supported by the network plugin"))
+		Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
+	})
+
+	It("returns the configured capacity", func() {
+		Expect(plugin.Capacity()).To(BeEquivalentTo(42))
+	})
+
+	Describe("Destroy", func() {
+		It("removes the result of the up hook", func() {
+			resultPath := filepath.Join(resultsDir, "some-handle.json")
+			Expect(ioutil.WriteFile(resultPath, []byte(`{"version":"1"}`), 0600)).To(Succeed())
+
+			Expect(plugin.Destroy(logger, "some-handle")).To(Succeed())
+			Expect(resultPath).NotTo(BeAnExistingFile())
+		})
+
+		It("succeeds when there is no result", func() {
+			Expect(plugin.Destroy(logger, "some-handle")).To(Succeed())
+		})
+
+		Context("when the container's hooks were created", func() {
+			BeforeEach(func() {
+				_, err := plugin.Hooks(logger, "some-handle", "potato")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("runs the down action, in case the poststop hook did not", func() {
+				Expect(plugin.Destroy(logger, "some-handle")).To(Succeed())
+
+				Expect(fakeRunner).To(HaveExecutedSerially(fake_command_runner.CommandSpec{
+					Path: "some/path",
+					Args: []string{"--action", "down", "--handle", "some-handle", "--network", "potato", "--protocol-version", "1"},
+				}))
+			})
+
+			Context("when the down action fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(fake_command_runner.CommandSpec{Path: "some/path"}, func(cmd *exec.Cmd) error {
+						cmd.Stderr.Write([]byte("no such network"))
+						return errors.New("exit status 1")
+					})
+				})
+
+				It("returns the error and keeps the result, so that Destroy can be retried", func() {
+					resultPath := filepath.Join(resultsDir, "some-handle.json")
+					Expect(ioutil.WriteFile(resultPath, []byte(`{"version":"1"}`), 0600)).To(Succeed())
+
+					Expect(plugin.Destroy(logger, "some-handle")).To(MatchError("network plugin down failed: exit status 1: no such network"))
+					Expect(resultPath).To(BeAnExistingFile())
+				})
+			})
+		})
+
+		Context("when the container's hooks were never created", func() {
+			It("does not run the down action", func() {
+				Expect(plugin.Destroy(logger, "some-handle")).To(Succeed())
+				Expect(fakeRunner.ExecutedCommands()).To(BeEmpty())
 			})
 		})
 	})
@@ -0,0 +1,76 @@
+package netplugin
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the protocol spoken with network plugins,
+// passed to the plugin as --protocol-version on every invocation.
+//
+// The plugin is invoked as
+//
+//	<path> <extra args> --action <action> --handle <handle> [flags...] --protocol-version 1
+//
+// with one of the following actions:
+//
+//	up       run as the container's prestart hook, with the OCI state on stdin
+//	         and --network giving the container's network spec. The network
+//	         modes none, host and container:<handle> are not supported with
+//	         plugins, so the spec is never one of them. As a hook's
+//	         output is not returned by the runtime, the plugin writes its
+//	         Result to the file given by --result-file.
+//	down     run as the container's poststop hook, with the same flags as up
+//	         except --result-file, and by guardian when it destroys the
+//	         container without stdin. It may therefore run more than once, and
+//	         must succeed for a network which is already torn down. Its output
+//	         is ignored.
+//	net-in   run by guardian with --host-port, --container-port, --port-count
+//	         and --protocol. A port of 0 asks the plugin to choose one. The
+//	         plugin prints a Result giving the first ports of the range it
+//	         mapped.
+//	net-out  run by guardian with the garden.NetOutRule as JSON on stdin. The
+//	         plugin prints a Result.
+//
+// A plugin fails an action by exiting non-zero, optionally with a Result
+// giving the Error.
+const ProtocolVersion = "1"
+
+const (
+	ActionUp     = "up"
+	ActionDown   = "down"
+	ActionNetIn  = "net-in"
+	ActionNetOut = "net-out"
+)
+
+// Result is the JSON output of a network plugin. Properties are stored as
+// properties of the container.
+type Result struct {
+	Version string `json:"version"`
+
+	// up only, stored as the standard garden.network.* properties
+	ContainerIP string `json:"container_ip,omitempty"`
+	HostIP      string `json:"host_ip,omitempty"`
+	ExternalIP  string `json:"external_ip,omitempty"`
+
+	Properties map[string]string `json:"properties,omitempty"`
+
+	// net-in only
+	HostPort      uint32 `json:"host_port,omitempty"`
+	ContainerPort uint32 `json:"container_port,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+func parseResult(output []byte) (Result, error) {
+	var result Result
+	if err := json.Unmarshal(output, &result); err != nil {
+		return Result{}, fmt.Errorf("invalid network plugin output '%s': %s", output, err)
+	}
+
+	if result.Version != ProtocolVersion {
+		return Result{}, fmt.Errorf("unsupported network plugin protocol version '%s', expected '%s'", result.Version, ProtocolVersion)
+	}
+
+	return result, nil
+}
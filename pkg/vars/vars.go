@@ -44,3 +44,25 @@ func (l IPList) Set(s string) error {
 	*l.List = append(*l.List, ip)
 	return nil
 }
+
+// CIDRList is a flag.Value to hold a list of CIDR blocks
+type CIDRList struct {
+	List *[]*net.IPNet
+}
+
+func (l CIDRList) String() string {
+	var strs []string
+	for _, cidr := range *l.List {
+		strs = append(strs, cidr.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+func (l CIDRList) Set(s string) error {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a valid CIDR block", s)
+	}
+	*l.List = append(*l.List, cidr)
+	return nil
+}
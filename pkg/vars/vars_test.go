@@ -60,4 +60,33 @@ var _ = Describe("Vars", func() {
 			})
 		})
 	})
+
+	Describe("CIDRList", func() {
+		Describe("when set is called", func() {
+
+			var cl *vars.CIDRList
+			var cidrs []*net.IPNet
+
+			BeforeEach(func() {
+				cidrs = nil
+				cl = &vars.CIDRList{List: &cidrs}
+				Expect(cl.Set("10.254.0.0/22")).To(Succeed())
+				Expect(cl.Set("10.253.0.1/24")).To(Succeed())
+			})
+
+			It("adds the network of the value to the list", func() {
+				Expect(cidrs).To(HaveLen(2))
+				Expect(cidrs[0].String()).To(Equal("10.254.0.0/22"))
+				Expect(cidrs[1].String()).To(Equal("10.253.0.0/24"))
+			})
+
+			It("stringifies with commas", func() {
+				Expect(cl.String()).To(Equal("10.254.0.0/22, 10.253.0.0/24"))
+			})
+
+			It("rejects invalid CIDR blocks", func() {
+				Expect(cl.Set("10.254.0.0")).To(MatchError("'10.254.0.0' is not a valid CIDR block"))
+			})
+		})
+	})
 })
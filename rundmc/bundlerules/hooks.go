@@ -19,11 +19,16 @@ func (r Hooks) Apply(bndl *goci.Bndl, spec gardener.DesiredContainerSpec) *goci.
 		"PATH=" + os.Getenv("PATH"),
 	}
 
-	hooks := bndl.WithPrestartHooks(specs.Hook{
-		Env:  env,
-		Path: spec.NetworkHooks.Prestart.Path,
-		Args: spec.NetworkHooks.Prestart.Args,
-	})
+	// containers in a network mode, rather than networked by the networker,
+	// have no hooks
+	hooks := bndl
+	if spec.NetworkHooks.Prestart.Path != "" {
+		hooks = hooks.WithPrestartHooks(specs.Hook{
+			Env:  env,
+			Path: spec.NetworkHooks.Prestart.Path,
+			Args: spec.NetworkHooks.Prestart.Args,
+		})
+	}
 
 	if spec.NetworkHooks.Poststop.Path != "" {
 		hooks = hooks.WithPoststopHooks(specs.Hook{
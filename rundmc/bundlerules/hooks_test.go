@@ -19,6 +19,9 @@ var _ = Describe("Hooks", func() {
 
 		newBndl := rule.Apply(goci.Bundle(), gardener.DesiredContainerSpec{
 			Handle: "fred",
+			NetworkHooks: gardener.Hooks{
+				Prestart: gardener.Hook{Path: "/path/to/bananas/network"},
+			},
 		})
 
 		Expect(newBndl.PrestartHooks()[0].Env).To(
@@ -66,6 +69,13 @@ var _ = Describe("Hooks", func() {
 
 		Expect(pathAndArgsOf(newBndl.PoststopHooks())).To(BeEmpty())
 	})
+
+	It("does not include any hooks if none were requested", func() {
+		newBndl := bundlerules.Hooks{}.Apply(goci.Bundle(), gardener.DesiredContainerSpec{})
+
+		Expect(newBndl.PrestartHooks()).To(BeEmpty())
+		Expect(newBndl.PoststopHooks()).To(BeEmpty())
+	})
 })
 
 func pathAndArgsOf(a []specs.Hook) (b []PathAndArgs) {
@@ -0,0 +1,32 @@
+package bundlerules
+
+import (
+	"github.com/cloudfoundry-incubator/goci"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// NetworkMode removes the network namespace from the bundle of a container in
+// the host network mode, so that it shares the host's network, and points it
+// at the peer's namespace for a container which joins another's network
+type NetworkMode struct {
+}
+
+func (r NetworkMode) Apply(bndl *goci.Bndl, spec gardener.DesiredContainerSpec) *goci.Bndl {
+	if spec.NetworkNamespacePath == "" && spec.NetworkMode != gardener.NetworkModeHost {
+		return bndl
+	}
+
+	var namespaces []specs.Namespace
+	for _, namespace := range bndl.Spec.Linux.Namespaces {
+		if namespace.Type != specs.NetworkNamespace {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	if spec.NetworkNamespacePath != "" {
+		namespaces = append(namespaces, specs.Namespace{Type: specs.NetworkNamespace, Path: spec.NetworkNamespacePath})
+	}
+
+	return bndl.WithNamespaces(namespaces...)
+}
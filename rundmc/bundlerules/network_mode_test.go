@@ -0,0 +1,42 @@
+package bundlerules_test
+
+import (
+	"github.com/cloudfoundry-incubator/goci"
+	"github.com/cloudfoundry-incubator/guardian/gardener"
+	"github.com/cloudfoundry-incubator/guardian/rundmc/bundlerules"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+var _ = Describe("NetworkMode", func() {
+	var bundle *goci.Bndl
+
+	BeforeEach(func() {
+		bundle = goci.Bundle().WithNamespaces(goci.NetworkNamespace, goci.PIDNamespace, goci.MountNamespace)
+	})
+
+	It("removes the network namespace in the host network mode", func() {
+		newBndl := bundlerules.NetworkMode{}.Apply(bundle, gardener.DesiredContainerSpec{NetworkMode: gardener.NetworkModeHost})
+		Expect(newBndl.Spec.Linux.Namespaces).To(ConsistOf(goci.PIDNamespace, goci.MountNamespace))
+	})
+
+	It("keeps the network namespace in the none network mode", func() {
+		newBndl := bundlerules.NetworkMode{}.Apply(bundle, gardener.DesiredContainerSpec{NetworkMode: gardener.NetworkModeNone})
+		Expect(newBndl.Spec.Linux.Namespaces).To(ConsistOf(goci.NetworkNamespace, goci.PIDNamespace, goci.MountNamespace))
+	})
+
+	It("joins the network namespace of a peer", func() {
+		newBndl := bundlerules.NetworkMode{}.Apply(bundle, gardener.DesiredContainerSpec{NetworkNamespacePath: "/proc/42/ns/net"})
+		Expect(newBndl.Spec.Linux.Namespaces).To(ConsistOf(
+			specs.Namespace{Type: specs.NetworkNamespace, Path: "/proc/42/ns/net"},
+			goci.PIDNamespace,
+			goci.MountNamespace,
+		))
+	})
+
+	It("keeps the network namespace when no mode is given", func() {
+		newBndl := bundlerules.NetworkMode{}.Apply(bundle, gardener.DesiredContainerSpec{})
+		Expect(newBndl.Spec.Linux.Namespaces).To(ConsistOf(goci.NetworkNamespace, goci.PIDNamespace, goci.MountNamespace))
+	})
+})
@@ -87,6 +87,21 @@ func (c *Containerizer) Create(log lager.Logger, spec gardener.DesiredContainerS
 	log.Info("start")
 	defer log.Info("finished")
 
+	if spec.NetworkPeer != "" {
+		state, err := c.runner.State(log, spec.NetworkPeer)
+		if err != nil {
+			log.Error("network-peer-state-failed", err)
+			return fmt.Errorf("network peer %s: %s", spec.NetworkPeer, err)
+		}
+
+		// a stopped peer has no init process whose namespace could be joined
+		if state.Status != runrunc.RunningStatus || state.Pid == 0 {
+			return fmt.Errorf("network peer %s is not running", spec.NetworkPeer)
+		}
+
+		spec.NetworkNamespacePath = fmt.Sprintf("/proc/%d/ns/net", state.Pid)
+	}
+
 	if err := c.depot.Create(log, spec.Handle, c.bundler.Generate(spec)); err != nil {
 		log.Error("create-failed", err)
 		return err
@@ -210,8 +225,13 @@ func (c *Containerizer) Info(log lager.Logger, handle string) (gardener.ActualCo
 		return gardener.ActualContainerSpec{}, err
 	}
 
+	// runc no longer knows about a container whose init process has exited
+	// and been reaped, so a container without a state is stopped too
+	state, err := c.runner.State(log, handle)
+
 	return gardener.ActualContainerSpec{
 		BundlePath: bundlePath,
+		Stopped:    err != nil || state.Status != runrunc.RunningStatus,
 		Events:     c.events.Events(handle),
 	}, nil
 }
@@ -79,6 +79,62 @@ var _ = Describe("Rundmc", func() {
 			})
 		})
 
+		Context("when the container joins a peer's network", func() {
+			It("generates the bundle with the network namespace of the peer's init process", func() {
+				fakeContainerRunner.StateReturns(runrunc.State{Pid: 42, Status: runrunc.RunningStatus}, nil)
+
+				Expect(containerizer.Create(logger, gardener.DesiredContainerSpec{
+					Handle:      "sidecar",
+					NetworkPeer: "app",
+				})).To(Succeed())
+
+				_, id := fakeContainerRunner.StateArgsForCall(0)
+				Expect(id).To(Equal("app"))
+
+				spec := fakeBundler.GenerateArgsForCall(0)
+				Expect(spec.NetworkNamespacePath).To(Equal("/proc/42/ns/net"))
+			})
+
+			Context("when the peer's state cannot be found", func() {
+				It("returns an error without creating the container", func() {
+					fakeContainerRunner.StateReturns(runrunc.State{}, errors.New("no such container"))
+
+					err := containerizer.Create(logger, gardener.DesiredContainerSpec{
+						Handle:      "sidecar",
+						NetworkPeer: "app",
+					})
+					Expect(err).To(MatchError("network peer app: no such container"))
+					Expect(fakeDepot.CreateCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the peer is not running", func() {
+				It("returns an error without creating the container", func() {
+					fakeContainerRunner.StateReturns(runrunc.State{Pid: 0, Status: "stopped"}, nil)
+
+					err := containerizer.Create(logger, gardener.DesiredContainerSpec{
+						Handle:      "sidecar",
+						NetworkPeer: "app",
+					})
+					Expect(err).To(MatchError("network peer app is not running"))
+					Expect(fakeDepot.CreateCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the peer has no init process", func() {
+				It("returns an error without creating the container", func() {
+					fakeContainerRunner.StateReturns(runrunc.State{Pid: 0, Status: runrunc.RunningStatus}, nil)
+
+					err := containerizer.Create(logger, gardener.DesiredContainerSpec{
+						Handle:      "sidecar",
+						NetworkPeer: "app",
+					})
+					Expect(err).To(MatchError("network peer app is not running"))
+					Expect(fakeDepot.CreateCallCount()).To(Equal(0))
+				})
+			})
+		})
+
 		It("should start a container in the created directory", func() {
 			Expect(containerizer.Create(logger, gardener.DesiredContainerSpec{
 				Handle: "exuberant!",
@@ -343,6 +399,35 @@ var _ = Describe("Rundmc", func() {
 			Expect(actualSpec.BundlePath).To(Equal("/path/to/some-handle"))
 		})
 
+		It("reports a running container as not stopped", func() {
+			fakeContainerRunner.StateReturns(runrunc.State{Pid: 42, Status: runrunc.RunningStatus}, nil)
+
+			actualSpec, err := containerizer.Info(logger, "some-handle")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actualSpec.Stopped).To(BeFalse())
+
+			_, handle := fakeContainerRunner.StateArgsForCall(0)
+			Expect(handle).To(Equal("some-handle"))
+		})
+
+		It("reports a container which is no longer running as stopped", func() {
+			fakeContainerRunner.StateReturns(runrunc.State{Pid: 42, Status: "stopped"}, nil)
+
+			actualSpec, err := containerizer.Info(logger, "some-handle")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actualSpec.Stopped).To(BeTrue())
+		})
+
+		Context("when the container's state cannot be found", func() {
+			It("reports it as stopped", func() {
+				fakeContainerRunner.StateReturns(runrunc.State{}, errors.New("no such container"))
+
+				actualSpec, err := containerizer.Info(logger, "some-handle")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(actualSpec.Stopped).To(BeTrue())
+			})
+		})
+
 		Context("when looking up the bundle path fails", func() {
 			It("should return the error", func() {
 				fakeDepot.LookupReturns("", errors.New("spiderman-error"))